@@ -0,0 +1,5 @@
+// Package ast declares the types used to represent scrapscript syntax trees.
+//
+// Nodes only store spans into their source; identifiers and literals are
+// read from the source of the SourceExpr they belong to.
+package ast
@@ -0,0 +1,503 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// The binary format of a SourceExpr starts with encodingMagic, followed
+// by the version of the format, the source, the header and the expression.
+// Numbers are unsigned varints, and strings are prefixed by their lengths.
+// Nodes start with their kind, followed by their fields in order; spans
+// as their start and end, tokens by their tokenCodes, and lists by their
+// lengths. Optional nodes are of kindNil if absent.
+const (
+	encodingMagic   = "scrapast"
+	encodingVersion = 1
+)
+
+// The kind of a node.
+type kind byte
+
+// The kinds of nodes, by which they are encoded. New kinds are added last,
+// so that encoded nodes stay decodable.
+const (
+	kindNil kind = iota
+	kindIdent
+	kindLiteral
+	kindBinary
+	kindFunc
+	kindMatchFunc
+	kindCall
+	kindVariant
+	kindEnum
+	kindRecord
+	kindAccess
+	kindList
+	kindWhere
+	kindImport
+)
+
+var kindNames = [...]string{
+	kindNil:       "nil",
+	kindIdent:     "ident",
+	kindLiteral:   "literal",
+	kindBinary:    "binary",
+	kindFunc:      "func",
+	kindMatchFunc: "match",
+	kindCall:      "call",
+	kindVariant:   "variant",
+	kindEnum:      "enum",
+	kindRecord:    "record",
+	kindAccess:    "access",
+	kindList:      "list",
+	kindWhere:     "where",
+	kindImport:    "import",
+}
+
+// The tokens of literals and operators, by their codes in the binary
+// format; which, unlike the values of tokens, never change. New tokens
+// are added last.
+var tokenCodes = []token.Token{
+	token.IDENT, token.INT, token.FLOAT, token.TEXT, token.BYTE, token.BYTES,
+	token.HOLE, token.IMPORT, token.ASSIGN, token.WHERE, token.COMMA,
+	token.DEFINE, token.PICK, token.OPTION, token.ACCESS, token.SPREAD,
+	token.ADD, token.SUB, token.MUL, token.CONCAT, token.APPEND, token.PREPEND,
+	token.ARROW, token.PIPE, token.LPIPE, token.RPIPE, token.RCOMP, token.LCOMP,
+	token.LT, token.GT,
+}
+
+// maxDepth is how deep expressions may be nested in the binary format;
+// since decoding recurses, like parsing, but data is cheaper to nest than
+// source, needing only a byte per call.
+const maxDepth = 1 << 16
+
+// The flags of record entries.
+const (
+	entryExtend = 1 << iota
+	entryDrop
+	entryPun
+	entryType
+)
+
+// ErrBadEncoding is returned when decoding data that isn't an encoded
+// SourceExpr, or of another version.
+var ErrBadEncoding = errors.New("bad encoding of a scrap")
+
+// MarshalBinary encodes a SourceExpr in a stable binary format, for tools
+// and caches to share parsed scraps by. The source is encoded with it.
+func (se SourceExpr) MarshalBinary() ([]byte, error) {
+	var e encoder
+	e.WriteString(encodingMagic)
+	e.uint(encodingVersion)
+	e.bytes(se.Source.Bytes())
+
+	e.span(se.Header.Pos)
+	e.string(se.Header.Shebang)
+	e.uint(len(se.Header.Pragmas))
+	for _, p := range se.Header.Pragmas {
+		e.span(p.Pos)
+		e.string(p.Name)
+		e.string(p.Value)
+	}
+
+	if err := e.expr(se.Expr); err != nil {
+		return nil, err
+	}
+	return e.Bytes(), nil
+}
+
+type encoder struct {
+	bytes.Buffer
+	depth int
+}
+
+func (e *encoder) uint(n int) {
+	e.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(len(b))
+	e.Write(b)
+}
+
+func (e *encoder) string(s string) {
+	e.uint(len(s))
+	e.WriteString(s)
+}
+
+func (e *encoder) span(s token.Span) {
+	e.uint(s.Start)
+	e.uint(s.End)
+}
+
+func (e *encoder) token(tok token.Token) error {
+	for code, t := range tokenCodes {
+		if t == tok {
+			e.uint(code)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot encode the token %s", tok)
+}
+
+func (e *encoder) kind(k kind) {
+	e.WriteByte(byte(k))
+}
+
+func (e *encoder) variant(x *VariantExpr) error {
+	e.span(x.Tag.Pos)
+	return e.expr(x.Typ)
+}
+
+func (e *encoder) expr(x Expr) error {
+	if e.depth >= maxDepth {
+		return fmt.Errorf("cannot encode expressions nested deeper than %d", maxDepth)
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+
+	switch x := x.(type) {
+	case nil:
+		e.kind(kindNil)
+	case *Ident:
+		e.kind(kindIdent)
+		e.span(x.Pos)
+	case *Literal:
+		e.kind(kindLiteral)
+		e.span(x.Pos)
+		return e.token(x.Kind)
+	case *BinaryExpr:
+		e.kind(kindBinary)
+		if err := e.token(x.Op); err != nil {
+			return err
+		}
+		return e.exprs(x.Left, x.Right)
+	case *FuncExpr:
+		e.kind(kindFunc)
+		return e.exprs(x.Arg, x.Body)
+	case MatchFuncExpr:
+		e.kind(kindMatchFunc)
+		e.uint(len(x))
+		for _, fn := range x {
+			if err := e.exprs(fn.Arg, fn.Body); err != nil {
+				return err
+			}
+		}
+	case *CallExpr:
+		e.kind(kindCall)
+		return e.exprs(x.Fn, x.Arg)
+	case *VariantExpr:
+		e.kind(kindVariant)
+		return e.variant(x)
+	case EnumExpr:
+		e.kind(kindEnum)
+		e.uint(len(x))
+		for _, v := range x {
+			if err := e.variant(v); err != nil {
+				return err
+			}
+		}
+	case *RecordExpr:
+		e.kind(kindRecord)
+		e.span(x.Pos)
+		if err := e.expr(x.Rest); err != nil {
+			return err
+		}
+		e.uint(len(x.Entries))
+		for _, entry := range x.Entries {
+			e.span(entry.Key.Pos)
+			flags := 0
+			if entry.Extend {
+				flags |= entryExtend
+			}
+			if entry.Drop {
+				flags |= entryDrop
+			}
+			if entry.Pun {
+				flags |= entryPun
+			}
+			if entry.Type {
+				flags |= entryType
+			}
+			e.uint(flags)
+			if err := e.expr(entry.Val); err != nil {
+				return err
+			}
+		}
+	case *AccessExpr:
+		e.kind(kindAccess)
+		e.span(x.Pos)
+		if err := e.expr(x.Rec); err != nil {
+			return err
+		}
+		e.span(x.Key.Pos)
+	case *ListExpr:
+		e.kind(kindList)
+		e.span(x.Pos)
+		e.uint(len(x.Elements))
+		return e.exprs(x.Elements...)
+	case *WhereExpr:
+		e.kind(kindWhere)
+		if err := e.expr(x.Expr); err != nil {
+			return err
+		}
+		e.span(x.Id.Pos)
+		return e.exprs(x.Typ, x.Val)
+	case *ImportExpr:
+		e.kind(kindImport)
+		e.span(x.Pos)
+		e.string(x.HashAlgo)
+		e.span(x.Value.Pos)
+		return e.token(x.Value.Kind)
+	default:
+		return fmt.Errorf("cannot encode %T", x)
+	}
+	return nil
+}
+
+func (e *encoder) exprs(xs ...Expr) error {
+	for _, x := range xs {
+		if err := e.expr(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnmarshalBinary decodes a SourceExpr encoded by MarshalBinary.
+func (se *SourceExpr) UnmarshalBinary(data []byte) error {
+	d := decoder{data: data}
+	if !bytes.HasPrefix(data, []byte(encodingMagic)) {
+		return ErrBadEncoding
+	}
+	d.data = data[len(encodingMagic):]
+	if d.uint() != encodingVersion {
+		return fmt.Errorf("%w: unknown version", ErrBadEncoding)
+	}
+	source := d.bytes()
+	if d.err != nil {
+		return d.err
+	}
+	d.source = sourceOf(source)
+
+	var h Header
+	h.Pos = d.span()
+	h.Shebang = d.string()
+	for range d.len() {
+		h.Pragmas = append(h.Pragmas, Pragma{Pos: d.span(), Name: d.string(), Value: d.string()})
+	}
+
+	x := d.expr()
+	if d.err == nil && x == nil {
+		d.fail("no expression")
+	}
+	if d.err == nil && len(d.data) > 0 {
+		d.fail("trailing data")
+	}
+	if d.err != nil {
+		return d.err
+	}
+	*se = SourceExpr{Source: d.source, Expr: x, Header: h}
+	return nil
+}
+
+// sourceOf returns a Source of bytes, with the line breaks that
+// parsing it adds.
+func sourceOf(b []byte) token.Source {
+	source := token.NewSource(b)
+	body := source.Body()
+	source.GrowLines(bytes.Count(b[body.Start:body.End], []byte("\n")))
+	for i := body.Start; i < body.End; i++ {
+		if b[i] == '\n' {
+			source.AddLineBreak(i + 1)
+		}
+	}
+	return source
+}
+
+type decoder struct {
+	data   []byte
+	source token.Source
+	err    error
+	depth  int
+}
+
+func (d *decoder) fail(msg string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrBadEncoding, msg)
+		d.data = nil
+	}
+}
+
+func (d *decoder) uint() int {
+	n, size := binary.Uvarint(d.data)
+	if size <= 0 || n > math.MaxInt32 {
+		d.fail("bad number")
+		return 0
+	}
+	d.data = d.data[size:]
+	return int(n)
+}
+
+// len decodes the length of a list, of at least a byte per element.
+func (d *decoder) len() int {
+	n := d.uint()
+	if n > len(d.data) {
+		d.fail("bad length")
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.len()
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *decoder) span() token.Span {
+	s := token.Span{Start: d.uint(), End: d.uint()}
+	if s.Start > s.End || s.End > len(d.source.Bytes()) {
+		d.fail("bad span")
+	}
+	return s
+}
+
+func (d *decoder) token() token.Token {
+	code := d.uint()
+	if code >= len(tokenCodes) {
+		d.fail("bad token")
+		return token.BAD
+	}
+	return tokenCodes[code]
+}
+
+func (d *decoder) kind() kind {
+	if len(d.data) == 0 {
+		d.fail("unexpected end")
+		return kindNil
+	}
+	k := kind(d.data[0])
+	d.data = d.data[1:]
+	return k
+}
+
+func (d *decoder) variant() *VariantExpr {
+	return &VariantExpr{Tag: Ident{Pos: d.span()}, Typ: d.expr()}
+}
+
+// required decodes an expression that mustn't be nil.
+func (d *decoder) required() Expr {
+	x := d.expr()
+	if x == nil {
+		d.fail("missing expression")
+		// Nil nodes would panic before the error is seen.
+		return &Ident{}
+	}
+	return x
+}
+
+func (d *decoder) expr() Expr {
+	if d.err != nil {
+		return nil
+	}
+	if d.depth >= maxDepth {
+		d.fail("nested too deep")
+		return nil
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+
+	switch k := d.kind(); k {
+	case kindNil:
+		return nil
+	case kindIdent:
+		return &Ident{Pos: d.span()}
+	case kindLiteral:
+		return &Literal{Pos: d.span(), Kind: d.token()}
+	case kindBinary:
+		return &BinaryExpr{Op: d.token(), Left: d.required(), Right: d.required()}
+	case kindFunc:
+		return &FuncExpr{Arg: d.required(), Body: d.required()}
+	case kindMatchFunc:
+		n := d.len()
+		if n == 0 {
+			d.fail("empty match function")
+		}
+		fns := make(MatchFuncExpr, n)
+		for i := range fns {
+			fns[i] = &FuncExpr{Arg: d.required(), Body: d.required()}
+		}
+		return fns
+	case kindCall:
+		return &CallExpr{Fn: d.required(), Arg: d.required()}
+	case kindVariant:
+		return d.variant()
+	case kindEnum:
+		n := d.len()
+		if n == 0 {
+			d.fail("empty enum")
+		}
+		enum := make(EnumExpr, n)
+		for i := range enum {
+			enum[i] = d.variant()
+		}
+		return enum
+	case kindRecord:
+		rec := &RecordExpr{Pos: d.span(), Rest: d.expr()}
+		// Empty records and lists have no entries or elements, as parsed.
+		if n := d.len(); n > 0 {
+			rec.Entries = make([]RecordEntry, n)
+		}
+		for i := range rec.Entries {
+			entry := &rec.Entries[i]
+			entry.Key = Ident{Pos: d.span()}
+			flags := d.uint()
+			entry.Extend = flags&entryExtend != 0
+			entry.Drop = flags&entryDrop != 0
+			entry.Pun = flags&entryPun != 0
+			entry.Type = flags&entryType != 0
+			if entry.Drop {
+				entry.Val = d.expr()
+			} else {
+				entry.Val = d.required()
+			}
+		}
+		return rec
+	case kindAccess:
+		return &AccessExpr{Pos: d.span(), Rec: d.required(), Key: Ident{Pos: d.span()}}
+	case kindList:
+		list := &ListExpr{Pos: d.span()}
+		if n := d.len(); n > 0 {
+			list.Elements = make([]Expr, n)
+		}
+		for i := range list.Elements {
+			list.Elements[i] = d.required()
+		}
+		return list
+	case kindWhere:
+		x := &WhereExpr{Expr: d.required(), Id: Ident{Pos: d.span()}, Typ: d.expr(), Val: d.expr()}
+		if x.Typ == nil && x.Val == nil {
+			d.fail("where-binding without a type or value")
+		}
+		return x
+	case kindImport:
+		x := &ImportExpr{Pos: d.span(), HashAlgo: d.string()}
+		x.Value = Literal{Pos: d.span(), Kind: d.token()}
+		return x
+	default:
+		d.fail(fmt.Sprintf("unknown kind %d", k))
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package ast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+var encodeExamples = []string{
+	`1`,
+	`{} ; a = []`,
+	`a + b * -1.5 ; a = 1 ; b : int = 2`,
+	"#!/usr/bin/env scrap\n-- scrap:nowarn shadow\n-- about\nf \"hi\" ~~aGk= ~ff",
+	`| [] -> 0 | [x] ++ xs -> x | _ -> ()`,
+	`{ ..r, a, +b = 1, -c } ; r : { a : int, c : text } = { a = 1, c = "" }`,
+	`t::a 1 ; t : #a int #b ; x = t::b`,
+	`$sha256~~` + "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa" + ` + $local:utils.one`,
+	`[1, 2] |> f >> g <| [] ; f = x -> x.a ; g = a -> b -> a +< b >+ []`,
+	"\uFEFFa\r\n ; a = 1\x00",
+}
+
+func TestEncodeBinary(t *testing.T) {
+	for _, source := range encodeExamples {
+		se, err := parser.ParseExpr(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := se.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ast.SourceExpr
+		if err := decoded.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%s: %s", source, err)
+		}
+		if again, _ := decoded.MarshalBinary(); !bytes.Equal(again, data) {
+			t.Errorf("%s: decoded differently", source)
+		}
+		// The source and header are decoded exactly; lines included.
+		if !reflect.DeepEqual(decoded.Source, se.Source) || !reflect.DeepEqual(decoded.Header, se.Header) {
+			t.Errorf("%s: decoded the source or header differently", source)
+		}
+
+		// Every prefix is bad.
+		for i := range data {
+			if err := decoded.UnmarshalBinary(data[:i]); !errors.Is(err, ast.ErrBadEncoding) {
+				t.Fatalf("%s: expected a bad encoding of %d bytes, got %v", source, i, err)
+			}
+		}
+	}
+}
+
+func TestEncodeDeep(t *testing.T) {
+	se, err := parser.ParseExpr(`f`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := se.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The identifier is encoded last, as its kind and span; and calls
+	// as their kind, followed by their function and argument.
+	const call = 6
+	head, ident := data[:len(data)-3], data[len(data)-3:]
+	nested := func(depth int) []byte {
+		return slices.Concat(head, bytes.Repeat([]byte{call}, depth-1), bytes.Repeat(ident, depth))
+	}
+
+	const max = 1 << 16
+	var decoded ast.SourceExpr
+	if err := decoded.UnmarshalBinary(nested(max)); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.UnmarshalBinary(nested(max + 1)); !errors.Is(err, ast.ErrBadEncoding) {
+		t.Errorf("expected a bad encoding, got %v", err)
+	}
+
+	decoded.Expr = &ast.CallExpr{Fn: decoded.Expr, Arg: decoded.Expr}
+	if _, err := decoded.MarshalBinary(); err == nil {
+		t.Errorf("expected expressions nested too deep not to be encoded")
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	for _, source := range encodeExamples {
+		se, err := parser.ParseExpr(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(se)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded ast.SourceExpr
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("%s: %s", source, err)
+		}
+		if again, _ := json.Marshal(decoded); !bytes.Equal(again, data) {
+			t.Errorf("%s: decoded differently from %s", source, data)
+		}
+		if !reflect.DeepEqual(decoded.Source, se.Source) || !reflect.DeepEqual(decoded.Header, se.Header) {
+			t.Errorf("%s: decoded the source or header differently", source)
+		}
+	}
+
+	// Unlike json.Marshal, MarshalJSON doesn't escape arrows.
+	se, err := parser.ParseExpr(`f 1 ; f = x -> x`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := se.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"source":"f 1 ; f = x -> x","header":{"pos":[0,0]},"expr":{"kind":"where",` +
+		`"expr":{"kind":"call","fn":{"kind":"ident","pos":[0,1],"text":"f"},"arg":{"kind":"literal","pos":[2,3],"text":"1","token":"INT"}},` +
+		`"id":{"kind":"ident","pos":[6,7],"text":"f"},` +
+		`"val":{"kind":"func","arg":{"kind":"ident","pos":[10,11],"text":"x"},"body":{"kind":"ident","pos":[15,16],"text":"x"}}}}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+
+	var decoded ast.SourceExpr
+	bad := `{"source":"x","header":{"pos":[0,0]},"expr":{"kind":"ident","pos":[0,2]}}`
+	if err := json.Unmarshal([]byte(bad), &decoded); !errors.Is(err, ast.ErrBadEncoding) {
+		t.Errorf("Expected a bad encoding, got %v", err)
+	}
+}
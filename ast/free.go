@@ -0,0 +1,133 @@
+package ast
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// FreeVars returns the sorted names of the variables x refers to,
+// but doesn't bind itself. Keys of records, tags and imports
+// aren't variables.
+func FreeVars(source *token.Source, x Expr) []string {
+	var free []string
+	var walk func(x Node, bound []string)
+	walk = func(x Node, bound []string) {
+		Inspect(x, func(n Node) bool {
+			switch n := n.(type) {
+			case *Ident:
+				name := source.GetString(n.Pos)
+				if !slices.Contains(bound, name) && !slices.Contains(free, name) {
+					free = append(free, name)
+				}
+			case *FuncExpr:
+				names := slices.Clip(bound)
+				for _, id := range PatternNames(n.Arg) {
+					names = append(names, source.GetString(id.Pos))
+				}
+				walk(n.Body, names)
+				return false
+			case *WhereExpr:
+				if n.Typ != nil {
+					walk(n.Typ, bound)
+				}
+				if n.Val != nil {
+					walk(n.Val, bound)
+				}
+				walk(n.Expr, append(slices.Clip(bound), source.GetString(n.Id.Pos)))
+				return false
+			case *RecordExpr:
+				if n.Rest != nil {
+					walk(n.Rest, bound)
+				}
+				for _, e := range n.Entries {
+					if e.Val != nil {
+						walk(e.Val, bound)
+					}
+				}
+				return false
+			case *AccessExpr:
+				walk(n.Rec, bound)
+				return false
+			case *BinaryExpr:
+				if n.Op == token.PICK {
+					walk(n.Left, bound)
+					return false
+				}
+			case *VariantExpr:
+				if n.Typ != nil {
+					walk(n.Typ, bound)
+				}
+				return false
+			case *ImportExpr:
+				return false
+			}
+			return true
+		})
+	}
+	walk(x, nil)
+	slices.Sort(free)
+	return free
+}
+
+// PatternNames returns the identifiers bound by a pattern,
+// in the order they appear.
+func PatternNames(x Expr) (ids []*Ident) {
+	switch x := x.(type) {
+	case *Ident:
+		ids = append(ids, x)
+	case *BinaryExpr:
+		// The alternatives of an or-pattern bind the same names.
+		if x.Op == token.PIPE {
+			return PatternNames(x.Left)
+		}
+		ids = append(PatternNames(x.Left), PatternNames(x.Right)...)
+	case *ListExpr:
+		for _, el := range x.Elements {
+			ids = append(ids, PatternNames(el)...)
+		}
+	case *VariantExpr:
+		if x.Typ != nil {
+			ids = PatternNames(x.Typ)
+		}
+	case *RecordExpr:
+		for _, e := range x.Entries {
+			ids = append(ids, PatternNames(e.Val)...)
+		}
+		if x.Rest != nil {
+			ids = append(ids, PatternNames(x.Rest)...)
+		}
+	}
+	return
+}
+
+// A FreeVarsCache remembers the free variables of the nodes it's asked
+// about, for analyses that ask repeatedly. The zero value is ready to use,
+// but it mustn't be used by multiple goroutines at once.
+type FreeVarsCache struct {
+	vars map[freeVarsKey][]string
+}
+
+// Nodes are identified by their source, span and type,
+// since some nodes are slices, which can't be map keys.
+type freeVarsKey struct {
+	source *token.Source
+	span   token.Span
+	typ    reflect.Type
+}
+
+// FreeVars returns FreeVars(source, x), computing it only once per node.
+// The result must not be modified.
+func (c *FreeVarsCache) FreeVars(source *token.Source, x Expr) []string {
+	key := freeVarsKey{source, x.Span(), reflect.TypeOf(x)}
+	if free, ok := c.vars[key]; ok {
+		return free
+	}
+	if c.vars == nil {
+		c.vars = make(map[freeVarsKey][]string)
+	}
+	free := FreeVars(source, x)
+	c.vars[key] = free
+	return free
+}
@@ -0,0 +1,57 @@
+package ast_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestFreeVars(t *testing.T) {
+	examples := []struct {
+		source string
+		free   string
+	}{
+		{`x`, `[x]`},
+		{`x -> x`, `[]`},
+		{`a -> b -> a + b + c`, `[c]`},
+		{`f y ; f = x -> x + y ; y = 1`, `[]`},
+		{`f ; f = x -> y`, `[y]`},
+		{`| [ a, b ] -> a + c | { ..r, k = d } -> d + e`, `[c e]`},
+		{`| #l x | #r x -> x + y`, `[y]`},
+		{`{ ..c, a = b }.a`, `[b c]`},
+		{`t::a z ; t : #a int`, `[int z]`},
+		{`$sha256~~a2V5 x`, `[x]`},
+	}
+
+	for _, ex := range examples {
+		se, err := parser.ParseExpr(ex.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if free := fmt.Sprint(ast.FreeVars(&se.Source, se.Expr)); free != ex.free {
+			t.Errorf("FreeVars(%q): got %s, want %s", ex.source, free, ex.free)
+		}
+	}
+}
+
+func TestFreeVarsCache(t *testing.T) {
+	se, err := parser.ParseExpr(`a -> a + b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := se.Expr.(*ast.FuncExpr)
+
+	var cache ast.FreeVarsCache
+	first := cache.FreeVars(&se.Source, fn)
+	if fmt.Sprint(first) != `[b]` {
+		t.Errorf("Expected [b], got %v", first)
+	}
+	if body := cache.FreeVars(&se.Source, fn.Body); fmt.Sprint(body) != `[a b]` {
+		t.Errorf("Expected [a b], got %v", body)
+	}
+	if again := cache.FreeVars(&se.Source, fn); &again[0] != &first[0] {
+		t.Errorf("Expected the cached result")
+	}
+}
@@ -0,0 +1,341 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// The JSON form of a SourceExpr, for debugging and tools in other
+// languages. Nodes are objects with their kind, like "binary", and their
+// fields; spans are [start, end] arrays of byte offsets into the source,
+// and tokens are named like token.Token.String. Identifiers and literals
+// include their text too, which is ignored when decoding.
+type jsonSourceExpr struct {
+	Source string     `json:"source"`
+	Header jsonHeader `json:"header"`
+	Expr   *jsonNode  `json:"expr"`
+}
+
+// A span, as [start, end].
+type jsonSpan [2]int
+
+func spanJSON(s token.Span) *jsonSpan {
+	return &jsonSpan{s.Start, s.End}
+}
+
+type jsonHeader struct {
+	Pos     *jsonSpan    `json:"pos"`
+	Shebang string       `json:"shebang,omitempty"`
+	Pragmas []jsonPragma `json:"pragmas,omitempty"`
+}
+
+type jsonPragma struct {
+	Pos   *jsonSpan `json:"pos"`
+	Name  string    `json:"name"`
+	Value string    `json:"value"`
+}
+
+type jsonNode struct {
+	Kind  string    `json:"kind"`
+	Pos   *jsonSpan `json:"pos,omitempty"`
+	Text  string    `json:"text,omitempty"`
+	Token string    `json:"token,omitempty"`
+	Algo  string    `json:"algo,omitempty"`
+
+	Left  *jsonNode `json:"left,omitempty"`
+	Right *jsonNode `json:"right,omitempty"`
+	Fn    *jsonNode `json:"fn,omitempty"`
+	Arg   *jsonNode `json:"arg,omitempty"`
+	Body  *jsonNode `json:"body,omitempty"`
+	Tag   *jsonNode `json:"tag,omitempty"`
+	Rec   *jsonNode `json:"rec,omitempty"`
+	Key   *jsonNode `json:"key,omitempty"`
+	Rest  *jsonNode `json:"rest,omitempty"`
+	Expr  *jsonNode `json:"expr,omitempty"`
+	Id    *jsonNode `json:"id,omitempty"`
+	Typ   *jsonNode `json:"type,omitempty"`
+	Val   *jsonNode `json:"val,omitempty"`
+	Value *jsonNode `json:"value,omitempty"`
+
+	// Of lists, the functions of match functions and the variants of enums.
+	Elements []*jsonNode `json:"elements,omitempty"`
+	Entries  []jsonEntry `json:"entries,omitempty"`
+}
+
+type jsonEntry struct {
+	Key    *jsonNode `json:"key"`
+	Val    *jsonNode `json:"val,omitempty"`
+	Extend bool      `json:"extend,omitempty"`
+	Drop   bool      `json:"drop,omitempty"`
+	Pun    bool      `json:"pun,omitempty"`
+	Type   bool      `json:"type,omitempty"`
+}
+
+// MarshalJSON encodes a SourceExpr as JSON, with its source.
+func (se SourceExpr) MarshalJSON() ([]byte, error) {
+	js := jsonSourceExpr{
+		Source: string(se.Source.Bytes()),
+		Header: jsonHeader{Pos: spanJSON(se.Header.Pos), Shebang: se.Header.Shebang},
+	}
+	for _, p := range se.Header.Pragmas {
+		js.Header.Pragmas = append(js.Header.Pragmas, jsonPragma{spanJSON(p.Pos), p.Name, p.Value})
+	}
+	var err error
+	if js.Expr, err = toJSON(&se.Source, se.Expr); err != nil {
+		return nil, err
+	}
+	// Marshal escapes <, > and &, for embedding in HTML, which the arrows
+	// of scraps are full of.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(js); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+func toJSON(source *token.Source, x Expr) (n *jsonNode, err error) {
+	node := func(k kind) *jsonNode {
+		n = &jsonNode{Kind: kindNames[k]}
+		return n
+	}
+	ident := func(id Ident) *jsonNode {
+		return &jsonNode{Kind: kindNames[kindIdent], Pos: spanJSON(id.Pos), Text: source.GetString(id.Pos)}
+	}
+	literal := func(lit Literal) *jsonNode {
+		return &jsonNode{Kind: kindNames[kindLiteral], Pos: spanJSON(lit.Pos), Text: source.GetString(lit.Pos), Token: lit.Kind.String()}
+	}
+	variant := func(v *VariantExpr) (*jsonNode, error) {
+		typ, err := toJSON(source, v.Typ)
+		return &jsonNode{Kind: kindNames[kindVariant], Tag: ident(v.Tag), Typ: typ}, err
+	}
+	// Converts the children of a node, keeping the first error.
+	child := func(x Expr) *jsonNode {
+		c, cerr := toJSON(source, x)
+		if err == nil {
+			err = cerr
+		}
+		return c
+	}
+
+	switch x := x.(type) {
+	case nil:
+		return nil, nil
+	case *Ident:
+		return ident(*x), nil
+	case *Literal:
+		return literal(*x), nil
+	case *BinaryExpr:
+		node(kindBinary)
+		n.Token, n.Left, n.Right = x.Op.String(), child(x.Left), child(x.Right)
+	case *FuncExpr:
+		node(kindFunc)
+		n.Arg, n.Body = child(x.Arg), child(x.Body)
+	case MatchFuncExpr:
+		node(kindMatchFunc)
+		for _, fn := range x {
+			n.Elements = append(n.Elements, child(fn))
+		}
+	case *CallExpr:
+		node(kindCall)
+		n.Fn, n.Arg = child(x.Fn), child(x.Arg)
+	case *VariantExpr:
+		return variant(x)
+	case EnumExpr:
+		node(kindEnum)
+		for _, v := range x {
+			n.Elements = append(n.Elements, child(v))
+		}
+	case *RecordExpr:
+		node(kindRecord)
+		n.Pos, n.Rest = spanJSON(x.Pos), child(x.Rest)
+		for _, e := range x.Entries {
+			n.Entries = append(n.Entries, jsonEntry{
+				Key: ident(e.Key), Val: child(e.Val),
+				Extend: e.Extend, Drop: e.Drop, Pun: e.Pun, Type: e.Type,
+			})
+		}
+	case *AccessExpr:
+		node(kindAccess)
+		n.Pos, n.Rec, n.Key = spanJSON(x.Pos), child(x.Rec), ident(x.Key)
+	case *ListExpr:
+		node(kindList)
+		n.Pos = spanJSON(x.Pos)
+		for _, el := range x.Elements {
+			n.Elements = append(n.Elements, child(el))
+		}
+	case *WhereExpr:
+		node(kindWhere)
+		n.Expr, n.Id, n.Typ, n.Val = child(x.Expr), ident(x.Id), child(x.Typ), child(x.Val)
+	case *ImportExpr:
+		node(kindImport)
+		n.Pos, n.Algo, n.Value = spanJSON(x.Pos), x.HashAlgo, literal(x.Value)
+	default:
+		return nil, fmt.Errorf("cannot encode %T", x)
+	}
+	return n, err
+}
+
+// UnmarshalJSON decodes a SourceExpr encoded by MarshalJSON.
+func (se *SourceExpr) UnmarshalJSON(data []byte) error {
+	var js jsonSourceExpr
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	d := jsonDecoder{source: sourceOf([]byte(js.Source))}
+
+	h := Header{Pos: d.span(js.Header.Pos), Shebang: js.Header.Shebang}
+	for _, p := range js.Header.Pragmas {
+		h.Pragmas = append(h.Pragmas, Pragma{Pos: d.span(p.Pos), Name: p.Name, Value: p.Value})
+	}
+	x := d.required(js.Expr)
+	if d.err != nil {
+		return d.err
+	}
+	*se = SourceExpr{Source: d.source, Expr: x, Header: h}
+	return nil
+}
+
+type jsonDecoder struct {
+	source token.Source
+	err    error
+}
+
+func (d *jsonDecoder) fail(msg string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", ErrBadEncoding, msg)
+	}
+}
+
+func (d *jsonDecoder) span(s *jsonSpan) token.Span {
+	if s == nil || s[0] < 0 || s[0] > s[1] || s[1] > len(d.source.Bytes()) {
+		d.fail("bad span")
+		return token.Span{}
+	}
+	return token.Span{Start: s[0], End: s[1]}
+}
+
+func (d *jsonDecoder) token(name string) token.Token {
+	for _, tok := range tokenCodes {
+		if tok.String() == name {
+			return tok
+		}
+	}
+	d.fail("bad token " + name)
+	return token.BAD
+}
+
+func (d *jsonDecoder) ident(n *jsonNode) Ident {
+	if n == nil || n.Kind != kindNames[kindIdent] {
+		d.fail("expected an ident")
+		return Ident{}
+	}
+	return Ident{Pos: d.span(n.Pos)}
+}
+
+func (d *jsonDecoder) literal(n *jsonNode) Literal {
+	if n == nil || n.Kind != kindNames[kindLiteral] {
+		d.fail("expected a literal")
+		return Literal{}
+	}
+	return Literal{Pos: d.span(n.Pos), Kind: d.token(n.Token)}
+}
+
+func (d *jsonDecoder) variant(n *jsonNode) *VariantExpr {
+	if n == nil || n.Kind != kindNames[kindVariant] {
+		d.fail("expected a variant")
+		return &VariantExpr{}
+	}
+	return &VariantExpr{Tag: d.ident(n.Tag), Typ: d.expr(n.Typ)}
+}
+
+func (d *jsonDecoder) function(n *jsonNode) *FuncExpr {
+	if n == nil || n.Kind != kindNames[kindFunc] {
+		d.fail("expected a function")
+		return &FuncExpr{Arg: &Ident{}, Body: &Ident{}}
+	}
+	return &FuncExpr{Arg: d.required(n.Arg), Body: d.required(n.Body)}
+}
+
+// required decodes an expression that mustn't be nil.
+func (d *jsonDecoder) required(n *jsonNode) Expr {
+	if n == nil {
+		d.fail("missing expression")
+		// Nil nodes would panic before the error is seen.
+		return &Ident{}
+	}
+	return d.expr(n)
+}
+
+func (d *jsonDecoder) expr(n *jsonNode) Expr {
+	if n == nil {
+		return nil
+	}
+	switch n.Kind {
+	case kindNames[kindIdent]:
+		id := d.ident(n)
+		return &id
+	case kindNames[kindLiteral]:
+		lit := d.literal(n)
+		return &lit
+	case kindNames[kindBinary]:
+		return &BinaryExpr{Op: d.token(n.Token), Left: d.required(n.Left), Right: d.required(n.Right)}
+	case kindNames[kindFunc]:
+		return d.function(n)
+	case kindNames[kindMatchFunc]:
+		if len(n.Elements) == 0 {
+			d.fail("empty match function")
+		}
+		fns := make(MatchFuncExpr, len(n.Elements))
+		for i, el := range n.Elements {
+			fns[i] = d.function(el)
+		}
+		return fns
+	case kindNames[kindCall]:
+		return &CallExpr{Fn: d.required(n.Fn), Arg: d.required(n.Arg)}
+	case kindNames[kindVariant]:
+		return d.variant(n)
+	case kindNames[kindEnum]:
+		if len(n.Elements) == 0 {
+			d.fail("empty enum")
+		}
+		enum := make(EnumExpr, len(n.Elements))
+		for i, el := range n.Elements {
+			enum[i] = d.variant(el)
+		}
+		return enum
+	case kindNames[kindRecord]:
+		rec := &RecordExpr{Pos: d.span(n.Pos), Rest: d.expr(n.Rest)}
+		for _, e := range n.Entries {
+			rec.Entries = append(rec.Entries, RecordEntry{Key: d.ident(e.Key), Extend: e.Extend, Drop: e.Drop, Pun: e.Pun, Type: e.Type})
+			if e.Drop {
+				rec.Entries[len(rec.Entries)-1].Val = d.expr(e.Val)
+			} else {
+				rec.Entries[len(rec.Entries)-1].Val = d.required(e.Val)
+			}
+		}
+		return rec
+	case kindNames[kindAccess]:
+		return &AccessExpr{Pos: d.span(n.Pos), Rec: d.required(n.Rec), Key: d.ident(n.Key)}
+	case kindNames[kindList]:
+		list := &ListExpr{Pos: d.span(n.Pos)}
+		for _, el := range n.Elements {
+			list.Elements = append(list.Elements, d.required(el))
+		}
+		return list
+	case kindNames[kindWhere]:
+		x := &WhereExpr{Expr: d.required(n.Expr), Id: d.ident(n.Id), Typ: d.expr(n.Typ), Val: d.expr(n.Val)}
+		if x.Typ == nil && x.Val == nil {
+			d.fail("where-binding without a type or value")
+		}
+		return x
+	case kindNames[kindImport]:
+		return &ImportExpr{Pos: d.span(n.Pos), HashAlgo: n.Algo, Value: d.literal(n.Value)}
+	}
+	d.fail("unknown kind " + n.Kind)
+	return &Ident{}
+}
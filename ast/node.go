@@ -1,6 +1,8 @@
 package ast
 
 import (
+	"encoding/hex"
+
 	"github.com/Victorystick/scrapscript/token"
 )
 
@@ -10,6 +12,36 @@ import (
 type SourceExpr struct {
 	Source token.Source
 	Expr   Expr
+	Header Header
+}
+
+// The Header of a scrap is its leading lines, before any expression: an
+// optional `#!` line, so that scraps can be executable, followed by `--`
+// comment lines. Comments of the form `-- scrap:name value` are pragmas;
+// metadata for tools, like `-- scrap:nowarn shadow`.
+type Header struct {
+	// The span of all its lines, which is empty if there are none.
+	Pos token.Span
+	// The line after `#!`, if any.
+	Shebang string
+	Pragmas []Pragma
+}
+
+// A Pragma is a `-- scrap:name value` line in a Header.
+type Pragma struct {
+	Pos   token.Span // Of the whole line.
+	Name  string
+	Value string
+}
+
+// Pragma returns the value of the last pragma with the name, if any.
+func (h Header) Pragma(name string) (string, bool) {
+	for i := len(h.Pragmas) - 1; i >= 0; i-- {
+		if h.Pragmas[i].Name == name {
+			return h.Pragmas[i].Value, true
+		}
+	}
+	return "", false
 }
 
 type Node interface {
@@ -61,12 +93,35 @@ type EnumExpr []*VariantExpr
 
 type RecordExpr struct {
 	Pos     token.Span
-	Entries map[string]Expr
-	Rest    Expr // May be nil
+	Entries []RecordEntry // In source order.
+	Rest    Expr          // May be nil
+}
+
+// An entry `Key = Val` of a record.
+type RecordEntry struct {
+	Key Ident
+	Val Expr // Nil if Drop.
+	// Whether the entry adds a key to the record spread,
+	// as in `{ ..base, +key = val }`, rather than updating it.
+	Extend bool
+	// Whether the entry removes a key from the record spread,
+	// as in `{ ..base, -key }`.
+	Drop bool
+	// Whether the key is punned, as in `{ key }`, short for `{ key = key }`.
+	// Val is then an Ident with the span of Key.
+	Pun bool
+	// Whether Val is the type of the key, as in the record type
+	// `{ key : int }`, rather than its value.
+	Type bool
+}
+
+// IsType reports whether the record is a record type, like `{ a : int }`.
+func (r *RecordExpr) IsType() bool {
+	return len(r.Entries) > 0 && r.Entries[0].Type
 }
 
 type AccessExpr struct {
-	Pos token.Span
+	Pos token.Span // The position of the dot.
 	Rec Expr
 	Key Ident
 }
@@ -85,12 +140,29 @@ type WhereExpr struct {
 
 type ImportExpr struct {
 	Pos token.Span
-	// Typically "sha256".
+	// Typically "sha256", or "local" for local imports.
 	HashAlgo string
-	// Any literal, typically a byte-string.
+	// Any literal, typically a byte-string,
+	// or the identifier naming a local import.
 	Value Literal
 }
 
+// Local reports whether the import is of a local scrap by name, like
+// `$local:utils`, rather than by hash. Local imports are for development,
+// and are linked to hashed imports before scraps are pushed.
+func (x *ImportExpr) Local() bool {
+	return x.Value.Kind == token.IDENT
+}
+
+// Hash returns the decoded hash an import is by,
+// or the name of a local import.
+func (x *ImportExpr) Hash(source *token.Source) ([]byte, error) {
+	if x.Local() {
+		return []byte(source.GetString(x.Value.Pos)), nil
+	}
+	return hex.DecodeString(source.GetString(x.Value.Pos.TrimStart(2)))
+}
+
 func (b Ident) expr()         {}
 func (b Literal) expr()       {}
 func (b BinaryExpr) expr()    {}
@@ -106,10 +178,7 @@ func (b WhereExpr) expr()     {}
 func (b ImportExpr) expr()    {}
 
 func span(start, end Expr) token.Span {
-	return token.Span{
-		Start: start.Span().Start,
-		End:   end.Span().End,
-	}
+	return start.Span().Union(end.Span())
 }
 
 func (i *Ident) Span() token.Span        { return i.Pos }
@@ -128,7 +197,15 @@ func (b *VariantExpr) Span() token.Span {
 }
 func (b EnumExpr) Span() token.Span   { return span(b[0], b[len(b)-1]) }
 func (b RecordExpr) Span() token.Span { return b.Pos }
-func (b AccessExpr) Span() token.Span { return b.Pos }
-func (b ListExpr) Span() token.Span   { return b.Pos }
-func (b *WhereExpr) Span() token.Span { return span(b.Expr, b.Val) }
+func (b AccessExpr) Span() token.Span {
+	return token.Span{Start: b.Rec.Span().Start, End: b.Key.Pos.End}
+}
+func (b ListExpr) Span() token.Span { return b.Pos }
+func (b *WhereExpr) Span() token.Span {
+	// Type-only bindings have no value.
+	if b.Val == nil {
+		return span(b.Expr, b.Typ)
+	}
+	return span(b.Expr, b.Val)
+}
 func (b ImportExpr) Span() token.Span { return b.Pos }
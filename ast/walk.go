@@ -0,0 +1,87 @@
+package ast
+
+// PathAt returns the path of nodes from node to the innermost one whose
+// span contains offset, as by token.Span.Contains, or nil if node doesn't.
+// Where adjacent nodes both contain offset, the first is chosen.
+func PathAt(node Node, offset int) (path []Node) {
+	for node != nil && node.Span().Contains(offset) {
+		path = append(path, node)
+
+		var next Node
+		first := true
+		Inspect(node, func(n Node) bool {
+			// Only the children of node are considered.
+			if first {
+				first = false
+				return true
+			}
+			if next == nil && n.Span().Contains(offset) {
+				next = n
+			}
+			return false
+		})
+		node = next
+	}
+	return
+}
+
+// Inspect traverses an AST in depth-first order, calling f for each node.
+// If f returns false, the children of that node are skipped.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *BinaryExpr:
+		Inspect(n.Left, f)
+		Inspect(n.Right, f)
+	case *FuncExpr:
+		Inspect(n.Arg, f)
+		Inspect(n.Body, f)
+	case MatchFuncExpr:
+		for _, fn := range n {
+			Inspect(fn, f)
+		}
+	case *CallExpr:
+		Inspect(n.Fn, f)
+		Inspect(n.Arg, f)
+	case *VariantExpr:
+		Inspect(&n.Tag, f)
+		if n.Typ != nil {
+			Inspect(n.Typ, f)
+		}
+	case EnumExpr:
+		for _, v := range n {
+			Inspect(v, f)
+		}
+	case *RecordExpr:
+		if n.Rest != nil {
+			Inspect(n.Rest, f)
+		}
+		for _, e := range n.Entries {
+			Inspect(&e.Key, f)
+			if e.Val != nil {
+				Inspect(e.Val, f)
+			}
+		}
+	case *AccessExpr:
+		Inspect(n.Rec, f)
+		Inspect(&n.Key, f)
+	case *ListExpr:
+		for _, x := range n.Elements {
+			Inspect(x, f)
+		}
+	case *WhereExpr:
+		Inspect(n.Expr, f)
+		Inspect(&n.Id, f)
+		if n.Typ != nil {
+			Inspect(n.Typ, f)
+		}
+		if n.Val != nil {
+			Inspect(n.Val, f)
+		}
+	case *ImportExpr:
+		Inspect(&n.Value, f)
+	}
+}
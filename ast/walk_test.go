@@ -0,0 +1,49 @@
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestPathAt(t *testing.T) {
+	const source = `f { a = [ 1, x + 2 ] } ; x = 3`
+	se, err := parser.ParseExpr(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	examples := []struct {
+		offset int
+		path   string
+	}{
+		// The 1 in the list.
+		{10, "WhereExpr CallExpr RecordExpr ListExpr Literal(1)"},
+		// Just past x, in `x + 2`.
+		{14, "WhereExpr CallExpr RecordExpr ListExpr BinaryExpr Ident(x)"},
+		// Between the operands of +.
+		{15, "WhereExpr CallExpr RecordExpr ListExpr BinaryExpr"},
+		// The name of the where-binding.
+		{25, "WhereExpr Ident(x)"},
+		{0, "WhereExpr CallExpr Ident(f)"},
+		{len(source) + 1, ""},
+	}
+
+	for _, ex := range examples {
+		var names []string
+		for _, n := range ast.PathAt(se.Expr, ex.offset) {
+			name := strings.TrimPrefix(fmt.Sprintf("%T", n), "*ast.")
+			switch n.(type) {
+			case *ast.Ident, *ast.Literal:
+				name += "(" + n.Span().Get([]byte(source)) + ")"
+			}
+			names = append(names, name)
+		}
+		if path := strings.Join(names, " "); path != ex.path {
+			t.Errorf("PathAt(%d): got %q, want %q", ex.offset, path, ex.path)
+		}
+	}
+}
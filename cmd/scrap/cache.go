@@ -0,0 +1,76 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+var (
+	cacheMaxAge   = flag.Duration("max-age", 0, "With cache gc, remove cached scraps older than this, like 720h")
+	cacheMaxBytes = flag.Int64("max-bytes", 0, "With cache gc, remove the oldest cached scraps until the rest fit in this many bytes")
+)
+
+// manageCache lists, garbage-collects or clears the cache of scraps
+// fetched from the scrapyard.
+func manageCache(args []string) {
+	dir := must(yards.DefaultCacheDir())
+
+	sub := "ls"
+	if len(args) > 0 {
+		sub = args[0]
+	}
+	switch sub {
+	case "ls":
+		now := time.Now()
+		var total int64
+		entries := must(dir.List())
+		for _, e := range entries {
+			fmt.Printf("%s %8d %s\n", e.Key, e.Size, age(now.Sub(e.Modified)))
+			total += e.Size
+		}
+		fmt.Printf("%d scraps, %d bytes in %s\n", len(entries), total, dir)
+	case "gc":
+		if *cacheMaxAge <= 0 && *cacheMaxBytes <= 0 {
+			fmt.Fprintln(os.Stderr, "cache gc needs -max-age or -max-bytes")
+			os.Exit(2)
+		}
+		var expiry time.Time
+		if *cacheMaxAge > 0 {
+			expiry = time.Now().Add(-*cacheMaxAge)
+		}
+		printRemoved(yards.CollectGarbage(dir, expiry, *cacheMaxBytes))
+	case "clear":
+		printRemoved(yards.Clear(dir))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown cache command %q; must be ls, gc or clear\n", sub)
+		os.Exit(2)
+	}
+}
+
+func printRemoved(removed []yards.CacheEntry, err error) {
+	var total int64
+	for _, e := range removed {
+		total += e.Size
+	}
+	fmt.Printf("removed %d scraps, %d bytes\n", len(removed), total)
+	if err != nil {
+		fail(stdin, err)
+	}
+}
+
+// age renders a duration in its largest whole unit, from minutes to days.
+func age(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	}
+	return fmt.Sprintf("%dm", d/time.Minute)
+}
@@ -0,0 +1,29 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// compatScraps reports whether a scrap can replace another, in scraps
+// that import it, by their types; each read from a file or fetched by
+// a hash like $sha256~~<hash>. It exits with status 1 if it can't.
+func compatScraps(args []string) {
+	if len(args) != 2 {
+		fail(stdin, fmt.Errorf("expected two scraps to compare, by file or hash"))
+	}
+	env := makeEnv()
+	before, after := loadScrap(env, args[0]), loadScrap(env, args[1])
+	reasons := must(env.Compat(before, after))
+	if len(reasons) == 0 {
+		fmt.Println("compatible")
+		return
+	}
+	fmt.Println("incompatible:")
+	for _, reason := range reasons {
+		fmt.Printf("  %s\n", reason)
+	}
+	os.Exit(1)
+}
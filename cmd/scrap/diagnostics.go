@@ -0,0 +1,129 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+var (
+	jsonDiagnostics = flag.Bool("json", false, "Print errors to stderr as JSON diagnostics, one per line")
+	maxErrors       = flag.Int("max-errors", 10, "The most errors to print of a script, or 0 for all of them; JSON diagnostics are never limited")
+)
+
+// The name of scripts read from stdin in diagnostics.
+const stdin = "<stdin>"
+
+// A diagnostic is the machine-readable form of an error.
+// Positions are 1-based and omitted if unknown.
+type diagnostic struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	EndLine   int    `json:"endLine,omitempty"`
+	EndColumn int    `json:"endColumn,omitempty"`
+	Span      *span  `json:"span,omitempty"`
+	Message   string `json:"message"`
+	Severity  string `json:"severity"`
+	// Diagnostics in other scraps, or calls, that led to this one.
+	Related []diagnostic `json:"related,omitempty"`
+}
+
+// A span of byte offsets into a file.
+type span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// diagnose converts an error in file to diagnostics.
+func diagnose(file string, err error) []diagnostic {
+	switch e := err.(type) {
+	case parser.Errors:
+		ds := make([]diagnostic, len(e))
+		for i, err := range e {
+			ds[i] = at(file, *err)
+		}
+		return ds
+
+	case token.Error:
+		return []diagnostic{at(file, e)}
+
+	case *eval.ScrapError:
+		// Report the error where the other scrap was
+		// imported or called, with the original as related.
+		related := diagnose(e.Scrap, e.Err)
+		d := at(file, e.At)
+		if len(related) > 0 {
+			d.Message = fmt.Sprintf("%s: %s", e.At.Msg, related[0].Message)
+		}
+		d.Related = related
+		return []diagnostic{d}
+
+	case *eval.TraceError:
+		ds := diagnose(file, e.Err)
+		if len(ds) == 0 {
+			return ds
+		}
+		for _, frame := range e.Stack {
+			name := frame.Scrap
+			// The outermost scrap is the file itself.
+			if name == e.Stack[len(e.Stack)-1].Scrap {
+				name = file
+			}
+			ds[0].Related = append(ds[0].Related, diagnostic{
+				File:     name,
+				Line:     frame.Pos.Line,
+				Column:   frame.Pos.Column,
+				Message:  fmt.Sprintf("in %s, called with %s", frame.Func, frame.Arg),
+				Severity: "info",
+			})
+		}
+		return ds
+	}
+
+	if inner := errors.Unwrap(err); inner != nil {
+		return diagnose(file, inner)
+	}
+	return []diagnostic{{File: file, Message: err.Error(), Severity: "error"}}
+}
+
+func at(file string, err token.Error) diagnostic {
+	return diagnostic{
+		File:      file,
+		Line:      err.Pos.Line,
+		Column:    err.Pos.Column,
+		EndLine:   err.End.Line,
+		EndColumn: err.End.Column,
+		Span:      &span{err.Range.Start, err.Range.End},
+		Message:   err.Msg,
+		Severity:  "error",
+	}
+}
+
+// report prints an error in file to stderr,
+// as JSON diagnostics if requested.
+func report(file string, err error) {
+	if !*jsonDiagnostics {
+		// Print every error of a script with many, not just the first.
+		var errs parser.Errors
+		if errors.As(err, &errs) && len(errs) > 0 {
+			fmt.Fprintln(os.Stderr, errs.Render(file, token.DefaultStyle, *maxErrors))
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	enc := json.NewEncoder(os.Stderr)
+	enc.SetEscapeHTML(false)
+	for _, d := range diagnose(file, err) {
+		enc.Encode(d)
+	}
+}
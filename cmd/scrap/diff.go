@@ -0,0 +1,22 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/diff"
+)
+
+// diffScraps prints the changes from one scrap to another, each read
+// from a file or fetched by a hash like $sha256~~<hash>.
+func diffScraps(args []string) {
+	if len(args) != 2 {
+		fail(stdin, fmt.Errorf("expected two scraps to diff, by file or hash"))
+	}
+	env := makeEnv()
+	before, after := loadScrap(env, args[0]), loadScrap(env, args[1])
+	for _, c := range diff.Diff(before.Expr(), after.Expr()) {
+		fmt.Println(c)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+// docScrap prints a summary of the API of a scrap, read from stdin, a file
+// or fetched by a hash like $sha256~~<hash>: its header comment, its type,
+// the members of a library and the types of its where-bindings.
+func docScrap(args []string) {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the documentation as JSON")
+	flags.Parse(args)
+
+	env := makeEnv()
+	var scrap *eval.Scrap
+	if flags.NArg() == 0 {
+		scrap = must(env.Read(must(io.ReadAll(os.Stdin))))
+	} else {
+		scrap = loadScrap(env, flags.Arg(0))
+	}
+	doc := must(env.Document(scrap))
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.Encode(doc)
+		return
+	}
+	for _, line := range doc.Comment {
+		fmt.Println(line)
+	}
+	if len(doc.Comment) > 0 {
+		fmt.Println()
+	}
+	fmt.Printf("type: %s\n", doc.Type)
+	if len(doc.Members) > 0 {
+		fmt.Println("members:")
+	}
+	for _, def := range doc.Members {
+		fmt.Printf("  %s : %s\n", def.Name, def.Type)
+	}
+	if len(doc.Definitions) > 0 {
+		fmt.Println("definitions:")
+	}
+	for _, def := range doc.Definitions {
+		fmt.Printf("  %s : %s\n", def.Name, def.Type)
+	}
+}
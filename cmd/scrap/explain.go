@@ -0,0 +1,78 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+// explainScrap prints a summary of a scrap, read from stdin, a file or
+// fetched by a hash like $sha256~~<hash>, for auditing it before running it.
+func explainScrap(args []string) {
+	env := makeEnv()
+	var scrap *eval.Scrap
+	if len(args) == 0 {
+		scrap = must(env.Read(must(io.ReadAll(os.Stdin))))
+	} else {
+		scrap = loadScrap(env, args[0])
+	}
+	ex := must(env.Explain(scrap))
+
+	fmt.Printf("type: %s\n", ex.Type)
+	fmt.Printf("size: %d bytes\n", ex.Size)
+	fmt.Printf("fuel: about %d steps, more if it recurses\n", ex.Fuel)
+	fmt.Printf("imports: %d\n", len(ex.Imports))
+	for _, imp := range ex.Imports {
+		fmt.Printf("  %s\n", imp)
+	}
+	if len(ex.Definitions) > 0 {
+		fmt.Println("definitions:")
+	}
+	for _, def := range ex.Definitions {
+		fmt.Printf("  %s : %s\n", def.Name, def.Type)
+	}
+
+	// Manifests are shown if the yards have one; see push -manifest.
+	if yard, ok := openYards().(yards.ArtifactFetcher); ok {
+		if m, err := eval.FetchManifest(yard, scrap); err == nil {
+			fmt.Println("manifest:")
+			fmt.Printf("  name: %s\n", m.Name)
+			fmt.Printf("  pushed: %s by %s\n", m.Pushed.Format(time.RFC3339), m.Tool)
+			for _, imp := range m.Imports {
+				fmt.Printf("  import: %s\n", imp)
+			}
+		}
+	}
+}
+
+// loadScrap reads a scrap from a file, or fetches it by a hash like
+// $sha256~~<hash>, or a bare sha256 hash that isn't a file.
+func loadScrap(env *eval.Environment, arg string) *eval.Scrap {
+	switch {
+	case strings.HasPrefix(arg, "$"):
+		algo, hash, ok := parseHash(arg)
+		if !ok {
+			fail(arg, fmt.Errorf("expected a hash like $sha256~~<hash>"))
+		}
+		return must(env.Import(algo, hash))
+	case isSha256(arg):
+		if _, err := os.Stat(arg); err != nil {
+			return must(env.Import("sha256", arg))
+		}
+	}
+	return must(env.Read(must(os.ReadFile(arg))))
+}
+
+// isSha256 reports whether s looks like a hex-encoded sha256 hash.
+func isSha256(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && len(s) == 64
+}
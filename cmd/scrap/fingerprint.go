@@ -0,0 +1,28 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// fingerprintScrap prints the hash of the canonical type of a scrap, and
+// the type itself; or for documents, records of definitions, their names
+// and types. CI can compare it with that of the last published version.
+func fingerprintScrap(args []string) {
+	input := must(io.ReadAll(os.Stdin))
+	env := makeEnv()
+	scrap := must(env.Read(input))
+	fp := must(env.Fingerprint(scrap))
+
+	fmt.Println(fp.Hash)
+	if fp.Exports == nil {
+		fmt.Println(fp.Type)
+		return
+	}
+	for _, export := range fp.Exports {
+		fmt.Printf("%s : %s\n", export.Name, export.Type)
+	}
+}
@@ -0,0 +1,44 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/printer"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+var (
+	annotate = flag.Bool("annotate", false, "Annotate where-bindings with their inferred types when formatting")
+)
+
+func formatScrap(args []string) {
+	input := must(io.ReadAll(os.Stdin))
+	src := token.NewSource(input)
+	se := must(parser.Parse(&src))
+
+	var config printer.Config
+	if *annotate {
+		env := makeEnv()
+		scrap := must(env.Read(input))
+		hints := must(env.InlayHints(scrap))
+		config.Annotations = make(map[token.Span]string, len(hints))
+		for _, hint := range hints {
+			config.Annotations[hint.Pos] = hint.Type
+		}
+	}
+
+	// Keep the header, with any shebang and pragmas, as is.
+	if header := se.Header.Pos; header.Len() > 0 {
+		fmt.Println(src.GetString(header))
+	}
+	if err := config.Fprint(os.Stdout, input, se.Expr); err != nil {
+		fail(stdin, err)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,56 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+var (
+	output = flag.String("o", "", "With get, the file to write the scrap to, instead of stdout; with link, the directory to write linked files to")
+)
+
+// getScrap fetches a scrap by a hash like $sha256~~<hash> from the
+// configured yards, checks its hash and writes its source to stdout,
+// or the -o file.
+func getScrap(args []string) {
+	if len(args) != 1 {
+		fail(stdin, fmt.Errorf("expected a hash like $sha256~~<hash>"))
+	}
+	algo, hash, ok := parseHash(args[0])
+	if !ok {
+		fail(stdin, fmt.Errorf("expected a hash like $sha256~~<hash>, got %s", args[0]))
+	}
+
+	fetcher := must(yards.NewDefaultCacheFetcher(openYards()))
+	script := must(yards.FetchHash(fetcher, algo, hash))
+	if sum := must(eval.NewEnvironment().Hash(algo, script)); sum != strings.ToLower(hash) {
+		fail(args[0], yards.ErrWrongHash)
+	}
+
+	if *output == "" {
+		must(os.Stdout.Write(script))
+		return
+	}
+	if err := os.WriteFile(*output, script, 0644); err != nil {
+		fail(*output, err)
+	}
+}
+
+// parseHash parses a hash like $sha256~~<hash>,
+// or the hex-encoded sha256 hash alone.
+func parseHash(s string) (algo, hash string, ok bool) {
+	if rest, ok := strings.CutPrefix(s, "$"); ok {
+		algo, hash, ok = strings.Cut(rest, "~~")
+		_, err := hex.DecodeString(hash)
+		return algo, hash, ok && err == nil
+	}
+	return "sha256", s, isSha256(s)
+}
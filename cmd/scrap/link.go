@@ -0,0 +1,50 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// linkScraps links the local imports of every .scrap file in a directory,
+// like `$local:utils`, to imports by the hashes of the files they name,
+// and prints a manifest of the linked files' hashes. With -o, the linked
+// files are written to another directory, by the same paths.
+func linkScraps(args []string) {
+	if len(args) != 1 {
+		fail(stdin, fmt.Errorf("expected a directory to link"))
+	}
+	dir := args[0]
+
+	files := readDir(makeEnv(), dir)
+	for _, file := range dependencyOrder(files) {
+		func() {
+			defer close(file.done)
+			if !awaitDeps(file) {
+				return
+			}
+			linked, err := link(file)
+			if err == nil && *output != "" {
+				err = writeLinked(*output, dir, file.path, linked)
+			}
+			file.key, file.err = fmt.Sprintf("%x", sha256.Sum256(linked)), err
+		}()
+	}
+	printManifest(files)
+}
+
+// writeLinked writes a linked file to out, by its path relative to dir.
+func writeLinked(out, dir, path string, linked []byte) error {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(out, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, linked, 0644)
+}
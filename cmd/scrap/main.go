@@ -1,13 +1,19 @@
+//go:build !scrap_tiny
+
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
 	"github.com/Victorystick/scrapscript"
 	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/token"
 	"github.com/Victorystick/scrapscript/yards"
 )
 
@@ -20,17 +26,54 @@ type Command struct {
 var commands = []Command{
 	{name: "eval", desc: "evaluates it", fn: evaluate},
 	{name: "type", desc: "infers its type", fn: inferType},
-	{name: "push", desc: "pushes it to the server", fn: pushScrap},
-	{name: "hash", desc: "prints its sha256 hash", fn: hashScrap},
+	{name: "push", desc: "pushes it to the server, or the first configured yard to push to", fn: pushScrap},
+	{name: "hash", desc: "prints its hash; sha256 unless another -algo is given", fn: hashScrap},
+	{name: "repl", desc: "evaluates it line by line; see :save and :load-session", fn: repl},
+	{name: "test", desc: "runs the test cases of the record it evaluates to", fn: testScraps},
+	{name: "opt", desc: "prints it optimized: with constant expressions folded, and unused where-bindings eliminated", fn: optimizeScrap},
+	{name: "parse", desc: "writes its syntax tree in binary, for tools to read; with -json, prints it as JSON", fn: parseScrap},
+	{name: "fmt", desc: "pretty-prints it; with -annotate, with the types of where-bindings", fn: formatScrap},
+	{name: "fingerprint", desc: "prints a hash of its type, and the type or names it exports, to detect API changes", fn: fingerprintScrap},
+	{name: "cache", desc: "with ls, gc or clear, lists, garbage-collects or clears the scraps cached locally; reads no script", fn: manageCache},
+	{name: "vet", desc: "warns about unused bindings, shadowing and unreachable match alternatives", fn: vetScrap},
+	{name: "get", desc: "fetches a scrap by a hash like $sha256~~<hash>, checks it and prints it, or writes it to -o; reads no script", fn: getScrap},
+	{name: "link", desc: "links the $local:<name> imports of the .scrap files in a directory to their hashes, printing a manifest; reads no script", fn: linkScraps},
+	{name: "diff", desc: "prints the changes between two scraps, by file or $sha256~~<hash>, by their syntax; reads no script", fn: diffScraps},
+	{name: "compat", desc: "reports whether the second of two scraps, by file or $sha256~~<hash>, can replace the first by its type; reads no script", fn: compatScraps},
+	{name: "doc", desc: "prints its API: its header comment, type, library members and the types of its where-bindings; of a file or $sha256~~<hash> if given", fn: docScrap},
+	{name: "explain", desc: "summarizes its type, imports, definitions and cost; of a file or $sha256~~<hash> if given", fn: explainScrap},
 }
 
 var (
-	server = flag.String("server", "https://scraps.oseg.dev/", "The scrapyard server to use")
+	server     = flag.String("server", "https://scraps.oseg.dev/", "The scrapyard server to use, instead of the yards of any -config")
+	shareTypes = flag.Bool("share-types", false, "Push the types of imports inferred locally to the yards as type:<key> artifacts")
+	trustTypes = flag.Bool("trust-types", false, "Fetch the types of imports from the yards as type:<key> artifacts, rather than infer them; only for yards trusted not to lie about them")
+	config     = flag.String("config", "", "The config file declaring the yards to use; by default scrapscript/config in the user's config directory")
+	colors     = flag.String("color", "auto", "Whether to color errors: auto, always or never")
+	emit       = flag.String("emit", "value", "What eval prints: the value, or scrap that is checked to evaluate back to it")
+	algo       = flag.String("algo", "sha256", "The hash algorithm hash uses: sha256 or sha512")
+	local      = flag.String("local", ".", "The directory $local:<name> imports read <name>.scrap from")
+	format     = flag.String("output", "text", "How eval prints its result: as text, or as json of the value, its type, the hash of the script and its imports")
+	profile    = flag.Bool("profile", false, "With eval, print how long each where-binding and import took to evaluate, and the memory it allocated, to stderr")
+	verbose    = flag.Bool("verbose", false, "Print record types in errors in full, rather than abbreviating those with many fields")
+	keepCache  = flag.Bool("keep-cache", false, "Remember the values of cache expressions across runs, in the user's cache directory, rather than for one run")
 )
 
 func main() {
 	flag.Parse()
 
+	switch *colors {
+	case "auto":
+		token.DefaultStyle = token.DetectStyle(os.Stderr)
+	case "always":
+		token.DefaultStyle = token.ANSI
+	case "never":
+		token.DefaultStyle = token.Plain
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -color %q; must be auto, always or never\n", *colors)
+		os.Exit(2)
+	}
+
 	name := flag.Arg(0)
 	var cmd *Command
 	for i := range commands {
@@ -56,57 +99,151 @@ func main() {
 
 func must[T any](val T, err error) T {
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fail(stdin, err)
 	}
 	return val
 }
 
+// fail reports an error in file and exits.
+func fail(file string, err error) {
+	report(file, err)
+	os.Exit(1)
+}
+
 func makeEnv() *eval.Environment {
 	env := eval.NewEnvironment()
 
-	pusher := yards.ByHttp(*server)
+	pusher := openYards()
 	env.UsePusher(pusher)
-	env.UseFetcher(must(yards.NewDefaultCacheFetcher(
-		// Don't cache invalid scraps, but trust the local cache for now.
-		yards.Validate(pusher)),
-	))
+	// The cache checks scraps it reads and writes itself.
+	env.UseFetcher(must(yards.NewDefaultCacheFetcher(pusher)))
+	if *shareTypes || *trustTypes {
+		if yard, ok := pusher.(yards.ArtifactFetcher); ok {
+			env.UseTypeCache(yard, *shareTypes, *trustTypes)
+			env.UseObserver(func(ev eval.Event) {
+				if ev.Kind == eval.TypePushed && ev.Err != nil {
+					fmt.Fprintf(os.Stderr, "warning: cannot share the type %s: %v\n", ev.Name, ev.Err)
+				}
+			})
+		}
+	}
+	if *keepCache {
+		env.UseStore(must(yards.NewDefaultStore()))
+	}
+	env.UseLocal(os.DirFS(*local))
+	env.UseVerboseErrors(*verbose)
 	return env
 }
 
+// openYards returns the yards of the config file, if there is one,
+// unless a -server is given.
+func openYards() yards.FetchPusher {
+	serverSet := false
+	flag.Visit(func(f *flag.Flag) {
+		serverSet = serverSet || f.Name == "server"
+	})
+	if serverSet {
+		return yards.ByHttp(*server)
+	}
+
+	path := *config
+	if path == "" {
+		path = must(yards.DefaultConfigPath())
+	}
+	c, err := yards.LoadConfig(path)
+	if errors.Is(err, fs.ErrNotExist) && *config == "" {
+		return yards.ByHttp(*server)
+	}
+	return must(yards.FromConfig(must(c, err)))
+}
+
 func evaluate(args []string) {
-	input := must(io.ReadAll(os.Stdin))
+	var input []byte
+	if len(args) == 1 && args[0] != "apply" {
+		// Executable scraps are passed by their path.
+		input = must(os.ReadFile(args[0]))
+	} else {
+		input = must(io.ReadAll(os.Stdin))
+	}
+	if *optimize {
+		input = optimized(input)
+	}
 	env := makeEnv()
+	if *profile {
+		p := new(eval.Profile)
+		env.UseProfile(p)
+		defer p.Write(os.Stderr)
+	}
 	scrap := must(env.Read(input))
 	val := must(env.Eval(scrap))
 
-	if len(args) >= 2 && args[0] == "apply" {
-		scrap = must(env.Read([]byte(args[1])))
-		fn := must(env.Eval(scrap))
+	applied := len(args) >= 2 && args[0] == "apply"
+	if applied {
+		fn := must(env.Eval(must(env.Read([]byte(args[1])))))
 		val = must(scrapscript.Call(fn, val))
 	}
 
-	fmt.Println(env.Scrap(val))
+	switch *format {
+	case "text":
+	case "json":
+		// The type of the result of applying a function is that of the value.
+		typ := env.TypeOf(val)
+		if !applied {
+			typ = must(env.Infer(scrap))
+		}
+		// Scripts without imports have an empty list of them, not null.
+		imports := append([]string{}, scrap.Imports()...)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.Encode(evalResult{
+			Value:   must(env.JSON(val)),
+			Type:    typ,
+			Hash:    scrap.Sha256(),
+			Imports: imports,
+		})
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -output %q; must be text or json\n", *format)
+		os.Exit(2)
+	}
+
+	switch *emit {
+	case "value":
+		fmt.Println(env.Scrap(val))
+	case "scrap":
+		fmt.Println(must(env.EmitScrap(val)))
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -emit %q; must be value or scrap\n", *emit)
+		os.Exit(2)
+	}
 }
 
-func inferType(args []string) {
-	input := must(io.ReadAll(os.Stdin))
-	env := makeEnv()
-	scrap := must(env.Read(input))
-	fmt.Println(must(env.Infer(scrap)))
+// The result of eval with -output json.
+type evalResult struct {
+	Value json.RawMessage `json:"value"`
+	Type  string          `json:"type"`
+	// Of the script, rather than the value.
+	Hash    string   `json:"hash"`
+	Imports []string `json:"imports"`
 }
 
-func pushScrap(args []string) {
+func inferType(args []string) {
 	input := must(io.ReadAll(os.Stdin))
 	env := makeEnv()
 	scrap := must(env.Read(input))
-	key := must(env.Push(scrap))
-	fmt.Println(key)
+	fmt.Println(must(env.Infer(scrap)))
 }
 
 func hashScrap(args []string) {
+	flags := flag.NewFlagSet("hash", flag.ExitOnError)
+	canonical := flags.Bool("canonical", false, "Hash the scrap in canonical form, as push -canonical pushes it")
+	flags.Parse(args)
+
 	input := must(io.ReadAll(os.Stdin))
 	env := makeEnv()
 	scrap := must(env.Read(input))
-	fmt.Println(scrap.Sha256())
+	if *canonical {
+		input = must(scrap.Canonical())
+	}
+	fmt.Println(must(env.Hash(*algo, input)))
 }
@@ -0,0 +1,30 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Victorystick/scrapscript/optimizer"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+var (
+	optimize = flag.Bool("O", false, "With eval, optimize the script like opt before evaluating it")
+)
+
+func optimizeScrap(args []string) {
+	input := must(io.ReadAll(os.Stdin))
+	fmt.Println(string(optimized(input)))
+}
+
+// optimized returns the source of a script, optimized.
+func optimized(input []byte) []byte {
+	src := token.NewSource(input)
+	se := must(parser.Parse(&src))
+	return must(optimizer.Optimize(se))
+}
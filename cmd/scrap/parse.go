@@ -0,0 +1,30 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// parseScrap writes the syntax tree of a script, with its source, in the
+// binary format of ast.SourceExpr, or with -json as JSON.
+func parseScrap(args []string) {
+	flags := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "Print the syntax tree as JSON, rather than in binary")
+	flags.Parse(args)
+
+	input := must(io.ReadAll(os.Stdin))
+	src := token.NewSource(input)
+	se := must(parser.Parse(&src))
+	if *asJSON {
+		data := must(se.MarshalJSON())
+		os.Stdout.Write(append(data, '\n'))
+		return
+	}
+	os.Stdout.Write(must(se.MarshalBinary()))
+}
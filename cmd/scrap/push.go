@@ -0,0 +1,267 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+// pushScrap pushes the scrap read from stdin, or with -r, every .scrap
+// file in a directory.
+func pushScrap(args []string) {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "Push every .scrap file in the directory given, imports first, and print a manifest of their hashes")
+	jobs := flags.Int("j", 4, "With -r, how many scraps to push at once")
+	manifest := flags.Bool("manifest", false, "Also push a manifest of each scrap, with the version of scrap, the time, its -name and imports, for explain to show")
+	name := flags.String("name", "", "With -manifest, the name to declare the scrap by; with -r, the paths of the files are")
+	canonical := flags.Bool("canonical", false, "Push scraps in canonical form, without comments and formatted, so that formatting doesn't change their hashes")
+	flags.Parse(args)
+
+	if *recursive {
+		if flags.NArg() != 1 {
+			fail(stdin, fmt.Errorf("expected a directory to push"))
+		}
+		pushDir(flags.Arg(0), *jobs, *manifest, *canonical)
+		return
+	}
+
+	input := must(io.ReadAll(os.Stdin))
+	env := makeEnv()
+	scrap := must(env.Read(input))
+	if *canonical {
+		scrap = must(env.Read(must(scrap.Canonical())))
+	}
+	key := must(env.Push(scrap))
+	if *manifest {
+		if err := pushManifest(env, scrap, *name); err != nil {
+			fail(stdin, err)
+		}
+	}
+	fmt.Println(key)
+}
+
+// pushManifest pushes the manifest of a pushed scrap, declared by name.
+func pushManifest(env *eval.Environment, scrap *eval.Scrap, name string) error {
+	tool := "scrap"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		tool += " " + info.Main.Version
+	}
+	return env.PushManifest(scrap, eval.Manifest{
+		Tool:    tool,
+		Pushed:  time.Now(),
+		Name:    name,
+		Imports: scrap.Imports(),
+	})
+}
+
+// A pushed file of a directory.
+type pushed struct {
+	path  string
+	name  string // Like $sha256~~<hash>, once read.
+	local string // The name local imports import it by, like $local:<name>.
+	scrap *eval.Scrap
+	deps  []*pushed // The other files it imports.
+	key   string
+	err   error
+	done  chan struct{} // Closed once pushed, or failed.
+}
+
+// pushDir pushes the .scrap files of dir with a pool of workers, each file
+// after those it imports, and prints a JSON manifest from their paths to
+// their hashes. Local imports are linked to the hashes of the files they
+// name. Files that fail, or import ones that did, are reported;
+// the others are pushed anyway. Files are pushed in canonical form,
+// once linked, if canonical is set.
+func pushDir(dir string, workers int, manifest, canonical bool) {
+	env := makeEnv()
+	files := readDir(env, dir)
+
+	// Files are queued in order, so that workers only wait for imports
+	// queued earlier.
+	queue := make(chan *pushed)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func(env *eval.Environment) {
+			defer wg.Done()
+			for file := range queue {
+				push(env, file, manifest, canonical)
+			}
+		}(env.Clone())
+	}
+	for _, file := range dependencyOrder(files) {
+		queue <- file
+	}
+	close(queue)
+	wg.Wait()
+
+	printManifest(files)
+}
+
+// readDir reads the .scrap files of dir, and which of them each imports.
+func readDir(env *eval.Environment, dir string) []*pushed {
+	var files []*pushed
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".scrap" {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		file := &pushed{
+			path:  path,
+			local: strings.TrimSuffix(filepath.ToSlash(rel), ".scrap"),
+			done:  make(chan struct{}),
+		}
+		if input, err := os.ReadFile(path); err != nil {
+			file.err = err
+		} else {
+			file.name = fmt.Sprintf("$sha256~~%x", sha256.Sum256(input))
+			file.scrap, file.err = env.Read(input)
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		fail(dir, err)
+	}
+
+	byName := make(map[string]*pushed, 2*len(files))
+	for _, file := range files {
+		if file.name != "" {
+			byName[file.name] = file
+		}
+		byName["$local:"+file.local] = file
+	}
+	for _, file := range files {
+		if file.err == nil {
+			for _, name := range file.scrap.Imports() {
+				if dep, ok := byName[name]; ok {
+					file.deps = append(file.deps, dep)
+				}
+			}
+		}
+	}
+	return files
+}
+
+// printManifest prints a JSON manifest from the paths of files to their
+// hashes, reporting those that failed instead, and exits with status 1
+// if any did.
+func printManifest(files []*pushed) {
+	manifest := make(map[string]string, len(files))
+	failed := false
+	for _, file := range files {
+		if file.err != nil {
+			report(file.path, fmt.Errorf("%s: %w", file.path, file.err))
+			failed = true
+		} else {
+			manifest[file.path] = file.key
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(manifest)
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// push pushes a file once the files it imports are, in canonical form
+// and with its manifest if asked to.
+func push(env *eval.Environment, file *pushed, manifest, canonical bool) {
+	defer close(file.done)
+	if !awaitDeps(file) {
+		return
+	}
+	var linked []byte
+	var scrap *eval.Scrap
+	linked, file.err = link(file)
+	if file.err == nil {
+		scrap, file.err = env.Read(linked)
+	}
+	if file.err == nil && canonical {
+		linked, file.err = scrap.Canonical()
+		if file.err == nil {
+			scrap, file.err = env.Read(linked)
+		}
+	}
+	if file.err == nil {
+		file.key, file.err = env.Push(scrap)
+	}
+	if file.err == nil && manifest {
+		file.err = pushManifest(env, scrap, file.local)
+	}
+}
+
+// awaitDeps waits for the files a file imports,
+// and reports whether they, and the file, are fine.
+func awaitDeps(file *pushed) bool {
+	if file.err != nil {
+		return false
+	}
+	for _, dep := range file.deps {
+		<-dep.done
+		if dep.err != nil {
+			file.err = fmt.Errorf("imports %s, which failed", dep.path)
+			return false
+		}
+	}
+	return true
+}
+
+// link returns the source of a file with its local imports
+// linked to the hashes of the files they name.
+func link(file *pushed) ([]byte, error) {
+	hashes := make(map[string]string, len(file.deps))
+	for _, dep := range file.deps {
+		hashes[dep.local] = dep.key
+	}
+	return file.scrap.Link(hashes)
+}
+
+// dependencyOrder returns files sorted such that each comes after the
+// files it imports. Imports by hash can't be cyclic, but local ones can;
+// files importing themselves through others fail.
+func dependencyOrder(files []*pushed) []*pushed {
+	order := make([]*pushed, 0, len(files))
+	visiting := make(map[*pushed]bool, len(files))
+	visited := make(map[*pushed]bool, len(files))
+	var visit func(file *pushed)
+	visit = func(file *pushed) {
+		if visited[file] {
+			return
+		}
+		visited[file] = true
+		visiting[file] = true
+		for _, dep := range file.deps {
+			if visiting[dep] {
+				file.err = fmt.Errorf("imports itself through %s", dep.path)
+				// Not to wait for dep, which waits for file.
+				file.deps = nil
+				break
+			}
+			visit(dep)
+		}
+		visiting[file] = false
+		order = append(order, file)
+	}
+	for _, file := range files {
+		visit(file)
+	}
+	return order
+}
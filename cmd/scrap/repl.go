@@ -0,0 +1,229 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/printer"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// A binding of the form `name = expr` entered in the REPL.
+var bindingLine = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_/-]*)\s*(:[^=]*)?=\s*([^=\s].*)$`)
+
+type binding struct {
+	name string
+	def  string // The printed definition, e.g. `a : int = 1`.
+}
+
+// A session holds the bindings defined in a REPL.
+type session struct {
+	bindings []binding
+}
+
+// define adds a binding, replacing any earlier one with the same name.
+func (s *session) define(b binding) {
+	for i := range s.bindings {
+		if s.bindings[i].name == b.name {
+			s.bindings[i] = b
+			return
+		}
+	}
+	s.bindings = append(s.bindings, b)
+}
+
+// scrap renders expr with all bindings of the session in scope.
+//
+// The bindings of a where-chain are visible to those before it,
+// so later bindings are written first.
+func (s *session) scrap(expr string) string {
+	var b strings.Builder
+	b.WriteString(expr)
+	for i := len(s.bindings) - 1; i >= 0; i-- {
+		b.WriteString("\n; ")
+		b.WriteString(s.bindings[i].def)
+	}
+	return b.String()
+}
+
+// save renders the session as a scrap evaluating to a record of its
+// bindings, so that they can be reached through its hash once pushed.
+func (s *session) save() string {
+	if len(s.bindings) == 0 {
+		return s.scrap("{}")
+	}
+	names := make([]string, len(s.bindings))
+	for i, b := range s.bindings {
+		names[i] = fmt.Sprintf("%s = %s", b.name, b.name)
+	}
+	return s.scrap("{ " + strings.Join(names, ", ") + " }")
+}
+
+// enter defines the bindings of a line of the form `name = expr`.
+func (s *session) enter(line string) error {
+	return s.load([]byte("{}\n; " + line))
+}
+
+// load reads the bindings of a where-chained scrap into the session.
+func (s *session) load(script []byte) error {
+	src := token.NewSource(script)
+	se, err := parser.Parse(&src)
+	if err != nil {
+		return err
+	}
+
+	// The outermost binding was defined first.
+	x := se.Expr
+	for {
+		where, ok := x.(*ast.WhereExpr)
+		if !ok {
+			return nil
+		}
+		def, err := printBinding(&src, where)
+		if err != nil {
+			return err
+		}
+		s.define(binding{name: src.GetString(where.Id.Pos), def: def})
+		x = where.Expr
+	}
+}
+
+// printBinding prints the definition of a where-binding, like `a = 1`,
+// without the expression it's bound in.
+func printBinding(src *token.Source, where *ast.WhereExpr) (string, error) {
+	var b strings.Builder
+	config := printer.Config{Replacements: map[token.Span]string{where.Expr.Span(): ""}}
+	if err := config.Fprint(&b, src.Bytes(), where); err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(b.String(), "\n; "), nil
+}
+
+func repl(args []string) {
+	env := makeEnv()
+	// Only bindings that changed are inferred again by :type.
+	env.UseIncremental(true)
+	var s session
+
+	run := func(script string) (string, error) {
+		scrap, err := env.Read([]byte(script))
+		if err != nil {
+			return "", err
+		}
+		val, err := env.Eval(scrap)
+		if err != nil {
+			return "", err
+		}
+		return env.Scrap(val), nil
+	}
+
+	in := bufio.NewScanner(os.Stdin)
+	for fmt.Fprint(os.Stderr, "> "); in.Scan(); fmt.Fprint(os.Stderr, "> ") {
+		line := strings.TrimSpace(in.Text())
+		command, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+
+		switch {
+		case line == "":
+			continue
+
+		case command == ":quit":
+			return
+
+		case command == ":save":
+			err := os.WriteFile(arg, []byte(s.save()), 0644)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+		case command == ":load-session":
+			script, err := os.ReadFile(arg)
+			if err == nil {
+				err = s.load(script)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+		case command == ":type":
+			scrap, err := env.Read([]byte(s.scrap(arg)))
+			var typ string
+			if err == nil {
+				typ, err = env.Infer(scrap)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			fmt.Println(typ)
+
+		case command == ":captured":
+			// Show what a function closes over, for debugging.
+			scrap, err := env.Read([]byte(s.scrap(arg)))
+			var val eval.Value
+			if err == nil {
+				val, err = env.Eval(scrap)
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			fn, ok := val.(eval.ScriptFunc)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "%s isn't a function defined in a scrap\n", arg)
+				continue
+			}
+			captured, err := fn.Captured()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			for _, b := range captured {
+				fmt.Printf("%s = %s\n", b.Name(), env.Scrap(b.Value()))
+			}
+
+		case command == ":push":
+			scrap, err := env.Read([]byte(s.save()))
+			if err == nil {
+				var key string
+				if key, err = env.Push(scrap); err == nil {
+					fmt.Println(key)
+				}
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+		case bindingLine.MatchString(line):
+			name := bindingLine.FindStringSubmatch(line)[1]
+			// Only keep bindings that evaluate.
+			var next session
+			next.bindings = append(next.bindings, s.bindings...)
+			if err := next.enter(line); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if _, err := run(next.scrap(name)); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			s = next
+
+		default:
+			out, err := run(s.scrap(line))
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			fmt.Println(out)
+		}
+	}
+}
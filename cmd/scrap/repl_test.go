@@ -0,0 +1,73 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+// A yard keeping scraps in memory.
+type memoryYard map[string][]byte
+
+func (y memoryYard) FetchSha256(key string) ([]byte, error) {
+	if data, ok := y[key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("no scrap %s", key)
+}
+
+func (y memoryYard) PushScrap(data []byte) (string, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256(data))
+	y[key] = data
+	return key, nil
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	var s session
+	for _, line := range []string{"a=1", "f : int -> int = x -> x+a", "a = 2", "g = | 0 -> a | n -> f n"} {
+		if err := s.enter(line); err != nil {
+			t.Fatalf("%s: %s", line, err)
+		}
+	}
+
+	saved := s.save()
+	expected := "{ a = a, f = f, g = g }\n" +
+		"; g =\n  | 0 -> a\n  | n -> f n\n" +
+		"; f : int -> int = x -> x + a\n" +
+		"; a = 2"
+	if saved != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, saved)
+	}
+
+	var loaded session
+	if err := loaded.load([]byte(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if again := loaded.save(); again != saved {
+		t.Errorf("Expected the loaded session to save the same, got:\n%s", again)
+	}
+
+	env := eval.NewEnvironment()
+	yard := memoryYard{}
+	env.UsePusher(yard)
+	env.UseFetcher(yard)
+	scrap, err := env.Read([]byte(loaded.save()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := env.Push(scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scrap, err = env.Read([]byte(fmt.Sprintf("$sha256~~%s.g 3", key)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := env.Eval(scrap); err != nil || val.String() != "5" {
+		t.Errorf("Expected the pushed session's g 3 to be 5, got %v, %v", val, err)
+	}
+}
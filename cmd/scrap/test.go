@@ -0,0 +1,157 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+var (
+	testFuel = flag.Int("fuel", 1_000_000, "The maximum number of evaluation steps of each test case")
+)
+
+// A case of a test suite.
+type testCase struct {
+	name string
+	// A scrap evaluating to a record `{ expect = ..., actual = ... }`.
+	source string
+}
+
+// testCases splits a test suite into its cases.
+//
+// A test suite is a scrap evaluating to a record of cases, optionally
+// followed by where-bindings. Each case is given the same bindings,
+// but evaluated on its own.
+func testCases(script []byte) ([]testCase, error) {
+	src := token.NewSource(script)
+	se, err := parser.Parse(&src)
+	if err != nil {
+		return nil, err
+	}
+
+	x := se.Expr
+	for {
+		where, ok := x.(*ast.WhereExpr)
+		if !ok {
+			break
+		}
+		x = where.Expr
+	}
+
+	record, ok := x.(*ast.RecordExpr)
+	if !ok || record.Rest != nil {
+		return nil, src.Error(x.Span(), "a test suite must be a record of test cases")
+	}
+
+	cases := make([]testCase, len(record.Entries))
+	for i, e := range record.Entries {
+		cases[i] = testCase{
+			name:   src.GetString(e.Key.Pos),
+			source: isolate(script, record.Pos.End, e.Val.Span()),
+		}
+	}
+	return cases, nil
+}
+
+// isolate blanks out everything but span and the bindings following end,
+// keeping line breaks so errors point at the same positions in script.
+// The span is wrapped in parentheses, in place of the bytes around it.
+func isolate(script []byte, end int, span token.Span) string {
+	source := []byte(string(script))
+	for i := range end {
+		if (i < span.Start || i >= span.End) && source[i] != '\n' {
+			source[i] = ' '
+		}
+	}
+	source[span.Start-1] = '('
+	source[span.End] = ')'
+	return string(source)
+}
+
+// run evaluates a test case, returning an error if it fails.
+func (tc testCase) run(env *eval.Environment) error {
+	env = env.Clone()
+	env.UseFuel(*testFuel)
+
+	scrap, err := env.Read([]byte(tc.source))
+	if err != nil {
+		return err
+	}
+	val, err := env.Eval(scrap)
+	if err != nil {
+		return err
+	}
+
+	record, ok := val.(eval.Record)
+	if !ok {
+		return fmt.Errorf("expected a record with expect and actual, got %s", env.Scrap(val))
+	}
+	expect, ok := record.Get("expect")
+	if !ok {
+		return errors.New("missing expect")
+	}
+	actual, ok := record.Get("actual")
+	if !ok {
+		return errors.New("missing actual")
+	}
+	if eq, err := eval.Equals(expect, actual); err != nil {
+		return err
+	} else if !eq {
+		return fmt.Errorf("- %s\n+ %s", env.Scrap(expect), env.Scrap(actual))
+	}
+	return nil
+}
+
+func testScraps(args []string) {
+	env := makeEnv()
+
+	files := args
+	scripts := make([][]byte, len(files))
+	if len(args) == 0 {
+		files = []string{stdin}
+		scripts = append(scripts, must(io.ReadAll(os.Stdin)))
+	}
+	for i, name := range args {
+		script, err := os.ReadFile(name)
+		if err != nil {
+			fail(name, err)
+		}
+		scripts[i] = script
+	}
+
+	passed, failed := 0, 0
+	for i, script := range scripts {
+		cases, err := testCases(script)
+		if err != nil {
+			fail(files[i], err)
+		}
+		for _, tc := range cases {
+			if err := tc.run(env); err != nil {
+				failed += 1
+				if *jsonDiagnostics {
+					fmt.Printf("FAIL %s\n", tc.name)
+					report(files[i], err)
+				} else {
+					fmt.Printf("FAIL %s\n%s\n", tc.name, err)
+				}
+			} else {
+				passed += 1
+				fmt.Printf("PASS %s\n", tc.name)
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
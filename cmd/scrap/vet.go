@@ -0,0 +1,34 @@
+//go:build !scrap_tiny
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// vetScrap prints the warnings of eval.Environment.Vet about a scrap,
+// as JSON diagnostics if requested, and fails if there are any.
+func vetScrap(args []string) {
+	input := must(io.ReadAll(os.Stdin))
+	env := makeEnv()
+	scrap := must(env.Read(input))
+	warnings := env.Vet(scrap)
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	for _, w := range warnings {
+		if *jsonDiagnostics {
+			d := at(stdin, w)
+			d.Severity = "warning"
+			enc.Encode(d)
+		} else {
+			fmt.Printf("%s:%d:%d: %s\n", stdin, w.Pos.Line, w.Pos.Column, w.Msg)
+		}
+	}
+	if len(warnings) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,614 @@
+package diff
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// An Op is the kind of a Change.
+type Op int
+
+const (
+	Changed Op = iota
+	Added
+	Removed
+	Renamed
+)
+
+// A Change is a difference between two versions of a scrap.
+type Change struct {
+	Op Op
+	// What changed, like "binding", "literal" or "match alternative".
+	What string
+	// The source of what changed, before and after; Before is empty if it
+	// was added, and After if it was removed. Renamed things are given by
+	// their names.
+	Before, After string
+	// Where what changed is in each version, if it's in it.
+	BeforePos, AfterPos token.Position
+}
+
+// String formats a Change on one line, like
+// `-3:5 +3:5 changed literal 1 to 2`, with the line and column of what
+// changed before and after.
+func (c Change) String() string {
+	var b strings.Builder
+	if c.Op != Added {
+		fmt.Fprintf(&b, "-%d:%d ", c.BeforePos.Line, c.BeforePos.Column)
+	}
+	if c.Op != Removed {
+		fmt.Fprintf(&b, "+%d:%d ", c.AfterPos.Line, c.AfterPos.Column)
+	}
+	switch c.Op {
+	case Added:
+		fmt.Fprintf(&b, "added %s %s", c.What, c.After)
+	case Removed:
+		fmt.Fprintf(&b, "removed %s %s", c.What, c.Before)
+	case Renamed:
+		fmt.Fprintf(&b, "renamed %s %s to %s", c.What, c.Before, c.After)
+	default:
+		fmt.Fprintf(&b, "changed %s %s to %s", c.What, c.Before, c.After)
+	}
+	return b.String()
+}
+
+// The longest source of a Change, in runes; longer ones are cut short.
+const maxText = 40
+
+// Diff returns the changes from one version of a scrap to another, in
+// the order they're found: the expression of a where-chain before its
+// bindings, and those in the order of the later version, followed by
+// those that were removed.
+//
+// Bindings are compared by name, but bindings that were renamed, with
+// the same values otherwise, are reported as renamed; and uses of them
+// by their new names aren't changes. Parameters of functions and names
+// bound by patterns are compared likewise. Match alternatives are
+// compared by their patterns, fields of records and tags of enums by
+// their names, and elements of lists by their longest common subsequence.
+// Other expressions that differ are reported as changed as a whole.
+func Diff(before, after ast.SourceExpr) []Change {
+	d := differ{before: &before.Source, after: &after.Source}
+	d.expr(before.Expr, after.Expr, nil)
+	return d.changes
+}
+
+type differ struct {
+	before, after *token.Source
+	changes       []Change
+}
+
+// renames maps the names of bindings before to their names after,
+// of those in scope that were renamed.
+type renames map[string]string
+
+// with returns renames, with names bound from before to after.
+func (r renames) with(before, after []string) renames {
+	r = maps.Clone(r)
+	if r == nil {
+		r = make(renames, len(before))
+	}
+	for i, name := range before {
+		r[name] = after[i]
+	}
+	return r
+}
+
+// name returns what a name before is named after.
+func (r renames) name(name string) string {
+	if renamed, ok := r[name]; ok {
+		return renamed
+	}
+	return name
+}
+
+// report adds a change between the spans of two versions, either of
+// which is nil if absent.
+func (d *differ) report(op Op, what string, before, after *token.Span) {
+	c := Change{Op: op, What: what}
+	if before != nil {
+		c.Before, c.BeforePos = text(d.before, *before), d.before.GetPosition(before.Start)
+	}
+	if after != nil {
+		c.After, c.AfterPos = text(d.after, *after), d.after.GetPosition(after.Start)
+	}
+	d.changes = append(d.changes, c)
+}
+
+// span returns the span of a node, for report.
+func span(n ast.Node) *token.Span {
+	s := n.Span()
+	return &s
+}
+
+// text returns the source of a span on one line, cut short if long.
+func text(source *token.Source, s token.Span) string {
+	t := strings.Join(strings.Fields(source.GetString(s)), " ")
+	if utf8.RuneCountInString(t) > maxText {
+		t = string([]rune(t)[:maxText-1]) + "…"
+	}
+	return t
+}
+
+func (d *differ) beforeName(id *ast.Ident) string {
+	return d.before.GetString(id.Pos)
+}
+
+func (d *differ) afterName(id *ast.Ident) string {
+	return d.after.GetString(id.Pos)
+}
+
+// patternNames returns the names a pattern binds, before or after.
+func patternNames(source *token.Source, x ast.Expr) (names []string) {
+	for _, id := range ast.PatternNames(x) {
+		names = append(names, source.GetString(id.Pos))
+	}
+	return
+}
+
+// equal reports whether two expressions are the same, but for the names
+// of bindings renamed outside of them.
+func (d *differ) equal(a, b ast.Expr, r renames) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	switch a := a.(type) {
+	case *ast.Ident:
+		b, ok := b.(*ast.Ident)
+		return ok && r.name(d.beforeName(a)) == d.afterName(b)
+	case *ast.Literal:
+		b, ok := b.(*ast.Literal)
+		return ok && a.Kind == b.Kind && d.before.GetString(a.Pos) == d.after.GetString(b.Pos)
+	case *ast.BinaryExpr:
+		b, ok := b.(*ast.BinaryExpr)
+		return ok && a.Op == b.Op && d.equal(a.Left, b.Left, r) && d.equal(a.Right, b.Right, r)
+	case *ast.FuncExpr:
+		b, ok := b.(*ast.FuncExpr)
+		return ok && d.equalFunc(a, b, r)
+	case ast.MatchFuncExpr:
+		b, ok := b.(ast.MatchFuncExpr)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !d.equalFunc(a[i], b[i], r) {
+				return false
+			}
+		}
+		return true
+	case *ast.CallExpr:
+		b, ok := b.(*ast.CallExpr)
+		return ok && d.equal(a.Fn, b.Fn, r) && d.equal(a.Arg, b.Arg, r)
+	case *ast.VariantExpr:
+		b, ok := b.(*ast.VariantExpr)
+		return ok && d.beforeName(&a.Tag) == d.afterName(&b.Tag) && d.equal(a.Typ, b.Typ, r)
+	case ast.EnumExpr:
+		b, ok := b.(ast.EnumExpr)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !d.equal(a[i], b[i], r) {
+				return false
+			}
+		}
+		return true
+	case *ast.RecordExpr:
+		b, ok := b.(*ast.RecordExpr)
+		if !ok || len(a.Entries) != len(b.Entries) || !d.equal(a.Rest, b.Rest, r) {
+			return false
+		}
+		for i, ae := range a.Entries {
+			if !d.equalEntry(ae, b.Entries[i], r) {
+				return false
+			}
+		}
+		return true
+	case *ast.AccessExpr:
+		b, ok := b.(*ast.AccessExpr)
+		return ok && d.beforeName(&a.Key) == d.afterName(&b.Key) && d.equal(a.Rec, b.Rec, r)
+	case *ast.ListExpr:
+		b, ok := b.(*ast.ListExpr)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !d.equal(a.Elements[i], b.Elements[i], r) {
+				return false
+			}
+		}
+		return true
+	case *ast.WhereExpr:
+		b, ok := b.(*ast.WhereExpr)
+		if !ok {
+			return false
+		}
+		name := d.beforeName(&a.Id)
+		inner := r.with([]string{name}, []string{name})
+		return name == d.afterName(&b.Id) && d.equal(a.Expr, b.Expr, inner) && d.equal(a.Typ, b.Typ, r) && d.equal(a.Val, b.Val, inner)
+	case *ast.ImportExpr:
+		b, ok := b.(*ast.ImportExpr)
+		return ok && d.before.GetString(a.Pos) == d.after.GetString(b.Pos)
+	}
+	return false
+}
+
+// equalFunc reports whether two functions are the same, but for renames;
+// their patterns bind the same names.
+func (d *differ) equalFunc(a, b *ast.FuncExpr, r renames) bool {
+	names := patternNames(d.before, a.Arg)
+	if !slices.Equal(names, patternNames(d.after, b.Arg)) {
+		return false
+	}
+	// The names shadow any renamed.
+	inner := r.with(names, names)
+	return d.equal(a.Arg, b.Arg, inner) && d.equal(a.Body, b.Body, inner)
+}
+
+// bindPatterns returns renames with the names bound by two patterns, and
+// whether the patterns are the same but for the names they bind.
+func (d *differ) bindPatterns(a, b ast.Expr, r renames) (renames, bool) {
+	an, bn := patternNames(d.before, a), patternNames(d.after, b)
+	if len(an) != len(bn) {
+		return r, false
+	}
+	inner := r.with(an, bn)
+	return inner, d.equal(a, b, inner)
+}
+
+func (d *differ) equalEntry(a, b ast.RecordEntry, r renames) bool {
+	return d.beforeName(&a.Key) == d.afterName(&b.Key) &&
+		a.Extend == b.Extend && a.Drop == b.Drop && a.Type == b.Type &&
+		d.equal(a.Val, b.Val, r)
+}
+
+// optional reports the changes between two expressions either of which
+// may be absent, like the type annotations of bindings.
+func (d *differ) optional(what string, a, b ast.Expr, r renames) {
+	switch {
+	case a == nil && b == nil:
+	case a == nil:
+		d.report(Added, what, nil, span(b))
+	case b == nil:
+		d.report(Removed, what, span(a), nil)
+	default:
+		d.expr(a, b, r)
+	}
+}
+
+// expr reports the changes between two expressions.
+func (d *differ) expr(a, b ast.Expr, r renames) {
+	if d.equal(a, b, r) {
+		return
+	}
+	switch a := a.(type) {
+	case *ast.WhereExpr:
+		if b, ok := b.(*ast.WhereExpr); ok {
+			d.chain(a, b, r)
+			return
+		}
+	case ast.MatchFuncExpr:
+		if b, ok := b.(ast.MatchFuncExpr); ok {
+			d.match(a, b, r)
+			return
+		}
+	case *ast.FuncExpr:
+		if b, ok := b.(*ast.FuncExpr); ok {
+			d.function(a, b, r)
+			return
+		}
+	case *ast.RecordExpr:
+		if b, ok := b.(*ast.RecordExpr); ok && a.IsType() == b.IsType() {
+			d.record(a, b, r)
+			return
+		}
+	case *ast.ListExpr:
+		if b, ok := b.(*ast.ListExpr); ok {
+			d.list(a, b, r)
+			return
+		}
+	case ast.EnumExpr:
+		if b, ok := b.(ast.EnumExpr); ok {
+			d.enum(a, b, r)
+			return
+		}
+	case *ast.VariantExpr:
+		if b, ok := b.(*ast.VariantExpr); ok && d.beforeName(&a.Tag) == d.afterName(&b.Tag) {
+			d.optional("value of #"+d.afterName(&b.Tag), a.Typ, b.Typ, r)
+			return
+		}
+	case *ast.BinaryExpr:
+		b, ok := b.(*ast.BinaryExpr)
+		if ok && a.Op == b.Op {
+			d.expr(a.Left, b.Left, r)
+			d.expr(a.Right, b.Right, r)
+			return
+		}
+		if ok && d.equal(a.Left, b.Left, r) && d.equal(a.Right, b.Right, r) {
+			d.report(Changed, "operator", span(a), span(b))
+			c := &d.changes[len(d.changes)-1]
+			c.Before, c.After = a.Op.Op(), b.Op.Op()
+			return
+		}
+	case *ast.CallExpr:
+		if b, ok := b.(*ast.CallExpr); ok {
+			d.expr(a.Fn, b.Fn, r)
+			d.expr(a.Arg, b.Arg, r)
+			return
+		}
+	case *ast.AccessExpr:
+		if b, ok := b.(*ast.AccessExpr); ok && d.beforeName(&a.Key) == d.afterName(&b.Key) {
+			d.expr(a.Rec, b.Rec, r)
+			return
+		}
+	case *ast.Literal:
+		if _, ok := b.(*ast.Literal); ok {
+			d.report(Changed, "literal", span(a), span(b))
+			return
+		}
+	case *ast.Ident:
+		if _, ok := b.(*ast.Ident); ok {
+			d.report(Changed, "name", span(a), span(b))
+			return
+		}
+	case *ast.ImportExpr:
+		if _, ok := b.(*ast.ImportExpr); ok {
+			d.report(Changed, "import", span(a), span(b))
+			return
+		}
+	}
+	d.report(Changed, "expression", span(a), span(b))
+}
+
+// function reports the changes between two functions. Names bound by
+// their patterns that were renamed are reported as renamed parameters.
+func (d *differ) function(a, b *ast.FuncExpr, r renames) {
+	inner, ok := d.bindPatterns(a.Arg, b.Arg, r)
+	if ok {
+		ai, bi := ast.PatternNames(a.Arg), ast.PatternNames(b.Arg)
+		for i := range ai {
+			if d.beforeName(ai[i]) != d.afterName(bi[i]) {
+				d.report(Renamed, "parameter", span(ai[i]), span(bi[i]))
+			}
+		}
+	} else {
+		d.report(Changed, "pattern", span(a.Arg), span(b.Arg))
+		// The names bound by the patterns shadow any renamed.
+		names := patternNames(d.before, a.Arg)
+		inner = r.with(names, names)
+	}
+	d.expr(a.Body, b.Body, inner)
+}
+
+// match reports the changes between the alternatives of two match
+// functions, which are paired by their patterns.
+func (d *differ) match(a, b ast.MatchFuncExpr, r renames) {
+	used := make([]bool, len(a))
+	last, reordered := -1, false
+	for _, bf := range b {
+		paired := false
+		for i, af := range a {
+			if _, ok := d.bindPatterns(af.Arg, bf.Arg, r); ok && !used[i] {
+				used[i], paired = true, true
+				reordered = reordered || i < last
+				last = i
+				d.function(af, bf, r)
+				break
+			}
+		}
+		if !paired {
+			d.report(Added, "match alternative", nil, span(bf))
+		}
+	}
+	for i, af := range a {
+		if !used[i] {
+			d.report(Removed, "match alternative", span(af), nil)
+		}
+	}
+	// The first alternative that matches is chosen.
+	if reordered {
+		d.report(Changed, "order of match alternatives", span(a), span(b))
+	}
+}
+
+// record reports the changes between two records, whose fields are
+// paired by their names.
+func (d *differ) record(a, b *ast.RecordExpr, r renames) {
+	d.optional("spread", a.Rest, b.Rest, r)
+	entry := func(e ast.RecordEntry) *token.Span {
+		s := e.Key.Pos
+		if e.Val != nil {
+			s = s.Union(e.Val.Span())
+		}
+		return &s
+	}
+	used := make([]bool, len(a.Entries))
+	for _, be := range b.Entries {
+		i := -1
+		for j, ae := range a.Entries {
+			if d.beforeName(&ae.Key) == d.afterName(&be.Key) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			d.report(Added, "field", nil, entry(be))
+			continue
+		}
+		used[i] = true
+		ae := a.Entries[i]
+		if ae.Extend != be.Extend || ae.Drop != be.Drop {
+			d.report(Changed, "field", entry(ae), entry(be))
+			continue
+		}
+		d.optional("field "+d.afterName(&be.Key), ae.Val, be.Val, r)
+	}
+	for i, ae := range a.Entries {
+		if !used[i] {
+			d.report(Removed, "field", entry(ae), nil)
+		}
+	}
+}
+
+// list reports the changes between the elements of two lists, beyond
+// their longest common subsequence. Elements that differ at the same
+// place are compared; others were added or removed.
+func (d *differ) list(a, b *ast.ListExpr, r renames) {
+	as, bs := a.Elements, b.Elements
+	// lcs[i][j] is the length of the longest common subsequence
+	// of as[i:] and bs[j:].
+	lcs := make([][]int, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if d.equal(as[i], bs[j], r) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	// The elements since the last common one.
+	var removed, added []ast.Expr
+	flush := func() {
+		n := min(len(removed), len(added))
+		for k := range n {
+			d.expr(removed[k], added[k], r)
+		}
+		for _, x := range added[n:] {
+			d.report(Added, "element", nil, span(x))
+		}
+		for _, x := range removed[n:] {
+			d.report(Removed, "element", span(x), nil)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < len(as) || j < len(bs) {
+		switch {
+		case i < len(as) && j < len(bs) && d.equal(as[i], bs[j], r):
+			flush()
+			i, j = i+1, j+1
+		case j < len(bs) && (i == len(as) || lcs[i][j+1] >= lcs[i+1][j]):
+			added = append(added, bs[j])
+			j++
+		default:
+			removed = append(removed, as[i])
+			i++
+		}
+	}
+	flush()
+}
+
+// enum reports the changes between two enums, whose variants are paired
+// by their tags.
+func (d *differ) enum(a, b ast.EnumExpr, r renames) {
+	used := make([]bool, len(a))
+	for _, bv := range b {
+		i := -1
+		for j, av := range a {
+			if d.beforeName(&av.Tag) == d.afterName(&bv.Tag) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			d.report(Added, "tag", nil, span(bv))
+			continue
+		}
+		used[i] = true
+		d.optional("value of #"+d.afterName(&bv.Tag), a[i].Typ, bv.Typ, r)
+	}
+	for i, av := range a {
+		if !used[i] {
+			d.report(Removed, "tag", span(av), nil)
+		}
+	}
+}
+
+// A binding of a where-chain.
+type binding struct {
+	id       *ast.Ident
+	typ, val ast.Expr
+	other    *binding // The binding it's paired with, if any.
+}
+
+// bindings returns the expression of a where-chain,
+// and its bindings in source order.
+func bindings(x ast.Expr) (ast.Expr, []*binding) {
+	var bs []*binding
+	for {
+		where, ok := x.(*ast.WhereExpr)
+		if !ok {
+			break
+		}
+		bs = append(bs, &binding{id: &where.Id, typ: where.Typ, val: where.Val})
+		x = where.Expr
+	}
+	// The last binding is the outermost.
+	for i, j := 0, len(bs)-1; i < j; i, j = i+1, j-1 {
+		bs[i], bs[j] = bs[j], bs[i]
+	}
+	return x, bs
+}
+
+// chain reports the changes between two where-chains, whose bindings are
+// paired by their names, or else by their values; in which case they were
+// renamed.
+func (d *differ) chain(a, b *ast.WhereExpr, r renames) {
+	ax, as := bindings(a)
+	bx, bs := bindings(b)
+
+	var before, after []string
+	for _, bb := range bs {
+		for _, ab := range as {
+			if ab.other == nil && d.beforeName(ab.id) == d.afterName(bb.id) {
+				ab.other, bb.other = bb, ab
+				before, after = append(before, d.beforeName(ab.id)), append(after, d.afterName(bb.id))
+				break
+			}
+		}
+	}
+	// Bindings see each other, so all are in scope for all.
+	inner := r.with(before, after)
+	for _, bb := range bs {
+		for _, ab := range as {
+			if bb.other != nil || ab.other != nil {
+				continue
+			}
+			renamed := inner.with([]string{d.beforeName(ab.id)}, []string{d.afterName(bb.id)})
+			if d.equal(ab.typ, bb.typ, renamed) && d.equal(ab.val, bb.val, renamed) {
+				ab.other, bb.other = bb, ab
+				inner = renamed
+				d.report(Renamed, "binding", span(ab.id), span(bb.id))
+				break
+			}
+		}
+	}
+
+	d.expr(ax, bx, inner)
+	for _, bb := range bs {
+		ab := bb.other
+		if ab == nil {
+			d.report(Added, "binding", nil, span(bb.id))
+			continue
+		}
+		name := d.afterName(bb.id)
+		d.optional("type of "+name, ab.typ, bb.typ, inner)
+		d.optional("value of "+name, ab.val, bb.val, inner)
+	}
+	for _, ab := range as {
+		if ab.other == nil {
+			d.report(Removed, "binding", span(ab.id), nil)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestDiff(t *testing.T) {
+	examples := []struct {
+		before, after string
+		changes       []string
+	}{
+		{`1`, `1`, nil},
+		{`1`, `2`, []string{`-1:1 +1:1 changed literal 1 to 2`}},
+		// Formatting isn't a change.
+		{"f 1 ; f = x -> x", "f 1\n; f = x ->\n  x", nil},
+		{
+			`inc 1 ; inc = x -> x + one ; one = 1`,
+			`increment 1 ; increment = x -> x + one ; one = 1`,
+			[]string{`-1:9 +1:15 renamed binding inc to increment`},
+		},
+		{
+			`f 1 ; f = x -> x + 1`,
+			`f 1 ; f = y -> y + 2`,
+			[]string{`-1:11 +1:11 renamed parameter x to y`, `-1:20 +1:20 changed literal 1 to 2`},
+		},
+		{
+			`| [] -> 0 | [x] ++ xs -> x`,
+			`| [] -> 0 | [y] ++ ys -> y | _ -> 1`,
+			[]string{
+				`-1:14 +1:14 renamed parameter x to y`,
+				`-1:20 +1:20 renamed parameter xs to ys`,
+				`+1:30 added match alternative _ -> 1`,
+			},
+		},
+		{
+			`| 1 -> "a" | 2 -> "b"`,
+			`| 2 -> "b" | 1 -> "a"`,
+			[]string{`-1:3 +1:3 changed order of match alternatives 1 -> "a" | 2 -> "b" to 2 -> "b" | 1 -> "a"`},
+		},
+		{
+			`{ a = 1, b = 2 }`,
+			`{ c = 3, a = 1 + 1 }`,
+			[]string{
+				`+1:3 added field c = 3`,
+				`-1:7 +1:14 changed expression 1 to 1 + 1`,
+				`-1:10 removed field b = 2`,
+			},
+		},
+		{`[1, 2, 3]`, `[0, 1, 3, 4]`, []string{
+			`+1:2 added element 0`,
+			`-1:5 removed element 2`,
+			`+1:11 added element 4`,
+		}},
+		{`[1, 2, 3]`, `[1, 5, 3]`, []string{`-1:5 +1:5 changed literal 2 to 5`}},
+		{`a - b ; a = 1 ; b = 2`, `a + b ; a = 1 ; b = 2`, []string{`-1:1 +1:1 changed operator - to +`}},
+		{
+			`x ; x : t = t::a ; t : #a #b int`,
+			`x ; y = 1 ; t : #a #c`,
+			[]string{
+				`+1:5 added binding y`,
+				`+1:20 added tag #c`,
+				`-1:27 removed tag #b int`,
+				`-1:5 removed binding x`,
+			},
+		},
+	}
+
+	for _, ex := range examples {
+		before, err := parser.ParseExpr(ex.before)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := parser.ParseExpr(ex.after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var changes []string
+		for _, c := range Diff(before, after) {
+			changes = append(changes, c.String())
+		}
+		if strings.Join(changes, "\n") != strings.Join(ex.changes, "\n") {
+			t.Errorf("%s to %s: expected\n%s\ngot\n%s", ex.before, ex.after, strings.Join(ex.changes, "\n"), strings.Join(changes, "\n"))
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package diff compares scrapscript syntax trees, reporting what changed
+// between two versions of a scrap in terms of its syntax: bindings renamed,
+// literals changed, match alternatives added, and so on.
+package diff
@@ -0,0 +1,18 @@
+// Package scrapscript is an implementation of the scrapscript language.
+//
+// # API stability
+//
+// The following packages make up the supported surface for embedders, and
+// follow semantic versioning from v1 on:
+//
+//   - eval: Environment, its methods and options, the Value types,
+//     Equals, Hash, the Store interface, Events and the exported errors.
+//   - yards: the Fetcher and Pusher interfaces and their implementations.
+//   - ast, token and parser: the syntax tree and parsing of sources.
+//   - types: Registry, TypeRef and Infer.
+//   - printer: Fprint.
+//
+// Functions documented as experimental within those packages may still
+// change between minor versions. Code under internal/ is not part of the
+// API, and deprecated names are removed in the next major version.
+package scrapscript
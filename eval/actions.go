@@ -0,0 +1,68 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// An Edit replaces a span of a script with new text.
+type Edit struct {
+	Span token.Span
+	Text string
+}
+
+// A CodeAction is a titled change of a script, offered to users by editors.
+type CodeAction struct {
+	Title string
+	Edits []Edit
+}
+
+// ImportActions returns the CodeActions for the import at offset in
+// script, which needn't parse.
+//
+// Imports by name, like `$lib/json`, don't resolve. If aliases, mapping
+// names to hex-encoded sha256 hashes, knows the name, the action is to
+// replace it by an import of its hash.
+func ImportActions(script []byte, offset int, aliases map[string]string) []CodeAction {
+	if offset < 0 || offset > len(script) {
+		return nil
+	}
+
+	// Find the $ starting the import.
+	start := offset
+	for start > 0 && isImportName(script[start-1]) {
+		start--
+	}
+	if start == 0 || script[start-1] != '$' {
+		return nil
+	}
+	end := offset
+	for end < len(script) && isImportName(script[end]) {
+		end++
+	}
+
+	name := string(script[start:end])
+	hash, ok := aliases[name]
+	if !ok {
+		return nil
+	}
+	if bs, err := hex.DecodeString(hash); err != nil || len(bs) != sha256.Size {
+		return nil
+	}
+
+	return []CodeAction{{
+		Title: fmt.Sprintf("Import %s by its hash", name),
+		Edits: []Edit{{
+			Span: token.Span{Start: start - 1, End: end},
+			Text: scrapName(hash),
+		}},
+	}}
+}
+
+func isImportName(b byte) bool {
+	return slices.Contains([]byte("/_-"), b) || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImportActions(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	aliases := map[string]string{
+		"lib/json": hash,
+		"bad":      "not a hash",
+	}
+
+	examples := []struct {
+		source string // The cursor is at ^.
+		result string // The script after applying the action.
+	}{
+		{`$lib/json^`, "$sha256~~" + hash},
+		{`f ($lib/js^on) ; f = x -> x`, "f ($sha256~~" + hash + ") ; f = x -> x"},
+		{`$^lib/json 1`, "$sha256~~" + hash + " 1"},
+		// No action.
+		{`$lib/yaml^`, ``},
+		{`$bad^`, ``},
+		{`lib/json^`, ``},
+		{`$sha256~~^` + hash, ``},
+	}
+
+	for _, ex := range examples {
+		offset := strings.Index(ex.source, "^")
+		source := ex.source[:offset] + ex.source[offset+1:]
+
+		result := ""
+		if actions := ImportActions([]byte(source), offset, aliases); len(actions) > 0 {
+			edit := actions[0].Edits[0]
+			result = source[:edit.Span.Start] + edit.Text + source[edit.Span.End:]
+		}
+		if result != ex.result {
+			t.Errorf("%s\n  got  %s\n  want %s", ex.source, result, ex.result)
+		}
+	}
+}
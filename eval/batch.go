@@ -0,0 +1,64 @@
+package eval
+
+import (
+	goctx "context"
+	"sync"
+)
+
+// A Result is the outcome of evaluating one script of a batch.
+type Result struct {
+	Value Value
+	Err   error
+	// The Environment that evaluated the script,
+	// which must be used to render or infer the Value.
+	Env *Environment
+}
+
+// EvalAll reads and evaluates a batch of scripts, returning their Results
+// in the same order. A script that fails to parse or evaluate doesn't
+// affect the others. Evaluation stops with an *ErrCancelled when ctx is
+// cancelled, and fuel limits apply to each script on its own.
+//
+// The scripts share the Environment's imports, types and cache, so an
+// import is fetched and inferred once per batch, rather than once per
+// script. If parallelism is more than one, that many Clones of the
+// Environment evaluate the scripts concurrently, each sharing its imports
+// with the scripts it evaluates. The Environment's Fetcher, Store and
+// Observer must then be safe for concurrent use.
+func (e *Environment) EvalAll(ctx goctx.Context, scripts [][]byte, parallelism int) []Result {
+	results := make([]Result, len(scripts))
+	if parallelism <= 1 {
+		for i, script := range scripts {
+			results[i] = e.evalScript(ctx, script)
+		}
+		return results
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(parallelism, len(scripts)) {
+		env := e.Clone()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = env.evalScript(ctx, scripts[i])
+			}
+		}()
+	}
+	for i := range scripts {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func (e *Environment) evalScript(ctx goctx.Context, script []byte) Result {
+	scrap, err := e.Read(script)
+	if err != nil {
+		return Result{Err: err, Env: e}
+	}
+	val, err := e.EvalContext(ctx, scrap)
+	return Result{val, err, e}
+}
@@ -0,0 +1,76 @@
+package eval
+
+import (
+	goctx "context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// countingFetcher counts how often each scrap is fetched.
+type countingFetcher struct {
+	MapFetcher
+	fetches atomic.Int32
+}
+
+func (f *countingFetcher) FetchSha256(key string) ([]byte, error) {
+	f.fetches.Add(1)
+	return f.MapFetcher.FetchSha256(key)
+}
+
+func TestEvalAll(t *testing.T) {
+	lib := `x -> { n = x * 2 }`
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+	fetcher := &countingFetcher{MapFetcher: MapFetcher{hash: lib}}
+
+	var scripts [][]byte
+	var expected []string
+	for i := range 20 {
+		if i%5 == 4 {
+			// Failures don't affect the other scripts.
+			scripts = append(scripts, []byte(`unknown`))
+			expected = append(expected, "error")
+			continue
+		}
+		scripts = append(scripts, fmt.Appendf(nil, `$sha256~~%s %d`, hash, i))
+		expected = append(expected, fmt.Sprintf("{ n = %d }", i*2))
+	}
+
+	for _, parallelism := range []int{1, 4} {
+		fetcher.fetches.Store(0)
+		env := NewEnvironment()
+		env.UseFetcher(fetcher)
+		env.UseFuel(1000)
+
+		for i, res := range env.EvalAll(goctx.Background(), scripts, parallelism) {
+			actual := "error"
+			if res.Err == nil {
+				actual = res.Env.Scrap(res.Value)
+			}
+			if actual != expected[i] {
+				t.Errorf("parallelism %d, script %d: expected %s, got %s (%v)",
+					parallelism, i, expected[i], actual, res.Err)
+			}
+		}
+
+		if n := fetcher.fetches.Load(); n > int32(parallelism) {
+			t.Errorf("parallelism %d: expected at most one fetch per worker, got %d", parallelism, n)
+		}
+	}
+}
+
+func TestEvalAllCancelled(t *testing.T) {
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cancel()
+
+	env := NewEnvironment()
+	env.UseFuel(1000)
+	for _, res := range env.EvalAll(ctx, [][]byte{[]byte(`1 + 1`), []byte(`"a" ++ "b"`)}, 2) {
+		if !errors.Is(res.Err, goctx.Canceled) || !strings.Contains(res.Err.Error(), "evaluation stopped") {
+			t.Errorf("Expected cancellation, got %v", res.Err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+// Representative scripts, for benchmarks of each stage of running them.
+var benchmarks = []struct{ name, source string }{
+	{"arithmetic", `a * b + c ; c = a - b ; a = 1 + 2 ; b = 3 * 4`},
+	{"functions", `list/map (n -> (n |> inc |> double |> inc)) (list/repeat 200 1) ; inc = n -> n + 1 ; double = n -> n * 2`},
+	{"lists", `list/fold 0 (a -> b -> a + b) (list/map (n -> n * n) (list/repeat 1000 3))`},
+	{"records", `list/map (| { name, count } -> { name = name, count = count + 1 }) (list/repeat 100 { name = "x", count = 0 })`},
+	{"enums", `list/map classify (list/repeat 100 (t::ok 5))
+; classify = | #ok n -> n | #err _ -> 0
+; t : #ok int #err text`},
+	{"text", `text/join ", " (list/map (n -> "item") (list/repeat 100 1))`},
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				if _, err := parser.ParseExpr(bench.source); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkInfer(b *testing.B) {
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				b.StopTimer()
+				env := NewEnvironment()
+				scrap, err := env.Read([]byte(bench.source))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if _, err := env.Infer(scrap); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEval(b *testing.B) {
+	for _, bench := range benchmarks {
+		b.Run(bench.name, func(b *testing.B) {
+			for b.Loop() {
+				b.StopTimer()
+				env := NewEnvironment()
+				scrap, err := env.Read([]byte(bench.source))
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+				if _, err := env.Eval(scrap); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
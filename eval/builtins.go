@@ -1,10 +1,16 @@
 package eval
 
 import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"math"
+	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/Victorystick/scrapscript/token"
 	"github.com/Victorystick/scrapscript/types"
 )
 
@@ -18,12 +24,11 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 	}
 
 	// Built-in types
-	builtIns["()"] = Type(types.HoleRef)
-	builtIns["int"] = Type(types.IntRef)
-	builtIns["float"] = Type(types.FloatRef)
-	builtIns["text"] = Type(types.TextRef)
-	builtIns["byte"] = Type(types.ByteRef)
-	builtIns["bytes"] = Type(types.BytesRef)
+	for _, typ := range []types.TypeRef{types.HoleRef, types.IntRef, types.FloatRef, types.TextRef, types.ByteRef, types.BytesRef, types.KindRef} {
+		name := reg.String(typ)
+		builtIns[name] = Type(typ)
+		scope = scope.Bind(name, types.TypeOf(typ))
+	}
 
 	a := reg.Unbound()
 	b := reg.Unbound()
@@ -38,7 +43,7 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 		if !ok {
 			return nil, fmt.Errorf("expected list, but got %T", val)
 		}
-		return Int(len(ls.elements)), nil
+		return Int(ls.Len()), nil
 	})
 	define("list/map", reg.Func(aToB, reg.Func(aList, bList)), func(val Value) (Value, error) {
 		fn := Callable(val)
@@ -47,29 +52,29 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 			return nil, fmt.Errorf("needed function, but got %T", val)
 		}
 		return ScriptFunc{
-			source: "list/map " + val.String(),
+			source: "list/map " + argument(val),
 			fn: func(val Value) (v Value, err error) {
 				ls, ok := val.(List)
 				if !ok {
 					return nil, fmt.Errorf("expected list, but got %T", val)
 				}
 
-				results := List{elements: make([]Value, len(ls.elements))}
-				for i, v := range ls.elements {
+				results := make([]Value, ls.Len())
+				for i, v := range ls.values() {
 					val, err = fn(v)
 					if err != nil {
 						return nil, err
 					}
-					results.elements[i] = val
+					results[i] = val
 					// TODO: propagate the new type.
 				}
-				return results, nil
+				return List{elements: leaf(results)}, nil
 			},
 		}, nil
 	})
 	accum := reg.Func(a, reg.Func(b, a))
 	define("list/fold", reg.Func(a, reg.Func(accum, reg.Func(bList, a))), func(acc Value) (Value, error) {
-		source := "list/fold " + acc.String()
+		source := "list/fold " + argument(acc)
 		return ScriptFunc{
 			source: source,
 			fn: func(val Value) (Value, error) {
@@ -79,14 +84,14 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 					return nil, fmt.Errorf("needed function, but got %T", val)
 				}
 				return ScriptFunc{
-					source: source + " " + val.String(),
+					source: source + " " + argument(val),
 					fn: func(val Value) (res Value, err error) {
 						ls, ok := val.(List)
 						if !ok {
 							return nil, fmt.Errorf("expected list, but got %T", val)
 						}
 						var mid Value
-						for _, v := range ls.elements {
+						for _, v := range ls.values() {
 							mid, err = fn(acc)
 							if err != nil {
 								return nil, err
@@ -113,16 +118,55 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 			return nil, fmt.Errorf("expected int, but got %T", val)
 		}
 		return ScriptFunc{
-			source: "list/repeat " + val.String(),
+			source: "list/repeat " + argument(val),
 			fn: func(val Value) (v Value, err error) {
 				elems := make([]Value, int(n))
 				for i := range elems {
 					elems[i] = val
 				}
-				return List{val.Type(), elems}, nil
+				return List{val.Type(), leaf(elems)}, nil
 			},
 		}, nil
 	})
+	// The sum of no numbers is 0 or 0.0, depending on their type. Classes
+	// let built-ins be polymorphic over the values they're given, like `+`
+	// is, but evaluation doesn't know types, so a `num a => list a -> a`
+	// couldn't tell which zero an empty list sums to; not even by the type
+	// inferred where it's used, since functions using it are polymorphic
+	// too. So each kind of number has its own sum.
+	define("int/sum", reg.Func(reg.List(types.IntRef), types.IntRef), func(val Value) (Value, error) {
+		ls, ok := val.(List)
+		if !ok {
+			return nil, fmt.Errorf("expected list, but got %T", val)
+		}
+		var sum Int
+		for _, v := range ls.values() {
+			i, ok := v.(Int)
+			if !ok {
+				return nil, fmt.Errorf("expected int, but got %T", v)
+			}
+			if overflows(token.ADD, sum, i, sum+i) {
+				return nil, errors.New("int/sum overflows")
+			}
+			sum += i
+		}
+		return sum, nil
+	})
+	define("float/sum", reg.Func(reg.List(types.FloatRef), types.FloatRef), func(val Value) (Value, error) {
+		ls, ok := val.(List)
+		if !ok {
+			return nil, fmt.Errorf("expected list, but got %T", val)
+		}
+		var sum Float
+		for _, v := range ls.values() {
+			f, ok := v.(Float)
+			if !ok {
+				return nil, fmt.Errorf("expected float, but got %T", v)
+			}
+			sum += f
+		}
+		return sum, nil
+	})
 
 	// Text
 	define("text/length", reg.Func(types.TextRef, types.IntRef), func(val Value) (Value, error) {
@@ -138,7 +182,7 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 			return nil, fmt.Errorf("expected int, but got %T", val)
 		}
 		return ScriptFunc{
-			source: "text/repeat " + val.String(),
+			source: "text/repeat " + argument(val),
 			fn: func(val Value) (v Value, err error) {
 				text, ok := val.(Text)
 				if !ok {
@@ -154,14 +198,14 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 			return nil, fmt.Errorf("expected text, but got %T", val)
 		}
 		return ScriptFunc{
-			source: "text/join " + val.String(),
+			source: "text/join " + argument(val),
 			fn: func(val Value) (v Value, err error) {
 				ls, ok := val.(List)
 				if !ok {
 					return nil, fmt.Errorf("expected list, but got %T", val)
 				}
-				elems := make([]string, len(ls.elements))
-				for i, v := range ls.elements {
+				elems := make([]string, ls.Len())
+				for i, v := range ls.values() {
 					text, ok := v.(Text)
 					if !ok {
 						return nil, fmt.Errorf("expected text, but got %T", v)
@@ -173,6 +217,20 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 		}, nil
 	})
 
+	// Records
+	define("record/keys", reg.Func(reg.UnboundOf(types.Record), textList), func(val Value) (Value, error) {
+		rec, ok := val.(Record)
+		if !ok {
+			return nil, fmt.Errorf("expected record, but got %T", val)
+		}
+		fields := reg.Fields(rec.typ)
+		keys := make([]Value, len(fields))
+		for i, field := range fields {
+			keys[i] = Text(field.Name)
+		}
+		return List{textList, leaf(keys)}, nil
+	})
+
 	// int -> float
 	define("to-float", reg.Func(types.IntRef, types.FloatRef), func(val Value) (Value, error) {
 		if i, ok := val.(Int); ok {
@@ -187,6 +245,89 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 	define("ceil", floatToInt, roundFunc(math.Ceil))
 	define("floor", floatToInt, roundFunc(math.Floor))
 
+	// Numbers
+	define("int/abs", reg.Func(types.IntRef, types.IntRef), func(val Value) (Value, error) {
+		i, ok := val.(Int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, but got %T", val)
+		}
+		if i == math.MinInt {
+			return nil, fmt.Errorf("int/abs %d overflows", i)
+		}
+		return max(i, -i), nil
+	})
+	intOp := reg.Func(types.IntRef, reg.Func(types.IntRef, types.IntRef))
+	define("int/min", intOp, intBinop("int/min", func(a, b Int) Int { return min(a, b) }))
+	define("int/max", intOp, intBinop("int/max", func(a, b Int) Int { return max(a, b) }))
+	define("float/pow", reg.Func(types.FloatRef, reg.Func(types.FloatRef, types.FloatRef)), func(val Value) (Value, error) {
+		base, ok := val.(Float)
+		if !ok {
+			return nil, fmt.Errorf("expected float, but got %T", val)
+		}
+		return ScriptFunc{
+			source: "float/pow " + argument(val),
+			fn: func(val Value) (Value, error) {
+				exp, ok := val.(Float)
+				if !ok {
+					return nil, fmt.Errorf("expected float, but got %T", val)
+				}
+				return finite("float/pow "+argument(base)+" "+argument(exp), math.Pow(float64(base), float64(exp)))
+			},
+		}, nil
+	})
+	define("float/sqrt", reg.Func(types.FloatRef, types.FloatRef), func(val Value) (Value, error) {
+		f, ok := val.(Float)
+		if !ok {
+			return nil, fmt.Errorf("expected float, but got %T", val)
+		}
+		return finite("float/sqrt "+argument(f), math.Sqrt(float64(f)))
+	})
+
+	// numbers <-> text
+	result := func(typ types.TypeRef) types.TypeRef {
+		return reg.EnumInOrder(types.MapRef{"ok": typ, "err": types.TextRef}, []string{"ok", "err"})
+	}
+	intParsed := result(types.IntRef)
+	define("int/parse", reg.Func(types.TextRef, intParsed), func(val Value) (Value, error) {
+		text, ok := val.(Text)
+		if !ok {
+			return nil, fmt.Errorf("expected text, but got %T", val)
+		}
+		i, err := strconv.ParseInt(string(text), 10, 64)
+		if err != nil {
+			return Variant{intParsed, "err", Text(parseError(text, "an int", err))}, nil
+		}
+		return Variant{intParsed, "ok", Int(i)}, nil
+	})
+	floatParsed := result(types.FloatRef)
+	define("float/parse", reg.Func(types.TextRef, floatParsed), func(val Value) (Value, error) {
+		text, ok := val.(Text)
+		if !ok {
+			return nil, fmt.Errorf("expected text, but got %T", val)
+		}
+		// Only decimals, as literals are.
+		f, err := strconv.ParseFloat(string(text), 64)
+		if !isDecimal(string(text)) {
+			err = strconv.ErrSyntax
+		}
+		if err != nil {
+			return Variant{floatParsed, "err", Text(parseError(text, "a float", err))}, nil
+		}
+		return Variant{floatParsed, "ok", Float(f)}, nil
+	})
+	define("int/to-text", reg.Func(types.IntRef, types.TextRef), func(val Value) (Value, error) {
+		if i, ok := val.(Int); ok {
+			return Text(i.String()), nil
+		}
+		return nil, fmt.Errorf("expected int, but got %T", val)
+	})
+	define("float/to-text", reg.Func(types.FloatRef, types.TextRef), func(val Value) (Value, error) {
+		if f, ok := val.(Float); ok {
+			return Text(f.String()), nil
+		}
+		return nil, fmt.Errorf("expected float, but got %T", val)
+	})
+
 	// bytes <-> text
 	define("bytes/to-utf8-text", reg.Func(types.BytesRef, types.TextRef), func(val Value) (Value, error) {
 		if bytes, ok := val.(Bytes); ok {
@@ -201,6 +342,138 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 		return nil, fmt.Errorf("cannot bytes/from-utf8-text on %T", val)
 	})
 
+	// Bytes
+	define("bytes/length", reg.Func(types.BytesRef, types.IntRef), func(val Value) (Value, error) {
+		bs, ok := val.(Bytes)
+		if !ok {
+			return nil, fmt.Errorf("expected bytes, but got %T", val)
+		}
+		return Int(len(bs)), nil
+	})
+	define("bytes/slice", reg.Func(types.IntRef, reg.Func(types.IntRef, reg.Func(types.BytesRef, types.BytesRef))), func(val Value) (Value, error) {
+		start, ok := val.(Int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, but got %T", val)
+		}
+		source := "bytes/slice " + argument(val)
+		return ScriptFunc{
+			source: source,
+			fn: func(val Value) (Value, error) {
+				end, ok := val.(Int)
+				if !ok {
+					return nil, fmt.Errorf("expected int, but got %T", val)
+				}
+				return ScriptFunc{
+					source: source + " " + argument(val),
+					fn: func(val Value) (Value, error) {
+						bs, ok := val.(Bytes)
+						if !ok {
+							return nil, fmt.Errorf("expected bytes, but got %T", val)
+						}
+						// Out of range indexes are clamped, like an empty
+						// slice if end is before start.
+						lo := min(max(int(start), 0), len(bs))
+						hi := min(max(int(end), lo), len(bs))
+						return slices.Clip(slices.Clone(bs[lo:hi])), nil
+					},
+				}, nil
+			},
+		}, nil
+	})
+	byteOption := reg.EnumInOrder(types.MapRef{"some": types.ByteRef, "none": types.NeverRef}, []string{"some", "none"})
+	define("bytes/at", reg.Func(types.IntRef, reg.Func(types.BytesRef, byteOption)), func(val Value) (Value, error) {
+		i, ok := val.(Int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, but got %T", val)
+		}
+		return ScriptFunc{
+			source: "bytes/at " + argument(val),
+			fn: func(val Value) (Value, error) {
+				bs, ok := val.(Bytes)
+				if !ok {
+					return nil, fmt.Errorf("expected bytes, but got %T", val)
+				}
+				if i < 0 || int(i) >= len(bs) {
+					return Variant{byteOption, "none", nil}, nil
+				}
+				return Variant{byteOption, "some", Byte(bs[i])}, nil
+			},
+		}, nil
+	})
+	define("bytes/concat-all", reg.Func(reg.List(types.BytesRef), types.BytesRef), func(val Value) (Value, error) {
+		ls, ok := val.(List)
+		if !ok {
+			return nil, fmt.Errorf("expected list, but got %T", val)
+		}
+		res := Bytes{}
+		for _, v := range ls.values() {
+			bs, ok := v.(Bytes)
+			if !ok {
+				return nil, fmt.Errorf("expected bytes, but got %T", v)
+			}
+			res = append(res, bs...)
+		}
+		return slices.Clip(res), nil
+	})
+	define("byte/to-int", reg.Func(types.ByteRef, types.IntRef), func(val Value) (Value, error) {
+		if b, ok := val.(Byte); ok {
+			return Int(b), nil
+		}
+		return nil, fmt.Errorf("expected byte, but got %T", val)
+	})
+	byteResult := result(types.ByteRef)
+	define("int/to-byte", reg.Func(types.IntRef, byteResult), func(val Value) (Value, error) {
+		i, ok := val.(Int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, but got %T", val)
+		}
+		if i < 0 || i > math.MaxUint8 {
+			return Variant{byteResult, "err", Text(fmt.Sprintf("%d is out of range for a byte", i))}, nil
+		}
+		return Variant{byteResult, "ok", Byte(i)}, nil
+	})
+
+	// bytes <-> hex and base64 text
+	bytesResult := result(types.BytesRef)
+	define("bytes/to-hex", reg.Func(types.BytesRef, types.TextRef), func(val Value) (Value, error) {
+		if bs, ok := val.(Bytes); ok {
+			return Text(hex.EncodeToString(bs)), nil
+		}
+		return nil, fmt.Errorf("expected bytes, but got %T", val)
+	})
+	define("bytes/from-hex", reg.Func(types.TextRef, bytesResult), func(val Value) (Value, error) {
+		text, ok := val.(Text)
+		if !ok {
+			return nil, fmt.Errorf("expected text, but got %T", val)
+		}
+		bs, err := hex.DecodeString(string(text))
+		if err != nil {
+			return Variant{bytesResult, "err", Text(parseError(text, "hex", err))}, nil
+		}
+		return Variant{bytesResult, "ok", Bytes(bs)}, nil
+	})
+	define("bytes/to-base64", reg.Func(types.BytesRef, types.TextRef), func(val Value) (Value, error) {
+		if bs, ok := val.(Bytes); ok {
+			return Text(base64.StdEncoding.EncodeToString(bs)), nil
+		}
+		return nil, fmt.Errorf("expected bytes, but got %T", val)
+	})
+	define("bytes/from-base64", reg.Func(types.TextRef, bytesResult), func(val Value) (Value, error) {
+		text, ok := val.(Text)
+		if !ok {
+			return nil, fmt.Errorf("expected text, but got %T", val)
+		}
+		bs, err := base64.StdEncoding.DecodeString(string(text))
+		if err != nil {
+			return Variant{bytesResult, "err", Text(parseError(text, "base64", err))}, nil
+		}
+		return Variant{bytesResult, "ok", Bytes(bs)}, nil
+	})
+
+	// Remembers the value of its argument in the Environment's Store.
+	// Applications of `cache` are handled by the evaluator.
+	define(cacheBuiltIn.name, reg.Func(a, a), cacheBuiltIn.fn)
+
 	// Use the Y combinator to define recursive functions.
 	// (a -> b) -> a -> b
 	define("fix", reg.Func(aToB, aToB), func(val Value) (Value, error) {
@@ -209,7 +482,7 @@ func bindBuiltIns(reg *types.Registry) (types.TypeScope, Variables) {
 			return nil, fmt.Errorf("needed function, but got %T", val)
 		}
 		return ScriptFunc{
-			source: "fix " + val.String(),
+			source: "fix " + argument(val),
 			fn:     fix(fn),
 		}, nil
 	})
@@ -221,7 +494,7 @@ func fix(outer Func) Func {
 	return func(inner Value) (Value, error) {
 		// Note: This calls `fix` for every recursive call, which is not super efficient.
 		self := fix(outer)
-		fn, err := outer(ScriptFunc{"self", self})
+		fn, err := outer(ScriptFunc{source: "self", fn: self})
 		if err != nil {
 			return nil, err
 		}
@@ -233,6 +506,57 @@ func fix(outer Func) Func {
 	}
 }
 
+// intBinop returns a curried built-in function of two ints.
+func intBinop(name string, op func(a, b Int) Int) Func {
+	return func(val Value) (Value, error) {
+		a, ok := val.(Int)
+		if !ok {
+			return nil, fmt.Errorf("expected int, but got %T", val)
+		}
+		return ScriptFunc{
+			source: name + " " + argument(val),
+			fn: func(val Value) (Value, error) {
+				b, ok := val.(Int)
+				if !ok {
+					return nil, fmt.Errorf("expected int, but got %T", val)
+				}
+				return op(a, b), nil
+			},
+		}, nil
+	}
+}
+
+// isDecimal reports whether text is a decimal number, like the literals of
+// floats and ints are, with an optional sign; without exponents,
+// underscores, or hexadecimal digits.
+func isDecimal(text string) bool {
+	if strings.HasPrefix(text, "-") || strings.HasPrefix(text, "+") {
+		text = text[1:]
+	}
+	whole, frac, _ := strings.Cut(text, ".")
+	digits := func(s string) bool {
+		return !strings.ContainsFunc(s, func(r rune) bool { return r < '0' || r > '9' })
+	}
+	return whole+frac != "" && digits(whole) && digits(frac)
+}
+
+// finite returns a float that a call results in, or an error if it isn't
+// finite, like the square root of a negative float.
+func finite(call string, f float64) (Value, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return nil, fmt.Errorf("%s has no finite result", call)
+	}
+	return Float(f), nil
+}
+
+// parseError describes why text failed to parse as a number.
+func parseError(text Text, what string, err error) string {
+	if errors.Is(err, strconv.ErrRange) {
+		return fmt.Sprintf("'%s' is out of range for %s", string(text), what)
+	}
+	return fmt.Sprintf("'%s' isn't %s", string(text), what)
+}
+
 func roundFunc(round func(float64) float64) Func {
 	return func(val Value) (Value, error) {
 		if f, ok := val.(Float); ok {
@@ -241,3 +565,10 @@ func roundFunc(round func(float64) float64) Func {
 		return Int(0), fmt.Errorf("non-float value %T", val)
 	}
 }
+
+var cacheBuiltIn = BuiltInFunc{
+	name: "cache",
+	fn: func(val Value) (Value, error) {
+		return val, nil
+	},
+}
@@ -0,0 +1,132 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/Victorystick/scrapscript/ast"
+)
+
+// A Store persists values, rendered as scrapscript, by a content hash.
+// It is used by the `cache` built-in to remember expensive results
+// across evaluations.
+type Store interface {
+	// Load returns the data saved for key, or an error if there is none.
+	Load(key string) ([]byte, error)
+	Save(key string, data []byte) error
+}
+
+// MemoryStore is a Store that keeps values in memory.
+type MemoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *MemoryStore) Load(key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if data, ok := m.data[key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("no value stored for %s", key)
+}
+
+func (m *MemoryStore) Save(key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.data == nil {
+		m.data = make(map[string][]byte)
+	}
+	m.data[key] = data
+	return nil
+}
+
+// UseStore sets the Store used by `cache` expressions.
+func (e *Environment) UseStore(store Store) {
+	e.store = store
+}
+
+// cached evaluates the value of `cache x`.
+//
+// The result is keyed by the source of x and the values of all variables
+// it references, so it is only recomputed if any of those change. If x
+// references a user-defined function, whose behavior depends on more than
+// its source, x is evaluated without caching.
+func (c *context) cached(x ast.Expr) (Value, error) {
+	if c.rt.cache == nil {
+		return c.eval(x)
+	}
+
+	vars := make(Variables)
+	pure := true
+	ast.Inspect(x, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok || !pure {
+			return pure
+		}
+		// Variables bound within x don't resolve, and are part of its source.
+		val, err := c.ident(id)
+		if err != nil {
+			return true
+		}
+		if _, ok := val.(ScriptFunc); ok {
+			pure = false
+		}
+		vars[c.name(id)] = val
+		return true
+	})
+
+	if !pure {
+		return c.eval(x)
+	}
+
+	return c.rt.cache(c.source.GetString(x.Span()), vars, func() (Value, error) {
+		return c.eval(x)
+	})
+}
+
+// cache looks up the value of the source of a `cache` expression, that
+// references vars, in the Environment's store; or computes and saves it.
+//
+// Values are keyed, and saved, by how EmitScrap renders them, which is the
+// same from run to run. Values that it can't render, like those nested
+// deeper than MaxNesting, are computed without caching.
+func (e *Environment) cache(source string, vars Variables, compute func() (Value, error)) (Value, error) {
+	hash := sha256.New()
+	hash.Write([]byte(source))
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		text, err := e.EmitScrap(vars[name])
+		if err != nil {
+			return compute()
+		}
+		fmt.Fprintf(hash, "\x00%s=%s", name, text)
+	}
+	key := fmt.Sprintf("%x", hash.Sum(nil))
+
+	// Stored values are read like imports are, without being registered.
+	if data, err := e.store.Load(key); err == nil {
+		if scrap, err := e.read(data); err == nil {
+			if val, err := e.eval(scrap); err == nil {
+				return val, nil
+			}
+		}
+	}
+
+	val, err := compute()
+	if err != nil {
+		return nil, err
+	}
+	switch val.(type) {
+	case ScriptFunc, BuiltInFunc, Type, Host:
+		// These can't be restored from their rendering.
+		return val, nil
+	}
+	text, err := e.EmitScrap(val)
+	if err != nil {
+		return val, nil
+	}
+	return val, e.store.Save(key, []byte(text))
+}
@@ -0,0 +1,81 @@
+package eval
+
+import (
+	goctx "context"
+	"errors"
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// ErrFuelExhausted is the cause of an ErrCancelled when an evaluation
+// ran out of the fuel given to Environment.UseFuel.
+var ErrFuelExhausted = errors.New("fuel exhausted")
+
+// ErrFuelRequired is returned by Eval in builds with the scrap_tiny tag,
+// unless Environment.UseFuel has set a limit.
+var ErrFuelRequired = errors.New("evaluation requires fuel in this build")
+
+// ErrTooManyTypes is returned when an Environment's types would exceed
+// the fixed size of its Registry, as in builds with the scrap_tiny tag.
+var ErrTooManyTypes = types.ErrTooManyTypes
+
+// ErrCancelled is returned when an evaluation is stopped before completion,
+// either by its context or by running out of fuel.
+type ErrCancelled struct {
+	// The reason for cancelling; the context's error or ErrFuelExhausted.
+	Cause error
+	// The innermost expression being evaluated when cancelled.
+	At token.Error
+	// The number of evaluation steps taken so far.
+	Fuel int
+}
+
+func (e *ErrCancelled) Error() string {
+	return fmt.Sprintf("evaluation stopped after %d steps: %s\n%s", e.Fuel, e.Cause, e.At)
+}
+
+func (e *ErrCancelled) Unwrap() error {
+	return e.Cause
+}
+
+// step accounts for evaluating x, returning an ErrCancelled
+// if evaluation should stop.
+func (rt *runtime) step(source *token.Source, x ast.Node) error {
+	rt.fuel += 1
+
+	var cause error
+	if rt.limit > 0 && rt.fuel > rt.limit {
+		cause = ErrFuelExhausted
+	} else if rt.ctx != nil {
+		cause = rt.ctx.Err()
+	}
+
+	if cause == nil {
+		return nil
+	}
+
+	return &ErrCancelled{
+		Cause: cause,
+		At:    source.Error(x.Span(), "evaluation stopped here"),
+		Fuel:  rt.fuel - 1,
+	}
+}
+
+// UseFuel limits every subsequent evaluation to at most limit steps.
+// A limit of zero or less means no limit, which builds with the
+// scrap_tiny tag don't allow.
+func (e *Environment) UseFuel(limit int) {
+	e.rt.limit = limit
+}
+
+// EvalContext evaluates a Scrap like Eval, but stops with an *ErrCancelled
+// when ctx is cancelled.
+func (e *Environment) EvalContext(ctx goctx.Context, scrap *Scrap) (Value, error) {
+	prev := e.rt.ctx
+	e.rt.ctx = ctx
+	defer func() { e.rt.ctx = prev }()
+	return e.Eval(scrap)
+}
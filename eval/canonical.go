@@ -0,0 +1,35 @@
+package eval
+
+import (
+	"bytes"
+
+	"github.com/Victorystick/scrapscript/printer"
+)
+
+// Canonical returns the source of a Scrap in canonical form, so that
+// scraps that differ only in formatting have the same hash. In canonical
+// form:
+//
+//   - The header only holds the pragmas, in order, as `-- scrap:name value`
+//     lines. Shebangs and other comments are dropped.
+//   - The expression is printed as by printer.Fprint; with its whitespace
+//     and parentheses normalized.
+//   - There's no trailing newline.
+//
+// The canonical form of a scrap is canonical itself.
+func (s *Scrap) Canonical() ([]byte, error) {
+	var b bytes.Buffer
+	for _, pragma := range s.expr.Header.Pragmas {
+		b.WriteString("-- scrap:")
+		b.WriteString(pragma.Name)
+		if pragma.Value != "" {
+			b.WriteString(" ")
+			b.WriteString(pragma.Value)
+		}
+		b.WriteString("\n")
+	}
+	if err := printer.Fprint(&b, s.expr.Source.Bytes(), s.expr.Expr); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
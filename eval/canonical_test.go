@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	canonical := "-- scrap:nowarn shadow\nf [ 1, 2 ]\n; f = x -> x +< 3"
+	sources := []string{
+		canonical,
+		"#!/usr/bin/env scrap\n-- scrap:nowarn   shadow\n-- doubles\nf [1,2]\n  ; f = x -> (x +< 3)\n",
+		"-- scrap:nowarn shadow\r\n(f) ([ 1 , 2 ]) ; f = (x -> ((x) +< 3))",
+	}
+
+	env := NewEnvironment()
+	env.UsePusher(artifactPusher{artifacts{}})
+	expected, err := env.Hash("sha256", []byte(canonical))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range sources {
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := scrap.Canonical()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != canonical {
+			t.Errorf("Expected %q canonically, got %q", canonical, data)
+		}
+
+		// It hashes as it's pushed.
+		hash, err := env.Hash("sha256", data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scrap, err = env.Read(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := env.Push(scrap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hash != expected || key != expected {
+			t.Errorf("Expected %s to hash and push as %s, got %s and %s", source, expected, hash, key)
+		}
+	}
+}
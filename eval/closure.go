@@ -0,0 +1,82 @@
+package eval
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/printer"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// Captured returns the bindings that the function closes over, sorted by
+// name. These are the values of the variables it refers to that are bound
+// in the scrap defining it, rather than by the Environment. Partial
+// applications of built-ins capture nothing. Where-bindings are evaluated
+// when first used, so it fails if evaluating any of them does.
+func (sf ScriptFunc) Captured() ([]Binding, error) {
+	vars, err := sf.captured()
+	if err != nil {
+		return nil, err
+	}
+	bindings := make([]Binding, 0, len(vars))
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		bindings = append(bindings, Binding{name, vars[name]})
+	}
+	return bindings, nil
+}
+
+func (sf ScriptFunc) captured() (Variables, error) {
+	if sf.captures == nil {
+		return nil, nil
+	}
+	return sf.captures()
+}
+
+// captured looks up the values that the function expression x,
+// evaluated in c, captures.
+func (c *context) captured(x ast.Expr) (Variables, error) {
+	vars := make(Variables)
+	for _, name := range c.rt.freeVars.FreeVars(c.source, x) {
+		// The outermost context holds the Environment's variables.
+		for cur := c; cur.parent != nil; cur = cur.parent {
+			val, ok, err := lookup(cur.vars, name, c.rt)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				vars[name] = val
+				break
+			}
+		}
+	}
+	return vars, nil
+}
+
+// printed returns the printed source of the function expression x,
+// printing it only once per runtime.
+func (c *context) printed(x ast.Expr) string {
+	key := printedKey{c.source, x.Span()}
+	if text, ok := c.rt.printed[key]; ok {
+		return text
+	}
+	var b strings.Builder
+	text := c.source.GetString(x.Span())
+	if err := printer.Fprint(&b, c.source.Bytes(), x); err == nil {
+		// Match functions are printed with each alternative on a new line.
+		text = strings.TrimPrefix(b.String(), "\n")
+	}
+	if c.rt.printed == nil {
+		c.rt.printed = make(map[printedKey]string)
+	}
+	c.rt.printed[key] = text
+	return text
+}
+
+// Functions are identified by their source and span,
+// since match functions are slices, which can't be map keys.
+type printedKey struct {
+	source *token.Source
+	span   token.Span
+}
@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCaptured(t *testing.T) {
+	env := NewEnvironment()
+	examples := []struct {
+		source   string
+		captured string
+	}{
+		{`x -> x`, `[]`},
+		{`x -> x + list/length []`, `[]`},
+		{`f 1 ; f = a -> b -> a + b + c ; c = 10`, `[a=1 c=10]`},
+		{`f ; f = x -> { ..r, a = x } ; r = { a = 1 }`, `[r={ a = 1 }]`},
+		{`f ; f = x -> y ; y = 1 ; x = 2`, `[y=1]`},
+		{`f ; f = | 0 -> z | n -> (z -> z) n ; z = 3`, `[z=3]`},
+		{`f ; f = x -> t::a ; t : #a #b`, `[t=<type>]`},
+		{`list/map (a -> a)`, `[]`},
+	}
+
+	for _, ex := range examples {
+		val, err := eval(env, ex.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn, ok := val.(ScriptFunc)
+		if !ok {
+			t.Fatalf("%s isn't a ScriptFunc", ex.source)
+		}
+		bindings, err := fn.Captured()
+		if err != nil {
+			t.Fatalf("%s: %s", ex.source, err)
+		}
+		var captured []string
+		for _, b := range bindings {
+			captured = append(captured, b.Name()+"="+b.Value().String())
+		}
+		if actual := fmt.Sprint(captured); actual != ex.captured {
+			t.Errorf("%s: expected %s, got %s", ex.source, ex.captured, actual)
+		}
+	}
+}
+
+func TestCapturedFailure(t *testing.T) {
+	env := NewEnvironment()
+	// The a that f captures fails to evaluate, and shadows the other.
+	val, err := eval(env, `g ; g = (f ; f = x -> a ; a = float/sqrt (0.0 - 1.0)) ; a = 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, ok := val.(ScriptFunc)
+	if !ok {
+		t.Fatalf("%s isn't a ScriptFunc", val)
+	}
+	if bindings, err := fn.Captured(); err == nil || !strings.Contains(err.Error(), "no finite result") {
+		t.Errorf("Expected an error about a, got %v, %v", bindings, err)
+	}
+}
@@ -0,0 +1,18 @@
+package eval
+
+import "github.com/Victorystick/scrapscript/types"
+
+// Compat infers the types of two versions of a Scrap, and returns the
+// reasons why the one after can't replace the one before, in scraps that
+// import it; none if it can. See types.Registry.Compatible.
+func (e *Environment) Compat(before, after *Scrap) ([]types.Incompatibility, error) {
+	b, err := e.infer(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := e.infer(after)
+	if err != nil {
+		return nil, err
+	}
+	return e.reg.Compatible(b, a), nil
+}
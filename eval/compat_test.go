@@ -0,0 +1,37 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestCompat(t *testing.T) {
+	lib := `{ inc = x -> x + 1, one = 1 }`
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash: lib})
+	before, err := env.Import("sha256", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for source, expected := range map[string]string{
+		`{ inc = x -> x + 1, one = 1, two = 2 }`: `[]`,
+		`{ inc = x -> x + 1 }`:                   `[field one was removed]`,
+		`{ inc = x -> x, one = "1" }`:            `[.one: was int, is text]`,
+	} {
+		after, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		reasons, err := env.Compat(before, after)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := fmt.Sprint(reasons); actual != expected {
+			t.Errorf("%s: expected %s, got %s", source, expected, actual)
+		}
+	}
+}
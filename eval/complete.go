@@ -0,0 +1,109 @@
+package eval
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// CompletionKind classifies a Completion.
+type CompletionKind int
+
+const (
+	// A name bound in the scrap, by a where-binding, argument or pattern.
+	CompleteLocal CompletionKind = iota
+	// A built-in function.
+	CompleteBuiltIn
+	// A key of a record, completed after `.`.
+	CompleteKey
+	// A tag of an enum, completed after `::`.
+	CompleteTag
+)
+
+var completionKindNames = [...]string{
+	CompleteLocal:   "local",
+	CompleteBuiltIn: "builtin",
+	CompleteKey:     "key",
+	CompleteTag:     "tag",
+}
+
+func (k CompletionKind) String() string {
+	return completionKindNames[k]
+}
+
+// A Completion is a candidate for the identifier being typed.
+type Completion struct {
+	Kind  CompletionKind
+	Label string
+	// The type of the candidate, or empty if it's unknown.
+	// Tags without a value have no type.
+	Type string
+}
+
+// Complete returns the completion candidates for the identifier at offset
+// in script, which needn't be complete or well-typed.
+//
+// After `rec.` the keys of the record are suggested, and after `t::` the
+// tags of the enum. Anywhere else, the names in scope are suggested,
+// innermost bindings first, followed by the built-ins. Only candidates
+// starting with the part of the identifier before offset are returned.
+func (e *Environment) Complete(script []byte, offset int) []Completion {
+	f := e.locate(script, offset)
+	if f == nil {
+		return nil
+	}
+	target, ok := f.target.(*ast.Ident)
+	if !ok {
+		return nil
+	}
+	src, info := f.src, f.info
+
+	name := src.GetString(target.Pos)
+	prefix := name[:offset-target.Pos.Start]
+
+	var res []Completion
+	add := func(kind CompletionKind, label string, ref types.TypeRef) {
+		if !strings.HasPrefix(label, prefix) || label == placeholder || label == "_" {
+			return
+		}
+		c := Completion{Kind: kind, Label: label}
+		// Tags without a value have type never.
+		if ref != types.NeverRef && ref != types.UnknownRef {
+			c.Type = f.reg.String(ref)
+		}
+		res = append(res, c)
+	}
+
+	switch {
+	case f.access != nil:
+		for _, field := range f.reg.Fields(f.typeOf(f.access.Rec)) {
+			add(CompleteKey, field.Name, field.Type)
+		}
+	case f.pick != nil:
+		typ := f.reg.Resolve(f.typeOf(f.pick.Left))
+		if denoted := typ.Denoted(); denoted != types.UnknownRef {
+			typ = denoted
+		}
+		for _, tag := range f.reg.Tags(typ) {
+			add(CompleteTag, tag.Name, tag.Type)
+		}
+	default:
+		seen := make(map[string]bool)
+		for _, id := range slices.Backward(f.scope) {
+			if name := src.GetString(id.Pos); !seen[name] {
+				seen[name] = true
+				add(CompleteLocal, name, info.Defs[id])
+			}
+		}
+		builtIns := e.typeScope.Names()
+		slices.Sort(builtIns)
+		for _, name := range builtIns {
+			if !seen[name] {
+				add(CompleteBuiltIn, name, e.typeScope.Lookup(name))
+			}
+		}
+	}
+	return res
+}
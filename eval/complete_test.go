@@ -0,0 +1,91 @@
+package eval
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	examples := []struct {
+		source string // The cursor is at ^.
+		result []string
+	}{
+		// Names in scope, innermost first.
+		{`f^ ; foo = 1 ; fab = "a"`, []string{"local foo : int", "local fab : text", "builtin fix : (a -> b) -> a -> b"}},
+		{`x -> y -> ^ ; zz = 1`, []string{"local y : $1", "local x : $0", "local zz : int"}},
+		{`(fo^ ; fo = 1) ; fo = "shadowed"`, []string{"local fo : int"}},
+		{`ab ; ab = ab^`, nil},
+		{`list/m^`, []string{"builtin list/map : (a -> b) -> list a -> list b"}},
+		{`| [z] -> 1 | [xs, ys] -> x^`, []string{"local xs : $2"}},
+
+		// Record keys.
+		{`rec.^ ; rec = { b = 1, a = "x" }`, []string{"key b : int", "key a : text"}},
+		{`rec.a^ ; rec = { b = 1, aa = "x" }`, []string{"key aa : text"}},
+		{`rec.in.^ ; rec = { in = { c = 1.0 } }`, []string{"key c : float"}},
+		{`x.^ ; x = 1`, nil},
+
+		// Enum tags.
+		{`t::^ ; t : #b #a`, []string{"tag b", "tag a"}},
+		{`t::a^ ; t : #b #aa #ab`, []string{"tag aa", "tag ab"}},
+		{`t::^ ; t = #b int #a`, []string{"tag b : int", "tag a"}},
+	}
+
+	for _, ex := range examples {
+		env := NewEnvironment()
+		offset := strings.Index(ex.source, "^")
+		source := ex.source[:offset] + ex.source[offset+1:]
+
+		var got []string
+		for _, c := range env.Complete([]byte(source), offset) {
+			if ex.result == nil || c.Kind != CompleteBuiltIn || slices.ContainsFunc(ex.result, func(s string) bool {
+				return strings.HasPrefix(s, "builtin "+c.Label+" ")
+			}) {
+				got = append(got, format(c))
+			}
+		}
+		if !slices.Equal(got, ex.result) {
+			t.Errorf("%s\n  got  %q\n  want %q", ex.source, got, ex.result)
+		}
+	}
+}
+
+func format(c Completion) string {
+	if c.Type == "" {
+		return fmt.Sprintf("%s %s", c.Kind, c.Label)
+	}
+	return fmt.Sprintf("%s %s : %s", c.Kind, c.Label, c.Type)
+}
+
+func TestCompleteScratch(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		"ed3d4fd5766d2789e9745e65d836f1379738e22999cbef8f6a71625741f6700a": `x -> { a = x }`,
+	})
+	source := `r.^ ; r = f 1 ; f = $sha256~~ed3d4fd5766d2789e9745e65d836f1379738e22999cbef8f6a71625741f6700a`
+	offset := strings.Index(source, "^")
+	source = source[:offset] + source[offset+1:]
+
+	// Imports are inferred into the Environment once, the rest is scratch.
+	want := []string{"key a : int"}
+	for range 2 {
+		var got []string
+		for _, c := range env.Complete([]byte(source), offset) {
+			got = append(got, format(c))
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		size := env.reg.Size()
+		env.Complete([]byte(source), offset)
+		if env.reg.Size() != size {
+			t.Errorf("the Registry grew from %d to %d types", size, env.reg.Size())
+		}
+	}
+
+	// Expressions that can't be inferred yet are errors, not panics.
+	if got := env.Complete([]byte(`f >> g ; f = a -> a ; g = b -> b`), 1); len(got) == 0 {
+		t.Errorf("got no completions for f")
+	}
+}
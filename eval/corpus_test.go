@@ -0,0 +1,37 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/internal/corpus"
+)
+
+func BenchmarkCorpus(b *testing.B) {
+	shapes := []corpus.Shape{
+		{Bindings: 10, Depth: 2, Imports: 1},
+		{Bindings: 100, Depth: 4, Imports: 10},
+		{Bindings: 1000, Depth: 8, Imports: 20},
+	}
+
+	for _, shape := range shapes {
+		c := corpus.Generate(shape)
+		name := fmt.Sprintf("bindings=%d,depth=%d,imports=%d", shape.Bindings, shape.Depth, shape.Imports)
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				env := NewEnvironment()
+				env.UseFetcher(c)
+				scrap, err := env.Read(c.Main)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := env.Infer(scrap); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := env.Eval(scrap); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package eval
+
+import (
+	"slices"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// placeholder is spliced into scripts being edited where no identifier
+// has been typed yet, so that expressions like `rec.` parse.
+const placeholder = "__complete"
+
+// A cursor locates the expression at an offset into a scrap being edited,
+// and what's in scope there.
+type cursor struct {
+	env    *Environment
+	reg    *types.Registry // A scratch Registry for the scrap; see scratch.
+	src    token.Source
+	info   *types.Info
+	offset int
+
+	target ast.Expr     // The identifier or literal at offset.
+	scope  []*ast.Ident // The bindings in scope of target, outermost first.
+	access *ast.AccessExpr
+	pick   *ast.BinaryExpr
+	call   *ast.CallExpr // The innermost call with target in its argument.
+}
+
+// locate returns a cursor at offset into script, or nil if script doesn't
+// parse. Since inference stops at the first error, which typically is
+// the code being edited, types are only known for bindings in scope.
+func (e *Environment) locate(script []byte, offset int) *cursor {
+	if offset < 0 || offset > len(script) {
+		return nil
+	}
+	if r, _ := utf8.DecodeLastRune(script[:offset]); !isIdentRune(r) {
+		script = slices.Concat(script[:offset], []byte(placeholder), script[offset:])
+	}
+
+	src := token.NewSource(script)
+	se, err := parser.Parse(&src)
+	if err != nil {
+		return nil
+	}
+
+	var info types.Info
+	reg, inferImport := e.scratch()
+	types.InferInfo(reg, e.typeScope, se, inferImport, &info)
+
+	f := &cursor{env: e, reg: reg, src: src, info: &info, offset: offset}
+	f.find(se.Expr, nil)
+	if f.target == nil {
+		return nil
+	}
+	return f
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func (f *cursor) find(node ast.Node, scope []*ast.Ident) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		if f.target != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.Ident:
+			if n.Pos.Contains(f.offset) {
+				f.target = n
+				f.scope = scope
+			}
+		case *ast.Literal:
+			if n.Pos.Contains(f.offset) {
+				f.target = n
+				f.scope = scope
+			}
+		case *ast.CallExpr:
+			f.find(n.Fn, scope)
+			if f.target == nil {
+				f.find(n.Arg, scope)
+				if f.target != nil && f.call == nil {
+					f.call = n
+				}
+			}
+			return false
+		case *ast.AccessExpr:
+			f.find(n.Rec, scope)
+			if f.target == nil {
+				f.find(&n.Key, scope)
+				if f.target == &n.Key {
+					f.access = n
+				}
+			}
+			return false
+		case *ast.BinaryExpr:
+			if n.Op != token.PICK {
+				break
+			}
+			f.find(n.Left, scope)
+			if f.target == nil {
+				f.find(n.Right, scope)
+				if f.target == n.Right {
+					f.pick = n
+				}
+			}
+			return false
+		case *ast.WhereExpr:
+			if n.Typ != nil {
+				f.find(n.Typ, scope)
+			}
+			if n.Val != nil {
+				f.find(n.Val, scope)
+			}
+			f.find(n.Expr, append(slices.Clip(scope), &n.Id))
+			return false
+		case *ast.FuncExpr:
+			f.find(n.Body, append(slices.Clip(scope), ast.PatternNames(n.Arg)...))
+			return false
+		}
+		return true
+	})
+}
+
+// typeOf returns the type of a name or a chain of record accesses,
+// or UnknownRef if it's unknown.
+func (f *cursor) typeOf(x ast.Expr) types.TypeRef {
+	switch x := x.(type) {
+	case *ast.Ident:
+		name := f.src.GetString(x.Pos)
+		for _, id := range slices.Backward(f.scope) {
+			if f.src.GetString(id.Pos) == name {
+				if typ, ok := f.info.Defs[id]; ok {
+					return typ
+				}
+				return types.UnknownRef
+			}
+		}
+		if f.env.typeScope.Get(name) != nil {
+			return f.env.typeScope.Lookup(name)
+		}
+	case *ast.AccessExpr:
+		key := f.src.GetString(x.Key.Pos)
+		for _, field := range f.reg.Fields(f.typeOf(x.Rec)) {
+			if field.Name == key {
+				return field.Type
+			}
+		}
+	}
+	return types.UnknownRef
+}
@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// A decisionTree dispatches the argument of a match function directly to
+// the alternatives that may match it, by its variant tag, constant value
+// or list length, rather than trying every alternative in turn.
+type decisionTree struct {
+	tags      map[string][]int
+	constants map[any][]int
+	// The alternatives that may match any other value.
+	others []int
+	// Whether an alternative matches every value dispatched to it,
+	// without binding any variables.
+	exact []bool
+}
+
+// bytesKey is a comparable stand-in for Bytes in the constants map.
+type bytesKey string
+
+// listKey is the length of lists in the constants map, since list
+// patterns only match lists of as many elements; so that big lists
+// aren't flattened for each alternative of other lengths.
+type listKey int
+
+// constantKey returns a comparable key for a value that may
+// appear as a literal pattern.
+func constantKey(val Value) (any, bool) {
+	switch val := val.(type) {
+	case Hole, Int, Text, Byte:
+		return val, true
+	case Bytes:
+		return bytesKey(val), true
+	case List:
+		return listKey(val.Len()), true
+	}
+	return nil, false
+}
+
+// newDecisionTree builds a decisionTree for the alternatives of a match function.
+func newDecisionTree(source *token.Source, x ast.MatchFuncExpr) *decisionTree {
+	tree := &decisionTree{
+		tags:      make(map[string][]int),
+		constants: make(map[any][]int),
+		exact:     make([]bool, len(x)),
+	}
+
+	// The tags or constants of each alternative, or nil if it may match
+	// other values.
+	keys := make([][]any, len(x))
+	for i, alt := range x {
+		keys[i], tree.exact[i] = patternKeys(source, alt.Arg)
+		for _, key := range keys[i] {
+			if tag, ok := key.(string); ok {
+				tree.tags[tag] = nil
+			} else {
+				tree.constants[key] = nil
+			}
+		}
+	}
+
+	// Each value is dispatched to the alternatives with its key, and all
+	// others that may match anything, in their original order.
+	add := func(alts []int, i int) []int {
+		// An or-pattern may list the same key twice.
+		if len(alts) > 0 && alts[len(alts)-1] == i {
+			return alts
+		}
+		return append(alts, i)
+	}
+	for i, keys := range keys {
+		if keys == nil {
+			for tag := range tree.tags {
+				tree.tags[tag] = append(tree.tags[tag], i)
+			}
+			for c := range tree.constants {
+				tree.constants[c] = append(tree.constants[c], i)
+			}
+			tree.others = append(tree.others, i)
+			continue
+		}
+		for _, key := range keys {
+			if tag, ok := key.(string); ok {
+				tree.tags[tag] = add(tree.tags[tag], i)
+			} else {
+				tree.constants[key] = add(tree.constants[key], i)
+			}
+		}
+	}
+
+	return tree
+}
+
+// patternKeys returns the tags or constants of the values a pattern may
+// match, or nil if it may match others, and whether it matches them all
+// without binding any variables.
+func patternKeys(source *token.Source, x ast.Expr) ([]any, bool) {
+	switch x := x.(type) {
+	case *ast.VariantExpr:
+		return []any{source.GetString(x.Tag.Pos)}, false
+	case *ast.ListExpr:
+		return []any{listKey(len(x.Elements))}, len(x.Elements) == 0
+	case *ast.Literal:
+		// Alternatives with invalid literals, or floats, are left to
+		// Match, which reports the error when they are tried.
+		if lit, err := Literal(source, x); err == nil {
+			if key, ok := constantKey(lit); ok {
+				return []any{key}, true
+			}
+		}
+	case *ast.BinaryExpr:
+		if x.Op == token.PIPE {
+			left, leftExact := patternKeys(source, x.Left)
+			right, rightExact := patternKeys(source, x.Right)
+			if left != nil && right != nil {
+				return append(left, right...), leftExact && rightExact
+			}
+		}
+	}
+	return nil, false
+}
+
+// candidates returns the indexes of the alternatives that may match val, in order.
+func (t *decisionTree) candidates(val Value) []int {
+	if v, ok := val.(Variant); ok {
+		if alts, ok := t.tags[v.tag]; ok {
+			return alts
+		}
+	} else if key, ok := constantKey(val); ok {
+		if alts, ok := t.constants[key]; ok {
+			return alts
+		}
+	}
+	return t.others
+}
@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestDecisionTree(t *testing.T) {
+	se, err := parser.ParseExpr(`| 1 -> "a" | #x y -> "b" | n -> "c" | 2 -> "d" | #x -> "e"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := newDecisionTree(&se.Source, se.Expr.(ast.MatchFuncExpr))
+
+	examples := []struct {
+		val  Value
+		alts []int
+	}{
+		{Int(1), []int{0, 2}},
+		{Int(2), []int{2, 3}},
+		{Int(3), []int{2}},
+		{Text("1"), []int{2}},
+		{Variant{tag: "x"}, []int{1, 2, 4}},
+		{Variant{tag: "y"}, []int{2}},
+	}
+
+	for _, ex := range examples {
+		if alts := tree.candidates(ex.val); !slices.Equal(alts, ex.alts) {
+			t.Errorf("Expected candidates for %s to be %v, got %v", ex.val, ex.alts, alts)
+		}
+	}
+
+	if !slices.Equal(tree.exact, []bool{true, false, false, true, false}) {
+		t.Errorf("Expected only literal alternatives to be exact, got %v", tree.exact)
+	}
+}
+
+func TestMatchLiteralWithoutAllocating(t *testing.T) {
+	val, err := eval(NewEnvironment(), `f ; f = | 1 -> a | 2 -> b | 3 -> c ; a = 1 ; b = 2 ; c = 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := val.(ScriptFunc)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		fn.fn(Int(3))
+	})
+	if allocs > 0 {
+		t.Errorf("Expected no allocations, got %f", allocs)
+	}
+}
+
+func TestDecisionTreeOrPatterns(t *testing.T) {
+	se, err := parser.ParseExpr(`| 1 | 2 -> "a" | #x | #y _ -> "b" | 3 | n -> "c" | 1 | 1 -> "d"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := newDecisionTree(&se.Source, se.Expr.(ast.MatchFuncExpr))
+
+	examples := []struct {
+		val  Value
+		alts []int
+	}{
+		{Int(1), []int{0, 2, 3}},
+		{Int(2), []int{0, 2}},
+		{Int(3), []int{2}},
+		{Variant{tag: "x"}, []int{1, 2}},
+		{Variant{tag: "y"}, []int{1, 2}},
+		{Text("z"), []int{2}},
+	}
+
+	for _, ex := range examples {
+		if alts := tree.candidates(ex.val); !slices.Equal(alts, ex.alts) {
+			t.Errorf("Expected candidates for %s to be %v, got %v", ex.val, ex.alts, alts)
+		}
+	}
+
+	if !slices.Equal(tree.exact, []bool{true, false, false, true}) {
+		t.Errorf("Expected only literal alternatives to be exact, got %v", tree.exact)
+	}
+}
+
+func TestDecisionTreeLists(t *testing.T) {
+	se, err := parser.ParseExpr(`| [] -> "a" | [x] -> "b" | [x] ++ xs -> "c" | [1, y] -> "d"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := newDecisionTree(&se.Source, se.Expr.(ast.MatchFuncExpr))
+
+	list := func(n int) List {
+		return List{elements: leaf(make([]Value, n))}
+	}
+	examples := []struct {
+		val  Value
+		alts []int
+	}{
+		{list(0), []int{0, 2}},
+		{list(1), []int{1, 2}},
+		{list(2), []int{2, 3}},
+		{list(3), []int{2}},
+	}
+
+	for _, ex := range examples {
+		if alts := tree.candidates(ex.val); !slices.Equal(alts, ex.alts) {
+			t.Errorf("Expected candidates for a list of %d to be %v, got %v", ex.val.(List).Len(), ex.alts, alts)
+		}
+	}
+
+	if !slices.Equal(tree.exact, []bool{true, false, false, false}) {
+		t.Errorf("Expected only the empty list to be exact, got %v", tree.exact)
+	}
+}
@@ -0,0 +1,8 @@
+// Package eval evaluates scrapscript programs.
+//
+// An Environment reads, infers, evaluates and renders Scraps, and is the
+// stable entrypoint for embedders. The lower-level Eval, Match and Literal
+// functions, and the Vars, Variables and Binding types they take, are
+// experimental; they expose details of evaluation that change as the
+// language grows.
+package eval
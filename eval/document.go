@@ -0,0 +1,65 @@
+package eval
+
+import (
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// Documentation summarizes the API of a Scrap for people using it,
+// like library authors checking what it exports, or an index of a yard.
+type Documentation struct {
+	// The comment lines of its header, other than pragmas,
+	// without their leading `--`.
+	Comment []string `json:"comment,omitempty"`
+	// The type of the scrap.
+	Type string `json:"type"`
+	// The members of a library, in source order; see types.IsLibrary.
+	Members []Definition `json:"members,omitempty"`
+	// Its top-level where-bindings, in source order.
+	Definitions []Definition `json:"definitions,omitempty"`
+}
+
+// Document infers the type of a Scrap, fetching its imports,
+// and returns its Documentation.
+func (e *Environment) Document(scrap *Scrap) (Documentation, error) {
+	var info types.Info
+	reg, inferImport := e.scratch()
+	ref, err := types.InferInfo(reg, e.typeScope, scrap.expr, inferImport, &info)
+	if err != nil {
+		return Documentation{}, err
+	}
+
+	doc := Documentation{
+		Comment:     scrap.comment(),
+		Type:        reg.String(ref),
+		Definitions: definitions(reg, scrap, &info),
+	}
+
+	// Libraries are record literals, optionally in where-chains.
+	x := scrap.expr.Expr
+	for where, ok := x.(*ast.WhereExpr); ok; where, ok = x.(*ast.WhereExpr) {
+		x = where.Expr
+	}
+	if rec, ok := x.(*ast.RecordExpr); ok && rec.Rest == nil && !rec.IsType() {
+		for _, field := range reg.Fields(ref) {
+			doc.Members = append(doc.Members, Definition{field.Name, reg.String(field.Type)})
+		}
+	}
+	return doc, nil
+}
+
+// comment returns the comment lines of the header of a scrap, other than
+// pragmas, without their leading `--`.
+func (s *Scrap) comment() (lines []string) {
+	header := s.expr.Source.GetString(s.expr.Header.Pos)
+	for _, line := range strings.Split(header, "\n") {
+		text, ok := strings.CutPrefix(line, "--")
+		if !ok || strings.HasPrefix(line, "-- scrap:") {
+			continue
+		}
+		lines = append(lines, strings.TrimSpace(text))
+	}
+	return
+}
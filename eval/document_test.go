@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDocument(t *testing.T) {
+	env := NewEnvironment()
+	source := `-- Counting by one.
+-- scrap:nowarn shadow
+--   Both ways.
+{ inc = n -> n + one, dec = n -> n - one }
+; one = 1`
+	scrap, err := env.Read([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := env.reg.Size()
+	doc, err := env.Document(scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.reg.Size() != size {
+		t.Errorf("The Registry grew from %d to %d types", size, env.reg.Size())
+	}
+
+	if !slices.Equal(doc.Comment, []string{"Counting by one.", "Both ways."}) {
+		t.Errorf("Unexpected comment %q", doc.Comment)
+	}
+	if doc.Type != "{ inc : (int -> int), dec : (int -> int) }" {
+		t.Errorf("Unexpected type %s", doc.Type)
+	}
+	members := []Definition{{"inc", "int -> int"}, {"dec", "int -> int"}}
+	if !slices.Equal(doc.Members, members) {
+		t.Errorf("Expected members %v, got %v", members, doc.Members)
+	}
+	if defs := []Definition{{"one", "int"}}; !slices.Equal(doc.Definitions, defs) {
+		t.Errorf("Expected definitions %v, got %v", defs, doc.Definitions)
+	}
+
+	// Other scraps have no members.
+	scrap, err = env.Read([]byte(`{ ..r, a = 2 } ; r = { a = 1 }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc, err := env.Document(scrap); err != nil || doc.Members != nil || doc.Comment != nil {
+		t.Errorf("Expected no members or comment, got %v, %v", doc, err)
+	}
+}
@@ -3,6 +3,10 @@ package eval
 import (
 	"crypto/sha256"
 	"fmt"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
 
 	"github.com/Victorystick/scrapscript/ast"
 	"github.com/Victorystick/scrapscript/parser"
@@ -12,15 +16,29 @@ import (
 )
 
 type Scrap struct {
-	expr  ast.SourceExpr
-	typ   types.TypeRef
-	value Value
+	expr    ast.SourceExpr
+	typ     stage[types.TypeRef]
+	value   stage[Value]
+	members map[string]*member // Of libraries, by key; may be nil.
+	// Why the Scrap can't be imported by hash, if it has local imports.
+	unlinked error
 }
 
-func (s Scrap) Sha256() string {
+func (s *Scrap) Sha256() string {
 	return fmt.Sprintf("%x", sha256.Sum256(s.expr.Source.Bytes()))
 }
 
+// Header returns the header of the Scrap,
+// with any shebang and pragmas for tools.
+func (s *Scrap) Header() ast.Header {
+	return s.expr.Header
+}
+
+// Expr returns the syntax tree of the Scrap, with its source.
+func (s *Scrap) Expr() ast.SourceExpr {
+	return s.expr
+}
+
 type Sha256Hash = [32]byte
 
 type Environment struct {
@@ -29,34 +47,124 @@ type Environment struct {
 	reg     types.Registry
 	// The TypeScope and Variables match each other's contents.
 	// One is used for type inference, the other for evaluation.
-	typeScope   types.TypeScope
-	vars        Variables
-	scraps      map[Sha256Hash]*Scrap
+	typeScope types.TypeScope
+	vars      Variables
+	// Scraps by the hashes they were read or imported by.
+	scraps map[hashKey]*Scrap
+	// Imports that couldn't be fetched or parsed, and why.
+	failed      map[hashKey]error
+	hashers     map[string]hasher // Only set if RegisterHash was called.
+	kinds       []*HostKind
+	policy      ImportPolicy
+	local       fs.FS      // May be nil.
+	types       *typeCache // May be nil.
 	evalImport  EvalImport
 	inferImport types.InferImport
+	store       Store
+	workers     workers            // Shared with clones.
+	incremental *types.Incremental // May be nil.
+	rt          runtime
 }
 
 func NewEnvironment() *Environment {
 	env := &Environment{}
+	env.scraps = make(map[hashKey]*Scrap)
+	env.store = &MemoryStore{}
+	env.workers = newWorkers()
+	env.init()
+	env.reg.Limit(maxTypes)
+	return env
+}
+
+// Clone returns a copy of the Environment, sharing its pusher, fetcher and
+// options but none of its mutable state.
+//
+// An Environment must not be used by multiple goroutines at once,
+// but clones may be used concurrently with each other. A server could
+// for instance prepare one Environment and Clone it for each request.
+// Scraps must be evaluated by the Environment that read them. Clones share
+// the types of the scraps it has inferred, but evaluate them anew, since
+// values like functions evaluate in the Environment that made them.
+func (e *Environment) Clone() *Environment {
+	clone := &Environment{
+		pusher:  e.pusher,
+		fetcher: e.fetcher,
+		store:   e.store,
+		reg:     e.reg.Clone(),
+		hashers: maps.Clone(e.hashers),
+		kinds:   slices.Clip(e.kinds),
+		policy:  e.policy,
+		local:   e.local,
+		types:   e.types,
+		workers: e.workers,
+		scraps:  make(map[hashKey]*Scrap, len(e.scraps)),
+		rt:      runtime{observe: e.rt.observe, limit: e.rt.limit, profile: e.rt.profile},
+	}
+	if e.rt.interner != nil {
+		clone.rt.interner = &interner{}
+	}
+	if e.rt.memo != nil {
+		clone.rt.memo = &memo{}
+	}
+	if e.incremental != nil {
+		clone.incremental = &types.Incremental{}
+	}
+	if e.rt.provenance != nil {
+		clone.rt.provenance = &provenance{maps.Clone(e.rt.provenance.scraps)}
+	}
+	// Scraps imported by other hashes than sha256 are known by two.
+	copies := make(map[*Scrap]*Scrap, len(e.scraps))
+	for key, scrap := range e.scraps {
+		cp, ok := copies[scrap]
+		if !ok {
+			cp = &Scrap{expr: scrap.expr, typ: scrap.typ.result(), unlinked: scrap.unlinked}
+			cp.members = scrap.cloneMembers()
+			copies[scrap] = cp
+		}
+		clone.scraps[key] = cp
+	}
+	clone.init()
+	return clone
+}
+
+// init binds the built-ins and import functions to the Environment.
+func (env *Environment) init() {
 	typeScope, vars := bindBuiltIns(&env.reg)
 	env.typeScope = typeScope
 	env.vars = vars
-	env.scraps = make(map[Sha256Hash]*Scrap)
+	for _, kind := range env.kinds {
+		env.bindKind(kind)
+	}
+	env.rt.cache = env.cache
+	env.rt.member = env.evalMember
 	env.evalImport = func(algo string, hash []byte) (Value, error) {
+		name := fmt.Sprintf("%x", hash)
+		if algo == localAlgo {
+			name = string(hash)
+		}
+		env.rt.emit(Event{Kind: ImportStarted, Name: name})
+		m := env.rt.measure()
 		scrap, err := env.fetch(algo, hash)
-		if err != nil {
-			return nil, err
+		var val Value
+		if err == nil {
+			val, err = env.eval(scrap)
 		}
-		return env.Eval(scrap)
+		env.rt.emit(Event{
+			Kind:     ImportFinished,
+			Name:     name,
+			Duration: env.rt.measured(m, ImportFinished, "", name),
+			Value:    val,
+			Err:      err,
+		})
+		return val, err
 	}
 	env.inferImport = func(algo string, hash []byte) (types.TypeRef, error) {
 		scrap, err := env.fetch(algo, hash)
 		if err != nil {
 			return types.NeverRef, err
 		}
-		return env.infer(scrap)
+		return env.inferImported(scrap)
 	}
-	return env
 }
 
 func (e *Environment) UsePusher(pusher yards.Pusher) {
@@ -67,62 +175,201 @@ func (e *Environment) UseFetcher(fetcher yards.Fetcher) {
 	e.fetcher = fetcher
 }
 
+// UseObserver registers an Observer to be notified of evaluation Events.
+func (e *Environment) UseObserver(observe Observer) {
+	e.rt.observe = observe
+}
+
+// UseVerboseErrors controls whether type errors print record types
+// in full, rather than abbreviating those with many fields.
+func (e *Environment) UseVerboseErrors(enabled bool) {
+	e.reg.Verbose = enabled
+}
+
+// UseIncremental controls whether inferring scraps reuses the types of
+// where-bindings, of the outermost where-chains of earlier scraps, whose
+// sources and the types of the names they use are unchanged; so that an
+// editor or REPL inferring a scrap after every edit only infers what the
+// edit changed. See types.Incremental.
+func (e *Environment) UseIncremental(enabled bool) {
+	if enabled {
+		e.incremental = &types.Incremental{}
+	} else {
+		e.incremental = nil
+	}
+}
+
 func (e *Environment) fetch(algo string, hash []byte) (*Scrap, error) {
-	if algo != "sha256" {
-		return nil, fmt.Errorf("only sha256 imports are supported")
+	if algo == localAlgo {
+		return e.fetchLocal(string(hash))
 	}
 
-	if len(hash) != sha256.Size {
-		return nil, fmt.Errorf("cannot import sha256 bytes of length %d, must be %d", len(hash), sha256.Size)
+	h, err := e.hasher(algo)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %s: %w", algo, err)
+	}
+
+	if len(hash) != h.size {
+		return nil, fmt.Errorf("cannot import %s bytes of length %d, must be %d", algo, len(hash), h.size)
 	}
 
-	if scrap, ok := e.scraps[(Sha256Hash)(hash)]; ok {
+	if e.policy != nil && !e.policy(algo, fmt.Sprintf("%x", hash)) {
+		return nil, &ErrImportDenied{algo, fmt.Sprintf("%x", hash)}
+	}
+
+	key := hashKey{algo, string(hash)}
+	if scrap, ok := e.scraps[key]; ok {
+		// Like a scrap with local imports read before.
+		if scrap.unlinked != nil {
+			return nil, scrap.unlinked
+		}
 		return scrap, nil
 	}
+	if err, ok := e.failed[key]; ok {
+		return nil, err
+	}
 
+	scrap, err := e.fetchAndRead(h, algo, hash)
+	if err != nil {
+		if transient(err) {
+			return nil, err
+		}
+		if e.failed == nil {
+			e.failed = make(map[hashKey]error)
+		}
+		e.failed[key] = err
+		return nil, err
+	}
+	e.scraps[key] = scrap
+	return scrap, nil
+}
+
+func (e *Environment) fetchAndRead(h hasher, algo string, hash []byte) (*Scrap, error) {
 	if e.fetcher == nil {
-		return nil, fmt.Errorf("cannot import without a fetcher")
+		return nil, &fetchError{fmt.Errorf("cannot import without a fetcher")}
 	}
 
-	key := fmt.Sprintf("%x", hash)
-	bytes, err := e.fetcher.FetchSha256(key)
+	bytes, err := e.fetchHash(h, algo, hash)
 	if err != nil {
-		return nil, err
+		return nil, &fetchError{err}
 	}
 
-	return e.Read(bytes)
+	scrap, err := e.read(bytes)
+	if err != nil {
+		return nil, err
+	}
+	if scrap.unlinked != nil {
+		return nil, scrap.unlinked
+	}
+	e.register(scrap)
+	return scrap, nil
 }
 
+// Read parses a script into a Scrap. Scraps requiring a newer Version
+// than this one, by a `scrap:version` pragma, are refused with an
+// ErrUnsupportedVersion.
 func (e *Environment) Read(script []byte) (*Scrap, error) {
+	scrap, err := e.read(script)
+	if err != nil {
+		return nil, err
+	}
+	e.register(scrap)
+	return scrap, nil
+}
+
+// read parses a script into a Scrap, like Read, without registering it.
+func (e *Environment) read(script []byte) (*Scrap, error) {
 	src := token.NewSource(script)
 	se, err := parser.Parse(&src)
 
+	// Scraps requiring newer syntax would fail to parse,
+	// so the version is checked first.
+	if err := checkVersion(&src, se.Header); err != nil {
+		return nil, err
+	}
 	if err != nil {
 		return nil, fmt.Errorf("parse error: %w", err)
 	}
 
 	scrap := &Scrap{expr: se}
-	e.scraps[sha256.Sum256(script)] = scrap
+	scrap.unlinked = scrap.checkUnlinked()
 	return scrap, nil
 }
 
+// register makes a Scrap known by its sha256 hash.
+func (e *Environment) register(scrap *Scrap) {
+	sum := sha256.Sum256(scrap.expr.Source.Bytes())
+	e.scraps[hashKey{"sha256", string(sum[:])}] = scrap
+}
+
 // Eval evaluates a Scrap.
 func (e *Environment) Eval(scrap *Scrap) (Value, error) {
-	if scrap.value == nil {
-		value, err := Eval(scrap.expr, &e.reg, e.vars, e.evalImport)
-		scrap.value = value
-		return value, err
+	if tiny && e.rt.limit <= 0 {
+		return nil, ErrFuelRequired
 	}
-	return scrap.value, nil
+	e.rt.fuel = 0
+	m := e.rt.measure()
+	value, err := e.eval(scrap)
+	e.rt.emit(Event{
+		Kind:     ResultReady,
+		Duration: e.rt.measured(m, ResultReady, "", ""),
+		Value:    value,
+		Err:      err,
+	})
+	return value, err
+}
+
+func (e *Environment) eval(scrap *Scrap) (Value, error) {
+	return scrap.value.run(e, func() (Value, error) {
+		return evalWith(scrap.expr, scrapName(scrap.Sha256()), &e.reg, e.vars, e.evalImport, &e.rt)
+	})
 }
 
 func (e *Environment) infer(scrap *Scrap) (types.TypeRef, error) {
-	if scrap.typ == types.NeverRef {
-		ref, err := types.Infer(&e.reg, e.typeScope, scrap.expr, e.inferImport)
-		scrap.typ = ref
+	return e.inferStage(scrap, false)
+}
+
+// inferImported infers the type of an imported Scrap, which is shared
+// through the type cache; see UseTypeCache.
+func (e *Environment) inferImported(scrap *Scrap) (types.TypeRef, error) {
+	return e.inferStage(scrap, true)
+}
+
+func (e *Environment) inferStage(scrap *Scrap, imported bool) (types.TypeRef, error) {
+	return scrap.typ.run(e, func() (types.TypeRef, error) {
+		if imported {
+			if ref, ok := e.fetchType(scrap); ok {
+				return ref, nil
+			}
+		}
+		e.inferImports(scrap)
+		var ref types.TypeRef
+		var err error
+		if e.incremental != nil {
+			ref, err = e.incremental.Infer(&e.reg, e.typeScope, scrap.expr, e.inferImport, e.inferMember, nil)
+		} else {
+			ref, err = types.InferMembers(&e.reg, e.typeScope, scrap.expr, e.inferImport, e.inferMember, nil)
+		}
+		if err == nil && imported {
+			e.storeType(scrap, ref)
+		}
 		return ref, err
+	})
+}
+
+// scratch returns a clone of the Registry, and an InferImport for it, for
+// inferring scraps being edited without filling the Registry with the
+// types of every keystroke. Imports are still inferred once, into the
+// Registry, and copied into the clone.
+func (e *Environment) scratch() (*types.Registry, types.InferImport) {
+	reg := e.reg.Clone()
+	return &reg, func(algo string, hash []byte) (types.TypeRef, error) {
+		ref, err := e.inferImport(algo, hash)
+		if err != nil {
+			return types.NeverRef, err
+		}
+		return reg.Decode(e.reg.Encode(ref))
 	}
-	return scrap.typ, nil
 }
 
 // Infer returns the string representation of the type of a Scrap.
@@ -132,17 +379,171 @@ func (e *Environment) Infer(scrap *Scrap) (string, error) {
 }
 
 // Scrap renders a Value as self-contained scrapscript program.
+// Variants are picked from their enum type, wherever they're nested,
+// and functions bind the values they capture in where-clauses.
 func (e *Environment) Scrap(value Value) string {
-	if vr, ok := value.(Variant); ok {
-		if vr.value == nil {
-			return fmt.Sprintf("(%s)::%s", e.reg.String(vr.typ), vr.tag)
+	var b strings.Builder
+	e.writeScrap(&b, value, 0)
+	return b.String()
+}
+
+// EmitScrap renders a Value like Scrap, but only if the result evaluates
+// back to a value that renders the same, so that it's guaranteed to be
+// valid input. Values that can't be rendered faithfully, like partially
+// applied built-ins or values nested deeper than MaxNesting, are errors.
+func (e *Environment) EmitScrap(value Value) (string, error) {
+	text := e.Scrap(value)
+	// Values are often emitted as the scrap they were read from,
+	// whose type and value are reused.
+	sum := sha256.Sum256([]byte(text))
+	scrap, ok := e.scraps[hashKey{"sha256", string(sum[:])}]
+	if !ok {
+		var err error
+		if scrap, err = e.read([]byte(text)); err != nil {
+			return "", fmt.Errorf("cannot emit %s as scrapscript, since it doesn't parse: %w", text, err)
+		}
+	}
+	// Functions are only checked when called, so check their types too,
+	// without filling the Registry with them.
+	err := scrap.typ.err
+	if scrap.typ.state != stageDone {
+		reg, inferImport := e.scratch()
+		_, err = types.Infer(reg, e.typeScope, scrap.expr, inferImport)
+	}
+	if err != nil {
+		return "", fmt.Errorf("cannot emit %s as scrapscript, since it isn't well-typed: %w", text, err)
+	}
+	val, err := e.eval(scrap)
+	if err != nil {
+		return "", fmt.Errorf("cannot emit %s as scrapscript, since it doesn't evaluate: %w", text, err)
+	}
+	// The types of lists aren't rendered, so values are compared as text.
+	if again := e.Scrap(val); again != text {
+		return "", fmt.Errorf("cannot emit %s as scrapscript, since it evaluates to %s", text, again)
+	}
+	return text, nil
+}
+
+func (e *Environment) writeScrap(b *strings.Builder, v Value, depth int) {
+	switch v.(type) {
+	case Record, List, Variant, ScriptFunc:
+		if depth >= MaxNesting {
+			b.WriteString("...")
+			return
+		}
+	}
+
+	switch v := v.(type) {
+	case Record:
+		b.WriteString("{ ")
+		comma := len(v.values) - 1
+		for _, key := range slices.Sorted(maps.Keys(v.values)) {
+			b.WriteString(key)
+			b.WriteString(" = ")
+			e.writeNested(b, v.values[key], depth+1)
+
+			if comma > 0 {
+				comma -= 1
+				b.WriteString(", ")
+			}
+		}
+		b.WriteString(" }")
+	case List:
+		if v.Len() == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[ ")
+		comma := v.Len() - 1
+		for _, val := range v.values() {
+			e.writeNested(b, val, depth+1)
+
+			if comma > 0 {
+				comma -= 1
+				b.WriteString(", ")
+			}
+		}
+		b.WriteString(" ]")
+	case Variant:
+		fmt.Fprintf(b, "(%s)::%s", e.reg.String(v.typ), v.tag)
+		if v.value != nil {
+			b.WriteString(" ")
+			// The value is an argument, so anything but atoms is parenthesized;
+			// and variants, which open with the parenthesized enum.
+			if _, ok := v.value.(Variant); !ok && isAtom(v.value) {
+				e.writeScrap(b, v.value, depth+1)
+			} else {
+				e.writeParens(b, v.value, depth+1)
+			}
+		}
+	case ScriptFunc:
+		b.WriteString(v.String())
+		// Bindings that fail to evaluate are left unbound, so the
+		// function fails when it uses them, like it would have.
+		captured, _ := v.Captured()
+		for _, binding := range captured {
+			fmt.Fprintf(b, "\n; %s = ", binding.name)
+			e.writeNested(b, binding.value, depth+1)
 		}
-		return fmt.Sprintf("(%s)::%s %s", e.reg.String(vr.typ), vr.tag, e.Scrap(vr.value))
+	case Type:
+		b.WriteString(e.reg.String(types.TypeRef(v)))
+	default:
+		b.WriteString(v.String())
 	}
-	return value.String()
+}
+
+// writeNested writes a value within a record, list or where-clause,
+// where functions and types other than names must be parenthesized.
+func (e *Environment) writeNested(b *strings.Builder, v Value, depth int) {
+	switch v := v.(type) {
+	case ScriptFunc:
+		e.writeParens(b, v, depth)
+	case Type:
+		if typ := e.reg.String(types.TypeRef(v)); strings.Contains(typ, " ") {
+			fmt.Fprintf(b, "(%s)", typ)
+		} else {
+			b.WriteString(typ)
+		}
+	default:
+		e.writeScrap(b, v, depth)
+	}
+}
+
+func (e *Environment) writeParens(b *strings.Builder, v Value, depth int) {
+	b.WriteString("(")
+	e.writeScrap(b, v, depth)
+	b.WriteString(")")
+}
+
+// isAtom reports whether the rendering of a value can be
+// passed as an argument without parentheses.
+func isAtom(v Value) bool {
+	switch v := v.(type) {
+	case Int:
+		return v >= 0
+	case Float:
+		return v >= 0
+	case Variant:
+		return v.value == nil
+	case Hole, Text, Byte, Bytes, Record, List, BuiltInFunc:
+		return true
+	}
+	return false
+}
+
+// argument renders a value passed as an argument,
+// parenthesized unless it's an atom.
+func argument(v Value) string {
+	if isAtom(v) {
+		return v.String()
+	}
+	return "(" + v.String() + ")"
 }
 
 func (e *Environment) Push(scrap *Scrap) (string, error) {
+	if slices.ContainsFunc(imports(scrap), func(imp importRef) bool { return imp.algo == localAlgo }) {
+		return "", fmt.Errorf("cannot push a scrap with local imports; link it first")
+	}
 	if e.pusher == nil {
 		return "", fmt.Errorf("cannot push without a pusher")
 	}
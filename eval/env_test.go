@@ -1,6 +1,17 @@
 package eval
 
-import "testing"
+import (
+	goctx "context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/token"
+)
 
 func TestInferBuiltin(t *testing.T) {
 	examples := []struct {
@@ -12,10 +23,28 @@ func TestInferBuiltin(t *testing.T) {
 		{`ceil`, `float -> int`},
 		{`floor`, `float -> int`},
 		{`to-float`, `int -> float`},
+		{`int/abs`, `int -> int`},
+		{`int/min`, `int -> int -> int`},
+		{`float/pow`, `float -> float -> float`},
+		{`float/sqrt`, `float -> float`},
+		{`int/parse`, `text -> #ok int #err text`},
+		{`float/parse "1.5" |> | #ok f -> f | #err _ -> 0.0`, `float`},
+		{`int/to-text`, `int -> text`},
+		{`float/to-text`, `float -> text`},
 
 		// byte <-> text conversion
 		{`bytes/to-utf8-text`, `bytes -> text`},
 		{`bytes/from-utf8-text`, `text -> bytes`},
+		{`bytes/length`, `bytes -> int`},
+		{`bytes/slice`, `int -> int -> bytes -> bytes`},
+		{`bytes/at`, `int -> bytes -> #some byte #none`},
+		{`bytes/concat-all`, `list bytes -> bytes`},
+		{`byte/to-int`, `byte -> int`},
+		{`int/to-byte`, `int -> #ok byte #err text`},
+		{`bytes/to-hex`, `bytes -> text`},
+		{`bytes/from-hex`, `text -> #ok bytes #err text`},
+		{`bytes/to-base64`, `bytes -> text`},
+		{`bytes/from-base64`, `text -> #ok bytes #err text`},
 
 		// list
 		{`list/length`, `list $0 -> int`},
@@ -23,6 +52,15 @@ func TestInferBuiltin(t *testing.T) {
 		{`list/map (a -> a + 1)`, `list int -> list int`},
 		{`list/fold`, `$0 -> ($0 -> $1 -> $0) -> list $1 -> $0`},
 		{`list/repeat`, `int -> $0 -> list $0`},
+		{`int/sum`, `list int -> int`},
+		{`float/sum`, `list float -> float`},
+		{`float/sum [] + 1.5`, `float`},
+		{`int/sum [1, 2]`, `int`},
+		{`float/sum [1.0]`, `float`},
+
+		// record
+		{`record/keys`, `record $0 => $0 -> list text`},
+		{`record/keys { a = 1 }`, `list text`},
 
 		// text
 		{`text/length`, `text -> int`},
@@ -33,8 +71,16 @@ func TestInferBuiltin(t *testing.T) {
 		{`list/fold 0 (a -> b -> a + text/length b) ["hey", "beautiful"]`, `int`},
 
 		{`fix`, `($0 -> $1) -> $0 -> $1`},
+		{`cache`, `$0 -> $0`},
+		{`cache (list/repeat 2 "a")`, `list text`},
 		{`fix (a -> a)`, `$3 -> $3`},
 
+		// Types are values too.
+		{`int`, `type int`},
+		{`f text ; f = t -> t`, `type text`},
+		{`x ; x : int = 1`, `int`},
+		{`t ; t : #a #b`, `type (#a #b)`},
+
 		// TODO: These should be equivalent, from a type perspective.
 		{`| 0 -> [0] | n -> seq (n - 1) +< n ; seq = x -> [x]`, `int -> list int`},
 		{`fix (seq -> | 0 -> [0] | n -> seq (n - 1) +< n)`, `(int -> list int) -> int -> list int`},
@@ -60,3 +106,297 @@ func TestInferBuiltin(t *testing.T) {
 		}
 	}
 }
+
+func TestInferBuiltinFailure(t *testing.T) {
+	for source, msg := range map[string]string{
+		`record/keys 1`:      `cannot unify 'record $1 => $1' with 'int': int isn't a record`,
+		`record/keys [1, 2]`: `int isn't a record`,
+	} {
+		env := NewEnvironment()
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Infer(scrap); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", source, msg, err)
+		}
+	}
+}
+
+func TestObserver(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445": `2`,
+	})
+
+	var kinds []string
+	env.UseObserver(func(ev Event) {
+		kinds = append(kinds, ev.Kind.String()+" "+ev.Name)
+	})
+
+	// Where-bindings are evaluated once, when first used; so the unused
+	// import of a scrap that doesn't exist is never fetched.
+	_, err := eval(env, `a + b + a ; a = 1 ; b = $sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445 ; c = $sha256~~0000000000000000000000000000000000000000000000000000000000000000`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"binding-evaluated a",
+		"import-started a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445",
+		"import-finished a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445",
+		"binding-evaluated b",
+		"result-ready ",
+	}
+	if !slices.Equal(kinds, expected) {
+		t.Errorf("Expected events:\n%v\ngot:\n%v", expected, kinds)
+	}
+}
+
+func TestEvalCancelled(t *testing.T) {
+	env := NewEnvironment()
+	scrap, err := env.Read([]byte(`loop 0 ; loop = fix (loop -> n -> loop (n + 1))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.UseFuel(1000)
+	_, err = env.Eval(scrap)
+	var cancelled *ErrCancelled
+	if !errors.As(err, &cancelled) || !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("Expected fuel to run out, got: %v", err)
+	}
+	if cancelled.Fuel != 1000 {
+		t.Errorf("Expected 1000 steps, got %d", cancelled.Fuel)
+	}
+
+	env.UseFuel(0)
+	ctx, cancel := goctx.WithCancel(goctx.Background())
+	cancel()
+	_, err = env.EvalContext(ctx, scrap)
+	if !errors.As(err, &cancelled) || !errors.Is(err, goctx.Canceled) {
+		t.Fatalf("Expected cancellation, got: %v", err)
+	}
+	if cancelled.Fuel != 0 {
+		t.Errorf("Expected no steps, got %d", cancelled.Fuel)
+	}
+}
+
+func TestCloneConcurrently(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445": `[ "x" ]`,
+		"b6a5cf693b91266fdc8ff7a852063deeca8e250dd16591e5efa3e9411f9e3d87": `n -> n + one ; one = 1`,
+	})
+	// The clones don't call the functions the Environment evaluated.
+	if _, err := eval(env, `$sha256~~b6a5cf693b91266fdc8ff7a852063deeca8e250dd16591e5efa3e9411f9e3d87`); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		clone := env.Clone()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			source := fmt.Sprintf(`[ inc (list/length rec + %d) - 1 ] ; inc = $sha256~~b6a5cf693b91266fdc8ff7a852063deeca8e250dd16591e5efa3e9411f9e3d87 ; rec = $sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445`, i)
+			val, err := eval(clone, source)
+			if err != nil {
+				t.Error(err)
+			} else if val.String() != fmt.Sprintf("[ %d ]", i+1) {
+				t.Errorf("Unexpected value %s", val)
+			}
+			scrap, _ := clone.Read([]byte(source))
+			if typ, err := clone.Infer(scrap); err != nil || typ != "list int" {
+				t.Errorf("Unexpected type %s: %v", typ, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCache(t *testing.T) {
+	env := NewEnvironment()
+	store := &MemoryStore{}
+	env.UseStore(store)
+
+	val, err := eval(env, `cache (1 + 2)`)
+	if err != nil || val.String() != "3" {
+		t.Fatalf("Unexpected result %v: %v", val, err)
+	}
+	if len(store.data) != 1 {
+		t.Fatalf("Expected one stored value, got %d", len(store.data))
+	}
+
+	// Tamper with the stored value to observe that it is used,
+	// even though the surrounding scrap changed.
+	for key := range store.data {
+		store.data[key] = []byte("42")
+	}
+	val, err = eval(env, `10 + cache (1 + 2)`)
+	if err != nil || val.String() != "52" {
+		t.Errorf("Expected stored value to be used, got %v: %v", val, err)
+	}
+
+	// Referenced variables are part of the key.
+	val, err = eval(env, `cache (x + 2) ; x = 2`)
+	if err != nil || val.String() != "4" {
+		t.Errorf("Unexpected result %v: %v", val, err)
+	}
+	val, err = eval(env, `cache (x + 2) ; x = 3`)
+	if err != nil || val.String() != "5" {
+		t.Errorf("Unexpected result %v: %v", val, err)
+	}
+
+	// Values nested too deep to render aren't cached.
+	clear(store.data)
+	val, err = eval(env, `cache (list/length x) ; x = list/repeat 10001 0 |> list/fold [] (acc -> _ -> [ acc ])`)
+	if err != nil || val.String() != "1" {
+		t.Errorf("Unexpected result %v: %v", val, err)
+	}
+	if len(store.data) != 0 {
+		t.Errorf("Expected nothing to be stored, got %d values", len(store.data))
+	}
+
+	// Keys don't depend on the order types are registered in,
+	// and stored values aren't registered as scraps.
+	if _, err := eval(env, `cache r.a ; r = { b = "b", a = [1] }`); err != nil {
+		t.Fatal(err)
+	}
+	for key := range store.data {
+		store.data[key] = []byte("[42]")
+	}
+	other := NewEnvironment()
+	other.UseStore(store)
+	if _, err := eval(other, `{ c = 1 }`); err != nil {
+		t.Fatal(err)
+	}
+	scraps := len(other.scraps)
+	val, err = eval(other, `cache r.a ; r = { a = [1], b = "b" }`)
+	if err != nil || val.String() != "[ 42 ]" {
+		t.Errorf("Expected stored value to be used, got %v: %v", val, err)
+	}
+	if len(other.scraps) != scraps+1 {
+		t.Errorf("Expected only the evaluated scrap to be registered, got %d more", len(other.scraps)-scraps)
+	}
+}
+
+func TestScrapErrorTrace(t *testing.T) {
+	env := NewEnvironment()
+	lib := `| 1 -> "one"`
+	broken := `unknown`
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	env.UseFetcher(MapFetcher{
+		hash(lib):    lib,
+		hash(broken): broken,
+	})
+
+	// Calling a function of an imported scrap.
+	_, err := eval(env, `f 2 ; f = $sha256~~`+hash(lib))
+	var se *ScrapError
+	if !errors.As(err, &se) {
+		t.Fatalf("Expected a ScrapError, got %v", err)
+	}
+	if se.Scrap != "$sha256~~"+hash(lib) || se.At.Msg != "called here" {
+		t.Errorf("Unexpected trace %s at %s", se.Scrap, se.At.Msg)
+	}
+
+	// Importing a scrap that fails to evaluate.
+	_, err = eval(env, `1 + $sha256~~`+hash(broken))
+	if !errors.As(err, &se) {
+		t.Fatalf("Expected a ScrapError, got %v", err)
+	}
+	if se.Scrap != "$sha256~~"+hash(broken) || se.At.Msg != "imported here" {
+		t.Errorf("Unexpected trace %s at %s", se.Scrap, se.At.Msg)
+	}
+	if !strings.Contains(err.Error(), "unknown variable unknown") {
+		t.Errorf("Expected the cause in the trace, got %s", err)
+	}
+}
+
+// TestEmitScrap checks that every value in the tests
+// can be emitted as scrapscript that evaluates back to it.
+func TestEmitScrap(t *testing.T) {
+	for _, ex := range append(slices.Clip(expressions), exp2str...) {
+		env := NewEnvironment()
+		val, err := eval(env, ex.source)
+		if err != nil {
+			continue
+		}
+		if _, err := env.EmitScrap(val); err != nil {
+			t.Errorf("EmitScrap of %q: %s", ex.source, err)
+		}
+	}
+
+	// Partially applied built-ins don't render the values their
+	// arguments capture.
+	env := NewEnvironment()
+	val, err := eval(env, `list/map (x -> x + a) ; a = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text, err := env.EmitScrap(val); err == nil || !strings.Contains(err.Error(), "unknown variable a") {
+		t.Errorf("Expected an error about a, got %q, %v", text, err)
+	}
+
+	// Emitting doesn't infer types into the Registry.
+	env = NewEnvironment()
+	val, err = eval(env, `f ; f = x -> { a = x, b = [x] }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := env.reg.Size()
+	if _, err := env.EmitScrap(val); err != nil {
+		t.Fatal(err)
+	}
+	if env.reg.Size() != size {
+		t.Errorf("Expected EmitScrap to keep %d types, got %d", size, env.reg.Size())
+	}
+}
+
+func TestReadWindowsInput(t *testing.T) {
+	env := NewEnvironment()
+	scrap, err := env.Read([]byte("\uFEFFf 1\r\n; f = a -> a + 1\r\n\x00\x00"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, err := env.Eval(scrap); err != nil || val.String() != "2" {
+		t.Errorf("expected 2, got %v, %v", val, err)
+	}
+
+	scrap, err = env.Read([]byte("\uFEFFf 1\r\n; f = a -> a + \"1\"\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = env.Eval(scrap)
+	var terr token.Error
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected a token.Error, got %v", err)
+	}
+	if terr.Pos.Line != 2 || terr.Line != `; f = a -> a + "1"` {
+		t.Errorf("unexpected error on line %d: %q", terr.Pos.Line, terr.Line)
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	env := NewEnvironment()
+	env.UseIncremental(true)
+	for source, expected := range map[string]string{
+		`f 1 ; f = a -> a + 1`:   `int`,
+		`f 1.0 ; f = a -> a + 1`: ``,
+		`f 1 ; f = a -> [ a ]`:   `list int`,
+	} {
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := env.Infer(scrap)
+		if expected == "" && err == nil {
+			t.Errorf("%s: expected an error, got %s", source, typ)
+		} else if expected != "" && (err != nil || typ != expected) {
+			t.Errorf("%s: expected %s, got %s, %v", source, expected, typ, err)
+		}
+	}
+}
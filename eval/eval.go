@@ -1,16 +1,19 @@
 package eval
 
 import (
+	goctx "context"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"maps"
+	"math"
 	"reflect"
 	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/internal/spell"
 	"github.com/Victorystick/scrapscript/token"
 	"github.com/Victorystick/scrapscript/types"
 )
@@ -19,12 +22,40 @@ type EvalImport func(algo string, hash []byte) (Value, error)
 
 type context struct {
 	source     *token.Source
+	scrap      string // The name of the scrap being evaluated, if any.
 	reg        *types.Registry
 	vars       Vars
 	evalImport EvalImport
+	rt         *runtime
 	parent     *context
 }
 
+// The state shared by all contexts of an evaluation.
+type runtime struct {
+	observe  Observer
+	ctx      goctx.Context // May be nil.
+	fuel     int           // Steps taken.
+	limit    int           // Maximum steps; unlimited if zero.
+	interner *interner     // May be nil.
+	// The scraps that constructed values; may be nil.
+	provenance *provenance
+	frames     []frame // The calls in progress.
+	// The free variables of functions, to find the values they capture.
+	freeVars ast.FreeVarsCache
+	// The printed source of functions, to render them by.
+	printed map[printedKey]string
+	// Looks up or computes the value of the source of a `cache`
+	// expression, that references vars.
+	cache func(source string, vars Variables, compute func() (Value, error)) (Value, error)
+	// Evaluates a member of an imported library, for `$algo~~hash.key`,
+	// or reports false if it's not a library with the member; may be nil.
+	member func(algo string, hash []byte, key string) (Value, bool, error)
+	// Remembers the results of calls of user-defined functions; may be nil.
+	memo *memo
+	// Records the time and memory of each step; may be nil.
+	profile *Profile
+}
+
 type Vars interface {
 	Get(name string) Value
 }
@@ -35,11 +66,15 @@ func (v Variables) Get(name string) Value {
 	return v[name]
 }
 
+// A Binding is a name bound to a value.
 type Binding struct {
 	name  string
 	value Value
 }
 
+func (b Binding) Name() string { return b.name }
+func (b Binding) Value() Value { return b.value }
+
 func (b Binding) Get(name string) Value {
 	if b.name == name {
 		return b.value
@@ -47,20 +82,77 @@ func (b Binding) Get(name string) Value {
 	return nil
 }
 
+// A lazyBinding binds a name to the value of a where-binding, which is
+// evaluated when the name is first looked up, if ever. Since values are
+// pure, the only observable difference from evaluating it eagerly is that
+// errors in unused bindings, and the imports only they use, go unnoticed.
+type lazyBinding struct {
+	name  string
+	eval  func() (Value, error)
+	value stage[Value]
+}
+
+// Get returns the value bound to name, if it's been evaluated without
+// error; lookup evaluates it, and returns its errors.
+func (b *lazyBinding) Get(name string) Value {
+	if r := b.value.result(); b.name == name && r.err == nil {
+		return r.val
+	}
+	return nil
+}
+
+// force evaluates the binding for owner, the runtime looking it up, once.
+// Forcing it again while it's evaluated for the same owner depends on
+// itself; other owners wait for its value, rather than evaluate it too.
+func (b *lazyBinding) force(owner *runtime) (Value, error) {
+	return b.value.run(owner, b.eval)
+}
+
+// lookup returns the value bound to name in vars, and whether it's bound
+// there, even if evaluating a lazy binding of it fails, so that bindings it
+// shadows aren't used instead.
+func lookup(vars Vars, name string, owner *runtime) (Value, bool, error) {
+	if lazy, ok := vars.(*lazyBinding); ok {
+		if lazy.name != name {
+			return nil, false, nil
+		}
+		val, err := lazy.force(owner)
+		return val, true, err
+	}
+	val := vars.Get(name)
+	return val, val != nil, nil
+}
+
 func (c *context) ident(x *ast.Ident) (Value, error) {
 	name := c.name(x)
 
 	// Traverse the context stack.
-	context := c
-	for context != nil {
-		val := context.vars.Get(name)
-		if val != nil {
-			return val, nil
+	for context := c; context != nil; context = context.parent {
+		if val, ok, err := lookup(context.vars, name, c.rt); ok {
+			return val, err
 		}
-		context = context.parent
 	}
 
-	return nil, c.error(x.Pos, fmt.Sprintf("unknown variable %s", name))
+	msg := fmt.Sprintf("unknown variable %s", name)
+	if s := spell.Suggest(name, c.names()); s != "" {
+		msg += fmt.Sprintf("; did you mean %s?", s)
+	}
+	return nil, c.error(x.Pos, msg)
+}
+
+// names returns the names bound in a context, innermost first.
+func (c *context) names() (names []string) {
+	for context := c; context != nil; context = context.parent {
+		switch vars := context.vars.(type) {
+		case Variables:
+			names = append(names, slices.Sorted(maps.Keys(vars))...)
+		case Binding:
+			names = append(names, vars.name)
+		case *lazyBinding:
+			names = append(names, vars.name)
+		}
+	}
+	return
 }
 
 func (c *context) name(id *ast.Ident) string {
@@ -68,7 +160,7 @@ func (c *context) name(id *ast.Ident) string {
 }
 
 func (c *context) sub(vars Vars) *context {
-	return &context{c.source, c.reg, vars, c.evalImport, c}
+	return &context{c.source, c.scrap, c.reg, vars, c.evalImport, c.rt, c}
 }
 
 func (c *context) error(span token.Span, msg string) error {
@@ -77,12 +169,30 @@ func (c *context) error(span token.Span, msg string) error {
 
 // Eval evaluates a SourceExpr in the context of a set of variables.
 func Eval(se ast.SourceExpr, reg *types.Registry, vars Vars, evalImport EvalImport) (Value, error) {
-	ctx := &context{&se.Source, reg, vars, evalImport, nil}
+	return evalWith(se, "", reg, vars, evalImport, &runtime{})
+}
+
+func evalWith(se ast.SourceExpr, scrap string, reg *types.Registry, vars Vars, evalImport EvalImport, rt *runtime) (val Value, err error) {
+	ctx := &context{&se.Source, scrap, reg, vars, evalImport, rt, nil}
+	defer types.RecoverLimit(&err)
 
 	return ctx.eval(se.Expr)
 }
 
+// evalMember evaluates the member key of a library in the context
+// of a set of variables, like evalWith.
+func evalMember(se ast.SourceExpr, scrap, key string, reg *types.Registry, vars Vars, evalImport EvalImport, rt *runtime) (val Value, err error) {
+	ctx := &context{&se.Source, scrap, reg, vars, evalImport, rt, nil}
+	defer types.RecoverLimit(&err)
+
+	return ctx.member(se.Expr, key)
+}
+
 func (c *context) eval(x ast.Node) (Value, error) {
+	if err := c.rt.step(c.source, x); err != nil {
+		return nil, err
+	}
+
 	switch x := x.(type) {
 	case *ast.Literal:
 		return Literal(c.source, x)
@@ -95,8 +205,18 @@ func (c *context) eval(x ast.Node) (Value, error) {
 	case *ast.WhereExpr:
 		return c.where(x)
 	case ast.EnumExpr:
+		if len(x) == 1 && x[0].Typ != nil {
+			return c.variant(x[0])
+		}
 		return c.enum(x)
 	case *ast.RecordExpr:
+		if x.IsType() {
+			ref, err := c.typeRef(x)
+			if err != nil {
+				return nil, err
+			}
+			return Type(ref), nil
+		}
 		return c.recordExpr(x)
 	case *ast.ListExpr:
 		return c.listExpr(x)
@@ -107,16 +227,33 @@ func (c *context) eval(x ast.Node) (Value, error) {
 	case *ast.AccessExpr:
 		return c.access(x)
 	case *ast.ImportExpr:
-		bs, err := hex.DecodeString(c.source.GetString(x.Value.Pos.TrimStart(2)))
+		bs, err := x.Hash(c.source)
 		if err != nil {
 			return nil, c.error(x.Span(), fmt.Sprintf("bad import hash %#v", x))
 		}
-		return c.evalImport(x.HashAlgo, bs)
+		val, err := c.evalImport(x.HashAlgo, bs)
+		if err != nil {
+			return nil, c.importError(x, bs, err)
+		}
+		return val, nil
 	}
 
 	return nil, c.error(x.Span(), fmt.Sprintf("unhandled node %#v", x))
 }
 
+// importError wraps an error of an import in a ScrapError.
+func (c *context) importError(x *ast.ImportExpr, hash []byte, err error) error {
+	name := fmt.Sprintf("$%s~~%x", x.HashAlgo, hash)
+	if x.Local() {
+		name = fmt.Sprintf("$local:%s", hash)
+	}
+	return &ScrapError{
+		Scrap: name,
+		At:    c.source.Error(x.Span(), "imported here"),
+		Err:   err,
+	}
+}
+
 func Literal(source *token.Source, x *ast.Literal) (Value, error) {
 	switch x.Kind {
 	case token.HOLE:
@@ -142,7 +279,7 @@ func Literal(source *token.Source, x *ast.Literal) (Value, error) {
 		if err != nil {
 			return nil, err
 		}
-		return Bytes(dst[:n]), nil
+		return Bytes(dst[:n:n]), nil
 	case token.BYTE:
 		val, err := strconv.ParseUint(source.GetString(x.Pos.TrimStart(1)), 16, 8)
 		if err != nil {
@@ -167,6 +304,20 @@ func binop[T ~int | ~float64](t token.Token, a, b T) (T, error) {
 	return 0, fmt.Errorf("unhandled binop %s", t)
 }
 
+// overflows reports whether res, the result of a binop of a and b, wrapped
+// around rather than fit in an int.
+func overflows(t token.Token, a, b, res Int) bool {
+	switch t {
+	case token.ADD:
+		return (a^res)&(b^res) < 0
+	case token.SUB:
+		return (a^b)&(a^res) < 0
+	case token.MUL:
+		return a != 0 && (res/a != b || a == -1 && b == math.MinInt)
+	}
+	return false
+}
+
 func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 	switch x.Op {
 	case token.ADD, token.SUB, token.MUL:
@@ -186,11 +337,16 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			return binop(x.Op, lf, rf)
+			res, err := binop(x.Op, lf, rf)
+			if err == nil && overflows(x.Op, lf, rf, res) {
+				return nil, c.error(x.Span(),
+					fmt.Sprintf("%d %s %d overflows", lf, x.Op.Op(), rf))
+			}
+			return res, err
 		}
 		return nil, c.error(x.Span(),
 			fmt.Sprintf("cannot perform addition on %s",
-				c.reg.String(l.Type())))
+				c.reg.ErrorString(l.Type())))
 
 	case token.APPEND:
 		l, err := c.eval(x.Left)
@@ -203,7 +359,8 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			return append(bs, byte(r)), nil
+			// Values share their bytes, so appending copies them.
+			return append(bs[:len(bs):len(bs)], byte(r)), nil
 		}
 
 		if ls, ok := l.(List); ok {
@@ -211,18 +368,13 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			typ := c.reg.GetList(ls.typ)
-			if r.Type() != typ {
-				// Special-case empty lists, which have type never.
-				if typ == types.NeverRef {
-					typ = r.Type()
-				} else {
-					return nil, c.error(x.Right.Span(),
-						fmt.Sprintf("cannot append %s to %s",
-							c.reg.String(r.Type()), c.reg.String(ls.typ)))
-				}
+			typ, ok := c.reg.Common(c.reg.GetList(ls.typ), r.Type())
+			if !ok {
+				return nil, c.error(x.Right.Span(),
+					fmt.Sprintf("cannot append %s to %s",
+						c.reg.ErrorString(r.Type()), c.reg.ErrorString(ls.typ)))
 			}
-			return List{c.reg.List(typ), append(ls.elements, r)}, nil
+			return c.constructed(List{c.reg.List(typ), join(ls.elements, leaf([]Value{r}))}), nil
 		}
 
 		return nil, fmt.Errorf("cannot append to non-list %s", reflect.TypeOf(l))
@@ -246,18 +398,13 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			typ := c.reg.GetList(ls.typ)
-			if l.Type() != typ {
-				// Special-case empty lists, which have type never.
-				if typ == types.NeverRef {
-					typ = r.Type()
-				} else {
-					return nil, c.error(x.Left.Span(),
-						fmt.Sprintf("cannot prepend %s to %s",
-							c.reg.String(l.Type()), c.reg.String(ls.typ)))
-				}
+			typ, ok := c.reg.Common(c.reg.GetList(ls.typ), l.Type())
+			if !ok {
+				return nil, c.error(x.Left.Span(),
+					fmt.Sprintf("cannot prepend %s to %s",
+						c.reg.ErrorString(l.Type()), c.reg.ErrorString(ls.typ)))
 			}
-			return List{c.reg.List(typ), append([]Value{l}, ls.elements...)}, nil
+			return c.constructed(List{c.reg.List(typ), join(leaf([]Value{l}), ls.elements)}), nil
 		}
 
 		return nil, fmt.Errorf("cannot prepend to non-list %s", reflect.TypeOf(r))
@@ -273,7 +420,7 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 			if err != nil {
 				return nil, err
 			}
-			return append(bs, r...), nil
+			return append(bs[:len(bs):len(bs)], r...), nil
 		}
 
 		if ls, ok := l.(List); ok {
@@ -282,16 +429,11 @@ func (c *context) binary(x *ast.BinaryExpr) (Value, error) {
 				return nil, err
 			}
 
-			// Special-case empty lists.
-			typ := ls.typ // a list type
-			if typ != r.typ {
-				if c.reg.GetList(typ) == types.NeverRef {
-					typ = r.typ
-				} else if c.reg.GetList(r.typ) != types.NeverRef {
-					return nil, c.error(x.Left.Span(), fmt.Sprintf("cannot concat %s to %s", c.reg.String(ls.typ), c.reg.String(r.typ)))
-				}
+			typ, ok := c.reg.Common(ls.typ, r.typ)
+			if !ok {
+				return nil, c.error(x.Left.Span(), fmt.Sprintf("cannot concat %s to %s", c.reg.String(ls.typ), c.reg.String(r.typ)))
 			}
-			return List{typ, append(ls.elements, r.elements...)}, nil
+			return c.constructed(List{typ, join(ls.elements, r.elements)}), nil
 		}
 
 		if tx, ok := l.(Text); ok {
@@ -338,15 +480,31 @@ func (c *context) call(x *ast.CallExpr) (Value, error) {
 		}
 	}
 
-	fn, err := c.fn(x.Fn)
+	val, err := c.eval(x.Fn)
 	if err != nil {
 		return nil, err
 	}
+	fn := Callable(val)
+	if fn == nil {
+		return nil, c.error(x.Fn.Span(), fmt.Sprintf("non-func value %s", val))
+	}
+	if same(val, cacheBuiltIn) {
+		return c.cached(x.Arg)
+	}
 	arg, err := c.eval(x.Arg)
 	if err != nil {
 		return nil, err
 	}
-	return fn(arg)
+	res, err := fn(arg)
+	if err == nil {
+		// Built-ins construct values too. Interned ones are found cheaply.
+		res = c.rt.interner.intern(res)
+	}
+	// Point out calls into functions defined by other scraps.
+	if sf, ok := val.(ScriptFunc); ok && err != nil && sf.scrap != "" && sf.scrap != c.scrap {
+		err = &ScrapError{Scrap: sf.scrap, At: c.source.Error(x.Span(), "called here"), Err: err}
+	}
+	return res, err
 }
 
 func (c *context) compose(first, second ast.Expr) (Value, error) {
@@ -372,8 +530,10 @@ func (c *context) compose(first, second ast.Expr) (Value, error) {
 
 func (c *context) enum(typ ast.EnumExpr) (Type, error) {
 	enum := make(types.MapRef, len(typ))
+	order := make([]string, 0, len(typ))
 	for _, v := range typ {
 		tag := c.name(&v.Tag)
+		order = append(order, tag)
 		if _, ok := enum[tag]; ok {
 			return Type(types.NeverRef), c.error(v.Tag.Pos, fmt.Sprintf("cannot define tag #%s more than once", tag))
 		}
@@ -388,25 +548,32 @@ func (c *context) enum(typ ast.EnumExpr) (Type, error) {
 		}
 		enum[tag] = ref
 	}
-	return Type(c.reg.Enum(enum)), nil
+	return Type(c.reg.EnumInOrder(enum, order)), nil
+}
+
+// variant evaluates a lone tag with a value, like `#ok 5`, to a variant of
+// an enum of only that tag; or with a type, like `#ok int`, to that enum.
+func (c *context) variant(x *ast.VariantExpr) (Value, error) {
+	switch x.Typ.(type) {
+	case *ast.FuncExpr, ast.EnumExpr:
+		// Type syntax.
+		return c.enum(ast.EnumExpr{x})
+	}
+
+	val, err := c.eval(x.Typ)
+	if err != nil {
+		return nil, err
+	}
+	tag := c.name(&x.Tag)
+	if t, ok := val.(Type); ok {
+		return Type(c.reg.Enum(types.MapRef{tag: types.TypeRef(t)})), nil
+	}
+	return Variant{c.reg.Enum(types.MapRef{tag: val.Type()}), tag, val}, nil
 }
 
 // typeRef returns the TypeRef of the type expression it is called with.
 func (c *context) typeRef(x ast.Expr) (ref types.TypeRef, err error) {
 	switch x := x.(type) {
-	case *ast.Ident:
-		var val Value
-		val, err = c.ident(x)
-		if err != nil {
-			return
-		}
-		t, ok := val.(Type)
-		if !ok {
-			return ref, c.error(x.Span(), fmt.Sprintf("required a type, got %s", val))
-		}
-		ref = types.TypeRef(t)
-		return
-
 	case *ast.FuncExpr:
 		var argRef, bodyRef types.TypeRef
 		argRef, err = c.typeRef(x.Arg)
@@ -420,26 +587,58 @@ func (c *context) typeRef(x ast.Expr) (ref types.TypeRef, err error) {
 		ref = c.reg.Func(argRef, bodyRef)
 		return
 
+	case *ast.CallExpr:
+		// Lists of a type, like `list int`.
+		if id, ok := x.Fn.(*ast.Ident); ok && c.name(id) == "list" {
+			var elemRef types.TypeRef
+			if elemRef, err = c.typeRef(x.Arg); err != nil {
+				return
+			}
+			ref = c.reg.List(elemRef)
+			return
+		}
+
 	case ast.EnumExpr:
-		mapRef := make(types.MapRef)
-		for _, v := range x {
-			key := c.name(&v.Tag)
-			value := types.NeverRef
-			if v.Typ != nil {
-				value, err = c.typeRef(v.Typ)
-				if err != nil {
-					return
-				}
+		var typ Type
+		typ, err = c.enum(x)
+		ref = types.TypeRef(typ)
+		return
+
+	case *ast.RecordExpr:
+		if !x.IsType() {
+			break
+		}
+		fields := make(types.MapRef, len(x.Entries))
+		order := make([]string, len(x.Entries))
+		for i, e := range x.Entries {
+			order[i] = c.name(&e.Key)
+			if fields[order[i]], err = c.typeRef(e.Val); err != nil {
+				return
 			}
-			mapRef[key] = value
 		}
-		ref = c.reg.Enum(mapRef)
+		ref = c.reg.RecordInOrder(fields, order)
+		return
+
+	case *ast.Literal:
+		err = c.error(x.Span(), fmt.Sprintf("%s does not evaluate to a type", c.source.GetString(x.Span())))
 		return
-		// TODO: Handle other expression types.
 	}
 
-	err = c.error(x.Span(), fmt.Sprintf("%s does not evaluate to a type", c.source.GetString(x.Span())))
-	return
+	// Other expressions must evaluate to types,
+	// like names of them, or `cfg.status`.
+	var val Value
+	val, err = c.eval(x)
+	if err != nil {
+		return
+	}
+	t, ok := val.(Type)
+	if !ok {
+		if v, ok := val.(Variant); ok {
+			return ref, c.error(x.Span(), fmt.Sprintf("required a type, got %s, a value of enum %s", val, c.reg.String(v.typ)))
+		}
+		return ref, c.error(x.Span(), fmt.Sprintf("required a type, got %s", val))
+	}
+	return types.TypeRef(t), nil
 }
 
 func (c *context) recordExpr(x *ast.RecordExpr) (r Record, err error) {
@@ -447,10 +646,13 @@ func (c *context) recordExpr(x *ast.RecordExpr) (r Record, err error) {
 	if x.Rest == nil {
 		ref := make(types.MapRef, len(x.Entries))
 		values := make(map[string]Value, len(x.Entries))
+		order := make([]string, len(x.Entries))
 
-		for tag, x := range x.Entries {
+		for i, e := range x.Entries {
+			tag := c.name(&e.Key)
+			order[i] = tag
 			var val Value
-			val, err = c.eval(x)
+			val, err = c.eval(e.Val)
 			if err != nil {
 				return
 			}
@@ -458,7 +660,7 @@ func (c *context) recordExpr(x *ast.RecordExpr) (r Record, err error) {
 			ref[tag] = val.Type()
 			values[tag] = val
 		}
-		r = Record{c.reg.Record(ref), values}
+		r = c.constructed(c.rt.interner.intern(Record{c.reg.RecordInOrder(ref, order), values})).(Record)
 		return
 	}
 
@@ -470,18 +672,56 @@ func (c *context) recordExpr(x *ast.RecordExpr) (r Record, err error) {
 	}
 	ref := c.reg.GetRecord(other.typ)
 	values := maps.Clone(other.values)
+	// Set when the keys of the record change.
+	var changed types.MapRef
+	var order []string
+	change := func() {
+		if changed == nil {
+			changed = maps.Clone(ref)
+			for _, field := range c.reg.Fields(other.typ) {
+				order = append(order, field.Name)
+			}
+			ref = changed
+		}
+	}
+
+	for _, e := range x.Entries {
+		tag, x := c.name(&e.Key), e.Val
+		typ, ok := ref[tag]
+		if e.Drop {
+			if !ok {
+				err = c.error(e.Key.Pos,
+					fmt.Sprintf("cannot drop key %s, which isn't in the base record", tag))
+				return
+			}
+			change()
+			delete(changed, tag)
+			delete(values, tag)
+			order = slices.DeleteFunc(order, func(name string) bool { return name == tag })
+			continue
+		}
 
-	for tag, x := range x.Entries {
 		var val Value
 		val, err = c.eval(x)
 		if err != nil {
 			return
 		}
 
-		typ, ok := ref[tag]
+		if e.Extend {
+			if ok {
+				err = c.error(e.Key.Pos,
+					fmt.Sprintf("cannot add key %s, which is already in the base record", tag))
+				return
+			}
+			change()
+			changed[tag] = val.Type()
+			order = append(order, tag)
+			values[tag] = val
+			continue
+		}
 		if !ok {
-			err = c.error(x.Span(),
-				fmt.Sprintf("cannot set key %s not in the base record", tag))
+			err = c.error(e.Key.Pos,
+				fmt.Sprintf("cannot set key %s not in the base record; use +%s to add it", tag, tag))
 			return
 		}
 		if val.Type() != typ {
@@ -494,15 +734,33 @@ func (c *context) recordExpr(x *ast.RecordExpr) (r Record, err error) {
 		values[tag] = val
 	}
 
-	return Record{other.typ, values}, nil
+	typ := other.typ
+	if changed != nil {
+		typ = c.reg.RecordInOrder(changed, order)
+	}
+	return c.constructed(c.rt.interner.intern(Record{typ, values})).(Record), nil
 }
 
 func (c *context) access(x *ast.AccessExpr) (Value, error) {
+	key := c.name(&x.Key)
+	if imp, ok := x.Rec.(*ast.ImportExpr); ok && c.rt.member != nil {
+		bs, err := imp.Hash(c.source)
+		if err != nil {
+			return nil, c.error(imp.Span(), fmt.Sprintf("bad import hash %#v", imp))
+		}
+		val, ok, err := c.rt.member(imp.HashAlgo, bs, key)
+		if err != nil {
+			return nil, c.importError(imp, bs, err)
+		}
+		if ok {
+			return val, nil
+		}
+	}
+
 	r, err := c.record(x.Rec)
 	if err != nil {
 		return nil, err
 	}
-	key := c.name(&x.Key)
 	val, ok := r.values[key]
 	if !ok {
 		return nil, c.error(x.Key.Pos,
@@ -513,7 +771,7 @@ func (c *context) access(x *ast.AccessExpr) (Value, error) {
 
 func (c *context) listExpr(x *ast.ListExpr) (ls List, err error) {
 	elements := make([]Value, len(x.Elements))
-	typ := types.NeverRef
+	typ := types.EmptyRef
 	for i, x := range x.Elements {
 		var val Value
 		val, err = c.eval(x)
@@ -522,16 +780,14 @@ func (c *context) listExpr(x *ast.ListExpr) (ls List, err error) {
 		}
 
 		elements[i] = val
-		if val.Type() != typ {
-			if typ == types.NeverRef {
-				typ = val.Type()
-			} else {
-				err = c.error(x.Span(), fmt.Sprintf("list elements must all be of type %s, got %s", c.reg.String(typ), c.reg.String(val.Type())))
-				return
-			}
+		common, ok := c.reg.Common(typ, val.Type())
+		if !ok {
+			err = c.error(x.Span(), fmt.Sprintf("list elements must all be of type %s, got %s", c.reg.String(typ), c.reg.String(val.Type())))
+			return
 		}
+		typ = common
 	}
-	return List{c.reg.List(typ), elements}, nil
+	return c.constructed(c.rt.interner.intern(List{c.reg.List(typ), leaf(elements)})).(List), nil
 }
 
 func (c *context) pick(pick *ast.BinaryExpr, x ast.Expr) (Value, error) {
@@ -539,13 +795,16 @@ func (c *context) pick(pick *ast.BinaryExpr, x ast.Expr) (Value, error) {
 	if err != nil {
 		return nil, err
 	}
+	enum := c.reg.GetEnum(ref)
+	if enum == nil {
+		return nil, c.error(pick.Left.Span(), fmt.Sprintf("%s isn't an enum", c.reg.String(ref)))
+	}
 	// This is always the case for a pick expression. Let's update the ast/parser.
 	id, ok := pick.Right.(*ast.Ident)
 	if !ok {
 		return nil, c.error(pick.Right.Span(), fmt.Sprintf("cannot pick using non-identifier %#v", pick))
 	}
 	tag := c.name(id)
-	enum := c.reg.GetEnum(ref)
 	if tagTyp, ok := enum[tag]; ok {
 		if tagTyp == types.NeverRef {
 			if x == nil {
@@ -561,13 +820,17 @@ func (c *context) pick(pick *ast.BinaryExpr, x ast.Expr) (Value, error) {
 				if err != nil {
 					return nil, err
 				}
-				return Variant{ref, tag, val}, nil
+				return c.rt.interner.intern(Variant{ref, tag, val}), nil
 			}
 		}
 	}
 
-	tags := strings.Join(slices.Sorted(maps.Keys(enum)), ", #")
-	return nil, c.error(pick.Span(), fmt.Sprintf("#%s isn't one of the valid tags: #%s", tag, tags))
+	tags := slices.Sorted(maps.Keys(enum))
+	msg := fmt.Sprintf("#%s isn't one of the valid tags: #%s", tag, strings.Join(tags, ", #"))
+	if s := spell.Suggest(tag, tags); s != "" {
+		msg += fmt.Sprintf("; did you mean #%s?", s)
+	}
+	return nil, c.error(pick.Span(), msg)
 }
 
 func (c *context) createFunc(x *ast.FuncExpr) (ScriptFunc, error) {
@@ -577,48 +840,120 @@ func (c *context) createFunc(x *ast.FuncExpr) (ScriptFunc, error) {
 	}
 	name := c.name(id)
 	return ScriptFunc{
-		source: c.source.GetString(x.Span()),
-		fn: func(value Value) (Value, error) {
-			return c.sub(Variables{name: value}).eval(x.Body)
-		},
+		source:   c.printed(x),
+		scrap:    c.scrap,
+		captures: func() (Variables, error) { return c.captured(x) },
+		fn: c.memoized(x, func(value Value) (Value, error) {
+			return c.traced(x.Span(), value, func() (Value, error) {
+				return c.sub(Variables{name: value}).eval(x.Body)
+			})
+		}),
 	}, nil
 }
 
 func (c *context) createMatchFunc(x ast.MatchFuncExpr) (ScriptFunc, error) {
+	for _, alt := range x {
+		if err := checkOrPatterns(c.source, alt.Arg); err != nil {
+			return ScriptFunc{}, err
+		}
+	}
 	source := c.source.GetString(x.Span())
+	tree := newDecisionTree(c.source, x)
 	return ScriptFunc{
-		source: source,
-		fn: func(a Value) (Value, error) {
-			for _, alt := range x {
-				matches, err := Match(c.source, c.reg, alt.Arg, a)
-				if err != nil {
-					if err == ErrNoMatch {
-						continue
+		source:   c.printed(x),
+		scrap:    c.scrap,
+		captures: func() (Variables, error) { return c.captured(x) },
+		fn: c.memoized(x, func(a Value) (Value, error) {
+			return c.traced(x.Span(), a, func() (Value, error) {
+				for _, i := range tree.candidates(a) {
+					alt := x[i]
+					if tree.exact[i] {
+						return c.eval(alt.Body)
 					}
-					return nil, err
+					matches, err := Match(c.source, c.reg, alt.Arg, a)
+					if err != nil {
+						if err == ErrNoMatch {
+							continue
+						}
+						return nil, err
+					}
+					return c.sub(matches).eval(alt.Body)
 				}
-				return c.sub(matches).eval(alt.Body)
-			}
-			return nil, fmt.Errorf("%s had no alternative for %s", source, a)
-		},
+				return nil, c.error(x.Span(), fmt.Sprintf("%s had no alternative for %s", source, a))
+			})
+		}),
 	}, nil
 }
 
 func (c *context) where(x *ast.WhereExpr) (Value, error) {
+	return c.bindWhere(x).eval(x.Expr)
+}
+
+// bindWhere returns a context with the name of a where-binding bound to
+// its value, which is evaluated when first used.
+func (c *context) bindWhere(x *ast.WhereExpr) *context {
 	name := c.name(&x.Id)
+	return c.sub(&lazyBinding{name: name, eval: func() (Value, error) {
+		m := c.rt.measure()
+		var val Value
+		var err error
+		if x.Val != nil {
+			val, err = c.eval(x.Val)
+		} else {
+			// Type-only bindings, like `t : #a #b`, bind the type.
+			val, err = c.typeDefs(x).ident(&x.Id)
+		}
+		c.rt.emit(Event{
+			Kind:     BindingEvaluated,
+			Name:     name,
+			Duration: c.rt.measured(m, BindingEvaluated, c.scrap, name),
+			Value:    val,
+			Err:      err,
+		})
+		return val, err
+	}})
+}
 
-	// This where is type-only; semantics TBD?
-	expr := x.Val
-	if expr == nil {
-		expr = x.Typ
+// typeDefs returns a context with the type-only bindings of a where-chain
+// bound, from x on, so that the types they define may refer to each other
+// regardless of their order, like in
+// `point : { x : int, y : int } ; pair : { first : point, second : point }`.
+func (c *context) typeDefs(x *ast.WhereExpr) *context {
+	defs := c
+	for w, ok := x, true; ok; w, ok = w.Expr.(*ast.WhereExpr) {
+		if w.Val != nil {
+			continue
+		}
+		name := c.name(&w.Id)
+		defs = defs.sub(&lazyBinding{name: name, eval: func() (Value, error) {
+			ref, err := defs.typeRef(w.Typ)
+			if errors.Is(err, errCycle) {
+				return nil, c.error(w.Id.Pos, fmt.Sprintf("type %s is defined in terms of itself", name))
+			}
+			if err != nil {
+				return nil, err
+			}
+			return Type(ref), nil
+		}})
 	}
+	return defs
+}
 
-	val, err := c.eval(expr)
-	if err != nil {
-		return nil, err
+// member evaluates the member key of a library, without evaluating its
+// other members; see types.IsLibrary. Like any where-bindings, those
+// around it are only evaluated if the member uses them.
+func (c *context) member(x ast.Expr, key string) (Value, error) {
+	switch x := x.(type) {
+	case *ast.WhereExpr:
+		return c.bindWhere(x).member(x.Expr, key)
+	case *ast.RecordExpr:
+		for _, e := range x.Entries {
+			if c.name(&e.Key) == key {
+				return c.eval(e.Val)
+			}
+		}
 	}
-
-	return c.sub(Binding{name, val}).eval(x.Expr)
+	return nil, c.error(x.Span(), fmt.Sprintf("not a library with a member %s", key))
 }
 
 // Evaluates a value, requiring a certain type.
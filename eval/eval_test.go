@@ -1,9 +1,15 @@
 package eval
 
 import (
+	"crypto/sha256"
 	"fmt"
+	goruntime "runtime"
 	"strings"
 	"testing"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/printer"
 )
 
 var expressions = []struct {
@@ -27,6 +33,44 @@ var expressions = []struct {
 	{`3 - 2`, `1`},
 	{`3.0 - 2.0`, `1.0`},
 	{`1.0 + to-float 1`, `2.0`},
+	{`int/abs (0 - 3)`, `3`},
+	{`int/min 3 (0 - 4)`, `-4`},
+	{`int/max 3 (0 - 4)`, `3`},
+	{`float/pow 2.0 0.5`, `1.4142135623730951`},
+	{`float/sqrt 9.0`, `3.0`},
+	{`int/parse "-12"`, `#ok -12`},
+	{`int/parse "1.5"`, `#err "'1.5' isn't an int"`},
+	{`int/parse "99999999999999999999"`, `#err "'99999999999999999999' is out of range for an int"`},
+	{`float/parse "1.5"`, `#ok 1.5`},
+	{`float/parse "NaN"`, `#err "'NaN' isn't a float"`},
+	{`float/parse "0x1p-2"`, `#err "'0x1p-2' isn't a float"`},
+	{`float/parse "1_000.5"`, `#err "'1_000.5' isn't a float"`},
+	{`float/parse "1e5"`, `#err "'1e5' isn't a float"`},
+	{`float/parse "-.5"`, `#ok -0.5`},
+	{`float/parse "3"`, `#ok 3.0`},
+	{`int/parse "7" |> | #ok n -> n * 2 | #err _ -> 0`, `14`},
+	{`int/to-text 42 ++ "!"`, `"42!"`},
+	{`float/to-text 2.0`, `"2.0"`},
+	{`bytes/length ~~AQID`, `3`},
+	{`bytes/slice 1 3 ~~AQIDBA==`, `~~AgM=`},
+	{`bytes/slice 2 9 ~~AQIDBA==`, `~~AwQ=`},
+	{`bytes/slice 3 1 ~~AQIDBA==`, `~~`},
+	{`bytes/slice 1 2`, `bytes/slice 1 2`},
+	{`bytes/at 1 ~~AQID`, `#some ~02`},
+	{`bytes/at 3 ~~AQID`, `#none`},
+	{`bytes/concat-all [~~AQI=, ~~, ~~Aw==]`, `~~AQID`},
+	{`[ s +< ~01, s +< ~02 ] ; s = bytes/slice 0 2 b ; b = ~~aGVsbG8=`, `[ ~~aGUB, ~~aGUC ]`},
+	{`[ s ++ ~~AQ==, s ++ ~~Ag== ] ; s = bytes/concat-all [~~aGU=, ~~] `, `[ ~~aGUB, ~~aGUC ]`},
+	{`[ b +< ~01, b +< ~02 ] ; b = ~~aGVsbG8=`, `[ ~~aGVsbG8B, ~~aGVsbG8C ]`},
+	{`byte/to-int ~ff`, `255`},
+	{`int/to-byte 16`, `#ok ~10`},
+	{`int/to-byte 256`, `#err "256 is out of range for a byte"`},
+	{`bytes/to-hex ~~AQID`, `"010203"`},
+	{`bytes/from-hex "0A0b"`, `#ok ~~Cgs=`},
+	{`bytes/from-hex "abc"`, `#err "'abc' isn't hex"`},
+	{`bytes/to-base64 ~~AQID`, `"AQID"`},
+	{`bytes/from-base64 "AQID"`, `#ok ~~AQID`},
+	{`bytes/from-base64 "A"`, `#err "'A' isn't base64"`},
 	{`"hello" ++ " " ++ "world"`, `"hello world"`},
 	// Functions
 	{`2 |> | _ -> 3`, `3`},
@@ -54,15 +98,37 @@ var expressions = []struct {
 	    |   a   -> "baby " ++ a`, `"kitten"`},
 	{`(x -> x) (y -> y)`, `y -> y`},
 	{`m::just 2 |> | #just 2 -> "two" | #just _ -> "other" | #no -> "x" ; m : #just int #no`, `"two"`},
+	{`m::no |> | #just _ -> "just" | #no -> "no" ; m : #just int #no`, `"no"`},
+	{`bool::false |> | #true -> 1 | #false -> 2 ; bool : #true #false`, `2`},
+	{`1 |> | n -> n + 1 | 1 -> 0`, `2`},
+	{`[ f "a", f "b", f "c" ] ; f = | "a" | "b" -> 1 | _ -> 0`, `[ 1, 1, 0 ]`},
+	{`[ f (t::l 1), f (t::r 2), f t::n ] ; f = | #l x | #r x -> x | #n -> 0 ; t : #l int #r int #n`, `[ 1, 2, 0 ]`},
+	{`[ 1, 2 ] |> | [ x ] | [ _, x ] -> x | _ -> 0`, `2`},
+	{`~2a |> | ~01 -> 1 | x -> 2 | ~2a -> 3`, `2`},
 	// {`| "hey" -> ""
 	// 	| "hello " ++ name -> name
 	// 	| _ -> "<empty>" <| "hello Oseg"`, Text("Oseg")},
 	{`box::empty ; box : #empty`, `#empty`},
+	{`#ok 5 |> | #ok n -> n + 1 | #err _ -> 0`, `6`},
+	{`f (c::config { cpus = 2, mem = 4 }) ; f = | #config { cpus, mem } -> cpus * mem | #none -> 0 ; c : #config { cpus : int, mem : int } #none`, `8`},
+	{`{ a = 1, b = 2 } |> | { ..r, a } -> r.b - a`, `1`},
+	{`list/map f [#ok 5, #err "x"] ; f = | #ok n -> n | #err _ -> 0`, `[ 5, 0 ]`},
+	{`cfg.status::ok |> | #ok -> 1 | #err _ -> 0 ; cfg = { status = status } ; status : #ok #err text`, `1`},
+	{`((x -> x) bool)::true |> | #true -> 1 | #false -> 0 ; bool : #true #false`, `1`},
 	{`typ::fun (x -> x * 2) ; typ : #fun (int -> int)`, `#fun x -> x * 2`},
+	{`t::ok [ 1, 2 ] ; t : #ok list int #none`, `#ok [ 1, 2 ]`},
+	{`x ; x : list int = [ 1, 2 ]`, `[ 1, 2 ]`},
+	{`t::l 1 ; t = e ; e : #l int #r`, `#l 1`},
+	{`p::k { first = { x = 1, y = 2 }, second = { x = 3, y = 4 } } ; point : { x : int, y : int } ; pair : { first : point, second : point } ; p : #k pair #n`, `#k { first = { x = 1, y = 2 }, second = { x = 3, y = 4 } }`},
+	{`(p::k (n::l) ; p : #k n ; n : #l)`, `#k #l`},
+	{`(types.pick 0)::r ; types = { pick = _ -> e } ; e : #l int #r`, `#r`},
 
 	// Destructuring.
 	{`{ a = 1, b = 2 } |> | { a = c, b = d } -> c + d`, `3`},
+	{`{ a, b } ; a = 1 ; b = "x"`, `{ a = 1, b = "x" }`},
+	{`{ ..r, a, +c } ; r = { a = 1, b = 2 } ; a = 3 ; c = 4`, `{ a = 3, b = 2, c = 4 }`},
 	{`{ a = 1 } |> | { a = 2 } -> c | { a = c } -> c`, `1`},
+	{`f { a = 1, b = 2 } ; f = | { a } -> a`, `1`},
 	{`3 |> a -> b -> a`, `b -> a`},
 
 	{`#true #false`, `<type>`}, // TODO: should be `#true #false`
@@ -79,11 +145,24 @@ var expressions = []struct {
 	{`| ns ++ [2, 3] -> ns <| [1, 2, 3]`, `[ 1 ]`},
 	{`| [1, 2] ++ ns -> ns <| [1, 2, 3]`, `[ 3 ]`},
 	{`| ns ++ [2, last] -> ns +< last <| [1, 2, 3]`, `[ 1, 3 ]`},
+	{`| ns +< n -> n <| [1, 2, 3]`, `3`},
+	// Lists share structure, but never change.
+	{`[ a +< 4, a +< 5, 0 >+ a ] ; a = [ 1 ] +< 2`, `[ [ 1, 2, 4 ], [ 1, 2, 5 ], [ 0, 1, 2 ] ]`},
 }
 
 func TestScrapItentity(t *testing.T) {
 	var scraps = []string{
 		`(#horse text #zebra int)::horse "Lucy"`,
+		// Variants nested in records and lists.
+		`[ (#a #b)::a, (#a #b)::b ]`,
+		`{ a = (#x int)::x (-1), b = [ (#y)::y ] }`,
+		`(#a int #b (#a int))::b ((#a int)::a 2)`,
+		// Functions, with the values they capture.
+		`[ (x -> x) ]`,
+		"x -> x + a\n; a = 1",
+		"{ f = (x -> g x\n; g = (y -> y * a\n; a = 2)) }",
+		// Types.
+		`{ a = int, b = (#a #b) }`,
 	}
 
 	for _, scrap := range scraps {
@@ -108,11 +187,26 @@ var failures = []struct {
 	{`f 1 ; f = a -> b`, "unknown variable b"},
 	{`f 1 ; b = 2 ; f = a -> b`, "unknown variable b"},
 	{`{} |> | { b = a } -> a`, "cannot bind to missing key b"},
+	{`1 |> | [ x ] | _ -> 0`, `x isn't bound in this alternative`},
+	{`1 |> | _ | [ y ] -> 0`, `y isn't bound in this alternative`},
 	{`[ 1, ] |> | [] -> "four"`, `[] -> "four" had no alternative for [ 1 ]`},
 	{`[] ++ ""`, `non-list value ""`},
 	{`"" ++ []`, `non-text value []`},
+	{`int/sum [1.5]`, `expected int, but got eval.Float`},
+	{`int/abs (0 - 9223372036854775807 - 1)`, `int/abs -9223372036854775808 overflows`},
+	{`9223372036854775807 + 1`, `9223372036854775807 + 1 overflows`},
+	{`0 - 9223372036854775807 - 2`, `-9223372036854775807 - 2 overflows`},
+	{`4611686018427387904 * 2`, `4611686018427387904 * 2 overflows`},
+	{`(0 - 9223372036854775807 - 1) * (0 - 1)`, `-9223372036854775808 * -1 overflows`},
+	{`(0 - 1) * (0 - 9223372036854775807 - 1)`, `-1 * -9223372036854775808 overflows`},
+	{`int/sum [9223372036854775807, 1]`, `int/sum overflows`},
+	{`float/sqrt (0.0 - 1.0)`, `float/sqrt (-1.0) has no finite result`},
+	{`float/pow 10.0 400.0`, `float/pow 10.0 400.0 has no finite result`},
 	{`1 -> x`, `function parameter must be an identifier`},
 	{`hand::left 5 ; hand : #l int #r int`, `#left isn't one of the valid tags: #l, #r`},
+	{`hand::lft 5 ; hand : #left int #right int`, `#lft isn't one of the valid tags: #left, #right; did you mean #left?`},
+	{`lenght ; length = 1`, `unknown variable lenght; did you mean length?`},
+	{`list/mpa (x -> x) []`, `unknown variable list/mpa; did you mean list/map?`},
 	{`{ a = 2 } |> | { a = a, b = a } -> ()`, `cannot bind to missing key b`},
 	{`{ a = 2, b = 1 } |> | { a = a, b = a } -> ()`, `cannot bind a twice`},
 	{`c ; c : #a #a`, `cannot define tag #a more than once`},
@@ -120,11 +214,21 @@ var failures = []struct {
 	{`1::a`, `1 does not evaluate to a type`},
 	{`box::empty 1 ; box : #empty`, `#empty does not take a value`},
 	{`box::with ; box : #with int`, `#with requires a value of type int`},
+	{`v::r ; v = e::r ; e : #l int #r`, `required a type, got #r, a value of enum #l int #r`},
+	{`t::r ; t = int`, `int isn't an enum`},
+	{`a ; a : #x a`, `type a is defined in terms of itself`},
+	{`a ; a : #x b ; b : #y a`, `is defined in terms of itself`},
 	{`["a"] +< ~be`, `cannot append byte to list text`},
 	{`1 >+ [~~abcd]`, `cannot prepend int to list bytes`},
 	{`[1, 1.2]`, `list elements must all be of type int, got float`},
 	{`{ b = 1 }.a`, `record { b = 1 } has no key a`},
-	{`{ ..{ a = 2, c = 1 }, a = 1, b = "x"}`, `cannot set key b not in the base record`},
+	{`{ a = 1 } |> | r.a -> r`, `cannot match on a record access`},
+	{`{ ..{ a = 2, c = 1 }, a = 1, b = "x"}`, `cannot set key b not in the base record; use +b to add it`},
+	{`{ ..{ a = 2 }, +a = 1 }`, `cannot add key a, which is already in the base record`},
+	{`{ ..{ a = 1 }, -b }`, `cannot drop key b, which isn't in the base record`},
+	{`{ a, b } ; a = 1`, `unknown variable b`},
+	{`{ ..{ a = 1 }, -a, a = 2 }`, `cannot set key a not in the base record; use +a to add it`},
+	{`record/keys 1`, `expected record, but got eval.Int`},
 	{`{ ..{ a = 2 }, a = "x"}`, `cannot change type of key a from int to text`},
 }
 
@@ -150,6 +254,16 @@ var exp2str = []struct{ source, result string }{
 	{`["prefix"] ++ ["in" ++ "fix"] +< "postfix"`, `[ "prefix", "infix", "postfix" ]`},
 	// Records
 	{`rec.a ; rec = { a = 1, b = "x" }`, `1`},
+	{`rec.in.b ; rec = { in = { b = "x" } }`, `"x"`},
+	{`{ ..base, +c = 3, b = "y" } ; base = { a = 1, b = "x" }`, `{ a = 1, b = "y", c = 3 }`},
+	{`{ ..{}, +a = 1 }`, `{ a = 1 }`},
+	{`{ ..base, -a } ; base = { a = 1, b = "x" }`, `{ b = "x" }`},
+	{`{ ..base, -a, +a = "y" } ; base = { a = 1 }`, `{ a = "y" }`},
+	{`record/keys { b = 1, a = "x" }`, `[ "b", "a" ]`},
+	{`record/keys {}`, `[]`},
+	{`f rec.in.b ; f = t -> t ++ "y" ; rec = { in = { b = "x" } }`, `"xy"`},
+	{`(f 1).a ; f = n -> { a = n + 1 }`, `2`},
+	{`rec |> | r -> r.in.b ; rec = { in = { b = 5 } }`, `5`},
 	{`{ ..g, a = 2, c = ~FF }
 	; g = { a = 1, b = "x", c = ~00 }`, `{ a = 2, b = "x", c = ~FF }`},
 	{`{ ..{ a = 2, c = 1 }, a = 1 }`, `{ a = 1, c = 1 }`},
@@ -176,8 +290,18 @@ var exp2str = []struct{ source, result string }{
 	{`list/map text/length`, `list/map text/length`},
 
 	{`list/fold 0 (a -> b -> a + b) []`, `0`},
-	{`list/fold 0 (a -> b -> a + b)`, `list/fold 0 a -> b -> a + b`},
+	{`list/fold 0 (a -> b -> a + b)`, `list/fold 0 (a -> b -> a + b)`},
+	{`x ->   f  (x+1) ; f = a -> a`, `x -> f (x + 1)`},
+	{`1 + 2 >+ [3]`, `[ 3, 3 ]`},
+	{`10 - 3 - 2`, `5`},
+	{`[ 1 ] +< 2 +< 3`, `[ 1, 2, 3 ]`},
+	{`(f << g) 7 ; f = x -> x + 1 ; g = x -> x * 2`, `15`},
+	{`| 0 -> 1 | n -> n`, "| 0 -> 1\n| n -> n"},
 	{`list/fold 0 (a -> b -> a + b) [1, 2]`, `3`},
+	{`int/sum [1, 2, 3]`, `6`},
+	{`int/sum []`, `0`},
+	{`float/sum [0.5, 2.0]`, `2.5`},
+	{`float/sum [] + 1.5`, `1.5`},
 	{`list/fold 0 (a -> b -> a + text/length b) ["hey", "beautiful"]`, `12`},
 
 	{`[ 4 + 2, 5 - 1, ]`, "[ 6, 4 ]"},
@@ -202,12 +326,83 @@ func TestEvalString(t *testing.T) {
 	}
 }
 
+func TestValueTypes(t *testing.T) {
+	for source, typ := range map[string]string{
+		`[]`:            `list _`,
+		`[] +< 1`:       `list int`,
+		`1 >+ []`:       `list int`,
+		`[] ++ ["a"]`:   `list text`,
+		`["a"] ++ []`:   `list text`,
+		`[[], [1]]`:     `list (list int)`,
+		`[[1], []]`:     `list (list int)`,
+		`[[]] +< [int]`: `list (list (type int))`,
+		`[int, int]`:    `list (type int)`,
+		`type`:          `type type`,
+	} {
+		env := NewEnvironment()
+		val, err := eval(env, source)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+			continue
+		}
+		if got := env.reg.String(val.Type()); got != typ {
+			t.Errorf("%s: expected type %s, got %s", source, typ, got)
+		}
+	}
+}
+
 func TestFailures(t *testing.T) {
 	for _, ex := range failures {
 		evalFailure(t, ex.source, ex.error)
 	}
 }
 
+// TestPrintRoundTrip prints every expression in the tests, and checks
+// that the output parses back to the same expression.
+func TestPrintRoundTrip(t *testing.T) {
+	var sources []string
+	for _, ex := range expressions {
+		sources = append(sources, ex.source)
+	}
+	for _, ex := range exp2str {
+		sources = append(sources, ex.source)
+	}
+	for _, ex := range failures {
+		sources = append(sources, ex.source)
+	}
+
+	// Printing with all parentheses shows how an expression was parsed.
+	shape := func(source []byte, x ast.Expr) string {
+		var b strings.Builder
+		if err := (&printer.Config{Parens: true}).Fprint(&b, source, x); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	for _, source := range sources {
+		se, err := parser.ParseExpr(source)
+		if err != nil {
+			// Some failures are parse errors.
+			continue
+		}
+		var printed strings.Builder
+		if err := printer.Fprint(&printed, []byte(source), se.Expr); err != nil {
+			t.Errorf("printing %q: %s", source, err)
+			continue
+		}
+		reparsed, err := parser.ParseExpr(printed.String())
+		if err != nil {
+			t.Errorf("%q printed as %q, which doesn't parse: %s", source, printed.String(), err)
+			continue
+		}
+		want, got := shape([]byte(source), se.Expr), shape([]byte(printed.String()), reparsed.Expr)
+		if want != got {
+			t.Errorf("%q printed as %q, which parses as\n%s\ninstead of\n%s", source, printed.String(), got, want)
+		}
+	}
+}
+
 func eval(e *Environment, source string) (Value, error) {
 	scrap, err := e.Read([]byte(source))
 	if err != nil {
@@ -270,3 +465,75 @@ func (mf MapFetcher) FetchSha256(key string) ([]byte, error) {
 	}
 	return []byte(source), nil
 }
+
+func TestEvalPickImported(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445": `e ; e : #l int #r`,
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a446": `{ e = e } ; e : #l int #r`,
+	})
+
+	for source, expected := range map[string]string{
+		`$sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445::l 2`:       `#l 2`,
+		`t::r ; t = $sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445`: `#r`,
+		`$sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a446.e::r`:       `#r`,
+	} {
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := env.Infer(scrap); err != nil {
+			t.Errorf("%s: %s", source, err)
+		}
+		val, err := env.Eval(scrap)
+		if err != nil {
+			t.Errorf("%s: %s", source, err)
+		} else if val.String() != expected {
+			t.Errorf("%s: expected %s, got %s", source, expected, val)
+		}
+	}
+}
+
+func TestImportedVariants(t *testing.T) {
+	defer goruntime.GOMAXPROCS(goruntime.GOMAXPROCS(4))
+
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	fetcher := MapFetcher{}
+	add := func(source string) string {
+		fetcher[hash(source)] = source
+		return "$sha256~~" + hash(source)
+	}
+	enum := add(`e ; e : #some int #none`)
+	lib := add(`{ e = e, some = x -> e::some x, get = | #some n -> n | #none -> 0 } ; e : #some int #none`)
+
+	// Variants constructed by the importer are of the same type as those
+	// constructed by the imported scraps, whether they are inferred one at
+	// a time or in parallel, and then merged into the same Registry.
+	tests := []struct{ source, typ, val string }{
+		{`(` + enum + `)::some 1`, `#some int #none`, `#some 1`},
+		{`m::none ; m = ` + enum, `#some int #none`, `#none`},
+		{`[ lib.some 1, lib.e::some 2, m::some 3, m::none ] |> list/map lib.get ; lib = ` + lib + ` ; m = ` + enum,
+			`list int`, `[ 1, 2, 3, 0 ]`},
+		{`f (m::some 2) ; f : e -> int = | #some n -> n | #none -> 0 ; e : #some int #none ; m = ` + enum,
+			`int`, `2`},
+	}
+	for _, procs := range []int{4, 1} {
+		goruntime.GOMAXPROCS(procs)
+		for _, test := range tests {
+			env := NewEnvironment()
+			env.UseFetcher(fetcher)
+			scrap, err := env.Read([]byte(test.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if typ, err := env.Infer(scrap); err != nil || typ != test.typ {
+				t.Errorf("%s: expected type %s, got %s, %v", test.source, test.typ, typ, err)
+			}
+			if val, err := env.Eval(scrap); err != nil || val.String() != test.val {
+				t.Errorf("%s: expected %s, got %v, %v", test.source, test.val, val, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package eval
+
+import "time"
+
+// EventKind classifies an Event.
+type EventKind int
+
+const (
+	// An import is about to be fetched and evaluated.
+	ImportStarted EventKind = iota
+	// An import has been evaluated, successfully or not.
+	ImportFinished
+	// A where-binding's value has been evaluated.
+	BindingEvaluated
+	// The scrap passed to Environment.Eval has been evaluated.
+	ResultReady
+	// The type of an imported scrap has been pushed to the type cache,
+	// successfully or not; see Environment.UseTypeCache.
+	TypePushed
+)
+
+var eventKindNames = [...]string{
+	ImportStarted:    "import-started",
+	ImportFinished:   "import-finished",
+	BindingEvaluated: "binding-evaluated",
+	ResultReady:      "result-ready",
+	TypePushed:       "type-pushed",
+}
+
+func (k EventKind) String() string {
+	return eventKindNames[k]
+}
+
+// An Event reports progress of an evaluation, for example to render
+// live progress of a long-running scrap in a UI.
+type Event struct {
+	Kind EventKind
+	// The binding name for BindingEvaluated, the hex-encoded hash for
+	// import events, or the key of the type for TypePushed.
+	Name string
+	// How long the step took. Zero for ImportStarted.
+	Duration time.Duration
+	// The resulting value, if any.
+	Value Value
+	// The error, if the step failed.
+	Err error
+}
+
+// An Observer receives evaluation Events synchronously,
+// on the goroutine doing the evaluation.
+type Observer func(Event)
+
+// SendTo returns an Observer that sends every Event on ch.
+func SendTo(ch chan<- Event) Observer {
+	return func(ev Event) {
+		ch <- ev
+	}
+}
+
+func (rt *runtime) emit(ev Event) {
+	if rt.observe != nil {
+		rt.observe(ev)
+	}
+}
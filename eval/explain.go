@@ -0,0 +1,166 @@
+package eval
+
+import (
+	"encoding/hex"
+	"fmt"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// An Explanation summarizes a Scrap for people auditing it before
+// running it.
+type Explanation struct {
+	// The type of the scrap.
+	Type string
+	// The size of its source in bytes.
+	Size int
+	// The scraps it imports, like $sha256~~<hash> or $local:<name>,
+	// in source order.
+	Imports []string
+	// Its top-level where-bindings, in source order.
+	Definitions []Definition
+	// A static estimate of the fuel evaluating it takes;
+	// see Environment.UseFuel.
+	Fuel int
+}
+
+// A Definition is a where-binding of a Scrap, or a member of a library.
+type Definition struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Import fetches the scrap with a hex-encoded hash by an algorithm,
+// as if imported by `$algo~~hash`; or for the algorithm "local",
+// the local scrap of a name, as if imported by `$local:name`.
+func (e *Environment) Import(algo, hash string) (*Scrap, error) {
+	if algo == localAlgo {
+		return e.fetchLocal(hash)
+	}
+	bs, err := hex.DecodeString(hash)
+	if err != nil {
+		return nil, fmt.Errorf("bad hash %s: %w", hash, err)
+	}
+	return e.fetch(algo, bs)
+}
+
+// Explain infers the type of a Scrap, fetching its imports,
+// and returns an Explanation of it.
+func (e *Environment) Explain(scrap *Scrap) (Explanation, error) {
+	var info types.Info
+	reg, inferImport := e.scratch()
+	ref, err := types.InferInfo(reg, e.typeScope, scrap.expr, inferImport, &info)
+	if err != nil {
+		return Explanation{}, err
+	}
+
+	ex := Explanation{
+		Type: reg.String(ref),
+		Size: len(scrap.expr.Source.Bytes()),
+		Fuel: e.estimateFuel(scrap, make(map[*Scrap]bool)),
+	}
+	ex.Imports = scrap.Imports()
+	ex.Definitions = definitions(reg, scrap, &info)
+	return ex, nil
+}
+
+// definitions returns the top-level where-bindings of a scrap, in source
+// order, with the types info has of them in reg.
+func definitions(reg *types.Registry, scrap *Scrap, info *types.Info) (defs []Definition) {
+	// Where-chains are nested with the last binding outermost.
+	for x, ok := scrap.expr.Expr.(*ast.WhereExpr); ok; x, ok = x.Expr.(*ast.WhereExpr) {
+		defs = append(defs, Definition{
+			Name: scrap.expr.Source.GetString(x.Id.Pos),
+			Type: reg.String(info.Defs[&x.Id]),
+		})
+	}
+	slices.Reverse(defs)
+	return
+}
+
+// Imports returns the distinct scraps a Scrap imports,
+// like $sha256~~<hash> or $local:<name>, in source order.
+func (s *Scrap) Imports() []string {
+	var names []string
+	for _, imp := range imports(s) {
+		if imp.algo == localAlgo {
+			names = append(names, fmt.Sprintf("$local:%s", imp.hash))
+		} else {
+			names = append(names, fmt.Sprintf("$%s~~%s", imp.algo, imp.hash))
+		}
+	}
+	return names
+}
+
+// An importRef is the algorithm and hex-encoded hash of an import,
+// or the name of a local one.
+type importRef struct{ algo, hash string }
+
+// imports returns the distinct imports of a scrap, in source order.
+func imports(scrap *Scrap) []importRef {
+	var refs []importRef
+	ast.Inspect(scrap.expr.Expr, func(n ast.Node) bool {
+		if x, ok := n.(*ast.ImportExpr); ok {
+			if ref := scrap.importRef(x); !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+// importRef returns the importRef of an import of a scrap.
+func (s *Scrap) importRef(x *ast.ImportExpr) importRef {
+	if x.Local() {
+		return importRef{x.HashAlgo, s.expr.Source.GetString(x.Value.Pos)}
+	}
+	return importRef{x.HashAlgo, s.expr.Source.GetString(x.Value.Pos.TrimStart(2))}
+}
+
+// estimateFuel estimates the fuel evaluating a scrap takes, as a step
+// per expression of it and the scraps it imports, where functions are
+// assumed to be called once. Recursion and built-ins like list/map
+// can make it take any number of steps more.
+func (e *Environment) estimateFuel(scrap *Scrap, seen map[*Scrap]bool) int {
+	if seen[scrap] {
+		// Imports are evaluated once.
+		return 0
+	}
+	seen[scrap] = true
+
+	fuel := exprFuel(scrap.expr.Expr)
+	for _, imp := range imports(scrap) {
+		if dep, err := e.Import(imp.algo, imp.hash); err == nil {
+			fuel += e.estimateFuel(dep, seen)
+		}
+	}
+	return fuel
+}
+
+// exprFuel counts the expressions of a node that are evaluated,
+// skipping the names and patterns that bind values, and types.
+func exprFuel(node ast.Node) int {
+	fuel := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		fuel++
+		switch n := n.(type) {
+		case *ast.WhereExpr:
+			if n.Val != nil {
+				fuel += exprFuel(n.Val)
+			}
+			fuel += exprFuel(n.Expr)
+			return false
+		case *ast.FuncExpr:
+			fuel += exprFuel(n.Body)
+			return false
+		case *ast.AccessExpr:
+			fuel += exprFuel(n.Rec)
+			return false
+		}
+		return true
+	})
+	return fuel
+}
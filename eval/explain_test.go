@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	lib := "n -> n + 1"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash: lib})
+	source := "inc two\n; two = 2\n; inc = $sha256~~" + hash + "\n; again = $sha256~~" + hash
+	scrap, err := env.Read([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex, err := env.Explain(scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Type != "int" || ex.Size != len(source) {
+		t.Errorf("Unexpected type %s or size %d", ex.Type, ex.Size)
+	}
+	if !slices.Equal(ex.Imports, []string{"$sha256~~" + hash}) {
+		t.Errorf("Unexpected imports %v", ex.Imports)
+	}
+	expected := []Definition{
+		{"two", "int"},
+		{"inc", "int -> int"},
+		{"again", "int -> int"},
+	}
+	if !slices.Equal(ex.Definitions, expected) {
+		t.Errorf("Expected definitions %v, got %v", expected, ex.Definitions)
+	}
+
+	// Only imports are inferred into the Environment.
+	size := env.reg.Size()
+	if _, err := env.Explain(scrap); err != nil || env.reg.Size() != size {
+		t.Errorf("Explaining again grew the Registry from %d to %d types: %v", size, env.reg.Size(), err)
+	}
+
+	if _, err := env.Eval(scrap); err != nil {
+		t.Fatal(err)
+	}
+	// The estimate is rough, but in the right ballpark.
+	if fuel := env.rt.fuel; ex.Fuel < fuel/2 || ex.Fuel > fuel*2 {
+		t.Errorf("Estimated %d steps, but took %d", ex.Fuel, fuel)
+	}
+}
@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+)
+
+// A Fingerprint summarizes the externally visible type of a Scrap, such
+// that changes to its implementation that keep its type keep its
+// Fingerprint, while any change to its API changes it.
+type Fingerprint struct {
+	// The canonical type of the scrap.
+	Type string
+	// The sha256 hash of Type, in hex.
+	Hash string
+	// If the scrap is a document, a record of definitions,
+	// the names and canonical types of its fields, sorted by name.
+	Exports []Export
+}
+
+// An Export is a field of a document scrap.
+type Export struct {
+	Name string
+	Type string
+}
+
+// Fingerprint infers the type of a Scrap and returns its Fingerprint.
+func (e *Environment) Fingerprint(scrap *Scrap) (Fingerprint, error) {
+	ref, err := e.infer(scrap)
+	if err != nil {
+		return Fingerprint{}, err
+	}
+
+	typ := e.reg.CanonicalString(ref)
+	fp := Fingerprint{Type: typ, Hash: fmt.Sprintf("%x", sha256.Sum256([]byte(typ)))}
+	for _, field := range e.reg.Fields(ref) {
+		fp.Exports = append(fp.Exports, Export{field.Name, e.reg.CanonicalString(field.Type)})
+	}
+	slices.SortFunc(fp.Exports, func(a, b Export) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+	return fp, nil
+}
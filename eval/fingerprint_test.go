@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := func(source string) Fingerprint {
+		env := NewEnvironment()
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp, err := env.Fingerprint(scrap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fp
+	}
+
+	lib := fingerprint(`{ inc = x -> x + 1, id = x -> x }`)
+	if lib.Type != "{ id : (a -> a), inc : (int -> int) }" {
+		t.Errorf("Unexpected type %s", lib.Type)
+	}
+	if exports := fmt.Sprint(lib.Exports); exports != "[{id a -> a} {inc int -> int}]" {
+		t.Errorf("Unexpected exports %s", exports)
+	}
+
+	// Implementations and declaration order don't matter.
+	same := fingerprint(`{ id = y -> y, inc = x -> 1 + x ; one = 1 }`)
+	if same.Hash != lib.Hash {
+		t.Errorf("Expected %s to have the same hash as %s", same.Type, lib.Type)
+	}
+
+	// But types do.
+	other := fingerprint(`{ inc = x -> x + 1, id = x -> x + 0 }`)
+	if other.Hash == lib.Hash {
+		t.Errorf("Expected %s to have another hash than %s", other.Type, lib.Type)
+	}
+
+	if fp := fingerprint(`1`); fp.Type != "int" || fp.Exports != nil {
+		t.Errorf("Unexpected fingerprint %v", fp)
+	}
+}
@@ -0,0 +1,82 @@
+package eval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"maps"
+
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+// A hasher is a hash algorithm scraps can be imported by,
+// like sha256 in `$sha256~~<hash>`.
+type hasher struct {
+	size int
+	new  func() hash.Hash
+}
+
+// A hashKey identifies a scrap by a hash of its source.
+type hashKey struct {
+	algo string
+	hash string // The raw bytes, not hex.
+}
+
+// The algorithms every Environment supports.
+var defaultHashers = map[string]hasher{
+	"sha256": {sha256.Size, sha256.New},
+	"sha512": {sha512.Size, sha512.New},
+}
+
+// RegisterHash makes scraps importable by hashes of another algorithm,
+// like `$blake3~~<hash>` for RegisterHash("blake3", 32, blake3.New).
+// Hashes must be size bytes long. Scraps imported by other algorithms
+// than sha256 are fetched with yards.FetchHash, and checked to have
+// the hash they were imported by.
+func (e *Environment) RegisterHash(algo string, size int, new func() hash.Hash) {
+	if e.hashers == nil {
+		e.hashers = maps.Clone(defaultHashers)
+	}
+	e.hashers[algo] = hasher{size, new}
+}
+
+// Hash returns the hex-encoded hash of a script by a registered algorithm.
+func (e *Environment) Hash(algo string, script []byte) (string, error) {
+	h, err := e.hasher(algo)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.sum(script)), nil
+}
+
+func (e *Environment) hasher(algo string) (hasher, error) {
+	h, ok := e.hashers[algo]
+	if !ok {
+		h, ok = defaultHashers[algo]
+	}
+	if !ok {
+		return h, fmt.Errorf("unknown hash algorithm %s", algo)
+	}
+	return h, nil
+}
+
+func (h hasher) sum(script []byte) []byte {
+	d := h.new()
+	d.Write(script)
+	return d.Sum(nil)
+}
+
+// fetchHash fetches the script with a hash, checking it unless
+// it's sha256, which fetchers are trusted to do with yards.Validate.
+func (e *Environment) fetchHash(h hasher, algo string, hash []byte) ([]byte, error) {
+	script, err := yards.FetchHash(e.fetcher, algo, fmt.Sprintf("%x", hash))
+	if err != nil || algo == "sha256" {
+		return script, err
+	}
+	if !bytes.Equal(h.sum(script), hash) {
+		return nil, yards.ErrWrongHash
+	}
+	return script, nil
+}
@@ -0,0 +1,85 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+func TestImportByAlgorithm(t *testing.T) {
+	lib := []byte(`a -> a + 1`)
+	sha512Key := fmt.Sprintf("%x", sha512.Sum512(lib))
+	sha224Key := fmt.Sprintf("%x", sha256.Sum224(lib))
+	fsys := fstest.MapFS{
+		"sha512/" + sha512Key: {Data: lib},
+		"sha224/" + sha224Key: {Data: lib},
+		// Stored under the hash of another script.
+		"sha512/" + fmt.Sprintf("%x", sha512.Sum512([]byte(`2`))): {Data: lib},
+	}
+
+	env := NewEnvironment()
+	env.UseFetcher(yards.ByDirectory(fsys))
+
+	val, err := eval(env, `$sha512~~`+sha512Key+` 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "2" {
+		t.Errorf("expected 2, got %s", val)
+	}
+
+	_, err = eval(env, `$sha512~~`+fmt.Sprintf("%x", sha512.Sum512([]byte(`2`))))
+	if !errors.Is(err, yards.ErrWrongHash) {
+		t.Errorf("expected %s, got %v", yards.ErrWrongHash, err)
+	}
+
+	_, err = eval(env, `$sha224~~`+sha224Key+` 1`)
+	if err == nil || !strings.Contains(err.Error(), "unknown hash algorithm sha224") {
+		t.Errorf("expected unknown algorithm, got %v", err)
+	}
+
+	// Failures are remembered, so register sha224 in a fresh Environment.
+	env = NewEnvironment()
+	env.UseFetcher(yards.ByDirectory(fsys))
+	env.RegisterHash("sha224", sha256.Size224, sha256.New224)
+	val, err = eval(env, `$sha224~~`+sha224Key+` 2`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "3" {
+		t.Errorf("expected 3, got %s", val)
+	}
+
+	_, err = eval(env, `$sha224~~`+sha512Key)
+	if err == nil || !strings.Contains(err.Error(), "cannot import sha224 bytes of length 64, must be 28") {
+		t.Errorf("expected a length error, got %v", err)
+	}
+
+	// Clones know the registered algorithms too.
+	if key, err := env.Clone().Hash("sha224", lib); err != nil || key != sha224Key {
+		t.Errorf("expected %s, got %s, %v", sha224Key, key, err)
+	}
+}
+
+func TestHashAlgorithms(t *testing.T) {
+	env := NewEnvironment()
+	script := []byte(`1 + 2`)
+	for algo, want := range map[string]string{
+		"sha256": fmt.Sprintf("%x", sha256.Sum256(script)),
+		"sha512": fmt.Sprintf("%x", sha512.Sum512(script)),
+	} {
+		got, err := env.Hash(algo, script)
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s, %v", algo, want, got, err)
+		}
+	}
+	if _, err := env.Hash("md5", script); err == nil {
+		t.Error("expected md5 to be unknown")
+	}
+}
@@ -0,0 +1,45 @@
+package eval
+
+import (
+	"slices"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// An InlayHint is the inferred type of an unannotated where-binding,
+// for editors to show next to its name.
+type InlayHint struct {
+	// The span of the binding's name.
+	Pos  token.Span
+	Type string
+}
+
+// InlayHints returns the InlayHints of a Scrap, in source order.
+//
+// If the Scrap is ill-typed, the hints for the bindings inferred
+// before the error are returned, along with the error.
+func (e *Environment) InlayHints(scrap *Scrap) ([]InlayHint, error) {
+	var info types.Info
+	reg, inferImport := e.scratch()
+	_, err := types.InferInfo(reg, e.typeScope, scrap.expr, inferImport, &info)
+
+	var hints []InlayHint
+	ast.Inspect(scrap.expr.Expr, func(n ast.Node) bool {
+		where, ok := n.(*ast.WhereExpr)
+		if !ok || where.Val == nil || where.Typ != nil {
+			return true
+		}
+		if ref, ok := info.Defs[&where.Id]; ok {
+			hints = append(hints, InlayHint{where.Id.Pos, reg.String(ref)})
+		}
+		return true
+	})
+
+	// Where-chains are nested with the last binding outermost.
+	slices.SortFunc(hints, func(a, b InlayHint) int {
+		return a.Pos.Start - b.Pos.Start
+	})
+	return hints, err
+}
@@ -0,0 +1,61 @@
+package eval
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestInlayHints(t *testing.T) {
+	examples := []struct {
+		source string
+		hints  []string
+	}{
+		{`f x ; f = a -> a + 1 ; x = 1`, []string{"f : int -> int", "x : int"}},
+		{`id ; id = a -> a`, []string{"id : a -> a"}},
+		// Annotated bindings need no hints.
+		{`x ; x : t = t::a ; y = "a" ; t : #a #b`, []string{"y : text"}},
+		{`x ; x = t::a ; t : #a #b`, []string{"x : #a #b"}},
+		// Nested where-chains.
+		{`f ; f = (g ; g = ~01)`, []string{"f : byte", "g : byte"}},
+	}
+
+	for _, ex := range examples {
+		env := NewEnvironment()
+		scrap, err := env.Read([]byte(ex.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := env.reg.Size()
+		hints, err := env.InlayHints(scrap)
+		if err != nil {
+			t.Errorf("%s: %s", ex.source, err)
+			continue
+		}
+		if env.reg.Size() != size {
+			t.Errorf("%s: the Registry grew from %d to %d types", ex.source, size, env.reg.Size())
+		}
+		var got []string
+		for _, hint := range hints {
+			got = append(got, fmt.Sprintf("%s : %s", ex.source[hint.Pos.Start:hint.Pos.End], hint.Type))
+		}
+		if !slices.Equal(got, ex.hints) {
+			t.Errorf("%s\n  got  %q\n  want %q", ex.source, got, ex.hints)
+		}
+	}
+}
+
+func TestInlayHintsIllTyped(t *testing.T) {
+	env := NewEnvironment()
+	scrap, err := env.Read([]byte(`x + y ; x = "a" ; y = 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hints, err := env.InlayHints(scrap)
+	if err == nil {
+		t.Error("Expected a type error")
+	}
+	if len(hints) != 2 || hints[0].Type != "text" || hints[1].Type != "int" {
+		t.Errorf("Expected hints for x and y, got %v", hints)
+	}
+}
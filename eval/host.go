@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// A HostValue is a Go value that a host passes through scraps, like a
+// database handle granted to a scrap as a capability. Scraps can't make
+// or inspect them, only pass them on, for instance to the host functions
+// they were given along with them.
+type HostValue interface {
+	// MarshalScrap renders the value. Since it's part of the keys of
+	// `cache` expressions, and of the hashes of Hosts, values must render
+	// the same if they're Equal, and differently if they aren't.
+	MarshalScrap() string
+	// Equal reports whether the value equals another of the same kind.
+	Equal(other HostValue) bool
+}
+
+// A HostKind is a kind of HostValues, with an opaque type of the same
+// name, which scraps may use in type annotations.
+type HostKind struct {
+	name string
+	typ  types.TypeRef
+}
+
+// A Host is a HostValue of some HostKind, as a Value.
+type Host struct {
+	kind  *HostKind
+	value HostValue
+}
+
+// RegisterKind registers a HostKind, binding its name to its type.
+// The name mustn't be bound already.
+func (e *Environment) RegisterKind(name string) (*HostKind, error) {
+	if e.typeScope.Get(name) != nil {
+		return nil, fmt.Errorf("cannot register kind %s, since the name is taken", name)
+	}
+	kind := &HostKind{name, e.reg.Opaque(name)}
+	e.kinds = append(e.kinds, kind)
+	e.bindKind(kind)
+	return kind, nil
+}
+
+func (e *Environment) bindKind(kind *HostKind) {
+	e.vars[kind.name] = Type(kind.typ)
+	e.typeScope = e.typeScope.Bind(kind.name, types.TypeOf(kind.typ))
+}
+
+// Name returns the name of the HostKind, which is also that of its type.
+func (k *HostKind) Name() string {
+	return k.name
+}
+
+// Wrap returns a HostValue of the kind as a Value.
+func (k *HostKind) Wrap(value HostValue) Host {
+	return Host{k, value}
+}
+
+// Unwrap returns the HostValue of val, if it's of the kind.
+func (k *HostKind) Unwrap(val Value) (HostValue, bool) {
+	if h, ok := val.(Host); ok && h.kind == k {
+		return h.value, true
+	}
+	return nil, false
+}
+
+func (h Host) eq(other Value, depth int) bool {
+	o, ok := other.(Host)
+	if !ok || h.kind != o.kind {
+		return false
+	}
+	if h.value == nil || o.value == nil {
+		return h.value == o.value
+	}
+	return h.value.Equal(o.value)
+}
+
+func (h Host) Type() types.TypeRef { return h.kind.typ }
+
+func (h Host) String() string {
+	return fmt.Sprintf("<%s %s>", h.kind.name, h.marshal())
+}
+
+// marshal renders the HostValue, or nil if the host wrapped none.
+func (h Host) marshal() string {
+	if h.value == nil {
+		return "nil"
+	}
+	return h.value.MarshalScrap()
+}
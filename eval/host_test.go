@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+type handle string
+
+func (h handle) MarshalScrap() string {
+	return string(h)
+}
+
+func (h handle) Equal(other HostValue) bool {
+	return h == other.(handle)
+}
+
+func TestHostKinds(t *testing.T) {
+	env := NewEnvironment()
+	db, err := env.RegisterKind("db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.RegisterKind("int"); err == nil {
+		t.Error("expected int to be taken")
+	}
+
+	for _, env := range []*Environment{env, env.Clone()} {
+		scrap, err := env.Read([]byte(`f ; f : db -> db = d -> list/fold d (a -> b -> b) [d, d]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := env.Infer(scrap)
+		if err != nil || typ != "db -> db" {
+			t.Errorf("expected db -> db, got %s, %v", typ, err)
+		}
+
+		fn, err := env.Eval(scrap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := Callable(fn)(db.Wrap(handle("conn-1")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.String() != "<db conn-1>" {
+			t.Errorf("unexpected %s", val)
+		}
+		if !same(val, db.Wrap(handle("conn-1"))) || same(val, db.Wrap(handle("conn-2"))) {
+			t.Error("expected host values to be compared with Equal")
+		}
+		if h, ok := db.Unwrap(val); !ok || h != handle("conn-1") {
+			t.Errorf("expected to unwrap conn-1, got %v", h)
+		}
+	}
+
+	scrap, err := env.Read([]byte(`f ; f : db -> db = d -> 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Infer(scrap); err == nil || !strings.Contains(err.Error(), "cannot unify") {
+		t.Errorf("expected host values not to unify with int, got %v", err)
+	}
+
+	// Host values can't be emitted as scrapscript.
+	if _, err := env.EmitScrap(db.Wrap(handle("conn-1"))); err == nil {
+		t.Error("expected host values not to be emitted")
+	}
+	if _, ok := db.Unwrap(Int(1)); ok {
+		t.Error("expected ints not to unwrap")
+	}
+
+	// Equal host values hash the same, and wrapping none doesn't panic.
+	if Hash(db.Wrap(handle("conn-1"))) != Hash(db.Wrap(handle("conn-1"))) ||
+		Hash(db.Wrap(handle("conn-1"))) == Hash(db.Wrap(handle("conn-2"))) {
+		t.Error("expected host values to hash by their kind and value")
+	}
+	if same(db.Wrap(nil), db.Wrap(handle("conn-1"))) || !same(db.Wrap(nil), db.Wrap(nil)) {
+		t.Error("expected only nil host values to equal nil ones")
+	}
+}
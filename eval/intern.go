@@ -0,0 +1,205 @@
+package eval
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// Hash returns a structural hash of a Value.
+// Values that are Equal have the same hash.
+func Hash(v Value) uint64 {
+	return hashValue(v, 0, nil)
+}
+
+// A contentKey is the identity of the contents of a record or list, with
+// its type, which copies sharing the contents may differ in.
+type contentKey struct {
+	id  any
+	typ types.TypeRef
+}
+
+// hashValue hashes a value nested depth records, lists and variants deep.
+// Values nested deeper than MaxNesting aren't hashed, like they aren't compared.
+// Nested values are hashed on their own, so that the hashes of records and
+// lists can be remembered in hashes, if it isn't nil, and not recomputed
+// for each value they are nested in.
+func hashValue(v Value, depth int, hashes map[contentKey]uint64) uint64 {
+	var key contentKey
+	id, ok := identity(v)
+	if ok {
+		key = contentKey{id, v.Type()}
+	}
+	if ok && hashes != nil {
+		if hash, ok := hashes[key]; ok {
+			return hash
+		}
+	}
+
+	w := fnv.New64a()
+	var buf [8]byte
+	number := func(n uint64) {
+		binary.LittleEndian.PutUint64(buf[:], n)
+		w.Write(buf[:])
+	}
+	text := func(s string) {
+		number(uint64(len(s)))
+		io.WriteString(w, s)
+	}
+
+	switch v.(type) {
+	case Record, List, Variant:
+		if depth >= MaxNesting {
+			text("...")
+			return w.Sum64()
+		}
+	}
+
+	// Tag each kind of value, so that e.g. 1 and ~01 differ.
+	switch v := v.(type) {
+	case nil:
+		text("nil")
+	case Hole:
+		text("hole")
+	case Int:
+		text("int")
+		number(uint64(v))
+	case Float:
+		text("float")
+		number(math.Float64bits(float64(v)))
+	case Text:
+		text("text")
+		text(string(v))
+	case Byte:
+		text("byte")
+		number(uint64(v))
+	case Bytes:
+		text("bytes")
+		text(string(v))
+	case Type:
+		text("type")
+		number(uint64(v))
+	case Record:
+		text("record")
+		number(uint64(v.typ))
+		for _, key := range slices.Sorted(maps.Keys(v.values)) {
+			text(key)
+			number(hashValue(v.values[key], depth+1, hashes))
+		}
+	case List:
+		text("list")
+		number(uint64(v.typ))
+		number(uint64(v.Len()))
+		for _, elem := range v.values() {
+			number(hashValue(elem, depth+1, hashes))
+		}
+	case Variant:
+		text("variant")
+		text(v.tag)
+		number(hashValue(v.value, depth+1, hashes))
+	case Host:
+		text("host")
+		text(v.kind.name)
+		text(v.marshal())
+	case BuiltInFunc:
+		text("builtin")
+		text(v.name)
+	case ScriptFunc:
+		text("func")
+		text(v.String())
+		// Functions capturing bindings that fail to evaluate
+		// are hashed by their source alone.
+		captured, _ := v.captured()
+		for _, name := range slices.Sorted(maps.Keys(captured)) {
+			text(name)
+			number(hashValue(captured[name], depth+1, hashes))
+		}
+	}
+
+	hash := w.Sum64()
+	if ok && hashes != nil {
+		hashes[key] = hash
+	}
+	return hash
+}
+
+// maxInterned is how many values, and hashes of records and lists, an
+// interner remembers, before it forgets them all and starts over.
+const maxInterned = 1 << 16
+
+// An interner ensures that equal records, lists and variants
+// share their underlying data, so that comparing them is cheap.
+type interner struct {
+	table  map[uint64][]Value
+	size   int // The number of values in table.
+	hashes map[contentKey]uint64
+}
+
+// intern returns a previously interned Value equal to v if there is one,
+// otherwise v. Variants have no data of their own to share, so only the
+// values they hold are interned.
+func (in *interner) intern(v Value) Value {
+	if in == nil {
+		return v
+	}
+	switch val := v.(type) {
+	case Record, List:
+	case Variant:
+		if val.value != nil {
+			val.value = in.intern(val.value)
+		}
+		return val
+	default:
+		return v
+	}
+	if in.table == nil || in.size >= maxInterned {
+		in.table = make(map[uint64][]Value)
+		in.size = 0
+	}
+
+	hash := in.hash(v)
+	for _, other := range in.table[hash] {
+		if same(v, other) {
+			return other
+		}
+	}
+	in.table[hash] = append(in.table[hash], v)
+	in.size++
+	return v
+}
+
+// hash returns the Hash of v, remembering those of records and lists.
+func (in *interner) hash(v Value) uint64 {
+	if in == nil {
+		return Hash(v)
+	}
+	if in.hashes == nil || len(in.hashes) >= maxInterned {
+		in.hashes = make(map[contentKey]uint64)
+	}
+	return hashValue(v, 0, in.hashes)
+}
+
+// UseInterning controls whether records, lists and variants are interned.
+//
+// When enabled, equal values constructed during evaluation share their
+// contents, making equality checks on big data, as in pattern matching,
+// nearly constant-time. The cost is hashing each constructed value,
+// and remembering many of them.
+func (e *Environment) UseInterning(enabled bool) {
+	if enabled {
+		e.rt.interner = &interner{}
+	} else {
+		e.rt.interner = nil
+	}
+}
+
+// sameMap returns true if both maps share the same underlying data.
+func sameMap[M ~map[K]V, K comparable, V any](a, b M) bool {
+	return reflect.ValueOf(a).UnsafePointer() == reflect.ValueOf(b).UnsafePointer()
+}
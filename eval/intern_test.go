@@ -0,0 +1,120 @@
+package eval
+
+import "testing"
+
+func TestHash(t *testing.T) {
+	env := NewEnvironment()
+	examples := []struct {
+		a, b  string
+		equal bool
+	}{
+		{`1`, `1`, true},
+		{`1`, `~01`, false},
+		{`"a"`, `"a"`, true},
+		{`{ a = 1, b = [ 2 ] }`, `{ b = [ 2 ], a = 1 }`, true},
+		{`{ a = 1, b = [ 2 ] }`, `{ a = 1, b = [ 3 ] }`, false},
+		{`[ 1, 2 ]`, `[ 1 ] +< 2`, true},
+		{`[ 1, 2 ]`, `[ 2, 1 ]`, false},
+		{`b::x ; b : #x #y`, `b::x ; b : #x #y`, true},
+		{`b::x ; b : #x #y`, `b::y ; b : #x #y`, false},
+		{`x -> x+1`, `x  ->  (x + 1)`, true},
+		{`x -> x + 1`, `y -> y + 1`, false},
+		{`| 0 -> 1 | n -> n`, `|  0 ->1  |  n ->  n`, true},
+		{`f 1 ; f = a -> x -> x + a`, `(a -> x -> x + a) 1`, true},
+		{`f 1 ; f = a -> x -> x + a`, `f 2 ; f = a -> x -> x + a`, false},
+	}
+
+	for _, ex := range examples {
+		a, err := eval(env, ex.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := eval(env, ex.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if same(a, b) != ex.equal {
+			t.Errorf("Expected Equals(%s, %s) to be %t", ex.a, ex.b, ex.equal)
+		}
+		if ex.equal && Hash(a) != Hash(b) {
+			t.Errorf("Expected equal hashes for %s and %s", ex.a, ex.b)
+		}
+	}
+}
+
+func TestInterning(t *testing.T) {
+	env := NewEnvironment()
+	env.UseInterning(true)
+
+	val, err := eval(env, `[ { a = [ 1, 2 ] }, { a = [ 1 ] +< 2 } ]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elements := val.(List).values()
+	a, b := elements[0].(Record), elements[1].(Record)
+	if !sameMap(a.values, b.values) {
+		t.Error("Expected equal records to share their values")
+	}
+	if !same(a, b) {
+		t.Error("Expected interned records to be equal")
+	}
+}
+
+func TestInterningVariantsAndBuiltIns(t *testing.T) {
+	env := NewEnvironment()
+	env.UseInterning(true)
+
+	val, err := eval(env, `{ v = [ a::x { b = 1 }, a::x { b = 1 } ], l = [ record/keys { a = 1 }, [ "a" ] ] } ; a : #x { b : int }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants, _ := val.(Record).Get("v")
+	elements := variants.(List).values()
+	a, b := elements[0].(Variant).value.(Record), elements[1].(Variant).value.(Record)
+	if !sameMap(a.values, b.values) {
+		t.Error("Expected equal variants to share their values")
+	}
+	lists, _ := val.(Record).Get("l")
+	elements = lists.(List).values()
+	if elements[0].(List).elements != elements[1].(List).elements {
+		t.Error("Expected the results of built-ins to be interned")
+	}
+}
+
+func TestInterningIsBounded(t *testing.T) {
+	in := &interner{}
+	first := in.intern(List{elements: leaf([]Value{Int(0)})})
+	for i := range maxInterned {
+		in.intern(List{elements: leaf([]Value{Int(i + 1)})})
+	}
+	if in.size > maxInterned || len(in.hashes) > maxInterned {
+		t.Errorf("Expected at most %d interned values, got %d and %d hashes", maxInterned, in.size, len(in.hashes))
+	}
+	// Forgotten values are interned anew.
+	again := in.intern(List{elements: leaf([]Value{Int(0)})})
+	if again.(List).elements == first.(List).elements {
+		t.Error("Expected the first value to be forgotten")
+	}
+}
+
+func TestInterningDeepValues(t *testing.T) {
+	// Values too deep to compare aren't taken for equal ones.
+	in := &interner{}
+	first := in.intern(nest(MaxNesting + 1))
+	again := in.intern(nest(MaxNesting + 1))
+	if again.(List).elements == first.(List).elements {
+		t.Error("Expected values too deep to compare not to be interned")
+	}
+}
+
+func TestHashRemembersNestedHashes(t *testing.T) {
+	in := &interner{}
+	inner := List{elements: leaf([]Value{Int(1), Int(2)})}
+	outer := List{elements: leaf([]Value{inner, inner})}
+	if in.hash(outer) != Hash(outer) {
+		t.Error("Expected remembered hashes to be the same")
+	}
+	if _, ok := in.hashes[contentKey{inner.elements, inner.typ}]; !ok {
+		t.Error("Expected the hash of the nested list to be remembered")
+	}
+}
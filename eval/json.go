@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// JSON renders a Value as JSON, for programs that don't read scrapscript.
+//
+// Numbers and bytes are numbers, text is a string, bytes are a base64
+// string, and hole is null. Lists are arrays, records are objects with
+// their keys sorted, and variants are objects like {"tag":"ok","value":5},
+// without a value if their tag takes none. Types are strings, like Infer
+// returns. Functions and values nested deeper than MaxNesting can't be
+// rendered, and are errors.
+func (e *Environment) JSON(value Value) ([]byte, error) {
+	v, err := e.jsonValue(value, 0)
+	if err != nil {
+		return nil, err
+	}
+	// Marshal escapes <, > and &, for embedding in HTML, which we don't.
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(b.Bytes(), []byte("\n")), nil
+}
+
+// jsonValue returns a value that encoding/json renders like JSON.
+func (e *Environment) jsonValue(v Value, depth int) (any, error) {
+	switch v.(type) {
+	case Record, List, Variant:
+		if depth >= MaxNesting {
+			return nil, fmt.Errorf("cannot render values nested more than %d deep as JSON", MaxNesting)
+		}
+	}
+
+	switch v := v.(type) {
+	case Hole:
+		return nil, nil
+	case Int, Float, Text, Byte, Bytes:
+		return v, nil
+	case Type:
+		return e.reg.String(types.TypeRef(v)), nil
+	case Record:
+		obj := make(map[string]any, len(v.values))
+		for key, val := range v.values {
+			js, err := e.jsonValue(val, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = js
+		}
+		return obj, nil
+	case List:
+		arr := make([]any, 0, v.Len())
+		for _, val := range v.values() {
+			js, err := e.jsonValue(val, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, js)
+		}
+		return arr, nil
+	case Variant:
+		obj := map[string]any{"tag": v.tag}
+		if v.value != nil {
+			js, err := e.jsonValue(v.value, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			obj["value"] = js
+		}
+		return obj, nil
+	}
+	return nil, fmt.Errorf("cannot render %s as JSON", v)
+}
+
+// TypeOf returns the type of a Value, as it was evaluated.
+// Functions defined in scrapscript are of the unknown type ?.
+func (e *Environment) TypeOf(value Value) string {
+	return e.reg.String(value.Type())
+}
@@ -0,0 +1,54 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	examples := []struct{ source, json string }{
+		{`1`, `1`},
+		{`1.5`, `1.5`},
+		{`"<a\b>"`, `"<a\\b>"`},
+		{`~ff`, `255`},
+		{`~~aGk=`, `"aGk="`},
+		{`()`, `null`},
+		{`[1, 2]`, `[1,2]`},
+		{`[]`, `[]`},
+		{`{ b = [], a = "x" }`, `{"a":"x","b":[]}`},
+		{`#ok 5`, `{"tag":"ok","value":5}`},
+		{`t::none ; t : #none #some int`, `{"tag":"none"}`},
+		{`int`, `"int"`},
+		{`{ f = { g = #a [1] } }`, `{"f":{"g":{"tag":"a","value":[1]}}}`},
+	}
+
+	env := NewEnvironment()
+	for _, ex := range examples {
+		scrap, err := env.Read([]byte(ex.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := env.Eval(scrap)
+		if err != nil {
+			t.Fatalf("%s: %v", ex.source, err)
+		}
+		js, err := env.JSON(val)
+		if err != nil || string(js) != ex.json {
+			t.Errorf("%s: expected %s, got %s, %v", ex.source, ex.json, js, err)
+		}
+	}
+
+	for _, source := range []string{`x -> x`, `{ f = x -> x }`, `[text/length]`} {
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		val, err := env.Eval(scrap)
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		if _, err := env.JSON(val); err == nil || !strings.Contains(err.Error(), "as JSON") {
+			t.Errorf("%s: expected an error, got %v", source, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// A member of a library, evaluated and inferred on its own.
+//
+// Libraries are scraps of records of named definitions, like
+// `{ inc = n -> n + 1, dec = n -> n - 1 }`, optionally in where-chains.
+// When a member of an imported library is accessed, like
+// `$sha256~~<hash>.inc`, only the where-bindings and that member are
+// inferred, and only that member and the where-bindings it uses are
+// evaluated, rather than every member of the library.
+type member struct {
+	typ   stage[types.TypeRef]
+	value stage[Value]
+}
+
+// member returns the member key of a Scrap.
+func (s *Scrap) member(key string) *member {
+	if s.members == nil {
+		s.members = make(map[string]*member)
+	}
+	m, ok := s.members[key]
+	if !ok {
+		m = new(member)
+		s.members[key] = m
+	}
+	return m
+}
+
+// cloneMembers returns a copy of the types of the members of a Scrap, such
+// that clones of an Environment don't share them; see Environment.Clone.
+func (s *Scrap) cloneMembers() map[string]*member {
+	if s.members == nil {
+		return nil
+	}
+	members := make(map[string]*member, len(s.members))
+	for key, m := range s.members {
+		members[key] = &member{typ: m.typ.result()}
+	}
+	return members
+}
+
+// evalMember evaluates the member key of an imported library,
+// or reports false if the scrap isn't a library with the member.
+func (e *Environment) evalMember(algo string, hash []byte, key string) (Value, bool, error) {
+	scrap, err := e.fetch(algo, hash)
+	if err != nil {
+		return nil, false, err
+	}
+	if !types.IsLibrary(scrap.expr, key) {
+		return nil, false, nil
+	}
+	// Once the whole library is evaluated, its members needn't be.
+	if scrap.value.state == stageDone && scrap.value.err == nil {
+		if rec, ok := scrap.value.val.(Record); ok {
+			return rec.values[key], true, nil
+		}
+	}
+
+	name := fmt.Sprintf("%x.%s", hash, key)
+	if algo == localAlgo {
+		name = fmt.Sprintf("%s.%s", hash, key)
+	}
+	e.rt.emit(Event{Kind: ImportStarted, Name: name})
+	m := e.rt.measure()
+	val, err := scrap.member(key).value.run(e, func() (Value, error) {
+		return evalMember(scrap.expr, scrapName(scrap.Sha256()), key, &e.reg, e.vars, e.evalImport, &e.rt)
+	})
+	e.rt.emit(Event{
+		Kind:     ImportFinished,
+		Name:     name,
+		Duration: e.rt.measured(m, ImportFinished, "", name),
+		Value:    val,
+		Err:      err,
+	})
+	return val, true, err
+}
+
+// inferMember infers the type of the member key of an imported library,
+// or reports false if the scrap isn't a library with the member.
+func (e *Environment) inferMember(algo string, hash []byte, key string) (types.TypeRef, bool, error) {
+	scrap, err := e.fetch(algo, hash)
+	if err != nil {
+		return types.NeverRef, false, err
+	}
+	if !types.IsLibrary(scrap.expr, key) {
+		return types.NeverRef, false, nil
+	}
+	// Once the whole library is inferred, its members needn't be.
+	if scrap.typ.state == stageDone && scrap.typ.err == nil {
+		return e.reg.GetRecord(scrap.typ.val)[key], true, nil
+	}
+
+	ref, err := scrap.member(key).typ.run(e, func() (types.TypeRef, error) {
+		return types.InferLibraryMember(&e.reg, e.typeScope, scrap.expr, key, e.inferImport, e.inferMember)
+	})
+	return ref, true, err
+}
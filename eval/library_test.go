@@ -0,0 +1,59 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLibraryMembers(t *testing.T) {
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	// Only members that are used are inferred and evaluated,
+	// so the ill-typed one doesn't get in the way.
+	lib := `{ inc = n -> n + one, bad = 1 + "a" } ; one = 1`
+	rec := `r ; r = { a = 1 }`
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash(lib): lib, hash(rec): rec})
+
+	for source, expected := range map[string]string{
+		"$sha256~~" + hash(lib) + ".inc 2":   "3",
+		"($sha256~~" + hash(lib) + ").inc 2": "3",
+		// Other records are evaluated whole.
+		"$sha256~~" + hash(rec) + ".a": "1",
+	} {
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ, err := env.Infer(scrap); err != nil || typ != "int" {
+			t.Errorf("%s: expected type int, got %s, %v", source, typ, err)
+		}
+		if val, err := env.Eval(scrap); err != nil || val.String() != expected {
+			t.Errorf("%s: expected %s, got %v, %v", source, expected, val, err)
+		}
+	}
+
+	scrap, err := env.Read([]byte("$sha256~~" + hash(lib) + ".bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Infer(scrap); err == nil || !strings.Contains(err.Error(), "+ requires int or float") {
+		t.Errorf("Expected the bad member not to infer, got %v", err)
+	}
+	if _, err := env.Eval(scrap); err == nil {
+		t.Errorf("Expected the bad member not to evaluate")
+	}
+
+	// Keys missing from libraries are reported as for other records.
+	scrap, err = env.Read([]byte("$sha256~~" + hash(rec) + ".b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Infer(scrap); err == nil || !strings.Contains(err.Error(), "has no key b") {
+		t.Errorf("Expected a missing key, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package eval
+
+// A seq is an immutable sequence of values.
+//
+// Prepending, appending and concatenating seqs takes constant time,
+// since the result shares the structure of its operands. A seq is
+// either a leaf holding a slice of values, or a node joining two seqs.
+type seq struct {
+	values      []Value // Only set for leaves.
+	left, right *seq    // Only set for nodes.
+	len         int
+}
+
+func leaf(values []Value) *seq {
+	return &seq{values: values, len: len(values)}
+}
+
+// join concatenates two seqs, either of which may be nil.
+func join(left, right *seq) *seq {
+	if left == nil || left.len == 0 {
+		return right
+	}
+	if right == nil || right.len == 0 {
+		return left
+	}
+	return &seq{left: left, right: right, len: left.len + right.len}
+}
+
+// flatten returns all values of the seq in order. The returned slice
+// may be shared with the seq, and must not be modified.
+func (s *seq) flatten() []Value {
+	if s == nil {
+		return nil
+	}
+	if s.left == nil {
+		return s.values
+	}
+
+	values := make([]Value, 0, s.len)
+	// Walk the tree iteratively, since appending
+	// to a list one value at a time makes it deep.
+	stack := []*seq{s}
+	for len(stack) > 0 {
+		s := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if s.left == nil {
+			values = append(values, s.values...)
+		} else {
+			stack = append(stack, s.right, s.left)
+		}
+	}
+	return values
+}
+
+// Len returns the number of elements in the List.
+func (l List) Len() int {
+	if l.elements == nil {
+		return 0
+	}
+	return l.elements.len
+}
+
+// values returns the elements of the List. The returned slice
+// must not be modified.
+func (l List) values() []Value {
+	return l.elements.flatten()
+}
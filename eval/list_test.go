@@ -0,0 +1,29 @@
+package eval
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSeq(t *testing.T) {
+	var s *seq
+	for i := range 10000 {
+		s = join(s, leaf([]Value{Int(i)}))
+	}
+	s = join(leaf([]Value{Int(-1)}), s)
+	s = join(s, join(leaf(nil), leaf([]Value{Int(10000), Int(10001)})))
+
+	values := s.flatten()
+	if s.len != len(values) || len(values) != 10003 {
+		t.Fatalf("Expected 10003 values, got %d (len %d)", len(values), s.len)
+	}
+	for i, v := range values {
+		if v != Int(i-1) {
+			t.Fatalf("Expected %d at index %d, got %s", i-1, i, v)
+		}
+	}
+
+	if !slices.Equal(join(nil, leaf(nil)).flatten(), nil) {
+		t.Error("Expected empty seq")
+	}
+}
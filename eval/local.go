@@ -0,0 +1,99 @@
+package eval
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/ast"
+)
+
+// The algorithm of local imports, like `$local:utils`.
+const localAlgo = "local"
+
+// UseLocal makes local imports, like `$local:utils`, import the scrap
+// `utils.scrap` of fsys. Local imports let scraps under development
+// import each other before they have hashes; they're linked to imports
+// by hash with Scrap.Link before being pushed. A nil fsys turns local
+// imports off, which is the default.
+func (e *Environment) UseLocal(fsys fs.FS) {
+	e.local = fsys
+}
+
+// fetchLocal reads the local scrap of a name. Since local scraps are
+// known by their sha256 hashes once read, each is read only once,
+// and the ImportPolicy applies to them by those.
+func (e *Environment) fetchLocal(name string) (*Scrap, error) {
+	if e.local == nil {
+		return nil, fmt.Errorf("cannot import $local:%s without a local directory; link it first", name)
+	}
+	script, err := fs.ReadFile(e.local, name+".scrap")
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(script)
+	if e.policy != nil && !e.policy("sha256", fmt.Sprintf("%x", sum)) {
+		return nil, &ErrImportDenied{"sha256", fmt.Sprintf("%x", sum)}
+	}
+	if scrap, ok := e.scraps[hashKey{"sha256", string(sum[:])}]; ok {
+		return scrap, nil
+	}
+	return e.Read(script)
+}
+
+// localImports returns the local imports of a Scrap, in source order.
+func (s *Scrap) localImports() []*ast.ImportExpr {
+	var locals []*ast.ImportExpr
+	ast.Inspect(s.expr.Expr, func(n ast.Node) bool {
+		if x, ok := n.(*ast.ImportExpr); ok && x.Local() {
+			locals = append(locals, x)
+		}
+		return true
+	})
+	// Where-chains are nested with the last binding outermost,
+	// so imports aren't inspected in source order.
+	slices.SortFunc(locals, func(a, b *ast.ImportExpr) int {
+		return a.Pos.Start - b.Pos.Start
+	})
+	return locals
+}
+
+// checkUnlinked returns an error if a Scrap imported by hash has local
+// imports, which would resolve to whatever the importer's local directory
+// has by their names, rather than what its author linked.
+func (s *Scrap) checkUnlinked() error {
+	if locals := s.localImports(); len(locals) > 0 {
+		x := locals[0]
+		src := &s.expr.Source
+		return src.Error(x.Pos, fmt.Sprintf("cannot import a scrap by hash that imports $local:%s; it must be linked first", src.GetString(x.Value.Pos)))
+	}
+	return nil
+}
+
+// Link returns the source of a Scrap with its local imports replaced
+// by imports by hash, like `$sha256~~<hash>`, from the hex-encoded sha256
+// hashes of the scraps they name. Since a scrap's hash depends on those
+// of its imports, scraps must be linked after the scraps they import.
+func (s *Scrap) Link(hashes map[string]string) ([]byte, error) {
+	locals := s.localImports()
+	src := &s.expr.Source
+	script := src.Bytes()
+	var b bytes.Buffer
+	last := 0
+	for _, x := range locals {
+		name := src.GetString(x.Value.Pos)
+		hash, ok := hashes[name]
+		if !ok {
+			return nil, src.Error(x.Pos, fmt.Sprintf("cannot link $local:%s, which has no hash", name))
+		}
+		b.Write(script[last:x.Pos.Start])
+		b.WriteString("$sha256~~")
+		b.WriteString(hash)
+		last = x.Pos.End
+	}
+	b.Write(script[last:])
+	return b.Bytes(), nil
+}
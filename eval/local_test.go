@@ -0,0 +1,107 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+func TestLocalImports(t *testing.T) {
+	env := NewEnvironment()
+	env.UseLocal(fstest.MapFS{
+		"inc.scrap":       {Data: []byte("n -> n + $local:lib/one")},
+		"lib/one.scrap":   {Data: []byte("1")},
+		"cycle-a.scrap":   {Data: []byte("$local:cycle-b")},
+		"cycle-b.scrap":   {Data: []byte("$local:cycle-a")},
+		"ill-typed.scrap": {Data: []byte(`1 + "a"`)},
+	})
+
+	val, err := eval(env, "$local:inc 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "3" {
+		t.Errorf("Expected 3, got %s", val)
+	}
+
+	scrap, err := env.Read([]byte("$local:inc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ, err := env.Infer(scrap); err != nil || typ != "int -> int" {
+		t.Errorf("Expected int -> int, got %s, %v", typ, err)
+	}
+	if imports := scrap.Imports(); !slices.Equal(imports, []string{"$local:inc"}) {
+		t.Errorf("Unexpected imports %v", imports)
+	}
+
+	for source, msg := range map[string]string{
+		"$local:missing":   "missing.scrap",
+		"$local:cycle-a":   errCycle.Error(),
+		"$local:ill-typed": `+ requires int or float`,
+	} {
+		scrap, err := env.Read([]byte(source))
+		if err == nil {
+			_, err = env.Infer(scrap)
+		}
+		if err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%s: expected an error containing %q, got %v", source, msg, err)
+		}
+	}
+
+	// Scraps imported by hash must not import local scraps, even if they
+	// would resolve.
+	unlinked := "$local:lib/one"
+	env.UseFetcher(MapFetcher{fmt.Sprintf("%x", sha256.Sum256([]byte(unlinked))): unlinked})
+	if _, err := eval(env, fmt.Sprintf("$sha256~~%x", sha256.Sum256([]byte(unlinked)))); err == nil || !strings.Contains(err.Error(), "imports $local:lib/one; it must be linked first") {
+		t.Errorf("Expected unlinked import to fail, got %v", err)
+	}
+	if _, err := eval(env, fmt.Sprintf("$sha256~~%x", sha256.Sum256([]byte("$local:inc")))); err == nil || !strings.Contains(err.Error(), "it must be linked first") {
+		t.Errorf("Expected unlinked import of a scrap read before to fail, got %v", err)
+	}
+
+	// Local imports are off by default.
+	if _, err := eval(NewEnvironment(), "$local:inc"); err == nil || !strings.Contains(err.Error(), "link it first") {
+		t.Errorf("Expected local imports to be off, got %v", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	lib := "n -> n + 1"
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash(lib): lib})
+	scrap, err := env.Read([]byte("-- comments survive\nf (f 1)\n; f = $local:lib\n; g = $local:lib"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Push(scrap); err == nil || !strings.Contains(err.Error(), "link it first") {
+		t.Errorf("Expected scraps with local imports not to be pushed, got %v", err)
+	}
+
+	linked, err := scrap.Link(map[string]string{"lib": hash(lib)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "-- comments survive\nf (f 1)\n; f = $sha256~~" + hash(lib) + "\n; g = $sha256~~" + hash(lib)
+	if string(linked) != expected {
+		t.Errorf("Expected %q, got %q", expected, linked)
+	}
+	if val, err := eval(env, string(linked)); err != nil || val.String() != "3" {
+		t.Errorf("Expected the linked scrap to evaluate to 3, got %v, %v", val, err)
+	}
+
+	_, err = scrap.Link(nil)
+	if !errors.As(err, new(token.Error)) || !strings.Contains(err.Error(), "cannot link $local:lib") {
+		t.Errorf("Expected an error linking an unknown scrap, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+// The kind of the artifacts that manifests are shared as.
+const manifestArtifact = "manifest"
+
+// A Manifest describes how a scrap was pushed. Manifests are pushed
+// alongside scraps, as `manifest:<sha256>` artifacts of the scraps they
+// describe, rather than in them, so that pushing the same scrap again
+// gives it the same hash.
+//
+// Manifests are themselves scraps, of records like
+// `{ imports = [ "$sha256~~<hash>" ], name = "lib", pushed = "2006-01-02T15:04:05Z", tool = "scrap v1.0.0" }`.
+type Manifest struct {
+	// The tool that pushed it, and its version.
+	Tool string
+	// When it was pushed.
+	Pushed time.Time
+	// The name it was declared with, like the path of its file;
+	// purely informational.
+	Name string
+	// The scraps it imports, like $sha256~~<hash>.
+	Imports []string
+}
+
+// String renders a Manifest as scrapscript.
+func (m Manifest) String() string {
+	var b strings.Builder
+	b.WriteString("{ imports = [")
+	for i, imp := range m.Imports {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, ` "%s"`, imp)
+	}
+	if len(m.Imports) > 0 {
+		b.WriteString(" ")
+	}
+	fmt.Fprintf(&b, `], name = "%s", pushed = "%s", tool = "%s" }`, m.Name, m.Pushed.UTC().Format(time.RFC3339), m.Tool)
+	return b.String()
+}
+
+// PushManifest pushes m as the manifest of a pushed Scrap. Its pusher
+// must be a yards.ArtifactPusher. Text in scrapscript can't contain
+// quotes, so neither can the fields of m.
+func (e *Environment) PushManifest(scrap *Scrap, m Manifest) error {
+	p, ok := e.pusher.(yards.ArtifactPusher)
+	if !ok {
+		return fmt.Errorf("cannot push a manifest without a pusher of artifacts")
+	}
+	for _, field := range append([]string{m.Tool, m.Name}, m.Imports...) {
+		if strings.ContainsRune(field, '"') {
+			return fmt.Errorf("cannot push a manifest with a quote in %s", field)
+		}
+	}
+	return p.PushArtifact(manifestArtifact, scrap.Sha256(), []byte(m.String()))
+}
+
+// FetchManifest fetches the manifest of a Scrap from a yard.
+// Manifests are read as record literals, without being evaluated;
+// so they can't import or compute anything.
+func FetchManifest(yard yards.ArtifactFetcher, scrap *Scrap) (Manifest, error) {
+	data, err := yard.FetchArtifact(manifestArtifact, scrap.Sha256())
+	if err != nil {
+		return Manifest{}, err
+	}
+	source := token.NewSource(data)
+	se, err := parser.Parse(&source)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("bad manifest: %w", err)
+	}
+	return readManifest(se)
+}
+
+// readManifest reads a Manifest from the record literal of its scrap.
+func readManifest(se ast.SourceExpr) (Manifest, error) {
+	rec, ok := se.Expr.(*ast.RecordExpr)
+	if !ok || rec.Rest != nil || rec.IsType() {
+		return Manifest{}, fmt.Errorf("bad manifest: it isn't a record literal")
+	}
+	fields := make(map[string]ast.Expr, len(rec.Entries))
+	for _, entry := range rec.Entries {
+		fields[se.Source.GetString(entry.Key.Pos)] = entry.Val
+	}
+	isText := func(x ast.Expr) (string, bool) {
+		if lit, ok := x.(*ast.Literal); ok && lit.Kind == token.TEXT {
+			return se.Source.GetString(lit.Pos.TrimBoth()), true
+		}
+		return "", false
+	}
+	text := func(key string) (string, error) {
+		if t, ok := isText(fields[key]); ok {
+			return t, nil
+		}
+		return "", fmt.Errorf("bad manifest: %s isn't text", key)
+	}
+
+	var m Manifest
+	var err error
+	if m.Tool, err = text("tool"); err != nil {
+		return Manifest{}, err
+	}
+	if m.Name, err = text("name"); err != nil {
+		return Manifest{}, err
+	}
+	pushed, err := text("pushed")
+	if err != nil {
+		return Manifest{}, err
+	}
+	if m.Pushed, err = time.Parse(time.RFC3339, pushed); err != nil {
+		return Manifest{}, fmt.Errorf("bad manifest: %w", err)
+	}
+	imports, ok := fields["imports"].(*ast.ListExpr)
+	if !ok {
+		return Manifest{}, fmt.Errorf("bad manifest: imports isn't a list")
+	}
+	for _, imp := range imports.Elements {
+		t, ok := isText(imp)
+		if !ok {
+			return Manifest{}, fmt.Errorf("bad manifest: imports isn't a list of text")
+		}
+		m.Imports = append(m.Imports, t)
+	}
+	return m, nil
+}
@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// artifactPusher is a pusher of scraps and artifacts.
+type artifactPusher struct {
+	artifacts
+}
+
+func (artifactPusher) PushScrap(data []byte) (string, error) {
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+func TestManifest(t *testing.T) {
+	lib := `1`
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+
+	yard := artifactPusher{artifacts{}}
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash: lib})
+	env.UsePusher(yard)
+
+	scrap, err := env.Read([]byte("$sha256~~" + hash + " + 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := Manifest{
+		Tool:    "scrap v1.0.0",
+		Pushed:  time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Name:    "lib/inc",
+		Imports: scrap.Imports(),
+	}
+	if err := env.PushManifest(scrap, m); err != nil {
+		t.Fatal(err)
+	}
+	// The scrap keeps its hash.
+	expected := `{ imports = [ "$sha256~~` + hash + `" ], name = "lib/inc", pushed = "2026-10-16T12:00:00Z", tool = "scrap v1.0.0" }`
+	if data := string(yard.artifacts["manifest:"+scrap.Sha256()]); data != expected {
+		t.Errorf("Expected the manifest %s, got %s", expected, data)
+	}
+
+	fetched, err := FetchManifest(yard, scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fetched, m) {
+		t.Errorf("Expected the manifest %v, got %v", m, fetched)
+	}
+
+	// Scraps without manifests have none.
+	other, err := env.Read([]byte(lib))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FetchManifest(yard, other); err == nil {
+		t.Errorf("Expected no manifest")
+	}
+
+	// Manifests are checked.
+	for _, bad := range []string{
+		`{ name = 1 }`,
+		// Manifests aren't evaluated.
+		`{ imports = [], name = n, pushed = "2026-10-16T12:00:00Z", tool = "scrap" } ; n = "lib"`,
+		`{ imports = [], name = "a" ++ "b", pushed = "2026-10-16T12:00:00Z", tool = "scrap" }`,
+	} {
+		yard.artifacts["manifest:"+other.Sha256()] = []byte(bad)
+		if _, err := FetchManifest(yard, other); err == nil || !strings.Contains(err.Error(), "bad manifest") {
+			t.Errorf("Expected %s to be a bad manifest, got %v", bad, err)
+		}
+	}
+	if err := env.PushManifest(other, Manifest{Name: `a"b`}); err == nil {
+		t.Errorf("Expected a quote not to be pushed")
+	}
+}
@@ -4,15 +4,16 @@ import (
 	"errors"
 	"fmt"
 	"maps"
+	"slices"
 
 	"github.com/Victorystick/scrapscript/ast"
 	"github.com/Victorystick/scrapscript/token"
 	"github.com/Victorystick/scrapscript/types"
 )
 
-type bail struct{}
-
 var (
+	// ErrNoMatch is returned by Match when a value doesn't match a pattern.
+	// It is a sentinel; no error message is built for ordinary mismatches.
 	ErrNoMatch      = errors.New("no match found")
 	ErrNoFloatMatch = errors.New("cannot match on floats")
 )
@@ -21,175 +22,228 @@ type matcher struct {
 	source *token.Source
 	reg    *types.Registry
 	vars   Variables
-	err    error
-}
-
-// Abandons matching returning err as the error.
-func (m *matcher) error(err error) {
-	m.err = err
-	panic(bail{})
 }
 
-// Abandons matching, creating an error pointing at the culprit span.
-func (m *matcher) errorf(span token.Span, format string, args ...any) {
-	m.error(m.source.Error(span, fmt.Sprintf(format, args...)))
+// Creates an error pointing at the culprit span.
+func (m *matcher) errorf(span token.Span, format string, args ...any) error {
+	return m.source.Error(span, fmt.Sprintf(format, args...))
 }
 
 // Matches an expression onto val returning new bindings.
 // It is a match if err is nil.
-func Match(source *token.Source, reg *types.Registry, x ast.Expr, val Value) (vars Variables, err error) {
-	m := matcher{source, reg, make(Variables), err}
-
-	defer func() {
-		if pnc := recover(); pnc != nil {
-			// resume same panic if it's not a bascanner.Errorilout
-			if _, ok := pnc.(bail); !ok {
-				panic(pnc)
-			}
-			err = m.err
-		}
-	}()
-
-	m.match(x, val)
-	return m.vars, m.err
+func Match(source *token.Source, reg *types.Registry, x ast.Expr, val Value) (Variables, error) {
+	m := matcher{source, reg, make(Variables)}
+	if err := m.match(x, val); err != nil {
+		return nil, err
+	}
+	return m.vars, nil
 }
 
-func (m *matcher) match(x ast.Expr, val Value) {
+func (m *matcher) match(x ast.Expr, val Value) error {
 	switch x := x.(type) {
 	case *ast.Ident:
 		name := m.source.GetString(x.Pos)
 		// Ignore _.
 		if name == "_" {
-			return
+			return nil
 		}
 
 		if _, ok := m.vars[name]; ok {
-			m.errorf(x.Pos, "cannot bind %s twice", name)
+			return m.errorf(x.Pos, "cannot bind %s twice", name)
 		}
 		m.vars[name] = val
-		return
+		return nil
 
 	case *ast.Literal:
 		lit, err := Literal(m.source, x)
 
 		if err != nil {
-			m.error(err)
+			return err
 		}
 
 		if _, ok := lit.(Float); ok {
-			m.error(ErrNoFloatMatch)
+			return ErrNoFloatMatch
 		}
 
-		if !lit.eq(val) {
-			m.err = ErrNoMatch
+		if eq, err := Equals(lit, val); err != nil {
+			return err
+		} else if !eq {
+			return ErrNoMatch
 		}
-		return
+		return nil
 
 	case *ast.VariantExpr:
 		if val, ok := val.(Variant); ok && m.source.GetString(x.Tag.Pos) == val.tag {
-			// TODO: handle nil
+			if x.Typ == nil || val.value == nil {
+				// A tag without a value only matches another such tag.
+				if x.Typ != nil || val.value != nil {
+					return ErrNoMatch
+				}
+				return nil
+			}
 			// Recursively match further.
-			m.match(x.Typ, val.value)
-			return
+			return m.match(x.Typ, val.value)
 		}
 
 	case *ast.RecordExpr:
 		if record, ok := val.(Record); ok {
-			for tag, x := range x.Entries {
+			for _, e := range x.Entries {
+				if e.Drop {
+					return m.errorf(e.Key.Pos, "cannot drop keys in a pattern")
+				}
+				tag := m.source.GetString(e.Key.Pos)
 				val, ok := record.values[tag]
 				if !ok {
-					// TODO: should point to the key, not the value (x).
-					m.errorf(x.Span(), "cannot bind to missing key %s", tag)
+					return m.errorf(e.Key.Pos, "cannot bind to missing key %s", tag)
 				}
 				// Recursively match further.
-				m.match(x, val)
+				if err := m.match(e.Val, val); err != nil {
+					return err
+				}
 			}
 
 			// If there's a rest expression; clone the record, clear used keys and recurse.
 			if x.Rest != nil {
 				ref := maps.Clone(m.reg.GetRecord(record.typ))
 				rest := maps.Clone(record.values)
-				for tag := range x.Entries {
+				for _, e := range x.Entries {
+					tag := m.source.GetString(e.Key.Pos)
 					delete(ref, tag)
 					delete(rest, tag)
 				}
-				m.match(x.Rest, Record{m.reg.Record(ref), rest})
+				return m.match(x.Rest, Record{m.reg.Record(ref), rest})
 			}
 
-			return
+			return nil
 		}
 
 	case *ast.ListExpr:
 		if list, ok := val.(List); ok {
-			if len(x.Elements) != len(list.elements) {
-				m.err = ErrNoMatch
-				return
+			if len(x.Elements) != list.Len() {
+				return ErrNoMatch
 			}
 
-			for index, x := range x.Elements {
-				// Recursively match further.
-				m.match(x, list.elements[index])
-			}
-			return
+			return m.matchAll(x.Elements, list.values())
 		}
 
 	case *ast.BinaryExpr:
+		if x.Op == token.PIPE {
+			// Try each alternative of an or-pattern in turn,
+			// discarding the bindings of those that don't match.
+			vars := maps.Clone(m.vars)
+			if err := m.match(x.Left, val); err != ErrNoMatch {
+				return err
+			}
+			m.vars = vars
+			return m.match(x.Right, val)
+		}
 		if x.Op == token.PREPEND {
-			if list, ok := val.(List); ok && len(list.elements) > 0 {
+			if list, ok := val.(List); ok && list.Len() > 0 {
+				elements := list.values()
 				// Match head.
-				m.match(x.Left, list.elements[0])
+				if err := m.match(x.Left, elements[0]); err != nil {
+					return err
+				}
 				// Match tail.
-				m.match(x.Right, List{list.typ, list.elements[1:]})
-				return
+				return m.match(x.Right, List{list.typ, leaf(elements[1:])})
 			}
 		}
 		if x.Op == token.APPEND {
-			if list, ok := val.(List); ok && len(list.elements) > 0 {
-				// Match head.
-				m.match(x.Left, List{list.typ, list.elements[:len(list.elements)-1]})
-				// Match tail.
-				m.match(x.Right, list.elements[0])
-				return
+			if list, ok := val.(List); ok && list.Len() > 0 {
+				elements := list.values()
+				last := len(elements) - 1
+				// Match init.
+				if err := m.match(x.Left, List{list.typ, leaf(elements[:last])}); err != nil {
+					return err
+				}
+				// Match last.
+				return m.match(x.Right, elements[last])
 			}
 		}
 		if x.Op == token.CONCAT {
 			if list, ok := val.(List); ok {
 				if sublist, ok := x.Left.(*ast.ListExpr); ok {
-					if len(sublist.Elements) > len(list.elements) {
-						m.err = ErrNoMatch
-						return
+					if len(sublist.Elements) > list.Len() {
+						return ErrNoMatch
 					}
 
-					head, tail := split(list.elements, len(sublist.Elements))
+					head, tail := split(list.values(), len(sublist.Elements))
 
-					for index, elem := range head {
-						m.match(sublist.Elements[index], elem)
+					if err := m.matchAll(sublist.Elements, head); err != nil {
+						return err
 					}
-					m.match(x.Right, List{list.typ, tail})
-					return
+					return m.match(x.Right, List{list.typ, leaf(tail)})
 				}
 
 				if sublist, ok := x.Right.(*ast.ListExpr); ok {
-					if len(sublist.Elements) > len(list.elements) {
-						m.err = ErrNoMatch
-						return
+					if len(sublist.Elements) > list.Len() {
+						return ErrNoMatch
 					}
 
-					head, tail := split(list.elements, len(list.elements)-len(sublist.Elements))
+					head, tail := split(list.values(), list.Len()-len(sublist.Elements))
 
-					m.match(x.Left, List{list.typ, head})
-					for index, elem := range tail {
-						m.match(sublist.Elements[index], elem)
+					if err := m.match(x.Left, List{list.typ, leaf(head)}); err != nil {
+						return err
 					}
-					return
+					return m.matchAll(sublist.Elements, tail)
 				}
 			}
 		}
+
+	case *ast.AccessExpr:
+		return m.errorf(x.Span(), "cannot match on a record access; access the record in the body instead")
 	}
 
-	m.err = ErrNoMatch
+	return ErrNoMatch
+}
+
+// Matches each expression onto the value at the same index.
+func (m *matcher) matchAll(xs []ast.Expr, vals []Value) error {
+	for index, x := range xs {
+		// Recursively match further.
+		if err := m.match(x, vals[index]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func split(list []Value, n int) ([]Value, []Value) {
 	return list[:n], list[n:]
 }
+
+// checkOrPatterns reports an error if the alternatives of an or-pattern
+// in x don't bind the same names.
+func checkOrPatterns(source *token.Source, x ast.Expr) (err error) {
+	ast.Inspect(x, func(n ast.Node) bool {
+		or, ok := n.(*ast.BinaryExpr)
+		if !ok || or.Op != token.PIPE || err != nil {
+			return err == nil
+		}
+		left, right := boundNames(source, or.Left), boundNames(source, or.Right)
+		for _, name := range left {
+			if !slices.Contains(right, name) {
+				err = source.Error(or.Right.Span(), fmt.Sprintf("%s isn't bound in this alternative", name))
+				return false
+			}
+		}
+		for _, name := range right {
+			if !slices.Contains(left, name) {
+				err = source.Error(or.Left.Span(), fmt.Sprintf("%s isn't bound in this alternative", name))
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// boundNames returns the names bound by a pattern, excluding _.
+func boundNames(source *token.Source, x ast.Expr) (names []string) {
+	for _, id := range ast.PatternNames(x) {
+		if name := source.GetString(id.Pos); name != "_" {
+			names = append(names, name)
+		}
+	}
+	return
+}
@@ -0,0 +1,47 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+func TestMatchErrors(t *testing.T) {
+	var reg types.Registry
+	examples := []struct {
+		pattern string
+		val     Value
+		err     error
+	}{
+		{`1`, Int(1), nil},
+		{`1`, Int(2), ErrNoMatch},
+		{`[ 1, a ]`, List{elements: leaf([]Value{Int(2), Int(3)})}, ErrNoMatch},
+		{`[ a, b ]`, List{elements: leaf([]Value{Int(2)})}, ErrNoMatch},
+		{`1.0`, Float(1), ErrNoFloatMatch},
+	}
+
+	for _, ex := range examples {
+		se, err := parser.ParseExpr(ex.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Match(&se.Source, &reg, se.Expr, ex.val)
+		// Mismatches must be the sentinel itself, not a wrapped error.
+		if err != ex.err {
+			t.Errorf("Expected matching %s onto %s to return %v, got %v", ex.pattern, ex.val, ex.err, err)
+		}
+	}
+}
+
+func TestMatchReportsErrors(t *testing.T) {
+	var reg types.Registry
+	se, err := parser.ParseExpr(`[ a, a ]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = Match(&se.Source, &reg, se.Expr, List{elements: leaf([]Value{Int(1), Int(2)})})
+	if err == nil || err == ErrNoMatch {
+		t.Fatalf("Expected an error binding a twice, got %v", err)
+	}
+}
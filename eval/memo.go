@@ -0,0 +1,93 @@
+package eval
+
+import (
+	"maps"
+	"sync"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// A memo remembers the results of calls of user-defined functions,
+// by the function and the argument they were called with.
+type memo struct {
+	table map[memoKey][]memoCall
+}
+
+type memoKey struct {
+	// The function expression, by its span.
+	source *token.Source
+	span   token.Span
+	fn     uint64 // The hash of the values it captured.
+	arg    uint64 // The hash of the argument.
+}
+
+type memoCall struct {
+	captured Variables
+	arg      Value
+	result   Value
+}
+
+// call returns the remembered result of calling the function of a key,
+// that captured some values, with arg; or calls fn and remembers it.
+// Functions are the same if they have the same expression and captured
+// equal values, and arguments if they are Equal. Errors aren't remembered.
+func (m *memo) call(key memoKey, captured Variables, arg Value, fn Func) (Value, error) {
+	for _, call := range m.table[key] {
+		if same(call.arg, arg) && maps.EqualFunc(call.captured, captured, same) {
+			return call.result, nil
+		}
+	}
+
+	result, err := fn(arg)
+	if err != nil {
+		return nil, err
+	}
+	if m.table == nil {
+		m.table = make(map[memoKey][]memoCall)
+	}
+	m.table[key] = append(m.table[key], memoCall{captured, arg, result})
+	return result, nil
+}
+
+// memoized returns fn, the function of the expression x evaluated in c,
+// remembering its results while memoization is enabled.
+func (c *context) memoized(x ast.Expr, fn Func) Func {
+	// The captured values are the same for every call. Calls of functions
+	// capturing bindings that fail to evaluate aren't remembered.
+	captured := sync.OnceValues(func() (Variables, error) {
+		return c.captured(x)
+	})
+	hashed := sync.OnceValue(func() uint64 {
+		vars, _ := captured()
+		return Hash(Record{values: vars})
+	})
+	return func(arg Value) (Value, error) {
+		if c.rt.memo == nil {
+			return fn(arg)
+		}
+		vars, err := captured()
+		if err != nil {
+			return fn(arg)
+		}
+		hash := hashed()
+		return c.rt.memo.call(memoKey{c.source, x.Span(), hash, c.rt.interner.hash(arg)}, vars, arg, fn)
+	}
+}
+
+// UseMemoization controls whether the results of calling user-defined
+// functions are remembered, and reused when a function is called again
+// with an equal argument.
+//
+// Since functions are pure, this only changes how long evaluation takes,
+// and how much fuel it uses; speeding up repeated calls, as when mapping
+// or folding over the same data again. The cost is hashing the argument
+// of every call, and remembering every result for the lifetime of the
+// Environment.
+func (e *Environment) UseMemoization(enabled bool) {
+	if enabled {
+		e.rt.memo = &memo{}
+	} else {
+		e.rt.memo = nil
+	}
+}
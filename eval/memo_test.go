@@ -0,0 +1,31 @@
+package eval
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoization(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFuel(100_000)
+	fib := `fib 30 ; fib = fix (fib -> | 0 -> 0 | 1 -> 1 | n -> fib (n - 1) + fib (n - 2))`
+	if _, err := eval(env, fib); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("Expected fuel to run out without memoization, got %v", err)
+	}
+
+	env.UseMemoization(true)
+	for source, expected := range map[string]string{
+		fib: "832040",
+		// Functions of the same expression that captured different values
+		// are different functions.
+		`list/map (a -> (x -> x + a) 1) [ 1, 2, 1 ]`: "[ 2, 3, 2 ]",
+	} {
+		val, err := eval(env, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.String() != expected {
+			t.Errorf("Expected %s, got %s", expected, val)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package eval
+
+import (
+	"cmp"
+	"maps"
+	goruntime "runtime"
+	"slices"
+	"sync"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// workers bounds how many goroutines infer imports at once,
+// across an Environment and its clones.
+type workers chan struct{}
+
+// newWorkers returns workers for as many goroutines as GOMAXPROCS.
+func newWorkers() workers {
+	return make(workers, goruntime.GOMAXPROCS(0))
+}
+
+// inferImports infers the imports of a scrap in parallel, before the scrap
+// itself, if there are more than one not yet inferred and workers to spare.
+//
+// Inference fills the Registry, which can't be shared between goroutines;
+// so each import is inferred by a clone of the Environment, with a Registry
+// of its own. The types of the import, and of any scraps it imports in
+// turn, are then merged back into the Environment. Imports that fail to
+// infer aren't merged, but are inferred again by the scrap as usual, so
+// that the errors are the same as without inferring them in parallel.
+func (e *Environment) inferImports(scrap *Scrap) {
+	var pending []importRef
+	for _, imp := range wholeImports(scrap) {
+		dep, err := e.Import(imp.algo, imp.hash)
+		if err == nil && dep.typ.state == stagePending {
+			pending = append(pending, imp)
+		}
+	}
+	if len(pending) < 2 || cap(e.workers) < 2 {
+		return
+	}
+
+	var clones []*Environment
+	var wg sync.WaitGroup
+	for _, imp := range pending {
+		// Imports without a worker to spare are inferred by the scrap.
+		select {
+		case e.workers <- struct{}{}:
+		default:
+			continue
+		}
+		clone := e.Clone()
+		clones = append(clones, clone)
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-e.workers
+				wg.Done()
+			}()
+			if dep, err := clone.Import(imp.algo, imp.hash); err == nil {
+				clone.inferImported(dep)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, clone := range clones {
+		e.mergeTypes(clone)
+	}
+}
+
+// mergeTypes merges the types that a clone inferred of scraps, that the
+// Environment hasn't, into its Registry. Scraps only the clone imported
+// are added too.
+func (e *Environment) mergeTypes(clone *Environment) {
+	// Scraps imported by other hashes than sha256 are known by two.
+	merged := make(map[*Scrap]*Scrap, len(clone.scraps))
+	// In order, so that the types are decoded alike from run to run.
+	keys := slices.SortedFunc(maps.Keys(clone.scraps), func(a, b hashKey) int {
+		return cmp.Or(cmp.Compare(a.algo, b.algo), cmp.Compare(a.hash, b.hash))
+	})
+	for _, key := range keys {
+		cs := clone.scraps[key]
+		if cs.typ.state != stageDone || cs.typ.err != nil {
+			continue
+		}
+		scrap, ok := merged[cs]
+		if !ok {
+			scrap, ok = e.scraps[key]
+			if !ok {
+				scrap = &Scrap{expr: cs.expr, unlinked: cs.unlinked}
+			}
+			if scrap.typ.state == stagePending {
+				ref, err := e.reg.Decode(clone.reg.Encode(cs.typ.val))
+				if err != nil {
+					continue
+				}
+				scrap.typ = stage[types.TypeRef]{state: stageDone, val: ref}
+			}
+			merged[cs] = scrap
+		}
+		if _, ok := e.scraps[key]; !ok {
+			e.scraps[key] = scrap
+		}
+	}
+}
+
+// wholeImports returns the distinct imports of a scrap whose whole types
+// are inferred, in source order; rather than only those of members
+// accessed, like `$sha256~~<hash>.key`, which needn't infer all of a
+// library.
+func wholeImports(scrap *Scrap) []importRef {
+	var refs []importRef
+	ast.Inspect(scrap.expr.Expr, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.AccessExpr:
+			_, member := x.Rec.(*ast.ImportExpr)
+			return !member
+		case *ast.ImportExpr:
+			if ref := scrap.importRef(x); !slices.Contains(refs, ref) {
+				refs = append(refs, ref)
+			}
+		}
+		return true
+	})
+	return refs
+}
@@ -0,0 +1,119 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	goruntime "runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrentFetcher is a MapFetcher that reports whether some scraps
+// were fetched at the same time.
+type concurrentFetcher struct {
+	MapFetcher
+	slow       map[string]bool
+	fetching   atomic.Int32
+	concurrent atomic.Bool
+}
+
+func (f *concurrentFetcher) FetchSha256(key string) ([]byte, error) {
+	if !f.slow[key] {
+		return f.MapFetcher.FetchSha256(key)
+	}
+	f.fetching.Add(1)
+	defer f.fetching.Add(-1)
+	// Wait a while for another slow fetch to start.
+	for deadline := time.Now().Add(100 * time.Millisecond); time.Now().Before(deadline); {
+		if f.fetching.Load() > 1 {
+			f.concurrent.Store(true)
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return f.MapFetcher.FetchSha256(key)
+}
+
+func TestInferImportsInParallel(t *testing.T) {
+	defer goruntime.GOMAXPROCS(goruntime.GOMAXPROCS(4))
+
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	fetcher := &concurrentFetcher{MapFetcher: MapFetcher{}, slow: map[string]bool{}}
+	add := func(source string) string {
+		fetcher.MapFetcher[hash(source)] = source
+		return "$sha256~~" + hash(source)
+	}
+
+	// The leaves import scraps of their own, which are only fetched
+	// when the leaves are inferred.
+	var leaves []string
+	for i := range 8 {
+		sub := add(fmt.Sprint(i))
+		fetcher.slow[strings.TrimPrefix(sub, "$sha256~~")] = true
+		leaves = append(leaves, add(fmt.Sprintf("%s + %d", sub, i)))
+	}
+	id := add(`x -> x`)
+	rec := add(`{ a = #b [1], c = "d" }`)
+	source := fmt.Sprintf(`{ sum = %s, id = %s 1, text = %s "a", rec = %s }`,
+		strings.Join(leaves, " + "), id, id, rec)
+
+	infer := func() string {
+		t.Helper()
+		env := NewEnvironment()
+		env.UseFetcher(fetcher)
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := env.Infer(scrap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val, err := env.Eval(scrap); err != nil || !strings.Contains(val.String(), "sum = 56") {
+			t.Errorf("Expected a sum of 56, got %v, %v", val, err)
+		}
+		return typ
+	}
+
+	typ := infer()
+	if !fetcher.concurrent.Load() {
+		t.Errorf("Expected imports to be inferred in parallel")
+	}
+	expected := `{ sum : int, id : int, text : text, rec : { a : (#b list int), c : text } }`
+	if typ != expected {
+		t.Errorf("Expected type %s, got %s", expected, typ)
+	}
+
+	// Without workers to spare, they are inferred one at a time.
+	goruntime.GOMAXPROCS(1)
+	fetcher.concurrent.Store(false)
+	if typ := infer(); typ != expected {
+		t.Errorf("Expected type %s, got %s", expected, typ)
+	}
+	if fetcher.concurrent.Load() {
+		t.Errorf("Expected imports not to be inferred in parallel")
+	}
+}
+
+func TestInferImportsInParallelErrors(t *testing.T) {
+	defer goruntime.GOMAXPROCS(goruntime.GOMAXPROCS(4))
+
+	good, bad := `1`, `1 + "a"`
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash(good): good, hash(bad): bad})
+	scrap, err := env.Read([]byte("$sha256~~" + hash(good) + " + $sha256~~" + hash(bad)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Errors are reported as without inferring imports in parallel.
+	if _, err := env.Infer(scrap); err == nil || !strings.Contains(err.Error(), "+ requires int or float, not text") {
+		t.Errorf("Expected the bad import not to infer, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"fmt"
+	"slices"
+)
+
+// An ImportPolicy decides whether a scrap may be imported,
+// by the algorithm and hex-encoded hash it's imported by.
+type ImportPolicy func(algo, hash string) bool
+
+// AllowImports returns an ImportPolicy allowing only the scraps with
+// the given sha256 hashes, hex-encoded, to be imported.
+func AllowImports(hashes ...string) ImportPolicy {
+	hashes = slices.Clone(hashes)
+	return func(algo, hash string) bool {
+		return algo == "sha256" && slices.Contains(hashes, hash)
+	}
+}
+
+// ErrImportDenied is returned when importing a scrap
+// that the ImportPolicy of an Environment doesn't allow.
+type ErrImportDenied struct {
+	Algo string
+	Hash string // Hex-encoded.
+}
+
+func (e *ErrImportDenied) Error() string {
+	return fmt.Sprintf("importing $%s~~%s is not allowed", e.Algo, e.Hash)
+}
+
+// UseImportPolicy restricts the scraps that may be imported, such that
+// untrusted scraps can only be composed from a vetted set of libraries.
+// The policy is checked for every import, including those of imported
+// scraps, before fetching them; so a library's dependencies must be
+// allowed too. A nil policy allows every import.
+//
+// To restrict the yards imports are fetched from instead,
+// use a Fetcher of only those.
+func (e *Environment) UseImportPolicy(policy ImportPolicy) {
+	e.policy = policy
+}
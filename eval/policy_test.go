@@ -0,0 +1,55 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestImportPolicy(t *testing.T) {
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	dep := "1"
+	lib := "n -> n + $sha256~~" + hash(dep)
+	other := "2"
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		hash(dep):   dep,
+		hash(lib):   lib,
+		hash(other): other,
+	})
+	env.UseImportPolicy(AllowImports(hash(lib), hash(dep)))
+
+	val, err := eval(env, "$sha256~~"+hash(lib)+" 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.String() != "3" {
+		t.Errorf("Expected 3, got %s", val)
+	}
+
+	_, err = eval(env, "$sha256~~"+hash(other))
+	var denied *ErrImportDenied
+	if !errors.As(err, &denied) || denied.Hash != hash(other) {
+		t.Fatalf("Expected an ErrImportDenied, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	if _, err := eval(env.Clone(), "$sha256~~"+hash(other)); !errors.As(err, &denied) {
+		t.Errorf("Expected clones to share the policy, got %v", err)
+	}
+
+	// The dependencies of allowed imports must be allowed too.
+	env = NewEnvironment()
+	env.UseFetcher(MapFetcher{hash(dep): dep, hash(lib): lib})
+	env.UseImportPolicy(AllowImports(hash(lib)))
+	if _, err := eval(env, "$sha256~~"+hash(lib)+" 2"); !errors.As(err, &denied) || denied.Hash != hash(dep) {
+		t.Errorf("Expected the dependency to be denied, got %v", err)
+	}
+}
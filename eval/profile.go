@@ -0,0 +1,11 @@
+//go:build !scrap_tiny
+
+package eval
+
+// The default profile puts no extra limits on evaluation.
+const (
+	tiny = false
+	// The maximum number of types in an Environment's Registry;
+	// unlimited if zero.
+	maxTypes = 0
+)
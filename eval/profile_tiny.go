@@ -0,0 +1,10 @@
+//go:build scrap_tiny
+
+package eval
+
+// The reduced-footprint profile, selected by the scrap_tiny build tag,
+// bounds the work and memory of every evaluation.
+const (
+	tiny     = true
+	maxTypes = 1 << 12
+)
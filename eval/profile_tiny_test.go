@@ -0,0 +1,63 @@
+//go:build scrap_tiny
+
+package eval
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTinyRequiresFuel(t *testing.T) {
+	env := NewEnvironment()
+	scrap, err := env.Read([]byte(`1 + 2`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = env.Eval(scrap)
+	if !errors.Is(err, ErrFuelRequired) {
+		t.Fatalf("expected ErrFuelRequired, got %v", err)
+	}
+
+	env.UseFuel(100)
+	val, err := env.Eval(scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != Int(3) {
+		t.Errorf("expected 3, got %s", val)
+	}
+}
+
+func TestTinyLimitsTypes(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFuel(1_000_000)
+	// Each nested list has a type of its own.
+	scrap, err := env.Read([]byte(`list/repeat 5000 1 |> list/fold [] (acc -> _ -> [ acc ])`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = env.Eval(scrap)
+	if !errors.Is(err, ErrTooManyTypes) {
+		t.Fatalf("expected ErrTooManyTypes, got %v", err)
+	}
+}
+
+func TestTinyLimitsInferredTypes(t *testing.T) {
+	env := NewEnvironment()
+	// Each nested list has a type of its own.
+	scrap, err := env.Read([]byte(strings.Repeat("[ ", 5000) + "1" + strings.Repeat(" ]", 5000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = env.Infer(scrap)
+	if !errors.Is(err, ErrTooManyTypes) {
+		t.Fatalf("expected ErrTooManyTypes, got %v", err)
+	}
+	if env.reg.Size() > maxTypes {
+		t.Errorf("expected at most %d types, got %d", maxTypes, env.reg.Size())
+	}
+}
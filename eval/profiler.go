@@ -0,0 +1,143 @@
+package eval
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	goruntime "runtime"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// A Profile records how long evaluating each where-binding and import
+// took, and how much memory it allocated, to find what makes a scrap
+// slow; along with the totals of each call of Environment.Eval. Steps
+// include those they depend on, so the time of a binding includes that
+// of the imports it uses. See Environment.UseProfile.
+type Profile struct {
+	mu      sync.Mutex
+	entries map[profileKey]*ProfileEntry
+}
+
+type profileKey struct {
+	kind        EventKind
+	scrap, name string
+}
+
+// A ProfileEntry is the total of all evaluations of a where-binding,
+// an import, or of the scraps passed to Environment.Eval.
+type ProfileEntry struct {
+	// BindingEvaluated, ImportFinished or ResultReady.
+	Kind EventKind
+	// The scrap a binding is in, like $sha256~~<hash>;
+	// empty for imports and results.
+	Scrap string
+	// The binding name, or the hex-encoded hash of an import.
+	Name string
+	// How many times the binding was evaluated, as bindings in functions
+	// are once per call; the import was, which is at most once; or
+	// Environment.Eval was called.
+	Count     int
+	Duration  time.Duration
+	Allocated uint64 // In bytes.
+}
+
+// Entries returns the entries of the Profile,
+// those that took the longest first.
+func (p *Profile) Entries() []ProfileEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entries := make([]ProfileEntry, 0, len(p.entries))
+	for _, e := range p.entries {
+		entries = append(entries, *e)
+	}
+	slices.SortFunc(entries, func(a, b ProfileEntry) int {
+		return cmp.Or(
+			cmp.Compare(b.Duration, a.Duration),
+			cmp.Compare(a.Scrap, b.Scrap),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+	return entries
+}
+
+// The names of the kinds of ProfileEntries, as Profile.Write prints them.
+var profileKinds = map[EventKind]string{
+	BindingEvaluated: "binding",
+	ImportFinished:   "import",
+	ResultReady:      "eval",
+}
+
+// Write writes the entries of the Profile to w as a table.
+func (p *Profile) Write(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(tw, "time\tallocated\tcount\t \tname\t\n")
+	for _, e := range p.Entries() {
+		name := e.Name
+		if e.Scrap != "" {
+			name = e.Scrap + " " + name
+		}
+		fmt.Fprintf(tw, "%s\t%dB\t%d\t%s\t%s\t\n", e.Duration, e.Allocated, e.Count, profileKinds[e.Kind], name)
+	}
+	return tw.Flush()
+}
+
+func (p *Profile) add(key profileKey, d time.Duration, allocated uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries == nil {
+		p.entries = make(map[profileKey]*ProfileEntry)
+	}
+	e, ok := p.entries[key]
+	if !ok {
+		e = &ProfileEntry{Kind: key.kind, Scrap: key.scrap, Name: key.name}
+		p.entries[key] = e
+	}
+	e.Count++
+	e.Duration += d
+	e.Allocated += allocated
+}
+
+// A measurement of a step of an evaluation in progress.
+type measurement struct {
+	start  time.Time
+	allocs uint64 // Only measured while profiling.
+}
+
+// measure starts measuring a step of the evaluation.
+func (rt *runtime) measure() measurement {
+	m := measurement{start: time.Now()}
+	if rt.profile != nil {
+		m.allocs = allocated()
+	}
+	return m
+}
+
+// measured ends the measurement m of a step, adding it to the profile,
+// and returns how long it took.
+func (rt *runtime) measured(m measurement, kind EventKind, scrap, name string) time.Duration {
+	d := time.Since(m.start)
+	if rt.profile != nil {
+		rt.profile.add(profileKey{kind, scrap, name}, d, allocated()-m.allocs)
+	}
+	return d
+}
+
+// allocated returns the bytes allocated by the process so far. Reading
+// them briefly stops the world, which is why they're only read while
+// profiling.
+func allocated() uint64 {
+	var stats goruntime.MemStats
+	goruntime.ReadMemStats(&stats)
+	return stats.TotalAlloc
+}
+
+// UseProfile records how long evaluating each where-binding and import
+// takes, and how much memory it allocates, in p; or stops if p is nil.
+// Allocations are of the whole process, so other goroutines allocating
+// at the same time are counted too.
+func (e *Environment) UseProfile(p *Profile) {
+	e.rt.profile = p
+}
@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445": `2`,
+	})
+	var p Profile
+	env.UseProfile(&p)
+
+	_, err := eval(env, `list/map f [ 1, 2, 3 ] ; f = n -> n + k ; k = $sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445 ; unused = 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, e := range p.Entries() {
+		counts[profileKinds[e.Kind]+" "+e.Name] = e.Count
+		if e.Duration <= 0 {
+			t.Errorf("Expected %s to take time", e.Name)
+		}
+	}
+	expected := map[string]int{
+		"eval ":     1,
+		"binding f": 1,
+		"binding k": 1,
+		"import a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a445": 1,
+	}
+	for name, count := range expected {
+		if counts[name] != count {
+			t.Errorf("Expected %s to be counted %d times, got %d", name, count, counts[name])
+		}
+	}
+	if len(counts) != len(expected) {
+		t.Errorf("Unexpected entries %v", counts)
+	}
+
+	var b strings.Builder
+	if err := p.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(b.String(), "\n"); lines != 5 {
+		t.Errorf("Expected a header and 4 entries, got:\n%s", b.String())
+	}
+}
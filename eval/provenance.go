@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// A ScrapError is an error that occurred within another scrap than the one
+// being evaluated; either while importing it, or when calling a function
+// defined in it. Nested ScrapErrors form a trace back to the outermost scrap.
+type ScrapError struct {
+	// The scrap the error occurred in, like $sha256~~<hash>.
+	Scrap string
+	// Where the scrap was imported, or its function called.
+	At  token.Error
+	Err error
+}
+
+func (e *ScrapError) Error() string {
+	return fmt.Sprintf("%s\nin %s\n%s", e.Err, e.Scrap, e.At)
+}
+
+func (e *ScrapError) Unwrap() error {
+	return e.Err
+}
+
+// scrapName returns the name of a scrap with the given sha256 hash.
+func scrapName(hash string) string {
+	return "$sha256~~" + hash
+}
+
+// provenance remembers the scraps that constructed records and lists,
+// by the identity of their contents, which values copied from them share.
+type provenance struct {
+	scraps map[any]string
+}
+
+// identity returns what identifies the contents of records and lists.
+func identity(v Value) (any, bool) {
+	switch v := v.(type) {
+	case Record:
+		return reflect.ValueOf(v.values).UnsafePointer(), v.values != nil
+	case List:
+		return v.elements, v.elements != nil
+	}
+	return nil, false
+}
+
+// record remembers that scrap constructed v, unless another scrap
+// constructed its contents before; as when joining an empty list.
+func (p *provenance) record(scrap string, v Value) {
+	if p == nil || scrap == "" {
+		return
+	}
+	if id, ok := identity(v); ok {
+		if _, seen := p.scraps[id]; !seen {
+			p.scraps[id] = scrap
+		}
+	}
+}
+
+// constructed records that the scrap of c constructed v, and returns it.
+func (c *context) constructed(v Value) Value {
+	c.rt.provenance.record(c.scrap, v)
+	return v
+}
+
+// UseProvenance controls whether the scraps constructing records and
+// lists are remembered, for Provenance to report which import produced
+// a value. Values themselves are unchanged. The cost is remembering
+// every record and list for the lifetime of the Environment.
+func (e *Environment) UseProvenance(enabled bool) {
+	if enabled {
+		e.rt.provenance = &provenance{scraps: make(map[any]string)}
+	} else {
+		e.rt.provenance = nil
+	}
+}
+
+// Provenance returns the scrap that constructed a record or list, or
+// defined a function, like $sha256~~<hash>. It reports false for other
+// values, for records and lists constructed by built-ins, and for those
+// constructed while UseProvenance wasn't enabled. With interning, equal
+// records and lists are reported as constructed by the first scrap to.
+func (e *Environment) Provenance(v Value) (string, bool) {
+	if sf, ok := v.(ScriptFunc); ok {
+		return sf.scrap, sf.scrap != ""
+	}
+	if e.rt.provenance == nil {
+		return "", false
+	}
+	id, ok := identity(v)
+	if !ok {
+		return "", false
+	}
+	scrap, ok := e.rt.provenance.scraps[id]
+	return scrap, ok
+}
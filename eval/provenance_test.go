@@ -0,0 +1,63 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	lib := "{ weird = [1, 2], f = x -> { x = x } }"
+	libName := "$sha256~~" + fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{libName[len("$sha256~~"):]: lib})
+	env.UseProvenance(true)
+	source := "{ weird = " + libName + ", made = " + libName + ".f 1, own = [3] ++ [4] }"
+	scrap, err := env.Read([]byte(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := env.Eval(scrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	main := scrapName(scrap.Sha256())
+
+	rec := val.(Record)
+	weird, _ := rec.Get("weird")
+	imported, _ := weird.(Record).Get("weird")
+	f, _ := weird.(Record).Get("f")
+	made, _ := rec.Get("made")
+	own, _ := rec.Get("own")
+	for _, tc := range []struct {
+		name  string
+		value Value
+		scrap string
+	}{
+		{"main record", rec, main},
+		{"imported record", weird, libName},
+		{"imported list", imported, libName},
+		{"imported function", f, libName},
+		{"record made by imported function", made, libName},
+		{"concatenated list", own, main},
+	} {
+		if scrap, ok := env.Provenance(tc.value); !ok || scrap != tc.scrap {
+			t.Errorf("Expected %s to be from %s, got %s", tc.name, tc.scrap, scrap)
+		}
+	}
+
+	if _, ok := env.Provenance(Int(1)); ok {
+		t.Errorf("Expected no provenance of ints")
+	}
+
+	// Clones remember the provenance of the values they share.
+	if scrap, _ := env.Clone().Provenance(weird); scrap != libName {
+		t.Errorf("Expected clones to remember provenance, got %s", scrap)
+	}
+
+	env.UseProvenance(false)
+	if _, ok := env.Provenance(weird); ok {
+		t.Errorf("Expected no provenance when disabled")
+	}
+}
@@ -0,0 +1,56 @@
+package eval
+
+import (
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// A Signature describes the function being applied at a cursor.
+type Signature struct {
+	// The name of the function.
+	Name string
+	// The type of the function.
+	Type string
+	// The spans of the curried parameters within Type.
+	Params []token.Span
+	// The index of the parameter the cursor is at.
+	Active int
+}
+
+// SignatureHelp returns the Signature of the function applied to the
+// argument at offset in script, which needn't be complete or well-typed.
+//
+// Since functions are curried, `list/fold 0 f ` is a chain of calls whose
+// next argument is the third parameter of `list/fold`. Only named functions
+// are described; false is returned when there's no such call at offset.
+func (e *Environment) SignatureHelp(script []byte, offset int) (Signature, bool) {
+	f := e.locate(script, offset)
+	if f == nil || f.call == nil {
+		return Signature{}, false
+	}
+
+	// Walk down the chain of calls, counting the preceding arguments.
+	active := 0
+	fn := f.call.Fn
+	for call, ok := fn.(*ast.CallExpr); ok; call, ok = fn.(*ast.CallExpr) {
+		fn = call.Fn
+		active++
+	}
+
+	ref := f.typeOf(fn)
+	if ref == types.UnknownRef {
+		return Signature{}, false
+	}
+	typ, params := f.reg.Params(ref)
+	if active >= len(params) {
+		return Signature{}, false
+	}
+
+	return Signature{
+		Name:   f.src.GetString(fn.Span()),
+		Type:   typ,
+		Params: params,
+		Active: active,
+	}, true
+}
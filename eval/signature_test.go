@@ -0,0 +1,43 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSignatureHelp(t *testing.T) {
+	examples := []struct {
+		source string // The cursor is at ^.
+		result string // The active parameter is in brackets.
+	}{
+		{`list/fold ^`, `list/fold : [a] -> (a -> b -> a) -> list b -> a`},
+		{`list/fold 0 (a -> b -> a + b) ^`, `list/fold : a -> (a -> b -> a) -> [list b] -> a`},
+		{`list/fold 0 (a -> b -> a + b^)`, `list/fold : a -> [(a -> b -> a)] -> list b -> a`},
+		{`list/fold 0^`, `list/fold : [a] -> (a -> b -> a) -> list b -> a`},
+		{`f 1 ^ ; f = a -> b -> a + b`, `f : num a => a -> [a] -> a`},
+		{`r.f ^ ; r = { f = a -> a + 1 }`, `r.f : [int] -> int`},
+		{`f (text/repeat 3 ^) ; f = x -> x`, `text/repeat : int -> [text] -> text`},
+
+		// No function or too many arguments.
+		{`^`, ``},
+		{`x ^ ; x = 1`, ``},
+		{`text/length "a" ^`, ``},
+		{`(a -> a) ^`, ``},
+	}
+
+	for _, ex := range examples {
+		env := NewEnvironment()
+		offset := strings.Index(ex.source, "^")
+		source := ex.source[:offset] + ex.source[offset+1:]
+
+		got := ""
+		if sig, ok := env.SignatureHelp([]byte(source), offset); ok {
+			param := sig.Params[sig.Active]
+			got = sig.Name + " : " + sig.Type[:param.Start] + "[" +
+				sig.Type[param.Start:param.End] + "]" + sig.Type[param.End:]
+		}
+		if got != ex.result {
+			t.Errorf("%s\n  got  %s\n  want %s", ex.source, got, ex.result)
+		}
+	}
+}
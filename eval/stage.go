@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"errors"
+	"sync"
+)
+
+// A stageState is how far a stage of processing a Scrap has come.
+type stageState uint8
+
+const (
+	stagePending stageState = iota
+	stageRunning
+	stageDone
+)
+
+// errCycle is returned when a stage depends on itself, which
+// content-addressed imports can't, but scraps read twice might.
+var errCycle = errors.New("scrap depends on itself")
+
+// A stage of processing a Scrap, like inferring its type or evaluating
+// it. A Scrap goes through each stage at most once per Environment, which
+// remembers the result, and any error, for every import of it. Stages
+// that fail for reasons that may pass, like being cancelled or failing
+// to fetch an import, are retried instead; see transient.
+type stage[T any] struct {
+	mu    sync.Mutex
+	state stageState
+	owner any           // What runs the stage, while running.
+	done  chan struct{} // Closed once the running stage is done.
+	val   T
+	err   error
+}
+
+// run returns the result of the stage, running f for it unless it's done.
+// Callers other than the owner running it wait for its result; the owner
+// itself would depend on itself, and gets an errCycle.
+func (s *stage[T]) run(owner any, f func() (T, error)) (T, error) {
+	s.mu.Lock()
+	for s.state == stageRunning {
+		if s.owner == owner {
+			s.mu.Unlock()
+			return s.val, errCycle
+		}
+		done := s.done
+		s.mu.Unlock()
+		<-done
+		s.mu.Lock()
+	}
+	if s.state == stageDone {
+		defer s.mu.Unlock()
+		return s.val, s.err
+	}
+	s.state, s.owner, s.done = stageRunning, owner, make(chan struct{})
+	s.mu.Unlock()
+
+	val, err := f()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if transient(err) {
+		s.state = stagePending
+	} else {
+		s.val, s.err, s.state = val, err, stageDone
+	}
+	close(s.done)
+	s.owner, s.done = nil, nil
+	return val, err
+}
+
+// result returns a copy of the stage if it's done, or a pending one.
+func (s *stage[T]) result() stage[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != stageDone {
+		return stage[T]{}
+	}
+	return stage[T]{state: stageDone, val: s.val, err: s.err}
+}
+
+// transient reports whether an error may not recur if what failed is
+// tried again; like running out of fuel, failing to fetch an import or
+// importing a scrap that the ImportPolicy denies, which may all change.
+func transient(err error) bool {
+	var cancelled *ErrCancelled
+	var fetch *fetchError
+	var denied *ErrImportDenied
+	return errors.As(err, &cancelled) || errors.As(err, &fetch) || errors.As(err, &denied) ||
+		errors.Is(err, ErrTooManyTypes)
+}
+
+// A fetchError is an import that couldn't be fetched.
+type fetchError struct {
+	err error
+}
+
+func (e *fetchError) Error() string { return e.err.Error() }
+func (e *fetchError) Unwrap() error { return e.err }
@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestImportStages(t *testing.T) {
+	lib := `{ n = 1 }`
+	broken := `unknown`
+	missing := strings.Repeat("00", sha256.Size)
+	hash := func(source string) string {
+		return fmt.Sprintf("%x", sha256.Sum256([]byte(source)))
+	}
+	fetcher := &countingFetcher{MapFetcher: MapFetcher{
+		hash(lib):    lib,
+		hash(broken): broken,
+	}}
+	env := NewEnvironment()
+	env.UseFetcher(fetcher)
+
+	// Each import is fetched, inferred and evaluated once.
+	for range 3 {
+		scrap, err := env.Read([]byte(`($sha256~~` + hash(lib) + `).n + ($sha256~~` + hash(lib) + `).n`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ, err := env.Infer(scrap); err != nil || typ != "int" {
+			t.Fatalf("Unexpected type %s: %v", typ, err)
+		}
+		if val, err := env.Eval(scrap); err != nil || val.String() != "2" {
+			t.Fatalf("Unexpected value %v: %v", val, err)
+		}
+	}
+	if n := fetcher.fetches.Load(); n != 1 {
+		t.Errorf("Expected the import to be fetched once, got %d", n)
+	}
+
+	// Failures are remembered too, unless fetching failed, which may not
+	// the next time.
+	for name, fetches := range map[string]int32{hash(broken): 1, missing: 3} {
+		fetcher.fetches.Store(0)
+		for range 3 {
+			if _, err := eval(env, `$sha256~~`+name); err == nil {
+				t.Fatalf("Expected importing %s to fail", name)
+			}
+		}
+		if n := fetcher.fetches.Load(); n != fetches {
+			t.Errorf("Expected %s to be fetched %d times, got %d", name, fetches, n)
+		}
+	}
+
+	// So scraps importing one that couldn't be fetched succeed once it can.
+	later := `2`
+	scrap, err := env.Read([]byte(`$sha256~~` + hash(later) + ` + 1`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Infer(scrap); err == nil {
+		t.Fatal("Expected inferring a missing import to fail")
+	}
+	if _, err := env.Eval(scrap); err == nil {
+		t.Fatal("Expected evaluating a missing import to fail")
+	}
+	fetcher.MapFetcher[hash(later)] = later
+	if typ, err := env.Infer(scrap); err != nil || typ != "int" {
+		t.Errorf("Unexpected type %s: %v", typ, err)
+	}
+	if val, err := env.Eval(scrap); err != nil || val.String() != "3" {
+		t.Errorf("Unexpected value %v: %v", val, err)
+	}
+}
+
+func TestStageSingleFlight(t *testing.T) {
+	var s stage[int]
+	var runs atomic.Int32
+	started, release := make(chan struct{}), make(chan struct{})
+
+	var wg sync.WaitGroup
+	results := make([]int, 4)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i > 0 {
+				<-started
+			}
+			results[i], _ = s.run(i, func() (int, error) {
+				runs.Add(1)
+				close(started)
+				<-release
+				return 42, nil
+			})
+		}()
+	}
+	<-started
+	close(release)
+	wg.Wait()
+
+	if n := runs.Load(); n != 1 {
+		t.Errorf("Expected the stage to run once, got %d", n)
+	}
+	if !slices.Equal(results, []int{42, 42, 42, 42}) {
+		t.Errorf("Expected all callers to get the result, got %v", results)
+	}
+
+	// The owner running a stage depends on itself.
+	var cycle stage[int]
+	_, err := cycle.run(1, func() (int, error) {
+		return cycle.run(1, func() (int, error) { return 0, nil })
+	})
+	if !errors.Is(err, errCycle) {
+		t.Errorf("Expected %v, got %v", errCycle, err)
+	}
+}
+
+func TestStageRetriesCancelled(t *testing.T) {
+	env := NewEnvironment()
+	scrap, err := env.Read([]byte(`list/length (list/repeat 100 1)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env.UseFuel(3)
+	if _, err := env.Eval(scrap); !errors.Is(err, ErrFuelExhausted) {
+		t.Fatalf("Expected to run out of fuel, got %v", err)
+	}
+	env.UseFuel(0)
+	if val, err := env.Eval(scrap); err != nil || val.String() != "100" {
+		t.Errorf("Expected a retry to succeed, got %v: %v", val, err)
+	}
+}
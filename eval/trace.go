@@ -0,0 +1,115 @@
+package eval
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/token"
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// The maximum number of frames printed by a TraceError.
+const maxPrintedFrames = 10
+
+// A Frame is a call of a user-defined function.
+type Frame struct {
+	// The scrap defining the function, if known.
+	Scrap string
+	// The position of the function in its source.
+	Pos token.Position
+	// The source of the function, abbreviated.
+	Func string
+	// A preview of the argument.
+	Arg string
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("in %s at %d:%d, called with %s", f.Func, f.Pos.Line, f.Pos.Column, f.Arg)
+}
+
+// A TraceError is a runtime error, together with the
+// calls of user-defined functions that led to it.
+type TraceError struct {
+	Err error
+	// The calls in progress, innermost first.
+	Stack []Frame
+}
+
+func (e *TraceError) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Err.Error())
+	for i, frame := range e.Stack {
+		if i == maxPrintedFrames {
+			fmt.Fprintf(&b, "\n  ... %d more", len(e.Stack)-i)
+			break
+		}
+		b.WriteString("\n  ")
+		b.WriteString(frame.String())
+		// Only name scraps other than the outermost one.
+		if frame.Scrap != e.Stack[len(e.Stack)-1].Scrap {
+			b.WriteString(" of ")
+			b.WriteString(frame.Scrap)
+		}
+	}
+	return b.String()
+}
+
+func (e *TraceError) Unwrap() error {
+	return e.Err
+}
+
+// A frame is the cheap representation of a Frame, that is only
+// rendered when an error occurs.
+type frame struct {
+	source *token.Source
+	scrap  string
+	span   token.Span
+	arg    Value
+}
+
+// traced calls fn as the user-defined function at span, recording a frame
+// for it. Errors returned by fn are given a trace, unless they have one.
+// Outermost calls, as by hosts, also report the Registry outgrowing its
+// limit as an error.
+func (c *context) traced(span token.Span, arg Value, fn func() (Value, error)) (val Value, err error) {
+	rt := c.rt
+	n := len(rt.frames)
+	rt.frames = append(rt.frames, frame{c.source, c.scrap, span, arg})
+	defer func() { rt.frames = rt.frames[:n] }()
+	if n == 0 {
+		defer types.RecoverLimit(&err)
+	}
+
+	val, err = fn()
+	if err != nil {
+		var traced *TraceError
+		if !errors.As(err, &traced) {
+			err = &TraceError{Err: err, Stack: rt.stack()}
+		}
+	}
+	return val, err
+}
+
+// stack renders the frames of the calls in progress, innermost first.
+func (rt *runtime) stack() []Frame {
+	stack := make([]Frame, len(rt.frames))
+	for i, f := range rt.frames {
+		stack[len(stack)-1-i] = Frame{
+			Scrap: f.scrap,
+			Pos:   f.source.GetPosition(f.span.Start),
+			Func:  abbreviate(f.source.GetString(f.span)),
+			Arg:   abbreviate(f.arg.String()),
+		}
+	}
+	return stack
+}
+
+// abbreviate shortens s to a single line of at most 40 characters.
+func abbreviate(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > 40 {
+		return s[:37] + "..."
+	}
+	return s
+}
@@ -0,0 +1,47 @@
+package eval
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTraceError(t *testing.T) {
+	_, err := eval(NewEnvironment(), `f 2
+; f = n -> g n
+; g =
+  | 0 -> "zero"
+  | 1 -> "one"`)
+
+	var traced *TraceError
+	if !errors.As(err, &traced) {
+		t.Fatalf("Expected a TraceError, got %v", err)
+	}
+
+	stack := make([]string, len(traced.Stack))
+	for i, frame := range traced.Stack {
+		stack[i] = frame.String()
+	}
+	expected := []string{
+		`in 0 -> "zero" | 1 -> "one" at 4:5, called with 2`,
+		`in n -> g n at 2:7, called with 2`,
+	}
+	if strings.Join(stack, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected stack:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(stack, "\n"))
+	}
+}
+
+func TestTraceErrorTruncates(t *testing.T) {
+	_, err := eval(NewEnvironment(), `f 20 ; f = fix (f -> | 0 -> unknown | n -> f (n - 1))`)
+
+	var traced *TraceError
+	if !errors.As(err, &traced) {
+		t.Fatalf("Expected a TraceError, got %v", err)
+	}
+	if len(traced.Stack) != 21 {
+		t.Errorf("Expected 21 frames, got %d", len(traced.Stack))
+	}
+	if !strings.HasSuffix(err.Error(), "... 11 more") {
+		t.Errorf("Expected a truncated trace, got:\n%s", err)
+	}
+}
@@ -0,0 +1,89 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Victorystick/scrapscript/types"
+	"github.com/Victorystick/scrapscript/yards"
+)
+
+// The kind of the artifacts that types are shared as.
+const typeArtifact = "type"
+
+// A typeCache shares the inferred types of scraps through a yard.
+type typeCache struct {
+	yard  yards.ArtifactFetcher
+	push  bool
+	trust bool
+}
+
+// UseTypeCache makes the types of imported scraps be shared as
+// `type:<key>` artifacts through a yard. If push is set, and the yard is a
+// yards.ArtifactPusher, types inferred locally are pushed to it, and
+// TypePushed Events report how that went. If trust is set, types are
+// fetched from the yard instead of inferred, falling back to inferring
+// them locally; so that clients sharing the yard infer big dependency
+// graphs only once. A nil yard turns the cache off.
+//
+// Fetched types can't be checked without inferring them, which is what
+// they save, so only a yard trusted not to lie about them should be.
+// Untrusted types are inferred locally.
+//
+// Only the types of scraps imported by hash, or locally without local
+// imports of their own, are shared; since the types of the others depend
+// on more than their sources.
+func (e *Environment) UseTypeCache(yard yards.ArtifactFetcher, push, trust bool) {
+	if yard == nil {
+		e.types = nil
+		return
+	}
+	e.types = &typeCache{yard, push, trust}
+}
+
+// typeKey returns the key of the type of a scrap in the yard: the sha256
+// hash of its hash, and the names and types in scope; since built-ins and
+// host kinds differ between Environments, and the type depends on them.
+func (e *Environment) typeKey(scrap *Scrap) string {
+	hash := sha256.New()
+	hash.Write([]byte(scrap.Sha256()))
+	names := e.typeScope.Names()
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(hash, "\x00%s : %s", name, e.reg.CanonicalString(e.typeScope.Lookup(name)))
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// fetchType returns the shared type of an imported scrap, if there is one
+// and the yard is trusted.
+func (e *Environment) fetchType(scrap *Scrap) (types.TypeRef, bool) {
+	tc := e.types
+	if tc == nil || !tc.trust || scrap.unlinked != nil {
+		return types.NeverRef, false
+	}
+	data, err := tc.yard.FetchArtifact(typeArtifact, e.typeKey(scrap))
+	if err != nil {
+		return types.NeverRef, false
+	}
+	ref, err := e.reg.Decode(data)
+	return ref, err == nil
+}
+
+// storeType shares the type of an imported scrap, if pushing is enabled.
+func (e *Environment) storeType(scrap *Scrap, ref types.TypeRef) {
+	tc := e.types
+	if tc == nil || !tc.push || scrap.unlinked != nil {
+		return
+	}
+	p, ok := tc.yard.(yards.ArtifactPusher)
+	if !ok {
+		return
+	}
+	key := e.typeKey(scrap)
+	start := time.Now()
+	err := p.PushArtifact(typeArtifact, key, e.reg.Encode(ref))
+	e.rt.emit(Event{Kind: TypePushed, Name: key, Duration: time.Since(start), Err: err})
+}
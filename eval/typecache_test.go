@@ -0,0 +1,122 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// artifacts is an in-memory yard of artifacts.
+type artifacts map[string][]byte
+
+func (a artifacts) FetchArtifact(kind, key string) ([]byte, error) {
+	if data, ok := a[kind+":"+key]; ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("no artifact %s:%s", kind, key)
+}
+
+func (a artifacts) PushArtifact(kind, key string, data []byte) error {
+	a[kind+":"+key] = data
+	return nil
+}
+
+// failingPusher is a yard of artifacts that fails to push them.
+type failingPusher struct{ artifacts }
+
+func (failingPusher) PushArtifact(kind, key string, data []byte) error {
+	return errors.New("read-only")
+}
+
+func TestTypeCache(t *testing.T) {
+	lib := "{ inc = x -> x + 1, one = 1 }"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+	source := "$sha256~~" + hash
+
+	shared := artifacts{}
+	newEnv := func(push, trust bool) *Environment {
+		env := NewEnvironment()
+		env.UseFetcher(MapFetcher{hash: lib})
+		env.UseTypeCache(shared, push, trust)
+		return env
+	}
+	keyOf := func(env *Environment) string {
+		t.Helper()
+		scrap, err := env.Read([]byte(lib))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "type:" + env.typeKey(scrap)
+	}
+	infer := func(env *Environment) string {
+		t.Helper()
+		scrap, err := env.Read([]byte(source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, err := env.Infer(scrap)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return typ
+	}
+
+	// Without pushing, nothing is shared.
+	expected := infer(newEnv(false, true))
+	if len(shared) != 0 {
+		t.Errorf("Expected no shared types, got %v", shared)
+	}
+
+	// Only the import's type is shared, not that of the script.
+	env := newEnv(true, false)
+	key := keyOf(env)
+	infer(env)
+	if _, ok := shared[key]; !ok || len(shared) != 1 {
+		t.Fatalf("Expected only the type of the import to be shared, got %v", shared)
+	}
+
+	// Another Environment that trusts the yard uses the shared type,
+	// instead of inferring it; here one that was tampered with to show
+	// that it's used.
+	shared[key] = env.reg.Encode(env.reg.List(types.IntRef))
+	if typ := infer(newEnv(false, true)); typ != "list int" {
+		t.Errorf("Expected the shared type to be used, got %s instead of %s", typ, expected)
+	}
+	// One that doesn't infers it.
+	if typ := infer(newEnv(false, false)); typ != expected {
+		t.Errorf("Expected %s, got %s", expected, typ)
+	}
+
+	// Bad encodings are inferred instead.
+	shared[key] = []byte("bad")
+	if typ := infer(newEnv(false, true)); typ != expected {
+		t.Errorf("Expected %s, got %s", expected, typ)
+	}
+
+	// Types are keyed by what's in scope, like host kinds.
+	kinds := newEnv(false, true)
+	if _, err := kinds.RegisterKind("db"); err != nil {
+		t.Fatal(err)
+	}
+	if keyOf(kinds) == key {
+		t.Errorf("Expected host kinds to change the key %s", key)
+	}
+
+	// Failures to push are reported.
+	env = NewEnvironment()
+	env.UseFetcher(MapFetcher{hash: lib})
+	env.UseTypeCache(failingPusher{artifacts{}}, true, true)
+	var pushed []error
+	env.UseObserver(func(ev Event) {
+		if ev.Kind == TypePushed {
+			pushed = append(pushed, ev.Err)
+		}
+	})
+	infer(env)
+	if len(pushed) != 1 || pushed[0] == nil || pushed[0].Error() != "read-only" {
+		t.Errorf("Expected a failure to push, got %v", pushed)
+	}
+}
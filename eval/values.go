@@ -3,6 +3,7 @@ package eval
 import (
 	"bytes"
 	"encoding/base64"
+	"fmt"
 	"maps"
 	"slices"
 	"strconv"
@@ -16,7 +17,9 @@ import (
 type Value interface {
 	Type() types.TypeRef
 	String() string
-	eq(other Value) bool
+	// eq compares the value, nested depth records,
+	// lists and variants deep, with another.
+	eq(other Value, depth int) bool
 }
 
 type Hole struct{}
@@ -36,7 +39,7 @@ type Record struct {
 
 type List struct {
 	typ      types.TypeRef
-	elements []Value
+	elements *seq
 }
 
 type Variant struct {
@@ -57,90 +60,137 @@ type BuiltInFunc struct {
 
 // A user-defined function.
 type ScriptFunc struct {
+	// The printed function expression, if defined in a scrap; or what
+	// describes others, like partial applications of built-ins.
 	source string
-	fn     Func
-}
-
-func Equals(a, b Value) bool {
-	switch a.(type) {
-	case Hole:
-		return a.eq(b)
-	case Int:
-		return a.eq(b)
-	case Float:
-		return a.eq(b)
-	case Text:
-		return a.eq(b)
-	case Byte:
-		return a.eq(b)
-	case Bytes:
-		return a.eq(b)
-	case Type:
-		return a.eq(b)
-	case Record:
-		return a.eq(b)
-	case List:
-		return a.eq(b)
-	case Variant:
-		return a.eq(b)
-	case BuiltInFunc:
-		return a.eq(b)
-	case ScriptFunc:
-		return a.eq(b)
+	scrap  string // The scrap defining the function, if any.
+	// Looks up the values that the function captures; nil unless
+	// it's defined in a scrap.
+	captures func() (Variables, error)
+	fn       Func
+}
+
+// MaxNesting is how deep records, lists and variants may be nested in each
+// other for values to be rendered and compared. Deeper values render as
+// `...`, and comparing them is an ErrTooDeep, rather than exhausting the
+// stack.
+const MaxNesting = 10000
+
+// ErrTooDeep is returned when comparing values nested deeper than
+// MaxNesting, before telling them apart.
+var ErrTooDeep = fmt.Errorf("cannot compare values nested more than %d deep", MaxNesting)
+
+// Equals reports whether two values are equal,
+// or ErrTooDeep if that can't be told.
+func Equals(a, b Value) (eq bool, err error) {
+	defer func() {
+		if pnc := recover(); pnc != nil {
+			if pnc != tooDeep {
+				panic(pnc)
+			}
+			eq, err = false, ErrTooDeep
+		}
+	}()
+	return equal(a, b, 0), nil
+}
+
+// same reports whether two values are Equal, or false if that can't be
+// told; for remembering values, where that only costs reusing them.
+func same(a, b Value) bool {
+	eq, err := Equals(a, b)
+	return eq && err == nil
+}
+
+// tooDeep is what comparisons panic with when values are nested too
+// deep to compare, to unwind to Equals.
+var tooDeep = new(int)
+
+func equal(a, b Value, depth int) bool {
+	if a == nil {
+		return false
+	}
+	return a.eq(b, depth)
+}
+
+// within panics with tooDeep unless depth is less than MaxNesting.
+func within(depth int) bool {
+	if depth >= MaxNesting {
+		panic(tooDeep)
 	}
-	return false
+	return true
 }
 
-func (h Hole) eq(other Value) bool {
+func (h Hole) eq(other Value, depth int) bool {
 	_, ok := other.(Hole)
 	return ok
 }
-func (i Int) eq(other Value) bool {
+func (i Int) eq(other Value, depth int) bool {
 	o, ok := other.(Int)
 	return ok && i == o
 }
-func (f Float) eq(other Value) bool {
+func (f Float) eq(other Value, depth int) bool {
 	o, ok := other.(Float)
 	return ok && f == o
 }
-func (t Text) eq(other Value) bool {
+func (t Text) eq(other Value, depth int) bool {
 	o, ok := other.(Text)
 	return ok && t == o
 }
-func (b Byte) eq(other Value) bool {
+func (b Byte) eq(other Value, depth int) bool {
 	o, ok := other.(Byte)
 	return ok && b == o
 }
-func (bs Bytes) eq(other Value) bool {
+func (bs Bytes) eq(other Value, depth int) bool {
 	o, ok := other.(Bytes)
 	return ok && bytes.Equal(bs, o)
 }
-func (t Type) eq(other Value) bool {
+func (t Type) eq(other Value, depth int) bool {
 	o, ok := other.(Type)
 	return ok && t == o
 }
-func (i Record) eq(other Value) bool {
+func (i Record) eq(other Value, depth int) bool {
 	o, ok := other.(Record)
-	return ok && i.typ == o.typ &&
-		maps.EqualFunc(i.values, o.values, Equals)
+	return ok && i.typ == o.typ && (sameMap(i.values, o.values) ||
+		within(depth) && maps.EqualFunc(i.values, o.values, nested(depth)))
 }
-func (l List) eq(other Value) bool {
+func (l List) eq(other Value, depth int) bool {
 	o, ok := other.(List)
-	return ok && l.typ == o.typ &&
-		slices.EqualFunc(l.elements, o.elements, Equals)
+	return ok && l.typ == o.typ && l.Len() == o.Len() && (l.elements == o.elements ||
+		within(depth) && slices.EqualFunc(l.values(), o.values(), nested(depth)))
 }
-func (v Variant) eq(other Value) bool {
+func (v Variant) eq(other Value, depth int) bool {
 	o, ok := other.(Variant)
-	return ok && v.tag == o.tag && Equals(v.value, o.value)
+	return ok && v.tag == o.tag &&
+		(v.value == nil && o.value == nil || within(depth) && equal(v.value, o.value, depth+1))
+}
+
+// nested returns a function comparing values nested within one at depth.
+func nested(depth int) func(a, b Value) bool {
+	return func(a, b Value) bool {
+		return equal(a, b, depth+1)
+	}
 }
-func (bf BuiltInFunc) eq(other Value) bool {
+func (bf BuiltInFunc) eq(other Value, depth int) bool {
 	o, ok := other.(BuiltInFunc)
 	return ok && bf.name == o.name
 }
-func (sf ScriptFunc) eq(other Value) bool {
+func (sf ScriptFunc) eq(other Value, depth int) bool {
 	o, ok := other.(ScriptFunc)
-	// TODO: This is very incomplete.
-	return ok && sf.source == o.source
+	if !ok || sf.String() != o.String() {
+		return false
+	}
+	// Equal functions must also have captured equal values.
+	a, errA := sf.captured()
+	b, errB := o.captured()
+	if errA != nil || errB != nil || len(a) != len(b) {
+		return false
+	}
+	for name, val := range a {
+		if other, ok := b[name]; !ok || !equal(val, other, depth+1) {
+			return false
+		}
+	}
+	return true
 }
 
 // Type
@@ -151,8 +201,7 @@ func (t Text) Type() types.TypeRef   { return types.TextRef }
 func (b Byte) Type() types.TypeRef   { return types.ByteRef }
 func (bs Bytes) Type() types.TypeRef { return types.BytesRef }
 func (t Type) Type() types.TypeRef {
-	// TODO: Should a type return itself, or a special type?
-	return types.NeverRef
+	return types.TypeOf(types.TypeRef(t))
 }
 func (r Record) Type() types.TypeRef       { return r.typ }
 func (l List) Type() types.TypeRef         { return l.typ }
@@ -160,7 +209,13 @@ func (v Variant) Type() types.TypeRef      { return v.typ }
 func (bf BuiltInFunc) Type() types.TypeRef { return bf.typ }
 func (sf ScriptFunc) Type() types.TypeRef {
 	// TODO: implement
-	return types.NeverRef
+	return types.UnknownRef
+}
+
+// Get returns the value of a key of the Record.
+func (r Record) Get(key string) (val Value, ok bool) {
+	val, ok = r.values[key]
+	return
 }
 
 // String
@@ -194,47 +249,71 @@ func (t Type) String() string {
 }
 func (r Record) String() string {
 	var b strings.Builder
-	b.WriteString("{ ")
-	comma := len(r.values) - 1
-	for _, key := range slices.Sorted(maps.Keys(r.values)) {
-		val := r.values[key]
-		b.WriteString(key)
-		b.WriteString(" = ")
-		b.WriteString(val.String())
-
-		if comma > 0 {
-			comma -= 1
-			b.WriteString(", ")
-		}
-	}
-	b.WriteString(" }")
+	write(&b, r, 0)
 	return b.String()
 }
 func (l List) String() string {
-	if len(l.elements) == 0 {
-		return "[]"
-	}
-
 	var b strings.Builder
-	b.WriteString("[ ")
-	comma := len(l.elements) - 1
-	for _, val := range l.elements {
-		b.WriteString(val.String())
-
-		if comma > 0 {
-			comma -= 1
-			b.WriteString(", ")
-		}
-	}
-	b.WriteString(" ]")
+	write(&b, l, 0)
 	return b.String()
 }
 func (v Variant) String() string {
-	value := ""
-	if v.value != nil {
-		value = " " + v.value.String()
+	var b strings.Builder
+	write(&b, v, 0)
+	return b.String()
+}
+
+// write renders a value nested depth records, lists and variants deep.
+func write(b *strings.Builder, v Value, depth int) {
+	switch v.(type) {
+	case Record, List, Variant:
+		if depth >= MaxNesting {
+			b.WriteString("...")
+			return
+		}
+	}
+
+	switch v := v.(type) {
+	case Record:
+		b.WriteString("{ ")
+		comma := len(v.values) - 1
+		for _, key := range slices.Sorted(maps.Keys(v.values)) {
+			b.WriteString(key)
+			b.WriteString(" = ")
+			write(b, v.values[key], depth+1)
+
+			if comma > 0 {
+				comma -= 1
+				b.WriteString(", ")
+			}
+		}
+		b.WriteString(" }")
+	case List:
+		if v.Len() == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[ ")
+		comma := v.Len() - 1
+		for _, val := range v.values() {
+			write(b, val, depth+1)
+
+			if comma > 0 {
+				comma -= 1
+				b.WriteString(", ")
+			}
+		}
+		b.WriteString(" ]")
+	case Variant:
+		b.WriteString("#")
+		b.WriteString(v.tag)
+		if v.value != nil {
+			b.WriteString(" ")
+			write(b, v.value, depth+1)
+		}
+	default:
+		b.WriteString(v.String())
 	}
-	return "#" + v.tag + value
 }
 func (bf BuiltInFunc) String() string {
 	return bf.name
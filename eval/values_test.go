@@ -0,0 +1,50 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/types"
+)
+
+// nest returns a value of n lists within each other.
+func nest(n int) Value {
+	var val Value = Int(1)
+	for range n {
+		val = List{types.NeverRef, leaf([]Value{val})}
+	}
+	return val
+}
+
+func TestMaxNesting(t *testing.T) {
+	if s := nest(MaxNesting).String(); !strings.HasSuffix(s, "[ 1 ]"+strings.Repeat(" ]", MaxNesting-1)) {
+		t.Errorf("expected the whole value to render, got %s", s[len(s)-20:])
+	}
+	if s := nest(MaxNesting + 1).String(); !strings.HasSuffix(s, "[ ... ]"+strings.Repeat(" ]", MaxNesting-1)) {
+		t.Errorf("expected the deepest list to be truncated, got %s", s[len(s)-20:])
+	}
+
+	if eq, err := Equals(nest(MaxNesting), nest(MaxNesting)); !eq || err != nil {
+		t.Errorf("expected values within MaxNesting to be equal, got %t, %v", eq, err)
+	}
+	if eq, err := Equals(nest(MaxNesting+1), nest(MaxNesting+1)); err != ErrTooDeep {
+		t.Errorf("expected values nested deeper than MaxNesting not to compare, got %t, %v", eq, err)
+	}
+	if eq, err := Equals(nest(MaxNesting+1), Int(1)); eq || err != nil {
+		t.Errorf("expected values of different shapes to be unequal, got %t, %v", eq, err)
+	}
+	Hash(nest(MaxNesting + 1))
+}
+
+func TestDeepValues(t *testing.T) {
+	// Far deeper than the default limit,
+	// which must not exhaust the stack.
+	a, b := nest(100_000), nest(100_000)
+	if s := a.String(); !strings.Contains(s, "[ ... ]") {
+		t.Errorf("expected a truncated rendering")
+	}
+	if _, err := Equals(a, b); err != ErrTooDeep {
+		t.Errorf("expected deep values not to compare, got %v", err)
+	}
+	Hash(a)
+}
@@ -0,0 +1,88 @@
+package eval
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// Version is the version of the language and built-ins that Environments
+// support. Scraps may require a minimum version with a pragma in their
+// header, like `-- scrap:version 0.2`.
+const Version = "0.2"
+
+// ErrUnsupportedVersion is returned when reading a scrap that requires
+// a newer Version than this one.
+type ErrUnsupportedVersion struct {
+	// The version the scrap requires.
+	Required string
+	// The pragma that requires it.
+	At token.Error
+}
+
+func (e *ErrUnsupportedVersion) Error() string {
+	return e.At.Error()
+}
+
+func (e *ErrUnsupportedVersion) Unwrap() error {
+	return e.At
+}
+
+// checkVersion returns an error if a scrap's header requires a version
+// newer than Version, or a malformed one.
+func checkVersion(source *token.Source, h ast.Header) error {
+	for _, pragma := range h.Pragmas {
+		if pragma.Name != "version" {
+			continue
+		}
+		required, ok := parseVersion(pragma.Value)
+		if !ok {
+			return source.Error(pragma.Pos, fmt.Sprintf(
+				"invalid scrapscript version %q, must be like %s", pragma.Value, Version))
+		}
+		supported, _ := parseVersion(Version)
+		if compareVersions(required, supported) > 0 {
+			return &ErrUnsupportedVersion{
+				Required: pragma.Value,
+				At: source.Error(pragma.Pos, fmt.Sprintf(
+					"scrap requires scrapscript %s, but only %s is supported; upgrade to run it",
+					pragma.Value, Version)),
+			}
+		}
+	}
+	return nil
+}
+
+// parseVersion parses dot-separated numbers, like 0.2 or 1.10.3.
+func parseVersion(v string) ([]int, bool) {
+	var parts []int
+	for part := range strings.SplitSeq(v, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || part != strconv.Itoa(n) {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
+
+// compareVersions compares versions part by part,
+// where missing parts are zero; 1.0 equals 1.
+func compareVersions(a, b []int) int {
+	for i := range max(len(a), len(b)) {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			return x - y
+		}
+	}
+	return 0
+}
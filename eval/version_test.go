@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	env := NewEnvironment()
+
+	for _, v := range []string{"0.1", "0.2", "0.2.0", Version} {
+		if _, err := env.Read([]byte("-- scrap:version " + v + "\n1")); err != nil {
+			t.Errorf("Expected version %s to be supported, got %v", v, err)
+		}
+	}
+
+	// Scraps requiring newer syntax are refused before they fail to parse.
+	for _, v := range []string{"0.3", "0.10", "0.2.1", "1"} {
+		_, err := env.Read([]byte("-- scrap:version " + v + "\nnew @ syntax"))
+		var uv *ErrUnsupportedVersion
+		if !errors.As(err, &uv) {
+			t.Errorf("Expected an ErrUnsupportedVersion for %s, got %v", v, err)
+			continue
+		}
+		if uv.Required != v || !strings.Contains(err.Error(), "upgrade") {
+			t.Errorf("Unexpected error for %s: %s", v, err)
+		}
+	}
+
+	for _, v := range []string{"", "latest", "1.x", "01", "-1"} {
+		_, err := env.Read([]byte("-- scrap:version " + v + "\n1"))
+		if err == nil || !strings.Contains(err.Error(), "invalid scrapscript version") {
+			t.Errorf("Expected version %q to be invalid, got %v", v, err)
+		}
+	}
+}
+
+func TestImportVersion(t *testing.T) {
+	lib := "-- scrap:version 99.0\n1"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+
+	env := NewEnvironment()
+	env.UseFetcher(MapFetcher{hash: lib})
+	_, err := eval(env, "$sha256~~"+hash)
+	var uv *ErrUnsupportedVersion
+	if !errors.As(err, &uv) || uv.Required != "99.0" {
+		t.Errorf("Expected an ErrUnsupportedVersion, got %v", err)
+	}
+}
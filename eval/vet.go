@@ -0,0 +1,177 @@
+package eval
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// Vet reports suspicious constructs in a Scrap, in source order:
+// where-bindings that are never used, bindings that shadow built-ins or
+// enclosing bindings, and alternatives of match functions that can never
+// be reached, since an earlier alternative matches everything they do.
+//
+// The scrap is not inferred, so Vet works on ill-typed scraps too.
+// Each kind of warning may be turned off by a pragma in its header,
+// like `-- scrap:nowarn unused shadow unreachable`.
+func (e *Environment) Vet(scrap *Scrap) []token.Error {
+	v := &vetter{source: &scrap.expr.Source, builtIns: e.typeScope.Names()}
+	if kinds, ok := scrap.Header().Pragma("nowarn"); ok {
+		v.nowarn = strings.Fields(kinds)
+	}
+	v.walk(scrap.expr.Expr, nil)
+
+	slices.SortStableFunc(v.warnings, func(a, b token.Error) int {
+		return a.Range.Start - b.Range.Start
+	})
+	return v.warnings
+}
+
+type vetter struct {
+	source   *token.Source
+	builtIns []string
+	nowarn   []string // The kinds of warnings turned off.
+	warnings []token.Error
+}
+
+func (v *vetter) warnf(kind string, span token.Span, format string, args ...any) {
+	if slices.Contains(v.nowarn, kind) {
+		return
+	}
+	v.warnings = append(v.warnings, v.source.Error(span, fmt.Sprintf(format, args...)))
+}
+
+// bind returns scope with ids added,
+// warning about those that shadow another name.
+func (v *vetter) bind(scope []*ast.Ident, ids ...*ast.Ident) []*ast.Ident {
+	scope = slices.Clip(scope)
+	for _, id := range ids {
+		name := v.source.GetString(id.Pos)
+		if name == "_" {
+			continue
+		}
+		if slices.ContainsFunc(scope, func(other *ast.Ident) bool {
+			return v.source.GetString(other.Pos) == name
+		}) {
+			v.warnf("shadow", id.Pos, "%s shadows an enclosing binding", name)
+		} else if slices.Contains(v.builtIns, name) {
+			v.warnf("shadow", id.Pos, "%s shadows a built-in", name)
+		}
+		scope = append(scope, id)
+	}
+	return scope
+}
+
+func (v *vetter) walk(node ast.Node, scope []*ast.Ident) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.WhereExpr:
+			if n.Typ != nil {
+				v.walk(n.Typ, scope)
+			}
+			if n.Val != nil {
+				v.walk(n.Val, scope)
+			}
+			name := v.source.GetString(n.Id.Pos)
+			if name != "_" && !slices.Contains(ast.FreeVars(v.source, n.Expr), name) {
+				v.warnf("unused", n.Id.Pos, "%s is never used", name)
+			}
+			v.walk(n.Expr, v.bind(scope, &n.Id))
+			return false
+		case *ast.FuncExpr:
+			v.walk(n.Body, v.bind(scope, ast.PatternNames(n.Arg)...))
+			return false
+		case ast.MatchFuncExpr:
+			for i, alt := range n {
+				for _, prev := range n[:i] {
+					if v.subsumes(prev.Arg, alt.Arg) {
+						v.warnf("unreachable", alt.Arg.Span(), "this alternative can never be reached")
+						break
+					}
+				}
+				v.walk(alt, scope)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// subsumes reports whether pattern a matches every value that b does.
+// It's conservative; false doesn't mean that b matches something a doesn't.
+func (v *vetter) subsumes(a, b ast.Expr) bool {
+	if alt, ok := b.(*ast.BinaryExpr); ok && alt.Op == token.PIPE {
+		return v.subsumes(a, alt.Left) && v.subsumes(a, alt.Right)
+	}
+
+	switch a := a.(type) {
+	case *ast.Ident:
+		return true
+
+	case *ast.Literal:
+		b, ok := b.(*ast.Literal)
+		if !ok || a.Kind != b.Kind || a.Kind == token.FLOAT {
+			return false
+		}
+		x, err := Literal(v.source, a)
+		if err != nil {
+			return false
+		}
+		y, err := Literal(v.source, b)
+		return err == nil && same(x, y)
+
+	case *ast.VariantExpr:
+		b, ok := b.(*ast.VariantExpr)
+		if !ok || v.source.GetString(a.Tag.Pos) != v.source.GetString(b.Tag.Pos) {
+			return false
+		}
+		if a.Typ == nil || b.Typ == nil {
+			return a.Typ == nil && b.Typ == nil
+		}
+		return v.subsumes(a.Typ, b.Typ)
+
+	case *ast.ListExpr:
+		b, ok := b.(*ast.ListExpr)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i, el := range a.Elements {
+			if !v.subsumes(el, b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.RecordExpr:
+		b, ok := b.(*ast.RecordExpr)
+		if !ok {
+			return false
+		}
+		if _, ok := a.Rest.(*ast.Ident); a.Rest != nil && !ok {
+			return false
+		}
+		for _, e := range a.Entries {
+			key := v.source.GetString(e.Key.Pos)
+			i := slices.IndexFunc(b.Entries, func(other ast.RecordEntry) bool {
+				return v.source.GetString(other.Key.Pos) == key
+			})
+			if e.Drop || i < 0 || !v.subsumes(e.Val, b.Entries[i].Val) {
+				return false
+			}
+		}
+		return true
+
+	case *ast.BinaryExpr:
+		if a.Op == token.PIPE {
+			return v.subsumes(a.Left, b) || v.subsumes(a.Right, b)
+		}
+		if a.Op == token.PREPEND || a.Op == token.APPEND {
+			b, ok := b.(*ast.BinaryExpr)
+			return ok && a.Op == b.Op && v.subsumes(a.Left, b.Left) && v.subsumes(a.Right, b.Right)
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package eval
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	examples := []struct {
+		source   string
+		warnings []string
+	}{
+		{`f 1 ; f = a -> a + 1`, nil},
+		{`1 ; x = 2`, []string{"x: x is never used"}},
+		{`1 ; _ = 2`, nil},
+		// Bindings used only by other unused bindings are used.
+		{`1 ; x = y ; y = 2`, []string{"x: x is never used"}},
+		{`f ; f = a -> b -> a`, nil},
+		{`f ; f = (g ; g = x -> x) ; g = 1`, []string{
+			"g: g shadows an enclosing binding",
+			"g: g is never used",
+		}},
+		{`f ; f = x -> (x -> x)`, []string{"x: x shadows an enclosing binding"}},
+		{`f ; f = bytes/to-utf8-text -> 1`, []string{"bytes/to-utf8-text: bytes/to-utf8-text shadows a built-in"}},
+		// Unreachable alternatives.
+		{`f ; f = | 1 -> 1 | 2 -> 2 | 1 -> 3 | x -> x`, []string{"1: this alternative can never be reached"}},
+		{`f ; f = | x -> 1 | 0 -> 0`, []string{"0: this alternative can never be reached"}},
+		{`f ; f = | #a -> 1 | #a x -> 2 | #a -> 3`, []string{"#a: this alternative can never be reached"}},
+		{`f ; f = | #a 1 -> 1 | #a _ -> 2 | #a 2 -> 3`, []string{"#a 2: this alternative can never be reached"}},
+		{`f ; f = | #a 1 -> 1 | #a 2 -> 2`, nil},
+		{`f ; f = | [_, _] -> 1 | [1, 2] -> 2`, []string{"[1, 2]: this alternative can never be reached"}},
+		{`f ; f = | { a = 1 } -> 1 | { a = 1, b = 2 } -> 2`, []string{"{ a = 1, b = 2 }: this alternative can never be reached"}},
+		{`f ; f = | { a = 1, b = 2 } -> 1 | { a = 1 } -> 2`, nil},
+		{`f ; f = | 1 | 2 -> 1 | 2 -> 2`, []string{"2: this alternative can never be reached"}},
+		{`f ; f = | 1 -> 1 | 1 | 2 -> 2`, nil},
+		{`f ; f = | h >+ t -> 1 | [] -> 0 | 1 >+ t -> 2`, []string{"1 >+ t: this alternative can never be reached"}},
+		// Kinds of warnings may be turned off.
+		{"-- scrap:nowarn unused unreachable\nf ; f = | x -> (x -> x) | 0 -> 1 ; y = 2", []string{"x: x shadows an enclosing binding"}},
+		{"-- scrap:nowarn shadow\nf ; f = | x -> (x -> x) | 0 -> 1 ; y = 2", []string{
+			"0: this alternative can never be reached",
+			"y: y is never used",
+		}},
+	}
+
+	for _, ex := range examples {
+		env := NewEnvironment()
+		scrap, err := env.Read([]byte(ex.source))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, w := range env.Vet(scrap) {
+			got = append(got, fmt.Sprintf("%s: %s", ex.source[w.Range.Start:w.Range.End], w.Msg))
+		}
+		if !slices.Equal(got, ex.warnings) {
+			t.Errorf("%s\n  got  %q\n  want %q", ex.source, got, ex.warnings)
+		}
+	}
+}
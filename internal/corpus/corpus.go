@@ -0,0 +1,132 @@
+// Package corpus generates synthetic scraps of configurable shape, for
+// benchmarks and fuzzing to have reproducible inputs of any size.
+//
+// Generated scraps are well-typed, and evaluate to an int.
+package corpus
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+)
+
+// A Shape configures the scraps Generate produces.
+type Shape struct {
+	// The number of where-bindings of the main scrap,
+	// each of which refers to earlier ones.
+	Bindings int
+	// How deep the patterns of the match function
+	// that bindings call are nested.
+	Depth int
+	// The number of scraps imported, in a chain where each imports
+	// the one before it. The main scrap imports all of them.
+	Imports int
+	// Scraps generated from the same Shape are identical.
+	Seed uint64
+}
+
+// A Corpus is a generated scrap, along with the scraps it imports.
+type Corpus struct {
+	Main []byte
+	// The imported scraps, by the hex-encoded sha256 hashes of their sources.
+	Imports map[string][]byte
+}
+
+// FetchSha256 fetches the imports of the Corpus, which makes it a yards.Fetcher.
+func (c Corpus) FetchSha256(key string) ([]byte, error) {
+	if bs, ok := c.Imports[key]; ok {
+		return bs, nil
+	}
+	return nil, fmt.Errorf("no scrap %s in corpus", key)
+}
+
+// Generate generates a Corpus of the given Shape.
+func Generate(shape Shape) Corpus {
+	g := generator{
+		shape:   shape,
+		rand:    rand.New(rand.NewPCG(shape.Seed, shape.Seed)),
+		imports: make(map[string][]byte, shape.Imports),
+	}
+	main := g.main()
+	return Corpus{Main: main, Imports: g.imports}
+}
+
+type generator struct {
+	shape   Shape
+	rand    *rand.Rand
+	imports map[string][]byte
+	hashes  []string // In the order they were generated.
+}
+
+func (g *generator) main() []byte {
+	var b strings.Builder
+	// The last binding is outermost in a where-chain, so bindings
+	// are written last to first, to refer to those before them.
+	if g.shape.Bindings > 0 {
+		fmt.Fprintf(&b, "b%d", g.shape.Bindings-1)
+	} else {
+		b.WriteString("0")
+	}
+	exprs := make([]string, g.shape.Bindings)
+	for i := range exprs {
+		exprs[i] = g.expr(i)
+	}
+	for i := len(exprs) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "\n; b%d = %s", i, exprs[i])
+	}
+
+	g.libraries()
+	for i, hash := range g.hashes {
+		fmt.Fprintf(&b, "\n; imp%d = $sha256~~%s", i, hash)
+	}
+	fmt.Fprintf(&b, "\n; m = %s", g.match())
+	return []byte(b.String())
+}
+
+// expr returns an int expression for the binding at index i,
+// using the bindings before it.
+func (g *generator) expr(i int) string {
+	if i == 0 {
+		return fmt.Sprint(g.rand.IntN(100))
+	}
+	prev := fmt.Sprintf("b%d", g.rand.IntN(i))
+	switch g.rand.IntN(5) {
+	case 0:
+		if g.shape.Imports > 0 {
+			return fmt.Sprintf("imp%d %s", g.rand.IntN(g.shape.Imports), prev)
+		}
+		fallthrough
+	case 1:
+		return fmt.Sprintf("m %s", g.nest(prev, g.shape.Depth))
+	case 2:
+		return fmt.Sprintf("list/length [%s, b%d]", prev, g.rand.IntN(i))
+	case 3:
+		return fmt.Sprintf("(x -> x - %d) %s", g.rand.IntN(10), prev)
+	}
+	return fmt.Sprintf("%s + b%d", prev, g.rand.IntN(i))
+}
+
+// nest returns x nested in depth lists.
+func (g *generator) nest(x string, depth int) string {
+	return strings.Repeat("[", depth) + x + strings.Repeat("]", depth)
+}
+
+// match returns a match function of values nested like nest does.
+func (g *generator) match() string {
+	return fmt.Sprintf("| %s -> 0 | %s -> x + 1 | _ -> 0",
+		g.nest("0", g.shape.Depth), g.nest("x", g.shape.Depth))
+}
+
+// libraries generates the imported scraps, each of which imports the one before it.
+func (g *generator) libraries() {
+	for i := range g.shape.Imports {
+		lib := fmt.Sprintf("n -> n + %d", g.rand.IntN(10))
+		if i > 0 {
+			lib = fmt.Sprintf("n -> prev n + %d\n; prev = $sha256~~%s", g.rand.IntN(10), g.hashes[i-1])
+		}
+		hash := fmt.Sprintf("%x", sha256.Sum256([]byte(lib)))
+		g.imports[hash] = []byte(lib)
+		g.hashes = append(g.hashes, hash)
+	}
+}
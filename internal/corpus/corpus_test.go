@@ -0,0 +1,49 @@
+package corpus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+func TestGenerate(t *testing.T) {
+	shapes := []Shape{
+		{},
+		{Bindings: 1},
+		{Bindings: 20, Depth: 3, Imports: 2, Seed: 1},
+		{Bindings: 50, Depth: 0, Imports: 5, Seed: 2},
+		{Bindings: 200, Depth: 8, Imports: 10, Seed: 3},
+	}
+
+	for _, shape := range shapes {
+		c := Generate(shape)
+		if len(c.Imports) != shape.Imports {
+			t.Errorf("%+v: expected %d imports, got %d", shape, shape.Imports, len(c.Imports))
+		}
+		if again := Generate(shape); !bytes.Equal(c.Main, again.Main) {
+			t.Errorf("%+v: expected the same scrap from the same shape", shape)
+		}
+
+		env := eval.NewEnvironment()
+		env.UseFetcher(c)
+		scrap, err := env.Read(c.Main)
+		if err != nil {
+			t.Fatalf("%+v: %s\n%s", shape, err, c.Main)
+		}
+		if typ, err := env.Infer(scrap); err != nil || typ != "int" {
+			t.Errorf("%+v: expected int, got %s, %v\n%s", shape, typ, err, c.Main)
+		}
+		if _, err := env.Eval(scrap); err != nil {
+			t.Errorf("%+v: %s\n%s", shape, err, c.Main)
+		}
+	}
+}
+
+func TestSeeds(t *testing.T) {
+	a := Generate(Shape{Bindings: 10, Seed: 1})
+	b := Generate(Shape{Bindings: 10, Seed: 2})
+	if bytes.Equal(a.Main, b.Main) {
+		t.Error("expected different seeds to generate different scraps")
+	}
+}
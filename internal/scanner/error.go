@@ -0,0 +1,60 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+type ErrorHandler func(err token.Error)
+
+type Errors []*token.Error
+
+func (e *Errors) Add(err token.Error) {
+	*e = append(*e, &err)
+}
+
+// Error renders every error, each with the source lines it spans.
+func (e Errors) Error() string {
+	if len(e) == 0 {
+		return "no errors"
+	}
+	errs := make([]string, len(e))
+	for i, err := range e {
+		errs[i] = err.Error()
+	}
+	return strings.Join(errs, "\n\n")
+}
+
+// Render renders the first max errors in a Style, or all of them if max
+// isn't positive. Each is prefixed by its position in file, like
+// `main.scrap:1:5: `, for editors and other tools to jump to, and
+// followed by the source lines it spans. Several errors end with a
+// summary of how many there were.
+func (e Errors) Render(file string, style token.Style, max int) string {
+	if max <= 0 || max > len(e) {
+		max = len(e)
+	}
+	var b strings.Builder
+	for i, err := range e[:max] {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "%s:%d:%d: %s", file, err.Pos.Line, err.Pos.Column, err.Render(style))
+	}
+	switch {
+	case max < len(e):
+		fmt.Fprintf(&b, "\n\n%d errors, %d not shown", len(e), len(e)-max)
+	case len(e) > 1:
+		fmt.Fprintf(&b, "\n\n%d errors", len(e))
+	}
+	return b.String()
+}
+
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
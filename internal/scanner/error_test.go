@@ -0,0 +1,49 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/token"
+)
+
+func TestErrorsRender(t *testing.T) {
+	source := token.NewSource([]byte("a +\n@ + #"))
+	source.AddLineBreak(4)
+	var errs Errors
+	errs.Add(source.Error(token.Span{Start: 4, End: 5}, "illegal character"))
+	errs.Add(source.Error(token.Span{Start: 8, End: 9}, "missing tag"))
+
+	expected := `main.scrap:2:1: error: illegal character
+
+    2: @ + #
+       ~
+
+main.scrap:2:5: error: missing tag
+
+    2: @ + #
+           ~
+
+2 errors`
+	if got := errs.Render("main.scrap", token.Plain, 0); got != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	expected = `main.scrap:2:1: error: illegal character
+
+    2: @ + #
+       ~
+
+2 errors, 1 not shown`
+	if got := errs.Render("main.scrap", token.Plain, 1); got != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+
+	// A single error has no summary.
+	expected = `main.scrap:2:1: error: illegal character
+
+    2: @ + #
+       ~`
+	if got := errs[:1].Render("main.scrap", token.Plain, 1); got != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, got)
+	}
+}
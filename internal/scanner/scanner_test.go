@@ -1,8 +1,10 @@
 package scanner
 
 import (
+	"strings"
 	"testing"
 
+	"github.com/Victorystick/scrapscript/internal/corpus"
 	"github.com/Victorystick/scrapscript/token"
 )
 
@@ -67,6 +69,9 @@ var elements = []elt{
 	{token.LPIPE, "<|", operator},
 	{token.RPIPE, "|>", operator},
 
+	{token.RCOMP, ">>", operator},
+	{token.LCOMP, "<<", operator},
+
 	{token.LT, "<", operator},
 	{token.GT, ">", operator},
 
@@ -170,3 +175,85 @@ func TestScanExample(t *testing.T) {
 		}
 	}
 }
+
+func TestScanWindowsInput(t *testing.T) {
+	src := []byte("\uFEFFf 1\r\n; f = a ->\r\n  a + 1\r\n\x00\x00")
+	source := token.NewSource(src)
+
+	var s Scanner
+	s.Init(&source, TestingErrorHandler(t))
+
+	var lits []string
+	for {
+		tok, span := s.Scan()
+		if tok == token.EOF {
+			if span.Start != len(src)-2 {
+				t.Errorf("expected EOF before the NULs, at %d, got %d", len(src)-2, span.Start)
+			}
+			break
+		}
+		lits = append(lits, source.GetString(span))
+	}
+	if got := strings.Join(lits, " "); got != "f 1 ; f = a -> a + 1" {
+		t.Errorf("unexpected tokens %q", got)
+	}
+
+	// Positions are of the original bytes, but lines don't
+	// include the byte order mark, \r or NULs.
+	err := source.Error(token.Span{Start: 3, End: 4}, "f")
+	if err.Pos != (token.Position{Line: 1, Column: 1}) || err.Line != "f 1" {
+		t.Errorf("unexpected position %v of line %q", err.Pos, err.Line)
+	}
+	for line, want := range []string{"f 1", "; f = a ->", "  a + 1", ""} {
+		if got := source.GetLine(line + 1); got != want {
+			t.Errorf("expected line %d to be %q, got %q", line+1, want, got)
+		}
+	}
+}
+
+func TestScanMisplacedByteOrderMark(t *testing.T) {
+	source := token.NewSource([]byte("1 \uFEFF"))
+
+	var s Scanner
+	var errs Errors
+	s.Init(&source, errs.Add)
+	for tok := token.BAD; tok != token.EOF; tok, _ = s.Scan() {
+	}
+	if len(errs) != 1 || errs[0].Msg != "illegal byte order mark" {
+		t.Errorf("expected an illegal byte order mark, got %v", errs)
+	}
+}
+
+// A generated scrap of about 1MB.
+func bigScrap() []byte {
+	return corpus.Generate(corpus.Shape{Bindings: 35_000, Depth: 8}).Main
+}
+
+func scanAll(src []byte) {
+	source := token.NewSource(src)
+	var s Scanner
+	s.Init(&source, nil)
+	for tok, _ := s.Scan(); tok != token.EOF; tok, _ = s.Scan() {
+	}
+}
+
+func TestScanAllocations(t *testing.T) {
+	small := corpus.Generate(corpus.Shape{Bindings: 10, Depth: 8}).Main
+	big := bigScrap()
+	// Only the Source and its table of line breaks are allocated, rather
+	// than anything per token or line, so scanning more doesn't allocate
+	// more often; however often the Source is allocated in this build.
+	base := testing.AllocsPerRun(10, func() { scanAll(small) })
+	if allocs := testing.AllocsPerRun(10, func() { scanAll(big) }); allocs > base {
+		t.Errorf("Expected scanning %d bytes to allocate as often as scanning %d, %.0f times, got %.0f", len(big), len(small), base, allocs)
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	src := bigScrap()
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		scanAll(src)
+	}
+}
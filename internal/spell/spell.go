@@ -0,0 +1,56 @@
+// Package spell suggests names for misspelled ones, like `length` for
+// `lenght`, for errors about unknown names to offer.
+package spell
+
+// Suggest returns the candidate most like name, if any is close enough
+// to be what was meant by it; or else the empty string. Candidates are
+// compared by how many characters must be inserted, deleted, changed or
+// swapped with their neighbours to turn one into the other, and only
+// those off by at most a third of the length of name are suggested.
+// Of equally close candidates, the first is suggested.
+func Suggest(name string, candidates []string) string {
+	best, bestDist := "", max(len(name)/3, 1)+1
+	for _, c := range candidates {
+		if c == name {
+			continue
+		}
+		if d := distance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	// Names of one or two characters are easy to confuse with anything.
+	if bestDist >= len(name) {
+		return ""
+	}
+	return best
+}
+
+// distance returns the optimal string alignment distance between a and
+// b; the edit distance where adjacent characters may also be swapped.
+func distance(a, b string) int {
+	x, y := []rune(a), []rune(b)
+	// Three rows of the matrix; before the previous, previous and current.
+	rows := [3][]int{}
+	for i := range rows {
+		rows[i] = make([]int, len(y)+1)
+	}
+	for j := range rows[1] {
+		rows[1][j] = j
+	}
+	for i := 1; i <= len(x); i++ {
+		pp, prev, cur := rows[0], rows[1], rows[2]
+		cur[0] = i
+		for j := 1; j <= len(y); j++ {
+			cost := 1
+			if x[i-1] == y[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && x[i-1] == y[j-2] && x[i-2] == y[j-1] {
+				cur[j] = min(cur[j], pp[j-2]+1)
+			}
+		}
+		rows[0], rows[1], rows[2] = prev, cur, pp
+	}
+	return rows[1][len(y)]
+}
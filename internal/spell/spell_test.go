@@ -0,0 +1,50 @@
+package spell
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		dist int
+	}{
+		{"", "", 0},
+		{"a", "", 1},
+		{"", "abc", 3},
+		{"length", "length", 0},
+		{"lenght", "length", 1},
+		{"lft", "left", 1},
+		{"kitten", "sitting", 3},
+		{"ca", "abc", 3},
+		{"åäö", "åöä", 1},
+	}
+	for _, test := range tests {
+		if got := distance(test.a, test.b); got != test.dist {
+			t.Errorf("distance(%q, %q) = %d, expected %d", test.a, test.b, got, test.dist)
+		}
+		if got := distance(test.b, test.a); got != test.dist {
+			t.Errorf("distance(%q, %q) = %d, expected %d", test.b, test.a, got, test.dist)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	names := []string{"left", "right", "length", "list/map", "x"}
+	tests := []struct{ name, suggestion string }{
+		{"lenght", "length"},
+		{"lft", "left"},
+		{"rihgt", "right"},
+		{"list/mpa", "list/map"},
+		// Too different.
+		{"width", ""},
+		{"lengthy-names", ""},
+		// Too short to tell.
+		{"y", ""},
+		// Not misspelled.
+		{"left", ""},
+	}
+	for _, test := range tests {
+		if got := Suggest(test.name, names); got != test.suggestion {
+			t.Errorf("Suggest(%q) = %q, expected %q", test.name, got, test.suggestion)
+		}
+	}
+}
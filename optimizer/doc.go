@@ -0,0 +1,4 @@
+// Package optimizer simplifies scrapscript syntax trees before they're
+// evaluated, by folding constant expressions and eliminating where-bindings
+// that are never used.
+package optimizer
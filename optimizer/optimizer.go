@@ -0,0 +1,198 @@
+package optimizer
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/eval"
+	"github.com/Victorystick/scrapscript/printer"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// The operators of constants that are folded.
+var foldable = []token.Token{
+	token.ADD, token.SUB, token.MUL,
+	token.CONCAT, token.APPEND, token.PREPEND,
+}
+
+// The fuel folding each constant expression may use; see
+// eval.Environment.UseFuel. Expressions that need more aren't folded.
+const foldFuel = 10_000
+
+// Optimize returns the source of a scrap simplified, keeping its header:
+//
+//   - Where-bindings that are never used are eliminated.
+//   - Arithmetic and concatenation of constants, like `1 + 2` or
+//     `[1] ++ [2]`, are folded to their values. Constants are literals,
+//     and lists and records of constants.
+//   - Records spread from constant records, and keys accessed of them,
+//     are folded too.
+//
+// Constant expressions are only folded if they are well-typed and
+// evaluate, so that the scrap fails as before if they don't. Eliminated
+// bindings aren't checked though, so scraps whose unused bindings are
+// ill-typed type-check once optimized.
+func Optimize(se ast.SourceExpr) ([]byte, error) {
+	x := eliminate(&se.Source, se.Expr)
+
+	f := folder{
+		source:       &se.Source,
+		env:          eval.NewEnvironment(),
+		replacements: make(map[token.Span]string),
+	}
+	f.env.UseFuel(foldFuel)
+	f.fold(x)
+
+	var b bytes.Buffer
+	// Keep the header, with any shebang and pragmas, as is.
+	if header := se.Header.Pos; header.Len() > 0 {
+		b.WriteString(se.Source.GetString(header))
+		b.WriteString("\n")
+	}
+	config := printer.Config{Replacements: f.replacements}
+	if err := config.Fprint(&b, se.Source.Bytes(), x); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// eliminate returns x without the where-bindings that are never used.
+// Eliminating one may leave others unused, which are eliminated too.
+func eliminate(source *token.Source, x ast.Expr) ast.Expr {
+	rec := func(x ast.Expr) ast.Expr {
+		if x == nil {
+			return nil
+		}
+		return eliminate(source, x)
+	}
+
+	switch x := x.(type) {
+	case *ast.WhereExpr:
+		expr := rec(x.Expr)
+		if !slices.Contains(ast.FreeVars(source, expr), source.GetString(x.Id.Pos)) {
+			return expr
+		}
+		return &ast.WhereExpr{Expr: expr, Id: x.Id, Typ: x.Typ, Val: rec(x.Val)}
+	case *ast.BinaryExpr:
+		return &ast.BinaryExpr{Left: rec(x.Left), Op: x.Op, Right: rec(x.Right)}
+	case *ast.FuncExpr:
+		return &ast.FuncExpr{Arg: x.Arg, Body: rec(x.Body)}
+	case ast.MatchFuncExpr:
+		fns := make(ast.MatchFuncExpr, len(x))
+		for i, fn := range x {
+			fns[i] = rec(fn).(*ast.FuncExpr)
+		}
+		return fns
+	case *ast.CallExpr:
+		return &ast.CallExpr{Fn: rec(x.Fn), Arg: rec(x.Arg)}
+	case *ast.RecordExpr:
+		if x.IsType() {
+			return x
+		}
+		entries := slices.Clone(x.Entries)
+		for i := range entries {
+			entries[i].Val = rec(entries[i].Val)
+		}
+		return &ast.RecordExpr{Pos: x.Pos, Entries: entries, Rest: rec(x.Rest)}
+	case *ast.AccessExpr:
+		return &ast.AccessExpr{Pos: x.Pos, Rec: rec(x.Rec), Key: x.Key}
+	case *ast.ListExpr:
+		elements := make([]ast.Expr, len(x.Elements))
+		for i, el := range x.Elements {
+			elements[i] = rec(el)
+		}
+		return &ast.ListExpr{Pos: x.Pos, Elements: elements}
+	}
+	// Identifiers, literals, imports, variants and enums.
+	return x
+}
+
+// A folder folds the constant expressions of a scrap.
+type folder struct {
+	source *token.Source
+	// Evaluates constant expressions.
+	env *eval.Environment
+	// The values that constant expressions are folded to, by their spans.
+	replacements map[token.Span]string
+}
+
+// fold folds the constant expressions of x, and reports whether x is a
+// constant itself.
+func (f *folder) fold(x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.Literal:
+		return true
+	case *ast.ListExpr:
+		constant := true
+		for _, el := range x.Elements {
+			constant = f.fold(el) && constant
+		}
+		return constant
+	case *ast.RecordExpr:
+		if x.IsType() {
+			return false
+		}
+		constant := x.Rest == nil || f.fold(x.Rest)
+		for _, e := range x.Entries {
+			constant = (e.Val == nil || !e.Pun && f.fold(e.Val)) && constant
+		}
+		if constant && x.Rest != nil {
+			return f.evaluate(x)
+		}
+		return constant
+	case *ast.AccessExpr:
+		return f.fold(x.Rec) && f.evaluate(x)
+	case *ast.BinaryExpr:
+		if x.Op == token.PICK {
+			return false
+		}
+		left, right := f.fold(x.Left), f.fold(x.Right)
+		return left && right && slices.Contains(foldable, x.Op) && f.evaluate(x)
+	case *ast.FuncExpr:
+		// Patterns aren't expressions.
+		f.fold(x.Body)
+	case ast.MatchFuncExpr:
+		for _, fn := range x {
+			f.fold(fn.Body)
+		}
+	case *ast.CallExpr:
+		f.fold(x.Fn)
+		f.fold(x.Arg)
+	case *ast.WhereExpr:
+		f.fold(x.Expr)
+		if x.Val != nil {
+			f.fold(x.Val)
+		}
+	}
+	// Identifiers, imports, variants and enums.
+	return false
+}
+
+// evaluate folds the constant expression x to its value, and reports
+// whether it could; which it can't if it's ill-typed, fails to evaluate
+// or its value can't be written as scrapscript.
+func (f *folder) evaluate(x ast.Expr) bool {
+	var b bytes.Buffer
+	config := printer.Config{Replacements: f.replacements}
+	if err := config.Fprint(&b, f.source.Bytes(), x); err != nil {
+		return false
+	}
+	scrap, err := f.env.Read(b.Bytes())
+	if err != nil {
+		return false
+	}
+	if _, err := f.env.Infer(scrap); err != nil {
+		return false
+	}
+	val, err := f.env.Eval(scrap)
+	if err != nil {
+		return false
+	}
+	text, err := f.env.EmitScrap(val)
+	if err != nil {
+		return false
+	}
+	f.replacements[x.Span()] = text
+	return true
+}
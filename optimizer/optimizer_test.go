@@ -0,0 +1,61 @@
+package optimizer
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+func TestOptimize(t *testing.T) {
+	examples := []struct{ source, expected string }{
+		// Arithmetic and concatenation of constants.
+		{`1 + 2 * 3`, `7`},
+		{`1.5 * 2.0`, `3.0`},
+		{`"a" ++ "b"`, `"ab"`},
+		{`[1, 2] ++ [3 + 4]`, `[ 1, 2, 7 ]`},
+		{`[1] +< 2`, `[ 1, 2 ]`},
+		{`f (1 - 2) ; f = x -> x`, "f (-1)\n; f = x -> x"},
+		{`x -> x + (1 + 1)`, `x -> x + 2`},
+		{`| 1 -> 2 + 2 | n -> n`, "\n| 1 -> 4\n| n -> n"},
+		// Records spread from constants, and their keys.
+		{`{ ..{ a = 1, b = 2 }, a = 3 }`, `{ a = 3, b = 2 }`},
+		{`{ a = 1 + 1, b = "c" }.a`, `2`},
+		{`{ a = 1 + 1, b }`, `{ a = 2, b }`},
+		// Not constants.
+		{`x + 1 ; x = 1`, "x + 1\n; x = 1"},
+		{`1 + "a"`, `1 + "a"`},
+		{`$sha256~~aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa + 1`, `$sha256~~aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa + 1`},
+		// Unused where-bindings.
+		{`a ; a = 1 ; b = c ; c = 2`, "a\n; a = 1"},
+		{`f 1 ; f = x -> y ; y = 1 ; z = 2`, "f 1\n; f = x -> y\n; y = 1"},
+		{`t::a ; t : #a #b`, "t::a\n; t : #a #b"},
+		{`| x -> x ; x = 1`, "\n| x -> x"},
+	}
+
+	for _, ex := range examples {
+		src := token.NewSource([]byte(ex.source))
+		se, err := parser.Parse(&src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := Optimize(se)
+		if err != nil || string(out) != ex.expected {
+			t.Errorf("%s: expected:\n%s\ngot:\n%s, %v", ex.source, ex.expected, out, err)
+		}
+	}
+}
+
+func TestOptimizeKeepsHeader(t *testing.T) {
+	source := "#!/usr/bin/env -S scrap eval\n-- scrap:version 0.2\n1 + 1"
+	src := token.NewSource([]byte(source))
+	se, err := parser.Parse(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Optimize(se)
+	expected := "#!/usr/bin/env -S scrap eval\n-- scrap:version 0.2\n2"
+	if err != nil || string(out) != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s, %v", expected, out, err)
+	}
+}
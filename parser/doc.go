@@ -0,0 +1,4 @@
+// Package parser parses scrapscript sources into syntax trees.
+//
+// Parse errors are returned as Errors, listing every error found.
+package parser
@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/internal/corpus"
+	"github.com/Victorystick/scrapscript/token"
+)
+
+// FuzzParse checks that the parser reports errors, rather than
+// panicking, for any input; starting from generated scraps.
+func FuzzParse(f *testing.F) {
+	for seed := range uint64(4) {
+		c := corpus.Generate(corpus.Shape{Bindings: 8, Depth: int(seed), Imports: 2, Seed: seed})
+		f.Add(c.Main)
+		for _, lib := range c.Imports {
+			f.Add(lib)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, script []byte) {
+		src := token.NewSource(script)
+		Parse(&src)
+	})
+}
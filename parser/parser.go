@@ -3,12 +3,16 @@ package parser
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/Victorystick/scrapscript/ast"
-	"github.com/Victorystick/scrapscript/scanner"
+	"github.com/Victorystick/scrapscript/internal/scanner"
 	"github.com/Victorystick/scrapscript/token"
 )
 
+// Errors lists all errors found when parsing a source.
+type Errors = scanner.Errors
+
 type parser struct {
 	source  *token.Source
 	scanner scanner.Scanner
@@ -17,10 +21,23 @@ type parser struct {
 	span token.Span
 
 	errors scanner.Errors
+
+	// Common nodes are allocated in blocks, and the elements of lists
+	// collected in a shared buffer, to allocate less for big scraps.
+	idents   block[ast.Ident]
+	literals block[ast.Literal]
+	calls    block[ast.CallExpr]
+	binaries block[ast.BinaryExpr]
+	lists    block[ast.ListExpr]
+	elements block[ast.Expr]
+	exprs    []ast.Expr
+
+	stack []string // for debugging
 }
 
-var debug = true
-var stack []string
+// Whether to print the parser's stack to stderr on errors.
+// Must be off for tools that read stderr, like `scrap -json`.
+var debug = false
 
 func (p *parser) next() {
 	p.tok, p.span = p.scanner.Scan()
@@ -38,7 +55,7 @@ func (p *parser) unexpected() {
 
 func (p *parser) bail(msg string) {
 	if debug {
-		fmt.Fprintln(os.Stderr, stack)
+		fmt.Fprintln(os.Stderr, p.stack)
 	}
 	panic(p.source.Error(p.span, msg))
 }
@@ -48,6 +65,8 @@ func ParseExpr(source string) (ast.SourceExpr, error) {
 	return Parse(&src)
 }
 
+// Parse parses a source into a SourceExpr. On errors, the SourceExpr
+// still has the Header of the source.
 func Parse(source *token.Source) (se ast.SourceExpr, err error) {
 	var p parser
 
@@ -60,7 +79,7 @@ func Parse(source *token.Source) (se ast.SourceExpr, err error) {
 			// resume same panic if it's not a token.Error.
 			e, ok := pnc.(token.Error)
 			if !ok {
-				panic(e)
+				panic(pnc)
 			} else if e.Msg != "" {
 				p.errors.Add(e)
 			}
@@ -72,6 +91,9 @@ func Parse(source *token.Source) (se ast.SourceExpr, err error) {
 	p.scanner.Init(p.source, eh)
 
 	p.next()
+	// Set before parsing, so that tools can check the pragmas
+	// of scraps that fail to parse.
+	se.Header = p.header()
 	expr := p.parseExpr()
 	if debug && p.tok != token.EOF {
 		fmt.Fprintf(os.Stderr, "%#v\n", expr)
@@ -79,22 +101,51 @@ func Parse(source *token.Source) (se ast.SourceExpr, err error) {
 	}
 	p.expect(token.EOF)
 
-	se = ast.SourceExpr{Source: *p.source, Expr: expr}
+	se.Source, se.Expr = *p.source, expr
+	return
+}
+
+// header parses the header the scanner skipped.
+func (p *parser) header() (h ast.Header) {
+	lines := p.scanner.Header()
+	if len(lines) > 0 {
+		h.Pos = lines[0].Union(lines[len(lines)-1])
+	}
+	for _, span := range lines {
+		line := p.source.GetString(span)
+		if shebang, ok := strings.CutPrefix(line, "#!"); ok {
+			h.Shebang = shebang
+		} else if pragma, ok := strings.CutPrefix(line, "-- scrap:"); ok {
+			name, value, _ := strings.Cut(strings.TrimSpace(pragma), " ")
+			h.Pragmas = append(h.Pragmas, ast.Pragma{Pos: span, Name: name, Value: strings.TrimSpace(value)})
+		}
+	}
 	return
 }
 
 func (p *parser) parseExpr() ast.Expr {
 	if debug {
-		stack = append(stack, "parseExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	expr := p.parsePlainExpr(token.BasePrec)
-	i := 0
 
+	// Names bound by this where-chain. A parenthesized
+	// expression starts a new chain, and may shadow them.
+	var bound map[string]bool
 	for p.tok == token.WHERE {
-		i += 1
 		p.next()
-		expr = p.parseWhereExpr(expr)
+		where := p.parseWhereExpr(expr)
+		if name := p.source.GetString(where.Id.Pos); bound[name] {
+			p.errors.Add(p.source.Error(where.Id.Pos, fmt.Sprintf(
+				"%s is already bound in this where-chain; use parentheses to shadow it", name)))
+		} else if name != "_" {
+			if bound == nil {
+				bound = make(map[string]bool)
+			}
+			bound[name] = true
+		}
+		expr = where
 	}
 
 	return expr
@@ -102,31 +153,32 @@ func (p *parser) parseExpr() ast.Expr {
 
 func (p *parser) parsePlainExpr(prec int) ast.Expr {
 	if debug {
-		stack = append(stack, "parsePlainExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parsePlainExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	left := p.parseBinaryExpr(nil, prec)
 
 	for {
 		if p.tok == token.LPAREN {
-			right := p.parseParenExpr()
-			left = &ast.CallExpr{
+			right := p.parseAccess(p.parseParenExpr())
+			left = p.calls.new(ast.CallExpr{
 				Fn:  left,
 				Arg: right,
-			}
-		} else if p.tok.IsOperator() && p.tok.Precedence() > prec {
-			op := p.tok
-			val := p.parseBinaryExpr(left, op.Precedence())
-			if left == val {
+			})
+		} else if p.tok.IsOperator() && p.tok.Precedence() >= max(prec, token.BasePrec+1) {
+			// Operators at BasePrec, like |, and punctuation end the expression.
+			op, at := p.tok, p.span
+			left = p.parseBinaryExpr(left, op.Precedence())
+			if p.span == at {
 				// Break if parse binary can't parse more.
 				break
 			}
-			left = val
-		} else if p.tok != token.EOF && (!p.tok.IsOperator() || startsSimpleValue(p.tok)) && token.CallPrec > prec {
-			left = &ast.CallExpr{
+		} else if p.tok != token.EOF && (!p.tok.IsOperator() || startsSimpleValue(p.tok)) && token.CallPrec >= prec {
+			// Only operators binding tighter than calls are part of the argument.
+			left = p.calls.new(ast.CallExpr{
 				Fn:  left,
-				Arg: p.parseBinaryExpr(nil, token.CallPrec-1),
-			}
+				Arg: p.parseBinaryExpr(nil, token.CallPrec+1),
+			})
 		} else {
 			break
 		}
@@ -145,9 +197,9 @@ func (p *parser) parseParenExpr() ast.Expr {
 
 func (p *parser) ident() *ast.Ident {
 	p.expect(token.IDENT)
-	ident := &ast.Ident{
+	ident := p.idents.new(ast.Ident{
 		Pos: p.span,
-	}
+	})
 	p.next()
 	return ident
 }
@@ -175,18 +227,18 @@ func startsSimpleValue(tok token.Token) bool {
 
 func (p *parser) parseUnaryExpr() ast.Expr {
 	if debug {
-		stack = append(stack, "parseUnaryExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseUnaryExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	switch p.tok {
 	case token.IDENT:
 		return p.ident()
 	case token.INT, token.FLOAT, token.HOLE,
 		token.TEXT, token.BYTE, token.BYTES:
-		lit := &ast.Literal{
+		lit := p.literals.new(ast.Literal{
 			Pos:  p.span,
 			Kind: p.tok,
-		}
+		})
 		p.next()
 		return lit
 
@@ -215,11 +267,11 @@ func (p *parser) parseUnaryExpr() ast.Expr {
 
 func (p *parser) parseBinaryExpr(x ast.Expr, prec int) ast.Expr {
 	if debug {
-		stack = append(stack, "parseBinaryExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseBinaryExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	if x == nil {
-		x = p.parseUnaryExpr()
+		x = p.parseAccess(p.parseUnaryExpr())
 	}
 
 	if p.tok.IsOperator() && p.tok.Precedence() < prec {
@@ -234,11 +286,12 @@ func (p *parser) parseBinaryExpr(x ast.Expr, prec int) ast.Expr {
 		token.CONCAT, token.APPEND, token.PREPEND:
 		op := p.tok
 		p.next()
-		return &ast.BinaryExpr{
+		_, prec := op.OperandPrecedences()
+		return p.binaries.new(ast.BinaryExpr{
 			Left:  x,
 			Op:    op,
-			Right: p.parsePlainExpr(op.Precedence()),
-		}
+			Right: p.parsePlainExpr(prec),
+		})
 
 	case token.PICK:
 		op := p.tok
@@ -249,27 +302,33 @@ func (p *parser) parseBinaryExpr(x ast.Expr, prec int) ast.Expr {
 			Right: p.ident(),
 		}
 
-	case token.ACCESS:
+	case token.ARROW:
+		p.next()
+		return p.parseFuncExpr(x)
+	}
+
+	return x
+}
+
+// parseAccess parses any accesses of x, like `x.a.b`. Access binds
+// tighter than any other operator, so `f x.a` calls f with `x.a`.
+func (p *parser) parseAccess(x ast.Expr) ast.Expr {
+	for p.tok == token.ACCESS {
 		span := p.span
 		p.next()
-		return &ast.AccessExpr{
+		x = &ast.AccessExpr{
 			Pos: span,
 			Rec: x,
 			Key: *p.ident(),
 		}
-
-	case token.ARROW:
-		p.next()
-		return p.parseFuncExpr(x)
 	}
-
 	return x
 }
 
-func (p *parser) parseWhereExpr(x ast.Expr) ast.Expr {
+func (p *parser) parseWhereExpr(x ast.Expr) *ast.WhereExpr {
 	if debug {
-		stack = append(stack, "parseWhereExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseWhereExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 
 	where := &ast.WhereExpr{
@@ -296,8 +355,10 @@ func (p *parser) parseType() ast.Expr {
 		return p.parseEnum()
 	}
 
+	// Types may be applied to others, like `list int`, and so are parsed
+	// like calls; as are functions of them, like `list int -> int`.
 	// TODO: only allow a subset of expressions here.
-	return p.parseBinaryExpr(nil, token.BasePrec)
+	return p.parsePlainExpr(token.BasePrec)
 }
 
 func (p *parser) parseRecord() *ast.RecordExpr {
@@ -314,7 +375,9 @@ func (p *parser) parseRecord() *ast.RecordExpr {
 		p.next()
 	}
 
-	entries := make(map[string]ast.Expr)
+	var entries []ast.RecordEntry
+	// The span of each key, to report duplicates.
+	keys := make(map[string]token.Span)
 	for {
 		if p.tok == token.RBRACE {
 			break
@@ -325,14 +388,56 @@ func (p *parser) parseRecord() *ast.RecordExpr {
 			p.bail("A spread must be first in a record.")
 		}
 
-		name := p.name()
+		// Keys not in the spread record are added with `+key = val`,
+		// and keys in it are dropped with `-key`.
+		extend, drop := p.tok == token.ADD, p.tok == token.SUB
+		if drop {
+			if rest == nil {
+				p.bail("Only keys of a record spread can be dropped.")
+			}
+			p.next()
+			key := p.ident()
+			entries = append(entries, ast.RecordEntry{Key: *key, Drop: true})
+			if p.tok != token.COMMA {
+				break
+			}
+			p.next()
+			continue
+		}
+		if extend {
+			if rest == nil {
+				p.bail("Only a record with a spread can be extended with new keys.")
+			}
+			p.next()
+		}
 
-		p.expect(token.ASSIGN)
-		p.next()
+		key := p.ident()
+		name := p.source.GetString(key.Pos)
+		if first, ok := keys[name]; ok {
+			p.errors.Add(p.source.Error(key.Pos, fmt.Sprintf("duplicate key %s in record", name)))
+			p.errors.Add(p.source.Error(first, fmt.Sprintf("%s is first set here", name)))
+		} else {
+			keys[name] = key.Pos
+		}
 
-		x := p.parseExpr()
+		// Record types give the types of their keys, like `{ a : int }`.
+		typed := p.tok == token.DEFINE && rest == nil
+		if len(entries) > 0 && entries[0].Type != typed {
+			p.bail("A record must give either types or values of all its keys.")
+		}
 
-		entries[name] = x
+		switch {
+		case typed:
+			p.next()
+			entries = append(entries, ast.RecordEntry{Key: *key, Val: p.parseType(), Type: true})
+		case p.tok == token.COMMA || p.tok == token.RBRACE:
+			// Keys are punned, so `{ key }` is short for `{ key = key }`.
+			entries = append(entries, ast.RecordEntry{Key: *key, Val: &ast.Ident{Pos: key.Pos}, Extend: extend, Pun: true})
+		default:
+			p.expect(token.ASSIGN)
+			p.next()
+			entries = append(entries, ast.RecordEntry{Key: *key, Val: p.parseExpr(), Extend: extend})
+		}
 
 		if p.tok != token.COMMA {
 			break
@@ -353,37 +458,43 @@ func (p *parser) parseRecord() *ast.RecordExpr {
 
 func (p *parser) parseList() *ast.ListExpr {
 	if debug {
-		stack = append(stack, "parseList")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseList")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	p.expect(token.LBRACK)
 	start := p.span.Start
 	p.next()
 
-	es := make([]ast.Expr, 0)
+	// Elements are collected in the buffer, after those of any lists
+	// they are in, and copied out once all are parsed.
+	mark := len(p.exprs)
 	for {
 		if p.tok == token.RBRACK {
 			break
 		}
-		es = append(es, p.parseExpr())
+		x := p.parseExpr()
+		p.exprs = append(p.exprs, x)
 
 		if p.tok != token.COMMA {
 			break
 		}
 		p.next()
 	}
+	es := p.elements.slice(p.exprs[mark:])
+	clear(p.exprs[mark:])
+	p.exprs = p.exprs[:mark]
 
 	p.expect(token.RBRACK)
 	end := p.span.End
 	p.next()
 
-	return &ast.ListExpr{Pos: token.Span{Start: start, End: end}, Elements: es}
+	return p.lists.new(ast.ListExpr{Pos: token.Span{Start: start, End: end}, Elements: es})
 }
 
 func (p *parser) parseFuncExpr(x ast.Expr) *ast.FuncExpr {
 	if debug {
-		stack = append(stack, "parseFuncExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseFuncExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	return &ast.FuncExpr{
 		Arg:  x,
@@ -393,8 +504,8 @@ func (p *parser) parseFuncExpr(x ast.Expr) *ast.FuncExpr {
 
 func (p *parser) parseMatchFuncExpr() ast.Expr {
 	if debug {
-		stack = append(stack, "parseMatchFuncExpr")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseMatchFuncExpr")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	// We guess there'll be about 2 branches.
 	exprs := make(ast.MatchFuncExpr, 0, 2)
@@ -402,12 +513,7 @@ func (p *parser) parseMatchFuncExpr() ast.Expr {
 	for p.tok == token.PIPE {
 		p.next()
 
-		var arg ast.Expr
-		if p.tok == token.OPTION {
-			arg = p.parseVariant()
-		} else {
-			arg = p.parseBinaryExpr(nil, token.ARROW.Precedence()+1)
-		}
+		arg := p.parseOrPattern()
 		p.expect(token.ARROW)
 		p.next()
 
@@ -418,16 +524,40 @@ func (p *parser) parseMatchFuncExpr() ast.Expr {
 	return exprs
 }
 
+// Parses the pattern of an alternative, or several separated by |
+// that share its body, as right-nested binary expressions.
+func (p *parser) parseOrPattern() ast.Expr {
+	var arg ast.Expr
+	if p.tok == token.OPTION {
+		arg = p.parseVariant()
+	} else {
+		arg = p.parseBinaryExpr(nil, token.ARROW.Precedence()+1)
+	}
+	if p.tok != token.PIPE {
+		return arg
+	}
+	p.next()
+	return &ast.BinaryExpr{Left: arg, Op: token.PIPE, Right: p.parseOrPattern()}
+}
+
 func (p *parser) parseEnum() ast.EnumExpr {
 	if debug {
-		stack = append(stack, "parseEnum")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseEnum")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	// We guess there'll be about 2 branches.
 	exprs := make(ast.EnumExpr, 0, 2)
 
 	for p.tok == token.OPTION {
 		variant := p.parseVariant()
+		// Payloads may be applied, like the type `list int` in
+		// `#ok list int #none`.
+		for variant.Typ != nil && startsSimpleValue(p.tok) {
+			variant.Typ = p.calls.new(ast.CallExpr{
+				Fn:  variant.Typ,
+				Arg: p.parseBinaryExpr(nil, token.CallPrec+1),
+			})
+		}
 		exprs = append(exprs, variant)
 	}
 
@@ -436,8 +566,8 @@ func (p *parser) parseEnum() ast.EnumExpr {
 
 func (p *parser) parseVariant() *ast.VariantExpr {
 	if debug {
-		stack = append(stack, "parseVariant")
-		defer func() { stack = stack[:len(stack)-1] }()
+		p.stack = append(p.stack, "parseVariant")
+		defer func() { p.stack = p.stack[:len(p.stack)-1] }()
 	}
 	// Eat option.
 	p.next()
@@ -452,7 +582,8 @@ func (p *parser) parseVariant() *ast.VariantExpr {
 
 	var typ ast.Expr
 
-	if !p.tok.IsOperator() && p.tok != token.EOF {
+	// Payloads may be records or lists, like `#config { cpus = 2 }`.
+	if !p.tok.IsOperator() && p.tok != token.EOF || p.tok == token.LBRACE || p.tok == token.LBRACK {
 		typ = p.parseBinaryExpr(nil, token.ARROW.Precedence()+1)
 	} else if p.tok == token.LPAREN {
 		typ = p.parseParenExpr()
@@ -475,7 +606,14 @@ func (p *parser) parseImport() *ast.ImportExpr {
 	algo := p.source.GetString(p.span)
 	p.next()
 
-	p.expect(token.BYTES)
+	// Local imports are by name, like $local:utils.
+	kind := token.BYTES
+	if algo == "local" {
+		p.expect(token.DEFINE)
+		p.next()
+		kind = token.IDENT
+	}
+	p.expect(kind)
 	bytes := ast.Literal{
 		Pos:  p.span,
 		Kind: p.tok,
@@ -489,3 +627,31 @@ func (p *parser) parseImport() *ast.ImportExpr {
 		Value:    bytes,
 	}
 }
+
+// A block allocates values of a type in blocks, rather than one by one.
+// Values of a block are kept alive by any one of them.
+type block[T any] struct {
+	free []T
+	size int // Of the last block; doubled for each, up to maxBlockSize.
+}
+
+const maxBlockSize = 256
+
+// new returns a pointer to a copy of v.
+func (b *block[T]) new(v T) *T {
+	return &b.slice([]T{v})[0]
+}
+
+// slice returns a copy of vs, whose capacity is its length,
+// so that appending to it doesn't overwrite other values.
+func (b *block[T]) slice(vs []T) []T {
+	if len(b.free) < len(vs) {
+		b.size = min(max(2*b.size, 4), maxBlockSize)
+		b.free = make([]T, max(b.size, len(vs)))
+	}
+	n := len(vs)
+	s := b.free[:n:n]
+	copy(s, vs)
+	b.free = b.free[n:]
+	return s
+}
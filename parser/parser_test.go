@@ -2,12 +2,15 @@ package parser
 
 import (
 	"bytes"
+	"fmt"
+	"slices"
 	"strings"
 	"testing"
 
 	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/internal/corpus"
+	"github.com/Victorystick/scrapscript/internal/scanner"
 	"github.com/Victorystick/scrapscript/printer"
-	"github.com/Victorystick/scrapscript/scanner"
 	"github.com/Victorystick/scrapscript/token"
 )
 
@@ -91,6 +94,11 @@ func TestParseRecord(t *testing.T) {
 		`{ a = 1, b = "x"}`,
 		`{ ..other, a = 1, b = "x"}`,
 		`{ ..{ a = 2, c = 1 }, a = 1, b = "x"}`,
+		`{ ..base, +c = 1, a = 2 }`,
+		`{ ..base, -a, +c = 1 }`,
+		`{ a : int, b : text -> int }`,
+		`{ a, b }`,
+		`{ ..base, a, +c }`,
 	}
 
 	for _, src := range valid {
@@ -101,6 +109,255 @@ func TestParseRecord(t *testing.T) {
 	}
 }
 
+func TestParseRecordEntriesInOrder(t *testing.T) {
+	src := `{ b = 1, a = 2, c = 3 }`
+	se, err := ParseExpr(src)
+	if err != nil {
+		writeParseError(t, src, err)
+		return
+	}
+	var keys []string
+	for _, e := range se.Expr.(*ast.RecordExpr).Entries {
+		keys = append(keys, se.Source.GetString(e.Key.Pos))
+	}
+	if strings.Join(keys, " ") != "b a c" {
+		t.Errorf("Expected entries in source order, got %v", keys)
+	}
+}
+
+func TestParseRecordPuns(t *testing.T) {
+	for src, record := range map[string]func(ast.Expr) *ast.RecordExpr{
+		`{ a, b = c }`: func(x ast.Expr) *ast.RecordExpr { return x.(*ast.RecordExpr) },
+		`| { a, b = c } -> a`: func(x ast.Expr) *ast.RecordExpr {
+			return x.(ast.MatchFuncExpr)[0].Arg.(*ast.RecordExpr)
+		},
+	} {
+		se, err := ParseExpr(src)
+		if err != nil {
+			writeParseError(t, src, err)
+			continue
+		}
+		entries := record(se.Expr).Entries
+		// A punned key refers to a name with the same span.
+		if id, ok := entries[0].Val.(*ast.Ident); !entries[0].Pun || !ok || id.Pos != entries[0].Key.Pos {
+			t.Errorf("%s: expected a to be punned, got %#v", src, entries[0])
+		}
+		if entries[1].Pun {
+			t.Errorf("%s: expected b not to be punned", src)
+		}
+	}
+}
+
+func TestParseRecordDuplicateKeys(t *testing.T) {
+	_, err := ParseExpr(`{ a = 1, b = 2, a = 3 }`)
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("Expected two errors, got: %v", err)
+	}
+	// Both occurrences are reported.
+	if errs[0].Pos.Column != 17 || !strings.Contains(errs[0].Msg, "duplicate key a") {
+		t.Errorf("Expected the duplicate key to be reported, got: %s", errs[0])
+	}
+	if errs[1].Pos.Column != 3 || !strings.Contains(errs[1].Msg, "a is first set here") {
+		t.Errorf("Expected the first key to be reported, got: %s", errs[1])
+	}
+}
+
+func TestParseAccess(t *testing.T) {
+	examples := []struct{ source, shape string }{
+		{`foo.a`, `foo.a`},
+		{`foo.a.b`, `(foo.a).b`},
+		{`(f x).a`, `(f x).a`},
+		{`f r.a.b`, `f ((r.a).b)`},
+		{`f (x).a y`, `(f (x.a)) y`},
+		{`f x.a + y.b`, `(f (x.a)) + (y.b)`},
+		{`x.a::b`, `(x.a)::b`},
+		{`t::a x.b`, `(t::a) (x.b)`},
+		{`{ a = { b = 1 } }.a.b`, `({ ... }.a).b`},
+		{`| r -> r.a.b`, `| r -> ((r.a).b)`},
+		{`| x.a -> 1`, `| (x.a) -> 1`},
+	}
+
+	for _, ex := range examples {
+		se, err := ParseExpr(ex.source)
+		if err != nil {
+			writeParseError(t, ex.source, err)
+			continue
+		}
+		if got := shape(ex.source, se.Expr); got != ex.shape {
+			t.Errorf("ParseExpr(%q): got %s, want %s", ex.source, got, ex.shape)
+		}
+	}
+
+	se, err := ParseExpr(`f foo.a.b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	access := se.Expr.(*ast.CallExpr).Arg
+	if span := access.Span(); span.Start != 2 || span.End != 9 {
+		t.Errorf("Expected the access to span foo.a.b, got %v", span)
+	}
+}
+
+// The precedences of binary operators in the reference implementation at
+// https://scrapscript.org, where function application is written "".
+var referencePrecedences = map[string]float64{
+	"":   1000,
+	">>": 14, "<<": 14,
+	"*": 12,
+	"+": 11, "-": 11,
+	"++": 10, "+<": 10, ">+": 10,
+	"<": 9, ">": 9,
+	"|>": 6, "<|": 6,
+}
+
+// TestPrecedenceMatrix parses every pair of binary operators of different
+// precedence, and compares the result with the reference implementation.
+func TestPrecedenceMatrix(t *testing.T) {
+	for a, aPrec := range referencePrecedences {
+		for b, bPrec := range referencePrecedences {
+			if aPrec == bPrec {
+				continue
+			}
+			src := fmt.Sprintf("x %s y %s z", a, b)
+			want := fmt.Sprintf("x %s (y %s z)", a, b)
+			if aPrec > bPrec {
+				want = fmt.Sprintf("(x %s y) %s z", a, b)
+			}
+			// Function application has no operator.
+			src = strings.ReplaceAll(src, "  ", " ")
+			want = strings.ReplaceAll(want, "  ", " ")
+
+			se, err := ParseExpr(src)
+			if err != nil {
+				writeParseError(t, src, err)
+				continue
+			}
+			if got := shape(src, se.Expr); got != want {
+				t.Errorf("ParseExpr(%q): got %s, want %s", src, got, want)
+			}
+		}
+	}
+}
+
+// TestAssociativity parses chains of binary operators of the same
+// precedence, which are grouped by their associativity.
+func TestAssociativity(t *testing.T) {
+	for prec, ops := range token.Precedences {
+		if prec <= token.BasePrec || prec >= token.CallPrec {
+			continue
+		}
+		for _, a := range ops {
+			for _, b := range ops {
+				src := fmt.Sprintf("x %s y %s z", a.Op(), b.Op())
+				want := fmt.Sprintf("(x %s y) %s z", a.Op(), b.Op())
+				if a.Associativity() == token.RightAssoc {
+					want = fmt.Sprintf("x %s (y %s z)", a.Op(), b.Op())
+				}
+				if a == token.ARROW {
+					want = "x -> (y -> z)"
+				}
+
+				se, err := ParseExpr(src)
+				if err != nil {
+					writeParseError(t, src, err)
+					continue
+				}
+				if got := shape(src, se.Expr); got != want {
+					t.Errorf("ParseExpr(%q): got %s, want %s", src, got, want)
+				}
+			}
+		}
+	}
+
+	examples := []struct{ source, shape string }{
+		{`a - b - c`, `(a - b) - c`},
+		{`a - b + c`, `(a - b) + c`},
+		{`a - b * c * d`, `a - ((b * c) * d)`},
+		{`x |> f |> g`, `(x |> f) |> g`},
+		{`f <| g <| x`, `f <| (g <| x)`},
+		{`a >+ b >+ c`, `a >+ (b >+ c)`},
+		{`a +< b +< c`, `(a +< b) +< c`},
+		{`a ++ b ++ c`, `a ++ (b ++ c)`},
+		{`f >> g >> h`, `(f >> g) >> h`},
+		// Operators associating differently bind differently tightly.
+		{`x |> f <| y`, `(x |> f) <| y`},
+		{`f <| x |> g`, `f <| (x |> g)`},
+		{`a >+ b +< c`, `a >+ (b +< c)`},
+		{`a +< b ++ c`, `(a +< b) ++ c`},
+		{`a ++ b +< c`, `a ++ (b +< c)`},
+	}
+
+	for _, ex := range examples {
+		se, err := ParseExpr(ex.source)
+		if err != nil {
+			writeParseError(t, ex.source, err)
+			continue
+		}
+		if got := shape(ex.source, se.Expr); got != ex.shape {
+			t.Errorf("ParseExpr(%q): got %s, want %s", ex.source, got, ex.shape)
+		}
+	}
+}
+
+func TestPrecedences(t *testing.T) {
+	for prec, ops := range token.Precedences {
+		for _, op := range ops {
+			if op.Precedence() != prec {
+				t.Errorf("%s has precedence %d, but is listed at %d", op, op.Precedence(), prec)
+			}
+			// Chains of operators of the same precedence group one way.
+			if op.Associativity() != ops[0].Associativity() {
+				t.Errorf("%s associates differently from %s at precedence %d", op, ops[0], prec)
+			}
+		}
+	}
+	if !slices.Contains(token.Precedences[token.WherePrec], token.WHERE) {
+		t.Errorf("expected WHERE at WherePrec")
+	}
+	if len(token.Precedences[token.CallPrec]) != 0 {
+		t.Errorf("expected no operators at CallPrec, got %v", token.Precedences[token.CallPrec])
+	}
+}
+
+// shape renders an expression with parenthesized operands,
+// to show how it was parsed.
+func shape(src string, x ast.Expr) string {
+	operand := func(x ast.Expr) string {
+		switch x.(type) {
+		case *ast.Ident, *ast.Literal, *ast.RecordExpr:
+			return shape(src, x)
+		}
+		return "(" + shape(src, x) + ")"
+	}
+	switch x := x.(type) {
+	case *ast.Ident:
+		return x.Pos.Get([]byte(src))
+	case *ast.Literal:
+		return x.Pos.Get([]byte(src))
+	case *ast.RecordExpr:
+		return "{ ... }"
+	case *ast.AccessExpr:
+		return operand(x.Rec) + "." + x.Key.Pos.Get([]byte(src))
+	case *ast.CallExpr:
+		return operand(x.Fn) + " " + operand(x.Arg)
+	case *ast.BinaryExpr:
+		if x.Op == token.PICK {
+			return operand(x.Left) + "::" + operand(x.Right)
+		}
+		return operand(x.Left) + " " + x.Op.Op() + " " + operand(x.Right)
+	case ast.MatchFuncExpr:
+		var alts []string
+		for _, fn := range x {
+			alts = append(alts, "| "+shape(src, fn))
+		}
+		return strings.Join(alts, " ")
+	case *ast.FuncExpr:
+		return operand(x.Arg) + " -> " + operand(x.Body)
+	}
+	return fmt.Sprintf("%T", x)
+}
+
 func TestParseEnum(t *testing.T) {
 	valid := []string{
 		`#true #false`,
@@ -133,10 +390,45 @@ func TestParseEnum(t *testing.T) {
 	}
 }
 
+func TestParseTypes(t *testing.T) {
+	// Types apply to others like calls, binding tighter than arrows.
+	se, err := ParseExpr(`f ; f : list int -> list text`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, ok := se.Expr.(*ast.WhereExpr).Typ.(*ast.FuncExpr)
+	if !ok {
+		t.Fatalf("Expected a function type, got %#v", se.Expr.(*ast.WhereExpr).Typ)
+	}
+	for _, x := range []ast.Expr{fn.Arg, fn.Body} {
+		if call, ok := x.(*ast.CallExpr); !ok || se.Source.GetString(call.Fn.Span()) != "list" {
+			t.Errorf("Expected a list type, got %#v", x)
+		}
+	}
+
+	// So do the types of variants.
+	se, err = ParseExpr(`t ; t : #ok list int #none`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enum := se.Expr.(*ast.WhereExpr).Typ.(ast.EnumExpr)
+	if len(enum) != 2 {
+		t.Fatalf("Expected 2 variants, got %d", len(enum))
+	}
+	if _, ok := enum[0].Typ.(*ast.CallExpr); !ok {
+		t.Errorf("Expected a list type, got %#v", enum[0].Typ)
+	}
+}
+
 func TestMatchFunc(t *testing.T) {
 	valid := []string{
 		`default -> | #none -> default | #just a -> a`,
 		`| "/" -> "Welcome" | _ -> "Where are you?" <| "/"`,
+		`| "a" | "b" -> 1 | _ -> 0`,
+		`| #left x | #right x -> x`,
+		`| [ x ] | [ x, _ ] -> x | _ -> 0`,
+		`| #config { cpus, mem = m } -> cpus * m`,
+		`| { ..rest, a } -> rest`,
 	}
 
 	for _, src := range valid {
@@ -159,12 +451,22 @@ func TestParses(t *testing.T) {
 | #r n -> n * 3)
   ; hand : #l int #r int`,
 		`t ; t : #a a #b int #c byte ; a : #x #y #z`,
+		`t ; t : #config { cpus : int, mem : int } #none`,
+		`x ; x : list int = [ 1, 2 ]`,
+		`r ; r : { a : list int, b : (int -> int) } = { a = [], b = n -> n }`,
+		`f ; f : list int -> list (list text) = _ -> []`,
+		`t ; t : #ok list int #none`,
+		`#c [ 1 ]`,
 		`[]`,
 		`[ "yo", 2, ]`,
 		`[ "yo", 2 ]`,
 		`foo.a`,
 		`inc ; inc : int -> int = a -> a + 1`,
 		`#true #false`,
+		// Parentheses start a new where-chain, which may shadow bindings.
+		`(a ; a = 1) ; a = 2`,
+		`a ; a = (b ; b = 1) ; b = 2`,
+		`_ ; _ = 1 ; _ = 2`,
 	}
 
 	for _, src := range valid {
@@ -178,6 +480,8 @@ func TestParses(t *testing.T) {
 func TestImports(t *testing.T) {
 	valid := []string{
 		`$sha256~~a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447`,
+		`$local:utils`,
+		`$local:lib/text-utils`,
 	}
 
 	for _, src := range valid {
@@ -196,7 +500,15 @@ func TestParseError(t *testing.T) {
 	examples := []struct{ source, message string }{
 		{`{ a = b ..c }`, `Expected RBRACE got SPREAD`},
 		{`{ a = 1, ..other }`, `A spread must be first in a record.`},
+		{`{ +a = 1 }`, `Only a record with a spread can be extended with new keys.`},
+		{`{ a = 1, -b }`, `Only keys of a record spread can be dropped.`},
+		{`{ a : int, b = 1 }`, `A record must give either types or values of all its keys.`},
+		{`{ a 1 }`, `Expected ASSIGN got INT`},
 		{`a::1 ; a : #a`, `Expected IDENT got INT`},
+		{`a ; a = 1 ; a = 2`, `a is already bound in this where-chain`},
+		{`a ; a = 1 ; b = 2 ; a : int`, `a is already bound in this where-chain`},
+		// Operators that parse nothing more end the expression.
+		{`#A..`, `Expected EOF got SPREAD`},
 	}
 
 	for _, example := range examples {
@@ -222,3 +534,59 @@ func writeExpr(t *testing.T, src string, expr ast.Expr) {
 	printer.Fprint(&buf, []byte(src), expr)
 	t.Error(buf.String())
 }
+
+func TestParseHeader(t *testing.T) {
+	source := "#!/usr/bin/env -S scrap eval\r\n-- Increments one.\n-- scrap:version 0.2\n-- scrap:nowarn  unused shadow\nf 1\n; f = a -> a + 1\n"
+	src := token.NewSource([]byte(source))
+	se, err := Parse(&src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := se.Header
+	if h.Shebang != "/usr/bin/env -S scrap eval" {
+		t.Errorf("unexpected shebang %q", h.Shebang)
+	}
+	if got := src.GetString(h.Pos); !strings.HasPrefix(got, "#!") || !strings.HasSuffix(got, "unused shadow") {
+		t.Errorf("unexpected header %q", got)
+	}
+	if v, ok := h.Pragma("version"); !ok || v != "0.2" {
+		t.Errorf("expected version 0.2, got %q", v)
+	}
+	if v, ok := h.Pragma("nowarn"); !ok || v != "unused shadow" {
+		t.Errorf("expected nowarn unused shadow, got %q", v)
+	}
+	if _, ok := h.Pragma("other"); ok {
+		t.Error("expected no other pragma")
+	}
+	if got := src.GetString(h.Pragmas[0].Pos); got != "-- scrap:version 0.2" {
+		t.Errorf("unexpected pragma span %q", got)
+	}
+
+	// Positions count the header's lines.
+	where := se.Expr.(*ast.WhereExpr)
+	if pos := src.GetPosition(where.Id.Pos.Start); pos != (token.Position{Line: 6, Column: 3}) {
+		t.Errorf("expected f at 6:3, got %v", pos)
+	}
+
+	// Shebangs must come first, and comments only in the header.
+	for _, source := range []string{"-- a\n#!scrap\n1", "1\n-- a"} {
+		src := token.NewSource([]byte(source))
+		if _, err := Parse(&src); err == nil {
+			t.Errorf("expected %q not to parse", source)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	// About 1MB.
+	src := corpus.Generate(corpus.Shape{Bindings: 35_000, Depth: 8}).Main
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for b.Loop() {
+		source := token.NewSource(src)
+		if _, err := Parse(&source); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// Package printer formats scrapscript syntax trees.
+package printer
@@ -12,9 +12,9 @@ import (
 type writer struct {
 	w      io.Writer
 	source []byte
+	config *Config
 
 	spaces int
-	parens bool // for debugging
 }
 
 func (w *writer) string(s string) error {
@@ -44,46 +44,146 @@ func (w *writer) space() error {
 	return err
 }
 
-func Fprint(w io.Writer, source []byte, expr ast.Expr) error {
-	wr := writer{w: w, source: source}
+// A Config controls the output of Fprint.
+type Config struct {
+	// Type annotations to add to where-bindings,
+	// keyed by the span of the binding's name.
+	Annotations map[token.Span]string
+	// Text to print instead of expressions, keyed by their spans;
+	// like the values optimizers fold constant expressions to. They are
+	// parenthesized like literals, unless they start with a minus sign,
+	// as negative numbers do.
+	Replacements map[token.Span]string
+	// Parenthesize every expression, to show how it was parsed.
+	// Otherwise, only the parentheses needed to parse the output
+	// back to the same expression are printed.
+	Parens bool
+}
+
+// Fprint pretty-prints an expression parsed from source to w.
+func (c *Config) Fprint(w io.Writer, source []byte, expr ast.Expr) error {
+	wr := writer{w: w, source: source, config: c}
 	return wr.print(expr)
 }
 
+// Fprint pretty-prints an expression parsed from source to w,
+// with the default Config.
+func Fprint(w io.Writer, source []byte, expr ast.Expr) error {
+	return (&Config{}).Fprint(w, source, expr)
+}
+
 func (w *writer) print(expr ast.Expr) error {
-	if w.parens {
+	if w.config.Parens {
 		w.string("(")
 		defer w.string(")")
 	}
+	if text, ok := w.config.Replacements[expr.Span()]; ok {
+		return w.string(text)
+	}
 
 	switch e := expr.(type) {
 	case *ast.Ident, *ast.Literal:
 		return w.span(e.Span())
 
+	case *ast.ImportExpr:
+		return w.span(e.Span())
+
 	case *ast.BinaryExpr:
-		err := w.print(e.Left)
+		left, right := e.Op.OperandPrecedences()
+		err := w.operand(e.Left, left)
 		if err != nil {
 			return err
 		}
+		if e.Op == token.PICK {
+			w.string(e.Op.Op())
+			return w.span(e.Right.Span())
+		}
 		w.space()
 		w.string(e.Op.Op())
 		w.space()
-		return w.print(e.Right)
+		return w.operand(e.Right, right)
+
+	case *ast.RecordExpr:
+		if e.Rest == nil && len(e.Entries) == 0 {
+			return w.string("{}")
+		}
+		w.string("{ ")
+		if e.Rest != nil {
+			w.string("..")
+			if err := w.operand(e.Rest, token.BasePrec); err != nil {
+				return err
+			}
+			if len(e.Entries) > 0 {
+				w.string(", ")
+			}
+		}
+		for i, entry := range e.Entries {
+			if i > 0 {
+				w.string(", ")
+			}
+			if entry.Drop {
+				w.string("-")
+				w.span(entry.Key.Pos)
+				continue
+			}
+			if entry.Extend {
+				w.string("+")
+			}
+			w.span(entry.Key.Pos)
+			if entry.Pun {
+				continue
+			}
+			if entry.Type {
+				w.string(" : ")
+			} else {
+				w.string(" = ")
+			}
+			if err := w.print(entry.Val); err != nil {
+				return err
+			}
+		}
+		return w.string(" }")
+
+	case *ast.ListExpr:
+		if len(e.Elements) == 0 {
+			return w.string("[]")
+		}
+		w.string("[ ")
+		for i, x := range e.Elements {
+			if i > 0 {
+				w.string(", ")
+			}
+			if err := w.print(x); err != nil {
+				return err
+			}
+		}
+		return w.string(" ]")
+
+	case *ast.AccessExpr:
+		if err := w.operand(e.Rec, token.CallPrec+1); err != nil {
+			return err
+		}
+		w.string(".")
+		return w.span(e.Key.Pos)
 
 	case *ast.FuncExpr:
-		err := w.print(e.Arg)
+		err := w.pattern(e.Arg)
 		if err != nil {
 			return err
 		}
 		w.string(" -> ")
-		return w.print(e.Body)
+		// The body extends as far as operators binding at least as tightly
+		// as ARROW, so looser ones like pipes must be parenthesized.
+		return w.operand(e.Body, token.ARROW.Precedence())
 
 	case *ast.CallExpr:
-		err := w.print(e.Fn)
+		err := w.operand(e.Fn, token.CallPrec)
 		if err != nil {
 			return err
 		}
 		w.space()
-		return w.print(e.Arg)
+		// Calls associate to the left.
+		return w.operand(e.Arg, token.CallPrec+1)
 
 	case ast.MatchFuncExpr:
 		for _, fn := range e {
@@ -96,6 +196,26 @@ func (w *writer) print(expr ast.Expr) error {
 		}
 		return nil
 
+	case ast.EnumExpr:
+		for i, v := range e {
+			if i > 0 {
+				w.space()
+			}
+			if err := w.print(v); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case *ast.VariantExpr:
+		w.string("#")
+		err := w.span(e.Tag.Pos)
+		if err != nil || e.Typ == nil {
+			return err
+		}
+		w.space()
+		return w.operand(e.Typ, token.CallPrec+1)
+
 	case *ast.WhereExpr:
 		// w.indent += 1
 		err := w.print(e.Expr)
@@ -109,6 +229,19 @@ func (w *writer) print(expr ast.Expr) error {
 		if err != nil {
 			return err
 		}
+		if e.Typ != nil {
+			w.string(" : ")
+			if err := w.print(e.Typ); err != nil {
+				return err
+			}
+		} else if typ, ok := w.config.Annotations[e.Id.Pos]; ok {
+			w.string(" : ")
+			w.string(typ)
+		}
+		// This where is type-only.
+		if e.Val == nil {
+			return nil
+		}
 		w.string(" =")
 		if _, ok := e.Val.(ast.MatchFuncExpr); ok {
 			w.indent()
@@ -116,8 +249,64 @@ func (w *writer) print(expr ast.Expr) error {
 		} else {
 			w.string(" ")
 		}
-		return w.print(e.Val)
+		return w.operand(e.Val, token.BasePrec)
 	}
 
 	return fmt.Errorf("unhandled AST node: %#v", expr)
 }
+
+// operand prints x in parentheses, unless it binds at least as tightly as
+// prec, the precedence of the operator or call it is an operand of.
+func (w *writer) operand(x ast.Expr, prec int) error {
+	if w.precedence(x) >= prec {
+		return w.print(x)
+	}
+	w.string("(")
+	if err := w.print(x); err != nil {
+		return err
+	}
+	return w.string(")")
+}
+
+// pattern prints the argument of a function, where the alternatives of
+// or-patterns may not be parenthesized.
+func (w *writer) pattern(x ast.Expr) error {
+	if or, ok := x.(*ast.BinaryExpr); ok && or.Op == token.PIPE {
+		if err := w.pattern(or.Left); err != nil {
+			return err
+		}
+		w.string(" | ")
+		return w.pattern(or.Right)
+	}
+	return w.operand(x, token.ARROW.Precedence()+1)
+}
+
+// precedence returns how tightly an expression, or its replacement, binds.
+func (w *writer) precedence(x ast.Expr) int {
+	if text, ok := w.config.Replacements[x.Span()]; ok && !strings.HasPrefix(text, "-") {
+		return token.CallPrec + 1
+	}
+	return precedence(x)
+}
+
+// precedence returns how tightly an expression binds.
+func precedence(x ast.Expr) int {
+	switch x := x.(type) {
+	case *ast.BinaryExpr:
+		return x.Op.Precedence()
+	case *ast.CallExpr:
+		return token.CallPrec
+	case *ast.VariantExpr:
+		if x.Typ != nil {
+			return token.CallPrec
+		}
+	case *ast.FuncExpr:
+		return token.ARROW.Precedence()
+	case ast.MatchFuncExpr:
+		return token.BasePrec
+	case *ast.WhereExpr, ast.EnumExpr:
+		return token.WherePrec
+	}
+	// Identifiers, literals, records, lists, accesses and imports.
+	return token.CallPrec + 1
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/Victorystick/scrapscript/parser"
+	"github.com/Victorystick/scrapscript/token"
 )
 
 func TestPrint(t *testing.T) {
@@ -23,10 +24,99 @@ func TestPrint(t *testing.T) {
 | "hello " ++ name -> name
 | _ -> ""`)
 
+	expect(t, `| "a" | "b" -> 1 | #c x | #d x -> x`, `
+| "a" | "b" -> 1
+| #c x | #d x -> x`)
+
 	expect(t, `a + b + c ; a = 1 ; b = 2 ; c = 3`, `a + b + c
 ; a = 1
 ; b = 2
 ; c = 3`)
+
+	expect(t, `f x ; f : t -> int = a -> 1 ; t : #a #b int`, `f x
+; f : t -> int = a -> 1
+; t : #a #b int`)
+
+	expect(t, `f x ; f : list int -> { a : list text } = a -> { a = [] } ; t : #a list int #b`, `f x
+; f : list int -> { a : list text } = a -> { a = [] }
+; t : #a (list int) #b`)
+
+	// Parentheses are dropped where they aren't needed.
+	expect(t, `(a * b) + (c)`, `a * b + c`)
+	expect(t, `(x ; x = 1) + 1`, `(x
+; x = 1) + 1`)
+
+	// Parentheses are kept where they are needed.
+	for _, source := range []string{
+		`f (g x) y`,
+		`(a -> a) 1`,
+		`(1 + 2) * 3`,
+		`a - b - c`,
+		`a - (b - c)`,
+		`x |> f |> g`,
+		`x |> (f |> g)`,
+		`a >+ b >+ c`,
+		`(a >+ b) >+ c`,
+		`a -> b -> c`,
+		`x -> (y |> f)`,
+		`x -> y |> f`,
+		`f (x -> x)`,
+		`(1 |> f) >+ []`,
+		"\n| \"a\" | \"b\" -> (x |> f)",
+		`(f x).a.b`,
+		`(#a #b)::a`,
+		`#a (f x)`,
+		`{ ..r, a = f x, -b, +c = [ 1, (x -> x) 2 ] }`,
+		"\n| #config { cpus, mem = m } -> cpus * m",
+		`{ a : int, b : #x #y }`,
+		`{ ..r, a, +b, c = 1 }`,
+		`{}`,
+		`[]`,
+	} {
+		expect(t, source, source)
+	}
+}
+
+func TestPrintAnnotations(t *testing.T) {
+	source := `f x ; f = a -> a ; x : int = 1`
+	se, err := parser.ParseExpr(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Annotations: map[token.Span]string{
+		{Start: 6, End: 7}:   "a -> a",
+		{Start: 19, End: 20}: "int", // Already annotated.
+	}}
+	var buf bytes.Buffer
+	if err := config.Fprint(&buf, []byte(source), se.Expr); err != nil {
+		t.Fatal(err)
+	}
+	expected := `f x
+; f : a -> a = a -> a
+; x : int = 1`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s ", expected, buf.String())
+	}
+}
+
+func TestPrintReplacements(t *testing.T) {
+	source := `f (1 - 2) [3 + 4]`
+	se, err := parser.ParseExpr(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Replacements: map[token.Span]string{
+		{Start: 3, End: 8}:   "-1",
+		{Start: 11, End: 16}: "7",
+	}}
+	var buf bytes.Buffer
+	if err := config.Fprint(&buf, []byte(source), se.Expr); err != nil {
+		t.Fatal(err)
+	}
+	// Replacements are parenthesized like what they replace.
+	if expected := `f (-1) [ 7 ]`; buf.String() != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s ", expected, buf.String())
+	}
 }
 
 func expect(t *testing.T, source, expected string) {
@@ -0,0 +1,168 @@
+// Package scraptest runs scraps against golden files, for testing
+// built-ins and platforms that extend an eval.Environment, and for
+// programs that embed scraps to snapshot-test them.
+//
+// Each file name.scrap in a directory is checked against those of the
+// following golden files that exist next to it:
+//
+//   - name.value, the rendering of the value it evaluates to.
+//   - name.type, its inferred type.
+//   - name.error, the error evaluating it, without colors.
+//
+// Running the tests with -scraptest.update rewrites the golden files,
+// creating name.value or name.error if neither exists. Mismatches are
+// reported as line diffs.
+package scraptest
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+var update = flag.Bool("scraptest.update", false, "rewrite the golden files of scraptest")
+
+// Matches ANSI escape sequences, which errors use for colors.
+var ansi = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Run checks each .scrap file in dir against its golden files in a subtest.
+// Every scrap is read by a new Environment returned by newEnv, or
+// eval.NewEnvironment if newEnv is nil.
+func Run(t *testing.T, dir string, newEnv func() *eval.Environment) {
+	t.Helper()
+	if newEnv == nil {
+		newEnv = eval.NewEnvironment
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.scrap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no .scrap files in %s", dir)
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".scrap")
+		t.Run(name, func(t *testing.T) {
+			Check(t, newEnv(), path)
+		})
+	}
+}
+
+// Check checks the .scrap file at path, read by env, against its golden files.
+func Check(t testing.TB, env *eval.Environment, path string) {
+	t.Helper()
+	base := strings.TrimSuffix(path, ".scrap")
+	script, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The outcome of evaluating the scrap, by golden file extension.
+	outcome := make(map[string]string)
+	scrap, err := env.Read(script)
+	if err == nil {
+		var val eval.Value
+		if val, err = env.Eval(scrap); err == nil {
+			outcome[".value"] = env.Scrap(val)
+		}
+	}
+	if err != nil {
+		outcome[".error"] = ansi.ReplaceAllString(err.Error(), "")
+	}
+	if scrap != nil {
+		if typ, err := env.Infer(scrap); err == nil {
+			outcome[".type"] = typ
+		} else {
+			outcome[".type"] = ansi.ReplaceAllString(err.Error(), "")
+		}
+	}
+
+	found := false
+	for _, ext := range []string{".value", ".error", ".type"} {
+		path := base + ext
+		actual, ok := outcome[ext]
+		expected, err := os.ReadFile(path)
+		exists := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+
+		if *update {
+			// Types are only checked if asked for.
+			var err error
+			if ok && (exists || ext != ".type") {
+				err = os.WriteFile(path, []byte(actual+"\n"), 0644)
+			} else if exists && !ok {
+				err = os.Remove(path)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		if !exists {
+			continue
+		}
+		found = true
+		want := strings.TrimSpace(string(expected))
+		if !ok {
+			t.Errorf("%s: expected %s, but got:\n%s", filepath.Base(path), want, outcome[".error"])
+		} else if strings.TrimSpace(actual) != want {
+			t.Errorf("%s: mismatch (-expected +actual):\n%s", filepath.Base(path), diff(want, strings.TrimSpace(actual)))
+		}
+	}
+
+	if !found && !*update {
+		t.Errorf("no golden files for %s.scrap; run with -scraptest.update to create them", filepath.Base(base))
+	}
+}
+
+// diff returns a line diff turning expected into actual, where removed
+// lines are prefixed by "-", added ones by "+" and common ones by " ".
+func diff(expected, actual string) string {
+	a, b := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+
+	// lcs[i][j] is the length of the longest common
+	// subsequence of the lines a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&sb, " %s\n", a[i])
+			i++
+			j++
+		case j == len(b) || i < len(a) && lcs[i+1][j] >= lcs[i][j+1]:
+			fmt.Fprintf(&sb, "-%s\n", a[i])
+			i++
+		default:
+			fmt.Fprintf(&sb, "+%s\n", b[j])
+			j++
+		}
+	}
+	return sb.String()
+}
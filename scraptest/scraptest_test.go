@@ -0,0 +1,58 @@
+package scraptest
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/eval"
+)
+
+func TestRun(t *testing.T) {
+	Run(t, "testdata", nil)
+}
+
+// A recorder records the failures of a test without failing it.
+type recorder struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestCheckMismatch(t *testing.T) {
+	if *update {
+		t.Skip("the golden file is meant to mismatch")
+	}
+	r := &recorder{TB: t}
+	Check(r, eval.NewEnvironment(), filepath.Join("testdata", "mismatch", "record.scrap"))
+	if len(r.failures) != 1 {
+		t.Fatalf("expected one failure, got %q", r.failures)
+	}
+	expected := "record.value: mismatch (-expected +actual):\n" +
+		"-{ a = 1, b = 3 }\n+{ a = 1, b = 2 }\n"
+	if r.failures[0] != expected {
+		t.Errorf("expected:\n%s\nactual:\n%s", expected, r.failures[0])
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		expected, actual, diff string
+	}{
+		{"a", "a", " a\n"},
+		{"a\nb\nc", "a\nc", " a\n-b\n c\n"},
+		{"a\nc", "a\nb\nc", " a\n+b\n c\n"},
+		{"a\nb", "a\nx", " a\n-b\n+x\n"},
+		{"", "x", "-\n+x\n"},
+	}
+	for _, tt := range tests {
+		if d := diff(tt.expected, tt.actual); d != tt.diff {
+			t.Errorf("diff(%q, %q):\nexpected: %q\n  actual: %q", tt.expected, tt.actual, tt.diff, d)
+		}
+	}
+}
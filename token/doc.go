@@ -0,0 +1,3 @@
+// Package token defines the tokens of scrapscript, and the Source, Span
+// and Error types used to point into programs.
+package token
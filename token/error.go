@@ -2,27 +2,92 @@ package token
 
 import (
 	"fmt"
+	"os"
 	"strings"
 )
 
 type Error struct {
 	Pos   Position
+	End   Position // The position just past the last character of Range.
 	Range Span
 	Line  string
-	Msg   string
+	// The following lines of Range, if it spans more than one.
+	More []string
+	Msg  string
+	// The error that the Error reports, if any, like that of an import.
+	Err error
 }
 
-var errorFormat = fmt.Sprintf(
-	"%s: %%s\n\n%s: %%s\n%%s%s",
-	color(red, "error"),
-	color(yellow, "%5d"),
-	color(red, "%s"))
+// A Style determines how an Error is rendered.
+type Style int
+
+const (
+	// Plain text.
+	Plain Style = iota
+	// Colored with ANSI escape codes.
+	ANSI
+)
+
+// DefaultStyle is the Style of Error.Error. Programs may set it once on
+// startup, for example from a flag or by DetectStyle(os.Stderr).
+var DefaultStyle = Plain
+
+// DetectStyle returns ANSI if f is a terminal
+// and NO_COLOR is unset or empty, otherwise Plain.
+func DetectStyle(f *os.File) Style {
+	if os.Getenv("NO_COLOR") != "" {
+		return Plain
+	}
+	if info, err := f.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return Plain
+	}
+	return ANSI
+}
 
 func (e Error) Error() string {
-	column := e.Pos.Column - 1
-	lineLength := min(len(e.Line)-column, e.Range.Len())
-	return fmt.Sprintf(
-		errorFormat, e.Msg, e.Pos.Line, e.Line, strings.Repeat(" ", 7+column), strings.Repeat("~", lineLength))
+	return e.Render(DefaultStyle)
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// Render renders the Error in a Style, with its message followed by the
+// source lines it spans, where the erroneous part is underlined.
+func (e Error) Render(style Style) string {
+	paint := func(c Color, text string) string {
+		if style == ANSI {
+			return color(c, text)
+		}
+		return text
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s\n", paint(red, "error"), e.Msg)
+
+	lines := append([]string{e.Line}, e.More...)
+	for i, line := range lines {
+		// Underline from the start of the span on its first line,
+		// or the indentation of the lines following it,
+		start := e.Pos.Column - 1
+		if i > 0 {
+			start = len(line) - len(strings.TrimLeft(line, " \t"))
+		}
+		// to the end of the span on its last line, or the end of the line.
+		end := len(line)
+		if len(lines) == 1 {
+			end = min(end, start+e.Range.Len())
+		} else if i == len(lines)-1 {
+			end = min(end, e.End.Column-1)
+		}
+
+		fmt.Fprintf(&b, "\n%s: %s\n%s%s",
+			paint(yellow, fmt.Sprintf("%5d", e.Pos.Line+i)),
+			line,
+			strings.Repeat(" ", 7+start),
+			paint(red, strings.Repeat("~", max(end-start, 0))))
+	}
+	return b.String()
 }
 
 type Color rune
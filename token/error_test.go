@@ -0,0 +1,33 @@
+package token
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	src := NewSource([]byte("x ; x =\n  [ 1,\n    2 ]\n"))
+	for i, b := range src.Bytes() {
+		if b == '\n' {
+			src.AddLineBreak(i + 1)
+		}
+	}
+
+	examples := []struct {
+		span     Span
+		style    Style
+		expected string
+	}{
+		{Span{0, 1}, Plain, "error: oops\n\n    1: x ; x =\n       ~"},
+		{Span{0, 1}, ANSI, "\033[31merror\033[m: oops\n\n\033[33m    1\033[m: x ; x =\n       \033[31m~\033[m"},
+		{Span{10, 22}, Plain, "error: oops\n\n" +
+			"    2:   [ 1,\n         ~~~~\n" +
+			"    3:     2 ]\n           ~~~"},
+		// Spans ending with a line break don't underline the next line.
+		{Span{4, 8}, Plain, "error: oops\n\n    1: x ; x =\n           ~~~"},
+	}
+
+	for _, ex := range examples {
+		err := src.Error(ex.span, "oops")
+		if actual := err.Render(ex.style); actual != ex.expected {
+			t.Errorf("Expected:\n%q\ngot:\n%q", ex.expected, actual)
+		}
+	}
+}
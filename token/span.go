@@ -1,23 +1,61 @@
 package token
 
-import "bytes"
+import (
+	"bytes"
+	"slices"
+)
 
 type Source struct {
 	bytes []byte
 	lines []int // indices of new lines
 }
 
+// The UTF-8 byte order mark, that some editors start files with.
+const byteOrderMark = "\uFEFF"
+
+// NewSource returns a Source of bytes, which may start with a byte order
+// mark, have \r\n line endings and end with NULs, as is common for text
+// from Windows editors and fixed-size buffers. Offsets are into bytes
+// as is, but line 1 starts after any byte order mark.
 func NewSource(bytes []byte) Source {
-	return Source{bytes, []int{0}}
+	return Source{bytes, []int{len(bom(bytes))}}
+}
+
+func bom(src []byte) []byte {
+	if bytes.HasPrefix(src, []byte(byteOrderMark)) {
+		return src[:len(byteOrderMark)]
+	}
+	return nil
+}
+
+// Body returns the Span of the Source to scan,
+// without any byte order mark or trailing NULs.
+func (s *Source) Body() Span {
+	end := len(bytes.TrimRight(s.bytes, "\x00"))
+	return Span{Start: min(len(bom(s.bytes)), end), End: end}
 }
 
 func (s *Source) Error(span Span, msg string) Error {
 	pos := s.GetPosition(span.Start)
+	// The end is just past the last character, on the same line.
+	end := pos
+	if span.End > span.Start {
+		end = s.GetPosition(span.End - 1)
+		end.Column += 1
+	}
+
+	var more []string
+	for line := pos.Line + 1; line <= end.Line; line++ {
+		more = append(more, s.GetLine(line))
+	}
+
 	return Error{
 		Pos:   pos,
+		End:   end,
 		Range: span,
-		Msg:   msg,
 		Line:  s.GetLine(pos.Line),
+		More:  more,
+		Msg:   msg,
 	}
 }
 
@@ -29,6 +67,12 @@ func (s *Source) AddLineBreak(offset int) {
 	s.lines = append(s.lines, offset)
 }
 
+// GrowLines makes room for n more line breaks,
+// so that adding them doesn't allocate.
+func (s *Source) GrowLines(n int) {
+	s.lines = slices.Grow(s.lines, n)
+}
+
 func (s *Source) LineCount() int {
 	return len(s.lines)
 }
@@ -64,6 +108,11 @@ func (s *Source) GetLine(i int) string {
 		// Skip newline.
 		span.End = s.lines[i] - 1
 	}
+	// Lines end before any \r of \r\n, and the last before any trailing NULs.
+	span.End = max(min(span.End, s.Body().End), span.Start)
+	if span.End > span.Start && s.bytes[span.End-1] == '\r' {
+		span.End--
+	}
 
 	return s.GetString(span)
 }
@@ -98,6 +147,22 @@ func (span Span) Len() int {
 	return span.End - span.Start
 }
 
+// Union returns the smallest Span covering both span and other.
+func (span Span) Union(other Span) Span {
+	return Span{Start: min(span.Start, other.Start), End: max(span.End, other.End)}
+}
+
+// Contains reports whether offset is within the Span, including just past
+// its end, which is where a cursor is after typing the spanned text.
+func (span Span) Contains(offset int) bool {
+	return span.Start <= offset && offset <= span.End
+}
+
+// Intersects reports whether span and other share any character.
+func (span Span) Intersects(other Span) bool {
+	return span.Start < other.End && other.Start < span.End
+}
+
 // Get returns the string sliced from src.
 func (span Span) Get(src []byte) string {
 	return string(src[span.Start:span.End])
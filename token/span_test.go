@@ -0,0 +1,27 @@
+package token
+
+import "testing"
+
+func TestSpan(t *testing.T) {
+	a, b, c := Span{0, 3}, Span{3, 5}, Span{2, 4}
+
+	if u := a.Union(b); u != (Span{0, 5}) {
+		t.Errorf("Expected %v ∪ %v to be {0 5}, got %v", a, b, u)
+	}
+	if u := c.Union(a); u != (Span{0, 4}) {
+		t.Errorf("Expected %v ∪ %v to be {0 4}, got %v", c, a, u)
+	}
+
+	for offset, want := range []bool{true, true, true, true, false} {
+		if got := a.Contains(offset); got != want {
+			t.Errorf("Expected %v.Contains(%d) to be %t", a, offset, want)
+		}
+	}
+
+	if a.Intersects(b) || b.Intersects(a) {
+		t.Errorf("Expected adjacent spans %v and %v not to intersect", a, b)
+	}
+	if !a.Intersects(c) || !c.Intersects(b) {
+		t.Errorf("Expected %v to intersect %v and %v", c, a, b)
+	}
+}
@@ -200,27 +200,95 @@ func (tok Token) String() string {
 const (
 	WherePrec = 0
 	BasePrec  = 1
-	CallPrec  = 7
+	CallPrec  = 11
 )
 
+// Precedences lists the operators by precedence, from the loosest binding
+// to the tightest. Operators at the same index bind equally tightly, and
+// function application binds at CallPrec. It follows the reference
+// implementation at https://scrapscript.org, except that pipes bind looser
+// than ARROW, so that `x |> a -> a` pipes x into a function; and that
+// operators associating differently bind differently tightly, so that
+// chains of them group predictably: `x |> f <| y` is `(x |> f) <| y`,
+// and `x >+ xs +< y` is `x >+ (xs +< y)`.
+var Precedences = [...][]Token{
+	WherePrec: {WHERE},
+	BasePrec:  {PIPE},
+	2:         {LPIPE},
+	3:         {RPIPE},
+	4:         {ARROW},
+	5:         {LT, GT},
+	6:         {CONCAT, PREPEND},
+	7:         {APPEND},
+	8:         {ADD, SUB},
+	9:         {MUL},
+	10:        {RCOMP, LCOMP},
+	CallPrec:  nil,
+	12:        {PICK, ACCESS, SPREAD},
+}
+
+// The precedence of each operator, derived from Precedences.
+var precedences = func() (precs [end_operators]int) {
+	for i := range precs {
+		precs[i] = BasePrec
+	}
+	for prec, ops := range Precedences {
+		for _, op := range ops {
+			precs[op] = prec
+		}
+	}
+	return
+}()
+
+// Precedence returns how tightly an operator binds, as its index in
+// Precedences. Other tokens have BasePrec.
 func (op Token) Precedence() int {
-	switch op {
-	case WHERE:
-		return WherePrec
-	case PIPE:
-		return 1
-	case LPIPE, RPIPE:
-		return 2
-	case ARROW:
-		return 3
-	case LT, GT:
-		return 4
-	case ADD, SUB, CONCAT, APPEND, PREPEND:
-		return 5
-	case MUL:
-		return 6
-	case PICK, ACCESS, SPREAD:
-		return 8
+	if 0 <= op && op < end_operators {
+		return precedences[op]
 	}
 	return BasePrec
 }
+
+// An Associativity determines how a chain of operators
+// of the same precedence is grouped.
+type Associativity int
+
+const (
+	// `a - b - c` is `(a - b) - c`.
+	LeftAssoc Associativity = iota
+	// `a -> b -> c` is `a -> (b -> c)`.
+	RightAssoc
+)
+
+// RightAssociative lists the operators that associate to the right.
+// All others associate to the left. The alternatives of or-patterns
+// are separated by PIPE.
+var RightAssociative = []Token{PIPE, ARROW, LPIPE, CONCAT, PREPEND}
+
+// The associativity of each operator, derived from RightAssociative.
+var associativities = func() (assocs [end_operators]Associativity) {
+	for _, op := range RightAssociative {
+		assocs[op] = RightAssoc
+	}
+	return
+}()
+
+// Associativity returns how a chain of operators of
+// the same precedence as op is grouped.
+func (op Token) Associativity() Associativity {
+	if 0 <= op && op < end_operators {
+		return associativities[op]
+	}
+	return LeftAssoc
+}
+
+// OperandPrecedences returns the precedences at which the left and
+// right operands of op are parsed, such that an operand can only
+// contain operators of the same precedence on its associative side.
+func (op Token) OperandPrecedences() (left, right int) {
+	prec := op.Precedence()
+	if op.Associativity() == RightAssoc {
+		return prec + 1, prec
+	}
+	return prec, prec + 1
+}
@@ -0,0 +1,93 @@
+package types
+
+// A Class constrains the types that a type variable may stand for, like
+// the numbers that `+` adds. Classes are what make operators, and the
+// functions that use them, polymorphic over the types that they support.
+type Class uint8
+
+const (
+	// Num is the class of numbers: int and float, which `+`, `-` and `*`
+	// apply to.
+	Num Class = iota + 1
+	// Concat is the class of what `++` concatenates: text, bytes and lists.
+	Concat
+	// Record is the class of records, which have no rows to be generic
+	// over otherwise; for built-ins like `record/keys`.
+	Record
+)
+
+var classNames = [...]string{"", "num", "concat", "record"}
+
+// The types of each class, for errors.
+var classMembers = [...]string{"", "int or float", "text, bytes or a list", "a record"}
+
+func (cl Class) String() string {
+	return classNames[cl]
+}
+
+// Members describes the types of the class, like `int or float`.
+func (cl Class) Members() string {
+	return classMembers[cl]
+}
+
+// has reports whether a type that isn't a variable is of the class.
+func (cl Class) has(ref TypeRef) bool {
+	switch cl {
+	case Num:
+		return ref == IntRef || ref == FloatRef
+	case Concat:
+		return ref == TextRef || ref == BytesRef || ref.IsList()
+	case Record:
+		return ref.hasTag(recordTag)
+	}
+	return true
+}
+
+// UnboundOf returns a new unbound TypeRef of a class, for the types of
+// built-in functions, like `num a => list a -> a`.
+func (c *Registry) UnboundOf(cl Class) TypeRef {
+	ref := c.Unbound()
+	c.setClass(ref, cl)
+	return ref
+}
+
+// classOf returns the class of an unbound type or free variable,
+// or zero if it has none.
+func (c *Registry) classOf(ref TypeRef) Class {
+	return c.classes[c.Resolve(ref)]
+}
+
+func (c *Registry) setClass(ref TypeRef, cl Class) {
+	if cl == 0 {
+		return
+	}
+	if c.classes == nil {
+		c.classes = make(map[TypeRef]Class)
+	}
+	c.classes[ref] = cl
+}
+
+// constrain constrains a type to a class, or reports false if it can't be
+// of it. Free variables without a class get it; since no type is of two
+// classes, those with another can't.
+func (c *Registry) constrain(ref TypeRef, cl Class) bool {
+	ref = c.Resolve(ref)
+	if !ref.IsVar() && !ref.IsUnbound() {
+		return cl.has(ref)
+	}
+	if has := c.classes[ref]; has != 0 {
+		return has == cl
+	}
+	c.setClass(ref, cl)
+	return true
+}
+
+// mayBe reports whether values of a type may always be used where the
+// class is required: if it's of the class, or a variable of it.
+func (c *Registry) mayBe(ref TypeRef, cl Class) bool {
+	ref = c.Resolve(ref)
+	if ref.IsVar() || ref.IsUnbound() {
+		return c.classes[ref] == cl
+	}
+	return cl.has(ref)
+}
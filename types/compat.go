@@ -0,0 +1,176 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Incompatibility is a reason why a type can't replace another.
+type Incompatibility struct {
+	// Where in the type it is, like `.inc argument`; empty at the top.
+	Path   string
+	Reason string
+}
+
+func (inc Incompatibility) String() string {
+	if inc.Path == "" {
+		return inc.Reason
+	}
+	return inc.Path + ": " + inc.Reason
+}
+
+// Compatible returns the reasons why values of the type after can't
+// replace those of the type before, for code that uses them; none if
+// they can. Values can replace others if they:
+//
+//   - are of the same type, or a more general one; like `a -> a` rather
+//     than `int -> int`, but not the other way around.
+//   - are records with at least the same fields, or functions that accept
+//     records with at most the same fields.
+//   - are enums with at most the same tags, or functions that accept
+//     enums with at least the same tags.
+//
+// Lists are compared by their elements, and functions by their results
+// and, the other way around, by their arguments.
+func (c *Registry) Compatible(before, after TypeRef) []Incompatibility {
+	cc := compat{reg: c, bound: make(map[TypeRef]TypeRef)}
+	cc.compare(before, after, true, nil)
+	return cc.reasons
+}
+
+type compat struct {
+	reg *Registry
+	// The types that the variables of the type after stand for,
+	// in the type before.
+	bound   map[TypeRef]TypeRef
+	reasons []Incompatibility
+}
+
+func (cc *compat) fail(path []string, format string, args ...any) {
+	cc.reasons = append(cc.reasons, Incompatibility{strings.Join(path, " "), fmt.Sprintf(format, args...)})
+}
+
+// compare compares the types before and after at a path, where after is
+// provided by the scrap if covariant, like results, or else provided to
+// it, like arguments.
+func (cc *compat) compare(before, after TypeRef, covariant bool, path []string) {
+	c := cc.reg
+	before, after = c.Resolve(before), c.Resolve(after)
+
+	// Variables of after stand for any type, as long as it's the same
+	// wherever they appear.
+	if after.IsVar() || after.IsUnbound() {
+		if bound, ok := cc.bound[after]; ok {
+			if !c.equal(bound, before) {
+				// Like int, in `int -> text` replaced by `a -> a`.
+				cc.fail(path, "was %s, is %s", c.ErrorString(before), c.ErrorString(bound))
+			}
+			return
+		}
+		cc.bound[after] = before
+		// Unless they're of a class, like only int or float for `num a`.
+		if cl := c.classes[after]; cl != 0 && !c.mayBe(before, cl) {
+			was := "of any type"
+			if !before.IsVar() && !before.IsUnbound() {
+				was = c.ErrorString(before)
+			}
+			cc.fail(path, "was %s, is only %s", was, cl.Members())
+		}
+		return
+	}
+	if before.IsVar() || before.IsUnbound() {
+		cc.fail(path, "was of any type, is %s", c.ErrorString(after))
+		return
+	}
+
+	mismatch := func() {
+		cc.fail(path, "was %s, is %s", c.ErrorString(before), c.ErrorString(after))
+	}
+	if !before.SameTypeAs(after) {
+		mismatch()
+		return
+	}
+	switch tag, index := before.extract(); tag {
+	case listTag:
+		cc.compare(c.lists[index], c.lists[after.index()], covariant, append(path, "element"))
+	case funcTag:
+		b, a := c.funcs[index], c.funcs[after.index()]
+		cc.compare(b.Arg, a.Arg, !covariant, append(path, "argument"))
+		cc.compare(b.Result, a.Result, covariant, append(path, "result"))
+	case recordTag:
+		// Records may have more fields if provided, or fewer if accepted.
+		b, a := c.records[index], c.records[after.index()]
+		for _, key := range c.keys(recordTag, index) {
+			if _, ok := a[key]; !ok && covariant {
+				cc.fail(path, "field %s was removed", key)
+			}
+		}
+		for _, key := range c.keys(recordTag, after.index()) {
+			if _, ok := b[key]; !ok {
+				if !covariant {
+					cc.fail(path, "field %s is required", key)
+				}
+				continue
+			}
+			cc.compare(b[key], a[key], covariant, append(path, "."+key))
+		}
+	case enumTag:
+		// Enums may have fewer tags if provided, or more if accepted.
+		b, a := c.enums[index], c.enums[after.index()]
+		for _, key := range c.keys(enumTag, index) {
+			if _, ok := a[key]; !ok && !covariant {
+				cc.fail(path, "tag #%s is no longer accepted", key)
+			}
+		}
+		for _, key := range c.keys(enumTag, after.index()) {
+			if _, ok := b[key]; !ok {
+				if covariant {
+					cc.fail(path, "tag #%s was added", key)
+				}
+				continue
+			}
+			cc.compare(b[key], a[key], covariant, append(path, "#"+key))
+		}
+	default:
+		// Primitives, types and opaque types must be the same.
+		if !c.equal(before, after) {
+			mismatch()
+		}
+	}
+}
+
+// equal reports whether two types are structurally the same.
+func (c *Registry) equal(a, b TypeRef) bool {
+	a, b = c.Resolve(a), c.Resolve(b)
+	if a == b {
+		return true
+	}
+	if !a.SameTypeAs(b) {
+		return false
+	}
+	switch tag, index := a.extract(); tag {
+	case listTag:
+		return c.equal(c.lists[index], c.lists[b.index()])
+	case funcTag:
+		fa, fb := c.funcs[index], c.funcs[b.index()]
+		return c.equal(fa.Arg, fb.Arg) && c.equal(fa.Result, fb.Result)
+	case recordTag, enumTag:
+		m := c.records
+		if tag == enumTag {
+			m = c.enums
+		}
+		if len(m[index]) != len(m[b.index()]) {
+			return false
+		}
+		for key, ref := range m[index] {
+			other, ok := m[b.index()][key]
+			if !ok || !c.equal(ref, other) {
+				return false
+			}
+		}
+		return true
+	case typeTag:
+		return c.equal(TypeRef(index), TypeRef(b.index()))
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package types
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestCompatible(t *testing.T) {
+	examples := []struct {
+		before, after string
+		reasons       []string
+	}{
+		{`1`, `2`, nil},
+		{`1`, `"a"`, []string{`was int, is text`}},
+		// More general types are compatible, but not less general ones.
+		{`x -> x + 1`, `x -> x`, nil},
+		{`x -> x`, `x -> x + 1`, []string{`argument: was of any type, is int`, `result: was of any type, is int`}},
+		{`x -> ""`, `x -> x`, []string{`result: was text, is $0`}},
+		// Unless they're of a class the type isn't.
+		{`x -> x + 1`, `x -> x + x`, nil},
+		{`x -> x`, `x -> x * x`, []string{`argument: was of any type, is only int or float`}},
+		{`x -> x ++ "a"`, `x -> x * x`, []string{`argument: was text, is only int or float`}},
+		// Records may gain fields, and functions may accept fewer.
+		{`{ a = 1 }`, `{ a = 2, b = 3 }`, nil},
+		{`{ a = 1, b = 2 }`, `{ a = 1 }`, []string{`field b was removed`}},
+		{`| { a = a } -> a`, `| { a = a, b = _ } -> a`, []string{`argument: field b is required`}},
+		// Enums may lose tags, and functions may accept more.
+		{`[#a, #b]`, `[#a]`, nil},
+		{`[#a]`, `[#a, #b]`, []string{`element: tag #b was added`}},
+		{`| #a -> 1 | #b -> 2`, `| #a -> 1 | #b -> 2 | #c -> 3`, nil},
+		{`| #a -> 1 | #b -> 2`, `| #a -> 1`, []string{`argument: tag #b is no longer accepted`}},
+		{`{ f = | #a n -> n }`, `{ f = | #a n -> 0 }`, []string{`.f result: was of any type, is int`}},
+	}
+
+	for _, ex := range examples {
+		var reg Registry
+		scope := DefaultScope(&reg)
+		before, err := Infer(&reg, scope, must(parser.ParseExpr(ex.before)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		after, err := Infer(&reg, scope, must(parser.ParseExpr(ex.after)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var reasons []string
+		for _, inc := range reg.Compatible(before, after) {
+			reasons = append(reasons, inc.String())
+		}
+		if strings.Join(reasons, "\n") != strings.Join(ex.reasons, "\n") {
+			t.Errorf("%s to %s: expected\n%s\ngot\n%s", ex.before, ex.after, strings.Join(ex.reasons, "\n"), strings.Join(reasons, "\n"))
+		}
+	}
+}
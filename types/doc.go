@@ -0,0 +1,5 @@
+// Package types implements type inference for scrapscript.
+//
+// Types are interned in a Registry and referenced by TypeRefs, which are
+// only meaningful together with the Registry that created them.
+package types
@@ -0,0 +1,238 @@
+package types
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// The version of the encoding of types, written as its first byte.
+const encodingVersion = 3
+
+// openTag marks the variables of open enums and records in encodings,
+// which are numbered like other variables, and followed by their types
+// when they first appear.
+const openTag tag = 0xff
+
+// Encode returns a compact binary encoding of a type that Decode reads
+// back into any Registry. Keys of enums and records keep their
+// declaration order, and unbound types and type variables are numbered
+// by their first appearance, along with their classes, so equal types
+// have equal encodings if declared in the same order. Open enums and
+// records remain open.
+func (c *Registry) Encode(ref TypeRef) []byte {
+	e := encoder{reg: c, buf: []byte{encodingVersion}}
+	e.encode(ref)
+	return e.buf
+}
+
+type encoder struct {
+	reg      *Registry
+	buf      []byte
+	unbounds []TypeRef // In order of appearance, along with free and open vars.
+}
+
+// number returns the number of an unbound type or variable, and whether
+// it's its first appearance.
+func (e *encoder) number(ref TypeRef) (int, bool) {
+	i := slices.Index(e.unbounds, ref)
+	if i < 0 {
+		e.unbounds = append(e.unbounds, ref)
+		return len(e.unbounds) - 1, true
+	}
+	return i, false
+}
+
+func (e *encoder) encode(ref TypeRef) {
+	if v := e.reg.boundVar(ref); e.reg.open[v] {
+		e.buf = append(e.buf, byte(openTag))
+		i, first := e.number(v)
+		e.buf = binary.AppendUvarint(e.buf, uint64(i))
+		if first {
+			e.encode(e.reg.Resolve(v))
+		}
+		return
+	}
+	ref = e.reg.Resolve(ref)
+	tag, index := ref.extract()
+	e.buf = append(e.buf, byte(tag))
+	switch tag {
+	case primitiveTag:
+		e.buf = binary.AppendUvarint(e.buf, uint64(index))
+	case listTag:
+		e.encode(e.reg.lists[index])
+	case funcTag:
+		fn := e.reg.funcs[index]
+		e.encode(fn.Arg)
+		e.encode(fn.Result)
+	case enumTag, recordTag:
+		m := e.reg.enums
+		if tag == recordTag {
+			m = e.reg.records
+		}
+		keys := e.reg.keys(tag, index)
+		e.buf = binary.AppendUvarint(e.buf, uint64(len(keys)))
+		for _, key := range keys {
+			e.string(key)
+			e.encode(m[index][key])
+		}
+	case unboundTag, varTag:
+		i, first := e.number(ref)
+		e.buf = binary.AppendUvarint(e.buf, uint64(i))
+		if first {
+			e.buf = append(e.buf, byte(e.reg.classes[ref]))
+		}
+	case typeTag:
+		e.encode(TypeRef(index))
+	case opaqueTag:
+		e.string(e.reg.opaques[index])
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+var errBadEncoding = errors.New("bad type encoding")
+
+// Decode adds the type of an encoding by Encode to the Registry,
+// with fresh unbound types and type variables.
+func (c *Registry) Decode(data []byte) (ref TypeRef, err error) {
+	defer RecoverLimit(&err)
+	if len(data) == 0 || data[0] != encodingVersion {
+		return NeverRef, fmt.Errorf("%w: unknown version", errBadEncoding)
+	}
+	d := decoder{reg: c, buf: data[1:], fresh: make(map[uint64]TypeRef)}
+	ref = d.decode()
+	if d.err == nil && len(d.buf) > 0 {
+		d.fail("trailing bytes")
+	}
+	if d.err != nil {
+		return NeverRef, d.err
+	}
+	return ref, nil
+}
+
+type decoder struct {
+	reg   *Registry
+	buf   []byte
+	fresh map[uint64]TypeRef // The fresh types of numbered ones.
+	err   error
+}
+
+func (d *decoder) fail(msg string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: %s", errBadEncoding, msg)
+	}
+	d.buf = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	n, size := binary.Uvarint(d.buf)
+	if size <= 0 {
+		d.fail("bad number")
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail("string too long")
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func (d *decoder) decode() TypeRef {
+	if len(d.buf) == 0 {
+		d.fail("unexpected end")
+		return NeverRef
+	}
+	tag := tag(d.buf[0])
+	d.buf = d.buf[1:]
+	switch tag {
+	case primitiveTag:
+		i := d.uvarint()
+		if i >= uint64(len(primitiveNames)) {
+			d.fail("unknown primitive")
+			return NeverRef
+		}
+		return makeTypeRef(primitiveTag, int(i))
+	case listTag:
+		return d.reg.List(d.decode())
+	case funcTag:
+		arg := d.decode()
+		return d.reg.Func(arg, d.decode())
+	case enumTag, recordTag:
+		n := d.uvarint()
+		if n > uint64(len(d.buf)) {
+			d.fail("too many keys")
+			return NeverRef
+		}
+		m := make(MapRef, n)
+		order := make([]string, 0, n)
+		for range n {
+			key := d.string()
+			if _, ok := m[key]; ok {
+				d.fail("duplicate key")
+				return NeverRef
+			}
+			m[key] = d.decode()
+			order = append(order, key)
+		}
+		if d.err != nil {
+			return NeverRef
+		}
+		if tag == recordTag {
+			return d.reg.RecordInOrder(m, order)
+		}
+		return d.reg.EnumInOrder(m, order)
+	case unboundTag, varTag:
+		i := d.uvarint()
+		ref, ok := d.fresh[i]
+		if !ok {
+			if tag == unboundTag {
+				ref = d.reg.Unbound()
+			} else {
+				ref = d.reg.Var()
+			}
+			if len(d.buf) == 0 || d.buf[0] >= byte(len(classNames)) {
+				d.fail("bad class")
+				return NeverRef
+			}
+			d.reg.setClass(ref, Class(d.buf[0]))
+			d.buf = d.buf[1:]
+			d.fresh[i] = ref
+		}
+		return ref
+	case openTag:
+		i := d.uvarint()
+		ref, ok := d.fresh[i]
+		if !ok {
+			typ := d.decode()
+			if d.err != nil {
+				return NeverRef
+			}
+			if tag, _ := typ.extract(); tag != enumTag && tag != recordTag {
+				d.fail("open type that isn't an enum or record")
+				return NeverRef
+			}
+			ref = d.reg.openType(typ)
+			d.fresh[i] = ref
+		}
+		return ref
+	case typeTag:
+		return TypeOf(d.decode())
+	case opaqueTag:
+		return d.reg.Opaque(d.string())
+	}
+	d.fail("unknown tag")
+	return NeverRef
+}
@@ -0,0 +1,69 @@
+package types
+
+import "testing"
+
+func TestEncode(t *testing.T) {
+	reg := Registry{}
+	a, b := reg.Unbound(), reg.Var()
+	refs := []TypeRef{
+		IntRef,
+		HoleRef,
+		reg.List(reg.List(BytesRef)),
+		reg.Func(a, reg.Func(b, a)),
+		reg.RecordInOrder(MapRef{"z": TextRef, "a": reg.List(a)}, []string{"z", "a"}),
+		reg.EnumInOrder(MapRef{"some": a, "none": NeverRef}, []string{"some", "none"}),
+		TypeOf(reg.Func(IntRef, FloatRef)),
+		reg.Func(reg.Opaque("db"), ByteRef),
+		reg.Func(reg.UnboundOf(Num), reg.List(reg.UnboundOf(Concat))),
+		reg.List(reg.openType(reg.Enum(MapRef{"ok": b}))),
+		reg.Func(reg.openType(reg.Record(MapRef{"a": IntRef})), IntRef),
+	}
+
+	for _, ref := range refs {
+		other := Registry{}
+		// Skip some variables, so that indexes differ between registries.
+		other.Var()
+		other.Unbound()
+		decoded, err := other.Decode(reg.Encode(ref))
+		if err != nil {
+			t.Errorf("Could not decode %s: %v", reg.String(ref), err)
+			continue
+		}
+		Eq(t, other.CanonicalString(decoded), reg.CanonicalString(ref))
+		Eq(t, string(other.Encode(decoded)), string(reg.Encode(ref)))
+	}
+
+	// Declaration order is kept.
+	other := Registry{}
+	decoded, _ := other.Decode(reg.Encode(refs[4]))
+	Eq(t, other.String(decoded), "{ z : text, a : list a }")
+
+	// Open enums remain open, and one enum.
+	open := reg.openType(reg.Enum(MapRef{"ok": IntRef}))
+	decoded, _ = other.Decode(reg.Encode(reg.Func(open, open)))
+	fn := other.GetFunc(decoded)
+	other.unify(fn.Arg, other.Enum(MapRef{"err": TextRef, "ok": IntRef}))
+	Eq(t, other.String(decoded), "(#err text #ok int) -> #err text #ok int")
+}
+
+func TestDecodeErrors(t *testing.T) {
+	reg := Registry{}
+	valid := reg.Encode(reg.Func(IntRef, reg.Record(MapRef{"a": IntRef})))
+
+	for _, data := range [][]byte{
+		nil,
+		{0},
+		{encodingVersion},
+		valid[:len(valid)-1],
+		append(valid, 0),
+		{encodingVersion, byte(primitiveTag), 100},
+		{encodingVersion, 15},
+		{encodingVersion, byte(recordTag), 2, 1, 'a', 0, 0, 1, 'a', 0, 0},
+		{encodingVersion, byte(unboundTag), 0, 9},
+		{encodingVersion, byte(openTag), 0, byte(primitiveTag), 0},
+	} {
+		if _, err := reg.Decode(data); err == nil {
+			t.Errorf("Expected %v not to decode", data)
+		}
+	}
+}
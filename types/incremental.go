@@ -0,0 +1,159 @@
+package types
+
+import (
+	"strings"
+
+	"github.com/Victorystick/scrapscript/ast"
+)
+
+// An Incremental infers the types of successive versions of a scrap, as
+// it's edited in an editor or REPL, reusing the types of where-bindings
+// that didn't change.
+//
+// Only the where-bindings of the outermost where-chain are reused, if
+// neither their source, nor the types of the names they use, changed
+// since the last inference. Other bindings are inferred again, as is the
+// expression of the scrap. Bindings of types with free type variables,
+// like that of `a = []`, are never reused, since inferring the rest of a
+// scrap may bind them; nor are those with local imports, like
+// `u = $local:utils`, whose scraps may have changed too.
+//
+// Since reused bindings aren't inferred, Info only holds the definitions
+// and types of expressions within where-bindings that were inferred again.
+//
+// The zero value is ready to use. An Incremental must always be used with
+// the same Registry and scope, and not by multiple goroutines at once.
+type Incremental struct {
+	bindings map[string]incrementalBinding
+	// The number of inferences, and how many are running.
+	generation, depth int
+
+	// The number of where-bindings that the last inference reused,
+	// and inferred again.
+	Reused, Inferred int
+}
+
+type incrementalBinding struct {
+	ref        TypeRef
+	generation int // Of the inference that last used it.
+}
+
+// Infer is like InferMembers, but reuses the types of where-bindings
+// that didn't change since the last inference. Info may be nil.
+func (inc *Incremental) Infer(reg *Registry, scope TypeScope, se ast.SourceExpr, inferImport InferImport, inferMember InferMember, info *Info) (TypeRef, error) {
+	info.init()
+	if inc.bindings == nil {
+		inc.bindings = make(map[string]incrementalBinding)
+	}
+	// Imports inferred while inferring a scrap are inferred incrementally
+	// too, but only the outermost inference counts, and forgets bindings
+	// it didn't use.
+	if inc.depth == 0 {
+		inc.generation++
+		inc.Reused, inc.Inferred = 0, 0
+		defer inc.forget()
+	}
+	inc.depth++
+	defer func() { inc.depth-- }()
+
+	c := context{
+		source:      se.Source,
+		reg:         reg,
+		scope:       scope,
+		inferImport: inferImport,
+		inferMember: inferMember,
+		info:        info,
+	}
+	return c.run(func() TypeRef {
+		return c.chain(inc, se.Expr)
+	})
+}
+
+// forget forgets the bindings that the last inference didn't use,
+// such that editing a scrap doesn't remember every version of it.
+func (inc *Incremental) forget() {
+	for key, b := range inc.bindings {
+		if b.generation != inc.generation {
+			delete(inc.bindings, key)
+		}
+	}
+}
+
+// chain infers the type of an outermost where-chain incrementally.
+func (c *context) chain(inc *Incremental, x ast.Expr) TypeRef {
+	where, ok := x.(*ast.WhereExpr)
+	if !ok {
+		return c.infer(x)
+	}
+	if where.Val == nil {
+		return c.bindWhere(where, func() TypeRef {
+			return c.chain(inc, where.Expr)
+		})
+	}
+
+	key := c.bindingKey(where)
+	if b, ok := inc.bindings[key]; ok {
+		inc.Reused++
+		inc.bindings[key] = incrementalBinding{b.ref, inc.generation}
+		c.bind(c.source.GetString(where.Id.Pos), b.ref)
+		c.def(&where.Id, b.ref)
+		defer c.unbind()
+		return c.chain(inc, where.Expr)
+	}
+
+	inc.Inferred++
+	return c.bindWhere(where, func() TypeRef {
+		if ref := c.scope.val; !c.reg.hasFreeVars(ref) && !hasLocalImport(where) {
+			inc.bindings[key] = incrementalBinding{ref, inc.generation}
+		}
+		return c.chain(inc, where.Expr)
+	})
+}
+
+// bindingKey returns what identifies the type of a where-binding: its
+// source, and the canonical types of the names it uses, which are bound
+// outside of it.
+func (c *context) bindingKey(x *ast.WhereExpr) string {
+	var b strings.Builder
+	b.WriteString(c.source.GetString(x.Id.Pos.Union(x.Val.Span())))
+	var used []string
+	if x.Typ != nil {
+		used = ast.FreeVars(&c.source, x.Typ)
+	}
+	used = append(used, ast.FreeVars(&c.source, x.Val)...)
+	for _, name := range used {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString(" : ")
+		if bound := c.scope.Get(name); bound != nil {
+			b.WriteString(c.reg.CanonicalString(bound.val))
+		}
+	}
+	return b.String()
+}
+
+// hasLocalImport reports whether a where-binding, or its annotation,
+// has local imports.
+func hasLocalImport(x *ast.WhereExpr) (local bool) {
+	for _, x := range []ast.Expr{x.Typ, x.Val} {
+		if x == nil {
+			continue
+		}
+		ast.Inspect(x, func(n ast.Node) bool {
+			if imp, ok := n.(*ast.ImportExpr); ok && imp.Local() {
+				local = true
+			}
+			return !local
+		})
+	}
+	return
+}
+
+// hasFreeVars reports whether a type has type variables that aren't bound.
+func (c *Registry) hasFreeVars(ref TypeRef) (free bool) {
+	c.Visit(ref, func(ref TypeRef) bool {
+		free = free || ref.IsVar()
+		return !free
+	})
+	return
+}
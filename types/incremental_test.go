@@ -0,0 +1,85 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+)
+
+func TestIncremental(t *testing.T) {
+	var reg Registry
+	scope := DefaultScope(&reg)
+	var inc Incremental
+
+	// Each edit of a scrap, its type, and how many bindings are reused
+	// and inferred again.
+	edits := []struct {
+		source, typ      string
+		reused, inferred int
+	}{
+		{`f 1 ; f = a -> g a ; g = b -> b + 1`, `int`, 0, 2},
+		{`f 2 ; f = a -> g a ; g = b -> b + 1`, `int`, 2, 0},
+		// The type of g is the same, so f needn't be inferred again.
+		{`f 2 ; f = a -> g a ; g = b -> b + 2`, `int`, 1, 1},
+		// But now it isn't.
+		{`f 2 ; f = a -> g a ; g = b -> [ b ]`, `list int`, 0, 2},
+		{`f 2 ; f = a -> g a ; g = b -> [ b ] ; h = 1`, `list int`, 2, 1},
+		// Bindings of types with free variables aren't reused.
+		{`e ++ [1] ; e = []`, `list int`, 0, 1},
+		{`e ++ [1] ; e = []`, `list int`, 0, 1},
+		// Nor are bindings that didn't infer.
+		{`f ; f = 1 + "a"`, ``, 0, 1},
+		{`f 1 ; f : int -> int = a -> a`, `int`, 0, 1},
+		{`f 1 ; f : int -> int = a -> a`, `int`, 1, 0},
+		{`f 1 ; f : int -> text = a -> a`, ``, 0, 1},
+	}
+
+	for _, edit := range edits {
+		se := must(parser.ParseExpr(edit.source))
+		ref, err := inc.Infer(&reg, scope, se, nil, nil, nil)
+
+		// The types are the same as if inferred from scratch.
+		var fresh Registry
+		expected, expectedErr := Infer(&fresh, DefaultScope(&fresh), se, nil)
+		if edit.typ == "" {
+			if err == nil || expectedErr == nil || err.Error() != expectedErr.Error() {
+				t.Errorf("%s: expected error %v, got %v", edit.source, expectedErr, err)
+			}
+		} else if err != nil || reg.String(ref) != edit.typ || fresh.String(expected) != edit.typ {
+			t.Errorf("%s: expected type %s, got %s, %v", edit.source, edit.typ, reg.String(ref), err)
+		}
+		if inc.Reused != edit.reused || inc.Inferred != edit.inferred {
+			t.Errorf("%s: expected %d reused and %d inferred bindings, got %d and %d",
+				edit.source, edit.reused, edit.inferred, inc.Reused, inc.Inferred)
+		}
+	}
+
+	// Bindings of earlier versions are forgotten,
+	// and the last binding didn't infer.
+	if len(inc.bindings) != 0 {
+		t.Errorf("Expected no bindings to be remembered, got %v", inc.bindings)
+	}
+}
+
+func TestIncrementalLocalImports(t *testing.T) {
+	var reg Registry
+	scope := DefaultScope(&reg)
+	var inc Incremental
+
+	// The local scrap is edited between inferences.
+	local := IntRef
+	inferImport := func(algo string, hash []byte) (TypeRef, error) {
+		return local, nil
+	}
+	se := must(parser.ParseExpr(`u ; u = $local:a`))
+	for _, typ := range []TypeRef{IntRef, TextRef} {
+		local = typ
+		ref, err := inc.Infer(&reg, scope, se, inferImport, nil, nil)
+		if err != nil || ref != typ {
+			t.Errorf("Expected %s, got %s, %v", reg.String(typ), reg.String(ref), err)
+		}
+		if inc.Reused != 0 {
+			t.Errorf("Expected no reused bindings, got %d", inc.Reused)
+		}
+	}
+}
@@ -1,10 +1,12 @@
 package types
 
 import (
-	"encoding/hex"
 	"fmt"
+	"maps"
+	"slices"
 
 	"github.com/Victorystick/scrapscript/ast"
+	"github.com/Victorystick/scrapscript/internal/spell"
 	"github.com/Victorystick/scrapscript/token"
 )
 
@@ -31,6 +33,16 @@ func (s *Scope[T]) Get(name string) *Scope[T] {
 	return nil
 }
 
+// Names returns the names visible in the Scope, innermost first.
+func (s *Scope[T]) Names() (names []string) {
+	for bound := s; bound != nil; bound = bound.parent {
+		if s.Get(bound.name) == bound {
+			names = append(names, bound.name)
+		}
+	}
+	return
+}
+
 func (s *Scope[T]) Bind(name string, val T) *Scope[T] {
 	return &Scope[T]{s, name, val}
 }
@@ -44,12 +56,34 @@ type context struct {
 	reg         *Registry
 	scope       TypeScope
 	inferImport InferImport
+	inferMember InferMember // May be nil.
+	info        *Info
+	// The type-only bindings of the where-chain of the type being inferred;
+	// see chainTyp.
+	defs *typeDefs
+	// The open enums of the variant patterns of the match functions being
+	// inferred, closed once all their alternatives are.
+	patterns []TypeRef
+}
+
+// typeDefs are the type-only bindings of a where-chain, by name, and the
+// types that they define, once inferred.
+type typeDefs struct {
+	defs map[string]*ast.WhereExpr
+	refs map[*ast.WhereExpr]TypeRef // UnknownRef while inferring it.
 }
 
 func (c *context) bail(span token.Span, msg string) {
 	panic(c.source.Error(span, msg))
 }
 
+// bailWith is like bail, with an error that the error reports.
+func (c *context) bailWith(span token.Span, err error) {
+	e := c.source.Error(span, err.Error())
+	e.Err = err
+	panic(e)
+}
+
 func (c *context) bind(name string, ref TypeRef) TypeScope {
 	c.scope = c.scope.Bind(name, ref)
 	return c.scope
@@ -60,63 +94,105 @@ func (c *context) unbind() {
 	c.scope = c.scope.parent
 }
 
+// DefaultScope binds the names of the primitive types to their type values.
 func DefaultScope(reg *Registry) (scope TypeScope) {
 	for _, p := range primitives {
-		scope = scope.Bind(reg.String(p), p)
+		scope = scope.Bind(reg.String(p), TypeOf(p))
 	}
 	return
 }
 
 func Infer(reg *Registry, scope TypeScope, se ast.SourceExpr, inferImport InferImport) (ref TypeRef, err error) {
+	return infer(reg, scope, se, inferImport, nil)
+}
+
+func infer(reg *Registry, scope TypeScope, se ast.SourceExpr, inferImport InferImport, info *Info) (ref TypeRef, err error) {
 	context := context{
 		source:      se.Source,
 		reg:         reg,
 		scope:       scope,
 		inferImport: inferImport,
+		info:        info,
 	}
+	return context.run(func() TypeRef {
+		return context.infer(se.Expr)
+	})
+}
 
+// run runs an inference, returning the error it bails with, if any.
+func (c *context) run(f func() TypeRef) (ref TypeRef, err error) {
 	defer func() {
 		if pnc := recover(); pnc != nil {
-			if e, ok := pnc.(token.Error); ok {
+			switch e := pnc.(type) {
+			case token.Error:
 				err = e
-			} else {
+			case limitError:
+				err = e.err
+			default:
 				panic(pnc)
 			}
 		}
 	}()
 
-	ref = context.infer(se.Expr)
-	return ref, err
+	return f(), nil
 }
 
-type InferFunc func(expr ast.Expr) TypeRef
+type inferFunc func(expr ast.Expr) TypeRef
 
 func (c *context) infer(expr ast.Expr) TypeRef {
+	ref := c.inferExpr(expr)
+	c.recordType(expr, ref)
+	return ref
+}
+
+func (c *context) inferExpr(expr ast.Expr) TypeRef {
 	switch x := expr.(type) {
 	case *ast.Literal:
 		return literalTypeRef(x.Kind)
 	case *ast.Ident:
 		name := c.source.GetString(x.Pos)
-		ref := c.scope.Lookup(name)
-		if ref == NeverRef {
-			c.bail(x.Pos, "unbound variable: "+name)
+		bound := c.scope.Get(name)
+		if bound == nil {
+			c.bail(x.Pos, suggest("unknown variable "+name, name, c.scope.Names()))
 		}
-		return c.reg.Instantiate(ref)
+		return c.reg.Instantiate(bound.val)
 	case *ast.WhereExpr:
 		return c.where(x)
 	case *ast.ListExpr:
 		return c.list(x)
 	case *ast.RecordExpr:
+		if x.IsType() {
+			return TypeOf(c.typ(x))
+		}
 		return c.record(x)
 	case ast.EnumExpr:
-		return c.enum(x, func(expr ast.Expr) TypeRef {
-			return c.infer(expr)
+		// The values of variants may be types or values.
+		variant := len(x) == 1 && x[0].Typ == nil
+		ref := c.enum(x, func(expr ast.Expr) TypeRef {
+			if c.isListType(expr) {
+				return c.typ(expr)
+			}
+			ref := c.infer(expr)
+			if typ := c.reg.Resolve(ref).Denoted(); typ != UnknownRef {
+				return typ
+			}
+			variant = true
+			return ref
 		})
+		// A lone tag, like `#none`, or one with a value, like `#ok 5`, is a
+		// variant of any enum with the tag; #ok of an int in the latter.
+		if variant && len(x) == 1 {
+			return c.reg.openType(ref)
+		}
+		return ref
 
 	case *ast.FuncExpr:
 		// Not sure how to juggle vars vs unbound. :/
 		binder := c.reg.Var()
 		c.bind(c.source.GetString(x.Arg.Span()), binder)
+		if id, ok := x.Arg.(*ast.Ident); ok {
+			c.def(id, binder)
+		}
 		defer c.unbind()
 		ret := c.infer(x.Body)
 		return c.reg.Func(binder, ret)
@@ -124,6 +200,13 @@ func (c *context) infer(expr ast.Expr) TypeRef {
 	case ast.MatchFuncExpr:
 		argTy := c.reg.Var()
 		bodyTy := c.reg.Var()
+		defer func(n int) {
+			// The function accepts only the tags of its alternatives.
+			for _, v := range c.patterns[n:] {
+				c.reg.close(v)
+			}
+			c.patterns = c.patterns[:n]
+		}(len(c.patterns))
 		for _, opt := range x {
 			boundVars := c.match(&argTy, opt.Arg)
 			bodyTy = c.ensure(opt.Body, bodyTy, c.infer(opt.Body))
@@ -155,27 +238,13 @@ func (c *context) infer(expr ast.Expr) TypeRef {
 		case token.APPEND:
 			return c.pend(x.Right, x.Left, right, left)
 		case token.CONCAT:
-			if left == TextRef || right == TextRef {
-				c.ensure(x, left, right)
-				return TextRef
-			}
-			if left == BytesRef || right == BytesRef {
-				c.ensure(x, left, right)
-				return BytesRef
-			}
-			// Local var to ensure left and right are lists.
-			a := c.reg.List(c.reg.Var())
-			c.ensure(x, left, right)
-			c.ensure(x, left, a)
-			return a
+			c.constrain(x.Op, x.Left, left, Concat)
+			c.constrain(x.Op, x.Right, right, Concat)
+			return c.ensure(x, left, right)
 		case token.ADD, token.SUB, token.MUL:
-			if left == FloatRef || right == FloatRef {
-				c.ensure(x, left, right)
-				return FloatRef
-			}
-			// Assume int, like ML does.
-			c.ensure(x.Left, left, IntRef)
-			return c.ensure(x.Right, right, IntRef)
+			c.constrain(x.Op, x.Left, left, Num)
+			c.constrain(x.Op, x.Right, right, Num)
+			return c.ensure(x, left, right)
 
 		// Pipes are essentially just calls.
 		case token.LPIPE:
@@ -183,23 +252,29 @@ func (c *context) infer(expr ast.Expr) TypeRef {
 		case token.RPIPE:
 			return c.call(x, x.Right, x.Left)
 		}
-		panic(fmt.Sprintf("can't infer binary expression %s", x.Op.String()))
+		c.bail(x.Span(), fmt.Sprintf("cannot infer the type of %s yet", x.Op.Op()))
+	case *ast.AccessExpr:
+		return c.access(x)
 	case *ast.ImportExpr:
 		if c.inferImport == nil {
 			c.bail(x.Span(), "<internal error> missing infer import function")
 		}
-		bs, err := hex.DecodeString(c.source.GetString(x.Value.Pos.TrimStart(2)))
+		bs, err := x.Hash(&c.source)
 		if err != nil {
 			c.bail(x.Span(), fmt.Sprintf("bad import hash %#v", x))
 		}
 		ref, err := c.inferImport(x.HashAlgo, bs)
 		if err != nil {
-			c.bail(x.Span(), err.Error())
+			c.bailWith(x.Span(), err)
 		}
-		return ref
+		// Imported scraps are closed, so any free variables in their
+		// type may be generalized. Each use gets a fresh instance,
+		// leaving the variables of the imported type untouched.
+		return c.reg.Instantiate(c.reg.generalize(ref))
 	}
 
-	panic(fmt.Sprintf("can't infer node %T", expr))
+	c.bail(expr.Span(), fmt.Sprintf("cannot infer the type of %T yet", expr))
+	return NeverRef
 }
 
 func (c *context) ensure(x ast.Expr, got, want TypeRef) TypeRef {
@@ -220,6 +295,19 @@ func (c *context) ensure(x ast.Expr, got, want TypeRef) TypeRef {
 	return want
 }
 
+// constrain bails unless the type of an operand x of an operator may be
+// of a class, constraining it to the class if it's a variable.
+func (c *context) constrain(op token.Token, x ast.Expr, ref TypeRef, cl Class) {
+	if c.reg.constrain(ref, cl) {
+		return
+	}
+	msg := fmt.Sprintf("%s requires %s, not %s", op.Op(), cl.Members(), c.reg.ErrorString(ref))
+	if op == token.ADD && c.reg.mayBe(ref, Concat) {
+		msg += "; use ++ to concatenate"
+	}
+	c.bail(x.Span(), msg)
+}
+
 func (c *context) call(x, fn, arg ast.Expr) TypeRef {
 	res := c.reg.Var()
 	fnTy := c.infer(fn)
@@ -239,6 +327,7 @@ func (c *context) match(ty *TypeRef, expr ast.Expr) int {
 		}
 
 		c.bind(name, *ty)
+		c.def(expr, *ty)
 		return 1
 
 	case *ast.Literal:
@@ -246,6 +335,9 @@ func (c *context) match(ty *TypeRef, expr ast.Expr) int {
 		return 0
 
 	case *ast.BinaryExpr:
+		if expr.Op == token.PIPE {
+			return c.matchOr(ty, expr)
+		}
 		if expr.Op == token.PREPEND {
 			val := c.reg.Var()
 			valList := c.reg.List(val)
@@ -275,6 +367,48 @@ func (c *context) match(ty *TypeRef, expr ast.Expr) int {
 		}
 		return bindings
 
+	case *ast.RecordExpr:
+		ref := c.reg.Resolve(*ty)
+		rec := c.reg.GetRecord(ref)
+		if rec == nil || c.reg.open[c.reg.boundVar(*ty)] {
+			// Without a known record type, the pattern matches any record
+			// with its keys, of an open record type.
+			if expr.Rest != nil {
+				c.bail(expr.Rest.Span(), "cannot match the rest of a record of unknown type")
+			}
+			rec = make(MapRef, len(expr.Entries))
+			order := make([]string, len(expr.Entries))
+			for i, e := range expr.Entries {
+				order[i] = c.source.GetString(e.Key.Pos)
+				rec[order[i]] = c.reg.Var()
+			}
+			*ty = c.ensure(expr, *ty, c.reg.openType(c.reg.RecordInOrder(rec, order)))
+			ref = c.reg.Resolve(*ty)
+			rec = c.reg.GetRecord(ref)
+		}
+
+		bindings := 0
+		for _, e := range expr.Entries {
+			key := c.source.GetString(e.Key.Pos)
+			if e.Drop {
+				c.bail(e.Key.Pos, "cannot drop keys in a pattern")
+			}
+			val, ok := rec[key]
+			if !ok {
+				c.bail(e.Key.Pos, fmt.Sprintf("record %s has no key %s", c.reg.ErrorString(ref), key))
+			}
+			bindings += c.match(&val, e.Val)
+		}
+		if expr.Rest != nil {
+			rest := maps.Clone(rec)
+			for _, e := range expr.Entries {
+				delete(rest, c.source.GetString(e.Key.Pos))
+			}
+			restRef := c.reg.Record(rest)
+			bindings += c.match(&restRef, expr.Rest)
+		}
+		return bindings
+
 	case *ast.VariantExpr:
 		bindings := 0
 		name := c.source.GetString(expr.Tag.Pos)
@@ -283,7 +417,8 @@ func (c *context) match(ty *TypeRef, expr ast.Expr) int {
 			vRef = c.reg.Var()
 			bindings += c.match(&vRef, expr.Typ)
 		}
-		ref := c.reg.Enum(map[string]TypeRef{name: vRef})
+		ref := c.reg.openType(c.reg.Enum(map[string]TypeRef{name: vRef}))
+		c.patterns = append(c.patterns, ref)
 		*ty = c.ensure(expr, *ty, ref)
 		return bindings
 
@@ -294,52 +429,184 @@ func (c *context) match(ty *TypeRef, expr ast.Expr) int {
 	return 0
 }
 
+// matchOr matches both alternatives of an or-pattern, which must bind
+// the same names to the same types, keeping the bindings of the left.
+func (c *context) matchOr(ty *TypeRef, expr *ast.BinaryExpr) int {
+	left := c.match(ty, expr.Left)
+	bound := make(map[string]TypeRef, left)
+	for s, i := c.scope, 0; i < left; s, i = s.parent, i+1 {
+		bound[s.name] = s.val
+	}
+
+	right := c.match(ty, expr.Right)
+	var extra []string
+	for s, i := c.scope, 0; i < right; s, i = s.parent, i+1 {
+		if ref, ok := bound[s.name]; ok {
+			c.ensure(expr.Right, s.val, ref)
+			delete(bound, s.name)
+		} else {
+			extra = append(extra, s.name)
+		}
+	}
+	if len(bound) > 0 {
+		name := slices.Sorted(maps.Keys(bound))[0]
+		c.bail(expr.Right.Span(), fmt.Sprintf("%s isn't bound in this alternative", name))
+	}
+	if len(extra) > 0 {
+		c.bail(expr.Left.Span(), fmt.Sprintf("%s isn't bound in this alternative", slices.Min(extra)))
+	}
+
+	for range right {
+		c.unbind()
+	}
+	return left
+}
+
 func (c *context) where(x *ast.WhereExpr) TypeRef {
+	return c.bindWhere(x, func() TypeRef {
+		return c.infer(x.Expr)
+	})
+}
+
+// bindWhere infers the type of a where-binding,
+// and binds its name while inferring in.
+func (c *context) bindWhere(x *ast.WhereExpr, in func() TypeRef) TypeRef {
 	name := c.source.GetString(x.Id.Pos)
 
 	// This where is type-only; semantics TBD?
 	if x.Val == nil {
-		c.bind(name, c.reg.generalize(c.typ(x.Typ)))
+		c.bind(name, c.reg.generalize(TypeOf(c.chainTyp(x, x.Typ))))
+		c.def(&x.Id, c.scope.val)
 		defer c.unbind()
-		return c.infer(x.Expr)
+		return in()
 	}
 
 	tyVal := c.infer(x.Val)
 
-	// If there's an annotation, make sure it matches the inferred type.
+	// If there's an annotation, make sure it matches the inferred type,
+	// which it then replaces.
 	if x.Typ != nil {
-		c.ensure(x.Typ, tyVal, c.typ(x.Typ))
+		typ := c.chainTyp(x, x.Typ)
+		c.ensure(x.Typ, tyVal, typ)
+		tyVal = typ
 	}
 
 	c.bind(name, c.reg.generalize(tyVal))
+	c.def(&x.Id, c.scope.val)
 	defer c.unbind()
-	return c.infer(x.Expr)
+	return in()
+}
+
+// chainTyp infers a type of a where-binding, like typ, except that it may
+// refer to the types of type-only bindings earlier in the where-chain too;
+// so that they may be defined in any order, like in
+// `point : { x : int, y : int } ; pair : { first : point, second : point }`.
+// Names in scope shadow those bindings, like they shadow names further
+// out; and of those, the nearest one is used.
+func (c *context) chainTyp(x *ast.WhereExpr, typ ast.Expr) TypeRef {
+	defer func(defs *typeDefs) { c.defs = defs }(c.defs)
+	c.defs = &typeDefs{
+		defs: make(map[string]*ast.WhereExpr),
+		refs: make(map[*ast.WhereExpr]TypeRef),
+	}
+	for w, ok := x, true; ok; w, ok = w.Expr.(*ast.WhereExpr) {
+		name := c.source.GetString(w.Id.Pos)
+		if _, ok := c.defs.defs[name]; !ok && w.Val == nil {
+			c.defs.defs[name] = w
+		}
+	}
+	if x.Val == nil {
+		c.defs.refs[x] = UnknownRef
+	}
+	return c.typ(typ)
 }
 
 func (c *context) typ(x ast.Expr) TypeRef {
 	switch x := x.(type) {
 	case *ast.Ident:
 		name := c.source.GetString(x.Pos)
-		ref := c.scope.Lookup(name)
-		if ref == NeverRef {
-			c.bail(x.Span(), fmt.Sprintf("unknown type %s", name))
+		bound := c.scope.Get(name)
+		if def, ok := c.defs.get(name); ok && bound == nil {
+			ref, inferred := c.defs.refs[def]
+			if !inferred {
+				c.defs.refs[def] = UnknownRef
+				ref = c.typ(def.Typ)
+				c.defs.refs[def] = ref
+			} else if ref == UnknownRef {
+				c.bail(x.Span(), fmt.Sprintf("type %s is defined in terms of itself", name))
+			}
+			return ref
 		}
-		return ref
+		if bound == nil && name == "list" {
+			c.bail(x.Span(), "list requires the type of its elements, like list int")
+		}
+		if bound == nil {
+			c.bail(x.Span(), suggest(fmt.Sprintf("unknown type %s", name), name, c.scope.Names()))
+		}
+		ref := bound.val
+		typ := c.reg.Resolve(ref).Denoted()
+		if typ == UnknownRef {
+			c.bail(x.Span(), fmt.Sprintf("%s isn't a type, but a value of type %s", name, c.reg.ErrorString(ref)))
+		}
+		return typ
 	case *ast.FuncExpr:
 		return c.reg.Func(
 			c.typ(x.Arg),
 			c.typ(x.Body),
 		)
+	case *ast.CallExpr:
+		if c.isListType(x) {
+			return c.reg.List(c.typ(x.Arg))
+		}
+		if id, ok := x.Fn.(*ast.Ident); ok && c.source.GetString(id.Pos) == "list" {
+			c.bail(id.Span(), "list is shadowed, so it isn't the type of lists")
+		}
+		c.bail(x.Span(), "only list may be applied to a type, like list int")
 	case ast.EnumExpr:
 		return c.enum(x, func(expr ast.Expr) TypeRef {
 			return c.typ(expr)
 		})
+	case *ast.RecordExpr:
+		if !x.IsType() {
+			break
+		}
+		ref := make(MapRef, len(x.Entries))
+		order := make([]string, len(x.Entries))
+		for i, e := range x.Entries {
+			order[i] = c.source.GetString(e.Key.Pos)
+			ref[order[i]] = c.typ(e.Val)
+		}
+		return c.reg.RecordInOrder(ref, order)
 	}
 
-	c.bail(x.Span(), fmt.Sprintf("cannot infer type of %T", x))
+	c.bail(x.Span(), fmt.Sprintf("%s isn't a type", c.source.GetString(x.Span())))
 	return NeverRef
 }
 
+// isListType reports whether x is a type of lists, like `list int`,
+// unless list is shadowed by a binding of the name.
+func (c *context) isListType(x ast.Expr) bool {
+	call, ok := x.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	id, ok := call.Fn.(*ast.Ident)
+	if !ok || c.source.GetString(id.Pos) != "list" {
+		return false
+	}
+	_, defined := c.defs.get("list")
+	return c.scope.Get("list") == nil && !defined
+}
+
+// get returns the type-only binding of a name, if any.
+func (d *typeDefs) get(name string) (*ast.WhereExpr, bool) {
+	if d == nil {
+		return nil, false
+	}
+	def, ok := d.defs[name]
+	return def, ok
+}
+
 func (c *context) list(x *ast.ListExpr) TypeRef {
 	res := NeverRef
 
@@ -351,7 +618,8 @@ func (c *context) list(x *ast.ListExpr) TypeRef {
 			continue
 		}
 
-		c.ensure(v, res, typ)
+		// Enums of different elements are merged.
+		res = c.ensure(v, res, typ)
 	}
 
 	if res == NeverRef {
@@ -361,79 +629,176 @@ func (c *context) list(x *ast.ListExpr) TypeRef {
 }
 
 func (c *context) record(x *ast.RecordExpr) TypeRef {
-	// If there is a rest/spread, our type is equal to that.
+	// If there is a rest/spread, our type is equal to that,
+	// unless keys are added to or dropped from it.
 	if x.Rest != nil {
 		rest := c.infer(x.Rest)
 		rec := c.reg.GetRecord(rest)
 		if rec == nil {
-			c.bail(x.Rest.Span(), fmt.Sprintf("cannot spread from non-record type %s", c.reg.String(rest)))
+			c.bail(x.Rest.Span(), fmt.Sprintf("cannot spread from non-record type %s", c.reg.ErrorString(rest)))
+		}
+		// Set when the keys of the record change.
+		var ref MapRef
+		var order []string
+		change := func() {
+			if ref == nil {
+				ref = maps.Clone(rec)
+				for _, field := range c.reg.Fields(rest) {
+					order = append(order, field.Name)
+				}
+				rec = ref
+			}
 		}
-		for k, v := range x.Entries {
+		for _, e := range x.Entries {
+			k, v := c.source.GetString(e.Key.Pos), e.Val
 			expected, ok := rec[k]
-			if !ok {
-				c.bail(v.Span(), fmt.Sprintf("cannot set %s not in the base record", k))
-
+			switch {
+			case e.Drop:
+				if !ok {
+					c.bail(e.Key.Pos, fmt.Sprintf("cannot drop %s, which isn't in the base record", k))
+				}
+				change()
+				delete(ref, k)
+				order = slices.DeleteFunc(order, func(name string) bool { return name == k })
+				continue
+			case e.Extend:
+				if ok {
+					c.bail(e.Key.Pos, fmt.Sprintf("cannot add %s, which is already in the base record", k))
+				}
+				change()
+				ref[k] = c.infer(v)
+				order = append(order, k)
+				continue
+			case !ok:
+				c.bail(e.Key.Pos, fmt.Sprintf("cannot set %s not in the base record; use +%s to add it", k, k))
 			}
 			actual := c.infer(v)
 			if actual != expected {
-				c.bail(v.Span(), fmt.Sprintf("type of %s must be %s, not %s", k, c.reg.String(expected), c.reg.String(actual)))
+				c.bail(v.Span(), fmt.Sprintf("type of %s must be %s, not %s", k, c.reg.ErrorString(expected), c.reg.ErrorString(actual)))
 			}
 		}
+		if ref != nil {
+			return c.reg.RecordInOrder(ref, order)
+		}
 		return rest
 	}
 
 	ref := make(MapRef, len(x.Entries))
-	for k, v := range x.Entries {
-		ref[k] = c.infer(v)
+	order := make([]string, len(x.Entries))
+	for i, e := range x.Entries {
+		order[i] = c.source.GetString(e.Key.Pos)
+		ref[order[i]] = c.infer(e.Val)
 	}
-	return c.reg.Record(ref)
+	return c.reg.RecordInOrder(ref, order)
 }
 
-func (c *context) enum(x ast.EnumExpr, rec InferFunc) TypeRef {
+func (c *context) access(x *ast.AccessExpr) TypeRef {
+	if imp, ok := x.Rec.(*ast.ImportExpr); ok && c.inferMember != nil {
+		if ref, ok := c.importedMember(imp, c.source.GetString(x.Key.Pos)); ok {
+			return ref
+		}
+	}
+
+	ref := c.reg.Resolve(c.infer(x.Rec))
+	rec := c.reg.GetRecord(ref)
+	if rec == nil {
+		c.bail(x.Rec.Span(), fmt.Sprintf("cannot access a key of non-record type %s", c.reg.ErrorString(ref)))
+	}
+	key := c.source.GetString(x.Key.Pos)
+	typ, ok := rec[key]
+	if !ok {
+		c.bail(x.Key.Pos, fmt.Sprintf("record %s has no key %s", c.reg.ErrorString(ref), key))
+	}
+	return typ
+}
+
+func (c *context) enum(x ast.EnumExpr, rec inferFunc) TypeRef {
 	ref := make(MapRef, len(x))
+	order := make([]string, 0, len(x))
 	for _, v := range x {
 		name := c.source.GetString(v.Tag.Pos)
+		if _, ok := ref[name]; ok {
+			c.bail(v.Tag.Pos, fmt.Sprintf("cannot define tag #%s more than once", name))
+		}
 		vRef := NeverRef
 		if v.Typ != nil {
 			vRef = rec(v.Typ)
 		}
 		ref[name] = vRef
+		order = append(order, name)
 	}
-	return c.reg.Enum(ref)
+	return c.reg.EnumInOrder(ref, order)
 }
 
 func (c *context) pick(x *ast.BinaryExpr, val ast.Expr) TypeRef {
-	ref := c.infer(x.Left)
+	// The left side may be any expression evaluating to a type; a name,
+	// an import, a record field or the result of a call.
+	ref := c.reg.Resolve(c.infer(x.Left))
+	switch typ := ref.Denoted(); {
+	case typ != UnknownRef:
+		ref = c.reg.Resolve(typ)
+	case ref.IsVar() || ref.IsUnbound():
+		c.bail(x.Left.Span(), fmt.Sprintf("cannot pick from %s, as the type it evaluates to isn't known here",
+			c.source.GetString(x.Left.Span())))
+	case c.reg.GetEnum(ref) != nil && !isEnumExpr(x.Left):
+		// Like `v::a ; v = e::a`; v is a value of the enum, not the enum,
+		// unlike in `(#a #b)::a`.
+		c.bail(x.Left.Span(), fmt.Sprintf("cannot pick from a value of enum %s; pick from the enum itself",
+			c.reg.ErrorString(ref)))
+	}
 	enum := c.reg.GetEnum(ref)
 	if enum == nil {
-		c.bail(x.Left.Span(), fmt.Sprintf("%s isn't an enum", c.reg.String(ref)))
+		c.bail(x.Left.Span(), fmt.Sprintf("%s isn't an enum", c.reg.ErrorString(ref)))
 	}
 
-	if id, ok := x.Right.(*ast.Ident); ok {
-		tag := c.source.GetString(id.Span())
-		typ, ok := enum[tag]
-		if !ok {
-			c.bail(id.Span(),
-				fmt.Sprintf("#%s isn't a valid option for enum %s",
-					tag, c.reg.String(ref)))
-		}
+	id, ok := x.Right.(*ast.Ident)
+	if !ok {
+		c.bail(x.Right.Span(), "cannot pick using a non-identifier")
+	}
+	tag := c.source.GetString(id.Span())
+	typ, ok := enum[tag]
+	if !ok {
+		msg := fmt.Sprintf("#%s isn't a valid option for enum %s", tag, c.reg.ErrorString(ref))
+		c.bail(id.Span(), suggestTag(msg, tag, slices.Sorted(maps.Keys(enum))))
+	}
 
-		// We expect no value.
-		if typ == NeverRef {
-			// But there was one.
-			if val != nil {
-				c.bail(val.Span(), fmt.Sprintf("#%s doesn't take any value", tag))
-			}
-		} else {
-			valRef := c.infer(val)
-			c.ensure(val, valRef, typ)
+	// We expect no value.
+	if typ == NeverRef {
+		// But there was one.
+		if val != nil {
+			c.bail(val.Span(), fmt.Sprintf("#%s doesn't take any value", tag))
 		}
+	} else {
+		if val == nil {
+			c.bail(x.Span(), fmt.Sprintf("#%s requires a value of type %s", tag, c.reg.ErrorString(typ)))
+		}
+		valRef := c.infer(val)
+		c.ensure(val, valRef, typ)
+	}
 
-		return ref
+	return ref
+}
+
+// suggest appends to an error message about an unknown name what it may
+// be a misspelling of, if any of names is like it.
+func suggest(msg, name string, names []string) string {
+	if s := spell.Suggest(name, names); s != "" {
+		return fmt.Sprintf("%s; did you mean %s?", msg, s)
 	}
+	return msg
+}
 
-	// TODO: better error handling?
-	return NeverRef
+// suggestTag is like suggest, but for tags of an enum.
+func suggestTag(msg, tag string, tags []string) string {
+	if s := spell.Suggest(tag, tags); s != "" {
+		return fmt.Sprintf("%s; did you mean #%s?", msg, s)
+	}
+	return msg
+}
+
+func isEnumExpr(x ast.Expr) bool {
+	_, ok := x.(ast.EnumExpr)
+	return ok
 }
 
 func literalTypeRef(tok token.Token) TypeRef {
@@ -464,6 +829,6 @@ func (c *context) pend(singleX, listX ast.Expr, single, list TypeRef) TypeRef {
 		return BytesRef
 	}
 
-	c.ensure(singleX, c.reg.List(single), list)
+	c.ensure(singleX, list, c.reg.List(single))
 	return list
 }
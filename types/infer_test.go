@@ -5,6 +5,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Victorystick/scrapscript/ast"
 	"github.com/Victorystick/scrapscript/parser"
 )
 
@@ -26,13 +27,67 @@ func TestInfer(t *testing.T) {
 		{`[1, 2]`, `list int`},
 		// Records
 		{`{ a = 1 }`, `{ a : int }`},
+		{`{ a, b } ; a = 1 ; b = "x"`, `{ a : int, b : text }`},
 		{`{ ..base, a = ~01 } ; base = { a = ~00 }`, `{ a : byte }`},
+		{`r.b.c ; r = { a = 1, b = { c = "x" } }`, `text`},
+		// Variables bound to polymorphic types are generalized too.
+		{`{ a = f 1, b = f "a" } ; f = h h ; h = x -> x`, `{ a : int, b : text }`},
+		{`{ ..base, +c = 1.0, a = 2 } ; base = { b = "x", a = 1 }`, `{ b : text, a : int, c : float }`},
+		{`{ ..base, -a, +c = 1.0 } ; base = { b = "x", a = 1 }`, `{ b : text, c : float }`},
+		{`{ ..base, -a, +a = "y" } ; base = { a = 1 }`, `{ a : text }`},
 		// // Enums
-		{`bool ; bool : #true #false`, `#false #true`},
-		{`e ; e : #l int #r`, `#l int #r`},
+		{`bool ; bool : #true #false`, `type (#true #false)`},
+		{`e ; e : #l int #r`, `type (#l int #r)`},
 		{`e::r ; e : #l int #r`, `#l int #r`},
 		{`e::l 4 ; e : #l int #r`, `#l int #r`},
+		// Types
+		{`type`, `type type`},
+		{`f ; f : type -> text = _ -> "a type"`, `type -> text`},
+		{`x ; x : list int = [1, 2]`, `list int`},
+		{`r ; r : { a : list int } = { a = [] }`, `{ a : list int }`},
+		{`f ; f : list int -> list (list text) = _ -> []`, `list int -> list (list text)`},
+		{`f ; f : (int -> int) -> int = g -> g 1`, `(int -> int) -> int`},
+		{`t::ok [1] ; t : #ok list int #none`, `#ok list int #none`},
+		{`f int ; f : type -> type = t -> t`, `type`},
 		{`(#horse text #zebra int)::horse "Lucy"`, `#horse text #zebra int`},
+		{`cfg.status::err "x" ; cfg = { status = status } ; status : #ok #err text`, `#ok #err text`},
+		{`((x -> x) bool)::true ; bool : #true #false`, `#true #false`},
+		{`t::l 1 ; t = e ; e : #l int #r`, `#l int #r`},
+		{`p ; point : { x : int, y : int } ; p : { first : point, second : point }`, `type { first : { x : int, y : int }, second : { x : int, y : int } }`},
+		{`p ; p : { first : point, second : point } ; point : { x : int, y : int }`, `type { first : { x : int, y : int }, second : { x : int, y : int } }`},
+		{`p ; p : (point) ; point : { x : int, y : int }`, `type { x : int, y : int }`},
+		{`p ; p : point -> int ; point : { x : int, y : int }`, `type ({ x : int, y : int } -> int)`},
+		{`p ; p : list point ; point : { x : int, y : int }`, `type (list { x : int, y : int })`},
+		{`p ; p : #a point #b ; point : { x : int, y : int }`, `type (#a { x : int, y : int } #b)`},
+		{`p ; p : point ; point : int`, `type int`},
+		{`p ; p : { a : list int }`, `type { a : list int }`},
+		{`p ; p : int -> int`, `type (int -> int)`},
+		// Names in scope shadow the types later in a where-chain, and the
+		// nearest of those is used.
+		{`(z ; z : t = 1 ; t : int) ; x : t = "a" ; t : text`, `int`},
+		{`(1 ; t : int) ; t : text ; x : t = "a"`, `int`},
+		{`(f ; n : int ; b : #k (a) #l ; a : n -> n ; f : a = x -> x + 1)`, `int -> int`},
+		{`(types.pick 0)::r ; types = { pick = _ -> e } ; e : #l int #r`, `#l int #r`},
+		// Anonymous variants
+		{`#ok 5`, `#ok int`},
+		{`[#ok 5, #err "x"]`, `list (#ok int #err text)`},
+		{`x -> [#ok x, #err "e"]`, `$0 -> list (#ok $0 #err text)`},
+		{`f (#err "x") ; f = | #ok n -> n | #err _ -> 0`, `int`},
+		{`[#ok 5, (#ok int #none)::none]`, `list (#ok int #none)`},
+		{`[#ok 5] +< #err "x"`, `list (#ok int #err text)`},
+		{`[#ok 5] ++ [#none]`, `list (#ok int #none)`},
+		{`y ; y : t = #ok 5 ; t : #ok int #err text`, `#ok int #err text`},
+		{`x -> [x, #b, #c]`, `(#b #c) -> list (#b #c)`},
+		{`x -> y -> [x, #c, y, #d]`, `(#c #d) -> (#c #d) -> list (#c #d)`},
+		// Record patterns
+		{`| { a, b = c } -> a + c`, `num $3 => { a : $3, b : $3 } -> $3`},
+		{`f (#config { cpus = 2, mem = 4 }) ; f = | #config { cpus, mem } -> cpus * mem | #none -> 0`, `int`},
+		{`f ; f : c -> int = | #config { cpus, mem } -> cpus * mem | #none -> 0 ; c : #config { cpus : int, mem : int } #none`, `(#config { cpus : int, mem : int } #none) -> int`},
+		{`{ a : int }`, `type { a : int }`},
+		// Record patterns match records with more keys.
+		{`f { a = 1, b = 2 } ; f = | { a } -> a`, `int`},
+		{`[f { a = 1, b = 2 }, f { a = "x" }] ; f = | { a } -> 1`, `list int`},
+		{`f ; f = | { a = 1 } -> 1 | { b = 2 } -> 2`, `{ a : int, b : int } -> int`},
 		// Functions
 		{`a -> a`, `$0 -> $0`},
 		{`_ -> "hi"`, `$0 -> text`},
@@ -40,8 +95,8 @@ func TestInfer(t *testing.T) {
 		{`(_ -> "hi") ()`, `text`},
 
 		// Prepend and append
-		{`a -> a >+ []`, `$1 -> list $1`},
-		{`a -> a +< int`, `list int -> list int`},
+		{`a -> a >+ []`, `$0 -> list $0`},
+		{`a -> a +< int`, `list (type int) -> list (type int)`},
 		{`a -> a >+ ~~1111`, `byte -> bytes`},
 		{`a -> a +< ~ff`, `bytes -> bytes`},
 
@@ -49,12 +104,20 @@ func TestInfer(t *testing.T) {
 		{`"hi " ++ "you!"`, `text`},
 		{`[] ++ [1]`, `list int`},
 		{`~~1111 ++ ~~`, `bytes`},
-		{`a -> b -> a ++ b`, `list $2 -> list $2 -> list $2`},
+		{`a -> b -> a ++ b`, `concat $1 => $1 -> $1 -> $1`},
+		{`a -> a ++ []`, `list $1 -> list $1`},
+		{`f "a" ; f = a -> a ++ a`, `text`},
+		{`f [1] ; f = a -> b -> a ++ b`, `list int -> list int`},
 
 		// Math
 		{`a -> 1.0 + a`, `float -> float`},
 		{`4 - 3`, `int`},
-		{`a -> b -> a * b`, `int -> int -> int`}, // Default to int.
+		{`a -> b -> a * b`, `num $1 => $1 -> $1 -> $1`},
+		{`f 1 ; f = a -> a * a`, `int`},
+		{`f 1.0 ; f = a -> a * a`, `float`},
+		{`f ; f = a -> a * a`, `num $1 => $1 -> $1`},
+		{`[f 1, f 2] ; f = a -> b -> a - b`, `list (int -> int)`},
+		{`| [] -> 0.0 | [x] ++ _ -> x`, `list float -> float`},
 
 		{`a -> b -> { a = a, b = b }`, `$0 -> $1 -> { a : $0, b : $1 }`},
 		{`(a -> b -> { a = a, b = b }) 1`, `$2 -> { a : int, b : $2 }`},
@@ -88,7 +151,7 @@ func TestInfer(t *testing.T) {
 
 		; notfound = (status 404 <| page "not found")
 		; status = code -> body -> { code = code, body = body }
-		; page = body -> "<!doctype html><html><body>" ++ body ++ "</body></html>"`, `text -> { body : text, code : int }`},
+		; page = body -> "<!doctype html><html><body>" ++ body ++ "</body></html>"`, `text -> { code : int, body : text }`},
 		{`t
 ; t :
   #a a
@@ -97,7 +160,7 @@ func TestInfer(t *testing.T) {
 ; a :
   #x
   #y
-  #z`, `#a (#x #y #z) #b int #c byte`},
+  #z`, `type (#a (#x #y #z) #b int #c byte)`},
 
 		{`| n >+ ns -> ns`, `list $2 -> list $2`},
 		{`| ns +< n -> ns`, `list $2 -> list $2`},
@@ -109,12 +172,15 @@ func TestInfer(t *testing.T) {
 		{`| [1, 2] ++ ns -> ns <| [1, 2, 3]`, `list int`},
 		{`| ns ++ [2, last] -> ns +< last <| [1, 2, 3]`, `list int`},
 		// Is empty.
-		{`| [] -> #true | _ -> #false`, `list $2 -> #false #true`},
-		{`| a >+ _ -> #first a | _ -> #empty`, `list $2 -> #empty #first $2`},
+		{`| [] -> #true | _ -> #false`, `list $2 -> #true #false`},
+		{`| a >+ _ -> #first a | _ -> #empty`, `list $2 -> #first $2 #empty`},
 		// Unifies nested types.
-		{`| [] -> { empty = #true } | _ -> { empty = #false }`, `list $2 -> { empty : (#false #true) }`},
+		{`| [] -> { empty = #true } | _ -> { empty = #false }`, `list $2 -> { empty : (#true #false) }`},
 		{`| 1 -> { list = [] } | _ -> { list = [ 1 ] }`, `int -> { list : list int }`},
-		{`| #true -> [1] | #false -> []`, `(#false #true) -> list int`},
+		{`| #true -> [1] | #false -> []`, `(#true #false) -> list int`},
+		// Or-patterns.
+		{`| "a" | "b" -> 1 | _ -> 0`, `text -> int`},
+		{`| #l x | #r x -> x + 1`, `(#l int #r int) -> int`},
 	}
 
 	for _, ex := range examples {
@@ -135,20 +201,64 @@ func TestInfer(t *testing.T) {
 func TestInferFailure(t *testing.T) {
 	examples := []struct{ source, message string }{
 		// Unbound
-		{`b ; a = b -> b`, `unbound variable: b`},
+		{`b ; a = b -> b`, `unknown variable b`},
+		// Not yet supported
+		{`f >> f ; f = a -> a`, `cannot infer the type of >> yet`},
+		// Enums
+		{`f (#err "x") ; f = | #ok n -> n`, `has no tag #err`},
+		{`[y, #err "x"] ; y : #ok int = #ok 5`, `cannot unify '#ok int' with '#err text': #ok int has no tag #err`},
 		// Lists
 		{`[1, 1.0]`, `cannot unify 'int' with 'float'`},
 		{`[4] ++ ["text"]`, `cannot unify 'int' with 'text'`},
-		{`4 ++ 6`, `cannot unify 'int' with 'list $0'`},
+		{`4 ++ 6`, `++ requires text, bytes or a list, not int`},
+		{`"a" + "b"`, `+ requires int or float, not text; use ++ to concatenate`},
+		// Only + hints at ++.
+		{`[1] - [2]`, "- requires int or float, not list int\n"},
+		{`"a" * "b"`, "* requires int or float, not text\n"},
+		{`a -> a + (a ++ a)`, `+ requires int or float, not concat $0 => $0; use ++ to concatenate`},
+		{`f "a" ; f = a -> a * a`, `cannot unify 'num $2 => $2' with 'text': text isn't int or float`},
+		{`f 1 ; f = a -> b -> a ++ b`, `cannot unify 'concat $3 => $3' with 'int': int isn't text, bytes or a list`},
 		// Records
 		{`{ ..base, a = 1 } ; base = { a = ~00 }`, `type of a must be byte, not int`},
 		{`{ ..1, a = 1 }`, `cannot spread from non-record type int`},
+		{`{ ..base, b = 1 } ; base = { a = 1 }`, `cannot set b not in the base record; use +b to add it`},
+		{`{ ..base, +a = 1 } ; base = { a = 1 }`, `cannot add a, which is already in the base record`},
+		{`{ ..base, -b } ; base = { a = 1 }`, `cannot drop b, which isn't in the base record`},
+		{`r.b ; r = { a = 1 }`, `record { a : int } has no key b`},
+		{`r.b ; r = 1`, `cannot access a key of non-record type int`},
+		{`f { a = 1 } ; f = | { b } -> b`, `cannot unify`},
+		{`f ; f : { a : int } -> int = | { b } -> b`, `cannot unify`},
+		{`| { ..r, a } -> a`, `cannot match the rest of a record of unknown type`},
+		{`f { b = 1 } ; f = | { a } -> a`, `{ b : int } has no key a`},
+		{`f { a = 1 } ; f = r -> (| { a } -> a) r + (| { b } -> b) r`, `{ a : int } has no key b`},
+		{`f { a = 1, b = 2 } ; f : { a : int } -> int = | { a } -> a`, `cannot unify`},
 		// Enums
 		{`1::a`, `int isn't an enum`},
+		{`f 1 ; f : type -> text = _ -> "a type"`, `cannot unify 'type' with 'int'`},
 		{`a::a ; a : #b`, `#a isn't a valid option for enum #b`},
+		{`hand::lft 5 ; hand : #left int #right int`, `#lft isn't a valid option for enum #left int #right int; did you mean #left?`},
+		{`lenght ; length = 1`, `unknown variable lenght; did you mean length?`},
+		{`p ; p : pont ; point : int`, `unknown type pont; did you mean point?`},
+		{`x ; t : list t ; x : t`, `type t is defined in terms of itself`},
+		{`f ; f = t -> (x ; x : t = 1) ; t : int`, `t isn't a type, but a value of type $0`},
 		{`a::b 1 ; a : #b`, `#b doesn't take any value`},
+		{`a::b ; a : #b int`, `#b requires a value of type int`},
+		{`t::r ; t = int`, `int isn't an enum`},
+		{`a ; a : #x a`, `type a is defined in terms of itself`},
+		{`x ; x : list int = ["a"]`, `cannot unify 'text' with 'int'`},
+		{`x ; x : list = []`, `list requires the type of its elements, like list int`},
+		{`x ; x : int list = []`, `only list may be applied to a type, like list int`},
+		{`x ; x : f int = [] ; f = a -> a`, `only list may be applied to a type, like list int`},
+		{`x ; x : 1 = 1`, `1 isn't a type`},
+		// A shadowed list isn't the type of lists.
+		{`x ; x : list int = [ 1 ] ; list = a -> a`, `list is shadowed, so it isn't the type of lists`},
+		{`a ; a : #x b ; b : #y a`, `type b is defined in terms of itself`},
+		{`v::r ; v = e::r ; e : #l int #r`, `cannot pick from a value of enum #l int #r; pick from the enum itself`},
+		{`f e ; f = t -> t::r ; e : #l int #r`, `cannot pick from t, as the type it evaluates to isn't known here`},
+		{`a ; a : #b #c int #b text`, `cannot define tag #b more than once`},
 		{`a::b 1 ; a : #b text`, `cannot unify 'int' with 'text'`},
-		{`1 + ~dd`, `cannot unify 'byte' with 'int'`},
+		{`1 + ~dd`, `+ requires int or float, not byte`},
+		{`1 + 1.0`, `cannot unify 'int' with 'float'`},
 		{`a ; a : int = 1.0`, `cannot unify 'float' with 'int'`},
 		{`f ; f : int -> text = a -> 1`, `cannot unify 'int' with 'text'`},
 		// Math
@@ -159,6 +269,10 @@ func TestInferFailure(t *testing.T) {
 		{`| [] -> #box int | _ -> #box text`, `cannot unify 'int' with 'text'`},
 		// Different input types.
 		{`| #box n -> [ n + 1 ] | #box "o" -> []`, `cannot unify 'int' with 'text'`},
+		// Alternatives of or-patterns bind the same names to the same types.
+		{`| #l x | #r y -> x`, `x isn't bound in this alternative`},
+		{`| #l x | #r _ -> 1`, `x isn't bound in this alternative`},
+		{`| [ x ] | x -> 1`, `occurs check failed`},
 		// Different fields.
 		{`| [] -> { a = 1 } | _ -> { b = 1 }`, `cannot unify '{ a : int }' with '{ b : int }'`},
 	}
@@ -178,6 +292,49 @@ func TestInferFailure(t *testing.T) {
 	}
 }
 
+func TestInferFailureAbbreviated(t *testing.T) {
+	examples := []struct{ source, message, verbose string }{
+		// The fields only one of the records has are shown.
+		{
+			`| [] -> { a = 1, b = 2, c = 3, d = 4, e = 5 } | _ -> { a = 1, b = 2, c = 3, d = 4, f = 5 }`,
+			`cannot unify '{ e : int, … 4 more fields }' with '{ f : int, … 4 more fields }'`,
+			`cannot unify '{ a : int, b : int, c : int, d : int, e : int }' with '{ a : int, b : int, c : int, d : int, f : int }'`,
+		},
+		// Otherwise, the first few.
+		{
+			`r.z ; r = { a = 1, b = 2, c = 3, d = 4, e = 5, f = 6 }`,
+			`record { a : int, b : int, c : int, d : int, … 2 more fields } has no key z`,
+			`record { a : int, b : int, c : int, d : int, e : int, f : int } has no key z`,
+		},
+		{
+			`[{ a = 1, b = 2, c = 3, d = 4, e = 5 }, 1]`,
+			`cannot unify '{ a : int, b : int, c : int, d : int, … 1 more field }' with 'int'`,
+			`cannot unify '{ a : int, b : int, c : int, d : int, e : int }' with 'int'`,
+		},
+		// Small records are shown in full.
+		{
+			`[{ a = 1, b = 2, c = 3, d = 4 }, 1]`,
+			`cannot unify '{ a : int, b : int, c : int, d : int }' with 'int'`,
+			`cannot unify '{ a : int, b : int, c : int, d : int }' with 'int'`,
+		},
+	}
+
+	for _, ex := range examples {
+		for _, verbose := range []bool{false, true} {
+			reg := Registry{Verbose: verbose}
+			se := must(parser.ParseExpr(ex.source))
+			_, err := Infer(&reg, DefaultScope(&reg), se, nil)
+			message := ex.message
+			if verbose {
+				message = ex.verbose
+			}
+			if err == nil || !strings.Contains(err.Error(), message) {
+				t.Errorf("Expected '%s' to be in error:\n%v", message, err)
+			}
+		}
+	}
+}
+
 func TestInferInScope(t *testing.T) {
 	examples := []struct{ source, typ string }{
 		{`len`, `list $0 -> int`},
@@ -242,9 +399,10 @@ func TestInferImport(t *testing.T) {
 		{in: `$sha256~~`, imp: a, result: `$0`},
 		{in: `a ; a = $sha256~~`, imp: a, result: `$0`},
 		{in: `$sha256~~ [ 1, 2 ]`, imp: reg.Func(a, a), result: `list int`},
-		// TODO: Aliasing allocates new type vars, just importing does not. :/
-		{in: `a ; a = $sha256~~`, imp: reg.Func(a, a), result: `$2 -> $2`},
-		{in: `a ; a = $sha256~~`, imp: reg.Func(a, a), result: `$3 -> $3`},
+		// Every use of an import is instantiated independently.
+		{in: `$sha256~~`, imp: reg.Func(a, a), result: `$3 -> $3`},
+		{in: `a ; a = $sha256~~`, imp: reg.Func(a, a), result: `$5 -> $5`},
+		{in: `{ a = $sha256~~ 1, b = $sha256~~ "" }`, imp: reg.Func(a, a), result: `{ a : int, b : text }`},
 	}
 
 	for _, ex := range examples {
@@ -267,5 +425,107 @@ func TestInferImport(t *testing.T) {
 				t.Errorf("Expected %s, got %s", ex.result, typStr)
 			}
 		}
+
+		// The imported type must never be bound by its uses.
+		if !reg.IsFree(a) {
+			t.Errorf("Import of '%s' bound the imported type to %s", ex.in, reg.String(a))
+		}
+	}
+}
+
+func TestInferInfo(t *testing.T) {
+	var reg Registry
+	se := must(parser.ParseExpr(`(| [x] ++ xs -> f x) [1] ; f = n -> n + 1 ; t : #a #b`))
+	var info Info
+	must(InferInfo(&reg, DefaultScope(&reg), se, nil, &info))
+
+	defs := make(map[string]string)
+	for id, ref := range info.Defs {
+		defs[se.Source.GetString(id.Pos)] = reg.String(ref)
+	}
+	expected := map[string]string{
+		"t":  "type (#a #b)",
+		"f":  "int -> int",
+		"n":  "int",
+		"x":  "int",
+		"xs": "list int",
+	}
+	if fmt.Sprint(defs) != fmt.Sprint(expected) {
+		t.Errorf("Expected defs %v, got %v", expected, defs)
+	}
+}
+
+func TestInferInfoTypes(t *testing.T) {
+	var reg Registry
+	se := must(parser.ParseExpr(`f [1, 2] ; f = | [] -> 0 | [x] ++ _ -> x + 1 ; e = #a #b int`))
+	var info Info
+	must(InferInfo(&reg, DefaultScope(&reg), se, nil, &info))
+
+	typs := make(map[string]string)
+	for x, ref := range info.Types {
+		typs[se.Source.GetString(x.Span())] = reg.String(ref)
+	}
+	expected := map[string]string{
+		"f [1, 2]": "int",
+		"f":        "list int -> int",
+		"[1, 2]":   "list int",
+		"1":        "int",
+		"2":        "int",
+		"[] -> 0":  "list int -> int",
+		"0":        "int",
+		// Both the alternative and its body.
+		"[x] ++ _ -> x + 1": "list int -> int",
+		"x + 1":             "int",
+		"x":                 "int",
+		"#a":                "#a #b int",
+		"#b int":            "#a #b int",
+		"int":               "type int",
+	}
+	for src, typ := range expected {
+		if typs[src] != typ {
+			t.Errorf("Expected type of '%s' to be %s, got %s", src, typ, typs[src])
+		}
+	}
+
+	// Match functions and enums have the types of their alternatives and variants.
+	where := se.Expr.(*ast.WhereExpr).Expr.(*ast.WhereExpr)
+	for _, x := range []ast.Expr{where.Val, se.Expr.(*ast.WhereExpr).Val} {
+		if got := info.TypeOf(x); got == UnknownRef {
+			t.Errorf("Missing type of '%s'", se.Source.GetString(x.Span()))
+		}
+	}
+	if got := reg.String(info.TypeOf(&where.Id)); got != "list int -> int" {
+		t.Errorf("Expected the type of f to be list int -> int, got %s", got)
+	}
+}
+
+func TestInferDeterministic(t *testing.T) {
+	// Instantiating the types of records and enums with many polymorphic
+	// fields makes fresh variables for each; which must be numbered alike
+	// however Go orders their maps.
+	sources := []string{
+		`r ; r = { a = x -> x, b = x -> x, c = x -> [x], d = x -> x, e = x -> x, f = x -> x }`,
+		`{ ..r, a = 1 } ; r = { a = 0, b = f, c = f, d = f, e = f } ; f = x -> x`,
+		`| { a = a, b = b, c = c, d = d } -> { a = b, b = c, c = d, d = a }`,
+		`x ; x : #a int #b int #c int #d int ; ok = #a 1`,
+		`(f -> { a = f, b = f, c = f, d = f }) (x -> [x])`,
+	}
+
+	for _, source := range sources {
+		want := ""
+		for i := range 50 {
+			se := must(parser.ParseExpr(source))
+			var reg Registry
+			typ, err := Infer(&reg, DefaultScope(&reg), se, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := reg.String(typ)
+			if i == 0 {
+				want = got
+			} else if got != want {
+				t.Fatalf("%s: got %s, then %s", source, want, got)
+			}
+		}
 	}
 }
@@ -0,0 +1,91 @@
+package types
+
+import "github.com/Victorystick/scrapscript/ast"
+
+// Info holds type information about a scrap, recorded during inference.
+//
+// Inference stops at the first error, so Info is partial for ill-typed
+// scraps. It still describes all bindings inferred until then, which is
+// what editors need to complete incomplete code.
+type Info struct {
+	// Defs maps the identifiers that bind names to their types:
+	// where-bindings, function arguments and names in patterns.
+	Defs map[*ast.Ident]TypeRef
+
+	// Types maps the expressions inferred as values to their types.
+	// Match functions and enums aren't comparable, so the types of
+	// each of their alternatives and variants are those of the whole.
+	// The types may contain variables bound later in the inference;
+	// a Registry resolves them.
+	Types map[ast.Expr]TypeRef
+}
+
+// InferInfo is like Infer, but also records type information in info.
+func InferInfo(reg *Registry, scope TypeScope, se ast.SourceExpr, inferImport InferImport, info *Info) (TypeRef, error) {
+	info.init()
+	return infer(reg, scope, se, inferImport, info)
+}
+
+// init makes the maps of info, unless it's nil.
+func (info *Info) init() {
+	if info == nil {
+		return
+	}
+	if info.Defs == nil {
+		info.Defs = make(map[*ast.Ident]TypeRef)
+	}
+	if info.Types == nil {
+		info.Types = make(map[ast.Expr]TypeRef)
+	}
+}
+
+// TypeOf returns the type of an expression, or of the name an identifier
+// binds, or UnknownRef if it wasn't inferred.
+func (info *Info) TypeOf(x ast.Expr) TypeRef {
+	switch x := x.(type) {
+	case ast.MatchFuncExpr:
+		if len(x) > 0 {
+			return info.TypeOf(x[0])
+		}
+		return UnknownRef
+	case ast.EnumExpr:
+		if len(x) > 0 {
+			return info.TypeOf(x[0])
+		}
+		return UnknownRef
+	case *ast.Ident:
+		if ref, ok := info.Defs[x]; ok {
+			return ref
+		}
+	}
+	if ref, ok := info.Types[x]; ok {
+		return ref
+	}
+	return UnknownRef
+}
+
+// def records the type of a binding identifier.
+func (c *context) def(id *ast.Ident, ref TypeRef) {
+	if c.info != nil {
+		c.info.Defs[id] = ref
+	}
+}
+
+// recordType records the type of an expression.
+func (c *context) recordType(x ast.Expr, ref TypeRef) {
+	if c.info == nil {
+		return
+	}
+	switch x := x.(type) {
+	case ast.MatchFuncExpr:
+		for _, alt := range x {
+			c.info.Types[alt] = ref
+		}
+	case ast.EnumExpr:
+		for _, variant := range x {
+			c.info.Types[variant] = ref
+		}
+	default:
+		c.info.Types[x] = ref
+	}
+}
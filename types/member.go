@@ -0,0 +1,101 @@
+package types
+
+import (
+	"fmt"
+
+	"github.com/Victorystick/scrapscript/ast"
+)
+
+// An InferMember infers the type of a member of an imported library,
+// like `$sha256~~<hash>.key`, or reports false if it can't without
+// inferring all of the imported scrap; see InferLibraryMember.
+type InferMember func(algo string, hash []byte, key string) (TypeRef, bool, error)
+
+// InferMembers is like InferInfo, but infers accesses to members of
+// imported scraps, like `$sha256~~<hash>.key`, with inferMember; so that
+// the other members of libraries needn't be inferred. Info may be nil.
+func InferMembers(reg *Registry, scope TypeScope, se ast.SourceExpr, inferImport InferImport, inferMember InferMember, info *Info) (TypeRef, error) {
+	info.init()
+	c := context{
+		source:      se.Source,
+		reg:         reg,
+		scope:       scope,
+		inferImport: inferImport,
+		inferMember: inferMember,
+		info:        info,
+	}
+	return c.run(func() TypeRef {
+		return c.infer(se.Expr)
+	})
+}
+
+// IsLibrary reports whether a scrap is a library with a member key:
+// a record literal, optionally in where-chains, with an entry key,
+// but no spread.
+func IsLibrary(source ast.SourceExpr, key string) bool {
+	x := source.Expr
+	for where, ok := x.(*ast.WhereExpr); ok; where, ok = x.(*ast.WhereExpr) {
+		x = where.Expr
+	}
+	rec, ok := x.(*ast.RecordExpr)
+	if !ok || rec.Rest != nil {
+		return false
+	}
+	for _, e := range rec.Entries {
+		if source.Source.GetString(e.Key.Pos) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// InferLibraryMember infers the type of the member key of a library,
+// without inferring its other members. The where-bindings around it are
+// inferred, whether the member uses them or not. The scrap must be a
+// library with the member; see IsLibrary.
+func InferLibraryMember(reg *Registry, scope TypeScope, se ast.SourceExpr, key string, inferImport InferImport, inferMember InferMember) (TypeRef, error) {
+	c := context{
+		source:      se.Source,
+		reg:         reg,
+		scope:       scope,
+		inferImport: inferImport,
+		inferMember: inferMember,
+	}
+	return c.run(func() TypeRef {
+		return c.member(se.Expr, key)
+	})
+}
+
+func (c *context) member(x ast.Expr, key string) TypeRef {
+	switch x := x.(type) {
+	case *ast.WhereExpr:
+		return c.bindWhere(x, func() TypeRef {
+			return c.member(x.Expr, key)
+		})
+	case *ast.RecordExpr:
+		for _, e := range x.Entries {
+			if c.source.GetString(e.Key.Pos) == key {
+				return c.infer(e.Val)
+			}
+		}
+	}
+	c.bail(x.Span(), fmt.Sprintf("not a library with a member %s", key))
+	return NeverRef
+}
+
+// importedMember infers the type of a member of an imported library.
+func (c *context) importedMember(x *ast.ImportExpr, key string) (TypeRef, bool) {
+	bs, err := x.Hash(&c.source)
+	if err != nil {
+		c.bail(x.Span(), fmt.Sprintf("bad import hash %#v", x))
+	}
+	ref, ok, err := c.inferMember(x.HashAlgo, bs, key)
+	if err != nil {
+		c.bailWith(x.Span(), err)
+	}
+	if !ok {
+		return NeverRef, false
+	}
+	// Like imported scraps, members of them are closed.
+	return c.reg.Instantiate(c.reg.generalize(ref)), true
+}
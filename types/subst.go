@@ -3,16 +3,16 @@ package types
 import "strings"
 
 // A single substitution.
-type Sub struct {
+type sub struct {
 	// Must be a variable.
 	replace TypeRef
 	with    TypeRef
 }
 
 // A set of substitutions.
-type Subst []Sub
+type substitutions []sub
 
-func (s Subst) binds(target TypeRef) bool {
+func (s substitutions) binds(target TypeRef) bool {
 	for _, s := range s {
 		if s.replace == target {
 			return true
@@ -21,7 +21,7 @@ func (s Subst) binds(target TypeRef) bool {
 	return false
 }
 
-func (s Subst) bound(target TypeRef) TypeRef {
+func (s substitutions) bound(target TypeRef) TypeRef {
 	for _, s := range s {
 		if s.replace == target {
 			return s.with
@@ -30,12 +30,12 @@ func (s Subst) bound(target TypeRef) TypeRef {
 	return NeverRef
 }
 
-func (s *Subst) bind(replace, with TypeRef) {
-	*s = append(*s, Sub{replace, with})
+func (s *substitutions) bind(replace, with TypeRef) {
+	*s = append(*s, sub{replace, with})
 }
 
 // For debugging.
-func (s Subst) String(reg *Registry) string {
+func (s substitutions) String(reg *Registry) string {
 	var b strings.Builder
 
 	for i, s := range s {
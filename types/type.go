@@ -1,10 +1,14 @@
 package types
 
 import (
+	"errors"
+	"fmt"
 	"maps"
 	"slices"
 	"strconv"
 	"strings"
+
+	"github.com/Victorystick/scrapscript/token"
 )
 
 // The type's tag within a Registry. An implementation detail.
@@ -18,6 +22,8 @@ const (
 	recordTag
 	unboundTag
 	varTag
+	typeTag
+	opaqueTag
 )
 
 var tagNames = [...]string{
@@ -28,6 +34,8 @@ var tagNames = [...]string{
 	recordTag:    "record",
 	unboundTag:   "unbound",
 	varTag:       "var",
+	typeTag:      "type",
+	opaqueTag:    "opaque",
 }
 
 // Efficiently encodes a type reference within a Registry.
@@ -85,6 +93,33 @@ func (ref TypeRef) IsVar() bool {
 	return ref.hasTag(varTag)
 }
 
+// IsType returns true if the TypeRef is the type of a type value.
+func (ref TypeRef) IsType() bool {
+	return ref.hasTag(typeTag)
+}
+
+// IsOpaque returns true if the TypeRef is an opaque type.
+func (ref TypeRef) IsOpaque() bool {
+	return ref.hasTag(opaqueTag)
+}
+
+// TypeOf returns the TypeRef of type values, like `int` or `#a #b`,
+// that denote the type ref. Since the denoted type is encoded within
+// the TypeRef, these need no Registry.
+func TypeOf(ref TypeRef) TypeRef {
+	return makeTypeRef(typeTag, int(ref))
+}
+
+// Denoted returns the type denoted by values of the TypeRef,
+// or UnknownRef if it isn't the type of type values.
+func (ref TypeRef) Denoted() TypeRef {
+	tag, index := ref.extract()
+	if tag != typeTag {
+		return UnknownRef
+	}
+	return TypeRef(index)
+}
+
 const (
 	// Shortcut to the TypeRef for Never.
 	NeverRef TypeRef = TypeRef(int(primitiveTag) | (iota << 4)) // Inlined makeTypeRef
@@ -94,9 +129,22 @@ const (
 	TextRef
 	ByteRef
 	BytesRef
+	// The element type of empty list values, which unifies with any type.
+	// Only values have it; inference gives `[]` a fresh variable instead.
+	EmptyRef
+	// A type that isn't known, like that of functions of scripts at runtime.
+	// It doesn't unify with anything, not even itself.
+	UnknownRef
+	// The kind of all type values, named type. The type value `int` is of
+	// the type `type int`, which unifies with type, but not `type text`.
+	KindRef
 )
 
-var primitives = [...]TypeRef{NeverRef, HoleRef, IntRef, FloatRef, TextRef, ByteRef, BytesRef}
+// unassigned is what type variables point to before they are bound.
+const unassigned TypeRef = -1
+
+// The primitives that are bound by name.
+var primitives = [...]TypeRef{NeverRef, HoleRef, IntRef, FloatRef, TextRef, ByteRef, BytesRef, KindRef}
 
 var primitiveNames = [...]string{
 	"never",
@@ -106,6 +154,9 @@ var primitiveNames = [...]string{
 	"text",
 	"byte",
 	"bytes",
+	"_",
+	"?",
+	"type",
 }
 
 type FuncRef struct {
@@ -116,6 +167,10 @@ type MapRef map[string]TypeRef
 
 // Contains the types of a running application.
 type Registry struct {
+	// Verbose makes errors print record types in full, rather than
+	// abbreviating those with many fields; see ErrorString.
+	Verbose bool
+
 	// The number of unique unbound types.
 	unbound int
 	// Lists just have a TypeRef.
@@ -125,30 +180,181 @@ type Registry struct {
 	// Enums and records are maps to TypeRefs.
 	enums   []MapRef
 	records []MapRef
+	// The declaration order of the keys of each enum and record,
+	// or nil if sorted.
+	enumOrder   [][]string
+	recordOrder [][]string
 	// Type variables that will point to another type,
-	// or NeverRef if not yet assigned.
+	// or unassigned if not yet bound.
 	//
 	// Schemes are types with unbound TypeRefs. When instantiating a type,
 	// all unbound types will be replaced with fresh vars instead.
 	vars []TypeRef
+	// The classes of the unbound types and free variables that have one.
+	classes map[TypeRef]Class
+	// The free variables bound to enums that may still gain tags, or
+	// records that may still gain keys; those of variants like `#ok 5` and
+	// record patterns like `{ a }`, whose types are known only in part.
+	open map[TypeRef]bool
+	// The open variables of generalized types, which each instance of them
+	// replaces with its own; unlike those of others, which are shared.
+	generic map[TypeRef]bool
+	// Opaque types are only known by their names.
+	opaques []string
+	// The most types the Registry may hold; unlimited if zero.
+	limit int
+
+	// Indexes from each type to its position in the slices above,
+	// so that looking up a type takes constant time. They are
+	// created lazily, keeping the zero Registry ready to use.
+	// Enums and records are indexed by their canonical key.
+	listIndex   map[TypeRef]int
+	funcIndex   map[FuncRef]int
+	enumIndex   map[string]int
+	recordIndex map[string]int
+	opaqueIndex map[string]int
+}
+
+// Clone returns a deep copy of the Registry. All TypeRefs valid for the
+// Registry remain valid, and equal, in the clone.
+func (c *Registry) Clone() Registry {
+	return Registry{
+		Verbose: c.Verbose,
+		unbound: c.unbound,
+		lists:   slices.Clone(c.lists),
+		funcs:   slices.Clone(c.funcs),
+		enums:   slices.Clone(c.enums),
+		records: slices.Clone(c.records),
+		vars:    slices.Clone(c.vars),
+		classes: maps.Clone(c.classes),
+		open:    maps.Clone(c.open),
+		generic: maps.Clone(c.generic),
+		opaques: slices.Clone(c.opaques),
+		limit:   c.limit,
+
+		enumOrder:   slices.Clone(c.enumOrder),
+		recordOrder: slices.Clone(c.recordOrder),
+
+		listIndex:   maps.Clone(c.listIndex),
+		funcIndex:   maps.Clone(c.funcIndex),
+		enumIndex:   maps.Clone(c.enumIndex),
+		recordIndex: maps.Clone(c.recordIndex),
+		opaqueIndex: maps.Clone(c.opaqueIndex),
+	}
 }
 
 // Returns the number of types in the registry, for debugging.
 func (c *Registry) Size() int {
-	return len(c.lists) + len(c.funcs) + len(c.enums) + len(c.records)
+	return len(c.lists) + len(c.funcs) + len(c.enums) + len(c.records) + len(c.opaques)
+}
+
+// ErrTooManyTypes is returned when a Registry would outgrow its Limit.
+var ErrTooManyTypes = errors.New("too many types")
+
+// A limitError is what a Registry panics with when it would outgrow its
+// Limit; inference returns it, and RecoverLimit turns it into an error.
+type limitError struct{ err error }
+
+// Limit bounds the number of types that the Registry may hold, as
+// counted by Size, or unbounds it if zero. Creating more types panics,
+// which inference and Decode turn into an error wrapping
+// ErrTooManyTypes, as RecoverLimit does for other callers.
+func (c *Registry) Limit(limit int) {
+	c.limit = limit
+}
+
+// grow panics if the Registry can't hold another type.
+func (c *Registry) grow() {
+	if c.limit > 0 && c.Size() >= c.limit {
+		panic(limitError{fmt.Errorf("%w: the limit is %d", ErrTooManyTypes, c.limit)})
+	}
+}
+
+// RecoverLimit sets *err to the error of a Registry outgrowing its
+// Limit, if that is what the caller is panicking with. It must be
+// deferred directly, like recover.
+func RecoverLimit(err *error) {
+	if pnc := recover(); pnc != nil {
+		e, ok := pnc.(limitError)
+		if !ok {
+			panic(pnc)
+		}
+		*err = e.err
+	}
 }
 
 // Strings returns a string representation for TypeRef.
+//
+// The keys of enums and records are printed in declaration order.
 func (c *Registry) String(ref TypeRef) string {
 	var s stringer
 	s.reg = c
 	s.string(ref, 0)
-	return s.String()
+	return s.result()
+}
+
+// The most fields of a record that errors print, unless Verbose.
+const maxErrorFields = 4
+
+// ErrorString returns a string representation for TypeRef, like String,
+// for use in errors. Unless the Registry is Verbose, records with more than
+// a few fields are abbreviated, like `{ a : int, … 12 more fields }`, so
+// that big records don't overwhelm the message.
+func (c *Registry) ErrorString(ref TypeRef) string {
+	return c.errorString(ref, nil)
+}
+
+// errorString is like ErrorString, but if ref is an abbreviated record,
+// only the fields in focus are printed, as those an error is about.
+func (c *Registry) errorString(ref TypeRef, focus []string) string {
+	var s stringer
+	s.reg = c
+	s.abbreviate = !c.Verbose
+	s.focus = focus
+	s.string(ref, 0)
+	return s.result()
+}
+
+// CanonicalString returns a string representation for TypeRef, with the
+// keys of enums and records sorted, and type variables named by their
+// first appearance. Equal types have the same canonical string regardless
+// of how they were declared, which makes it suitable for hashing and
+// comparing types across Registries.
+func (c *Registry) CanonicalString(ref TypeRef) string {
+	var s stringer
+	s.reg = c
+	s.canonical = true
+	s.string(ref, 0)
+	return s.result()
+}
+
+// Params returns the string representation of a function type, like String,
+// along with the spans of its curried parameters within that string.
+func (c *Registry) Params(ref TypeRef) (string, []token.Span) {
+	var s stringer
+	s.reg = c
+	var params []token.Span
+	for ref = c.Resolve(ref); ref.IsFunction(); ref = c.Resolve(ref) {
+		fn := c.funcs[ref.index()]
+		start := s.Len()
+		s.string(fn.Arg, 1)
+		params = append(params, token.Span{Start: start, End: s.Len()})
+		s.WriteString(" -> ")
+		ref = fn.Result
+	}
+	s.string(ref, 0)
+	// Constraints are prefixed, moving the parameters.
+	str := s.result()
+	for i := range params {
+		params[i].Start += len(str) - s.Len()
+		params[i].End += len(str) - s.Len()
+	}
+	return str, params
 }
 
 // List returns the TypeRef for a list type.
 func (c *Registry) List(ref TypeRef) TypeRef {
-	return findOrAdd(&c.lists, listTag, ref)
+	return findOrAdd(c, &c.lists, &c.listIndex, listTag, ref, ref)
 }
 
 // GetList returns the TypeRef for a list type.
@@ -161,9 +367,43 @@ func (c *Registry) GetList(ref TypeRef) (res TypeRef) {
 	return c.lists[index]
 }
 
+// Common returns the type of values of both the types a and b, which are
+// the same, but for the elements of empty lists, which may be of any type,
+// and enums, whose tags are merged.
+// It's for checking values at runtime, whose types have no variables.
+func (c *Registry) Common(a, b TypeRef) (TypeRef, bool) {
+	switch {
+	case a == b || b == EmptyRef:
+		return a, true
+	case a == EmptyRef:
+		return b, true
+	case a.IsList() && b.IsList():
+		elem, ok := c.Common(c.GetList(a), c.GetList(b))
+		return c.List(elem), ok
+	case a.hasTag(enumTag) && b.hasTag(enumTag):
+		// Like unify, merges the tags of enums.
+		enum := maps.Clone(c.GetEnum(a))
+		order := c.keys(enumTag, a.index())
+		for _, key := range c.keys(enumTag, b.index()) {
+			typ := c.GetEnum(b)[key]
+			if other, ok := enum[key]; ok {
+				if typ, ok = c.Common(other, typ); !ok {
+					return a, false
+				}
+			} else {
+				order = append(order, key)
+			}
+			enum[key] = typ
+		}
+		return c.EnumInOrder(enum, order), true
+	}
+	return a, false
+}
+
 // Func returns the TypeRef for a function type.
 func (c *Registry) Func(from, to TypeRef) TypeRef {
-	return findOrAdd(&c.funcs, funcTag, FuncRef{from, to})
+	fn := FuncRef{from, to}
+	return findOrAdd(c, &c.funcs, &c.funcIndex, funcTag, fn, fn)
 }
 
 // GetFunc returns the TypeRef for an function type.
@@ -177,7 +417,19 @@ func (c *Registry) GetFunc(ref TypeRef) (res FuncRef) {
 
 // Enum returns the TypeRef for an enum type.
 func (c *Registry) Enum(ref MapRef) TypeRef {
-	return findOrAddMap(&c.enums, enumTag, ref)
+	return c.EnumInOrder(ref, nil)
+}
+
+// EnumInOrder returns the TypeRef for an enum type, whose tags are printed
+// in the given order. Enums with the same tags are the same type, so only
+// the order given when the type is first created is kept.
+func (c *Registry) EnumInOrder(ref MapRef, order []string) TypeRef {
+	n := len(c.enums)
+	typ := findOrAddMap(c, &c.enums, &c.enumIndex, enumTag, ref)
+	if len(c.enums) > n {
+		c.enumOrder = append(c.enumOrder, order)
+	}
+	return typ
 }
 
 // GetEnum returns the TypeRef for an enum type.
@@ -191,7 +443,19 @@ func (c *Registry) GetEnum(ref TypeRef) MapRef {
 
 // Record returns the TypeRef for a record type.
 func (c *Registry) Record(ref MapRef) TypeRef {
-	return findOrAddMap(&c.records, recordTag, ref)
+	return c.RecordInOrder(ref, nil)
+}
+
+// RecordInOrder returns the TypeRef for a record type, whose keys are
+// printed in the given order. As with EnumInOrder, only the order given
+// when the type is first created is kept.
+func (c *Registry) RecordInOrder(ref MapRef, order []string) TypeRef {
+	n := len(c.records)
+	typ := findOrAddMap(c, &c.records, &c.recordIndex, recordTag, ref)
+	if len(c.records) > n {
+		c.recordOrder = append(c.recordOrder, order)
+	}
+	return typ
 }
 
 // GetRecord returns the TypeRef for an record type.
@@ -203,6 +467,52 @@ func (c *Registry) GetRecord(ref TypeRef) MapRef {
 	return c.records[index]
 }
 
+// Opaque returns the TypeRef for an opaque type, whose values only its
+// creator can make or inspect, like database handles passed by a host.
+// Opaque types with the same name are the same type, and only unify
+// with themselves.
+func (c *Registry) Opaque(name string) TypeRef {
+	return findOrAdd(c, &c.opaques, &c.opaqueIndex, opaqueTag, name, name)
+}
+
+// A Field is a key of a record type, or a tag of an enum type,
+// with its type. Tags without a value have the type NeverRef.
+type Field struct {
+	Name string
+	Type TypeRef
+}
+
+// Fields returns the fields of a record type in declaration order,
+// or nil if ref isn't a record.
+func (c *Registry) Fields(ref TypeRef) []Field {
+	return c.fields(recordTag, c.Resolve(ref))
+}
+
+// Tags returns the tags of an enum type in declaration order,
+// or nil if ref isn't an enum.
+func (c *Registry) Tags(ref TypeRef) []Field {
+	return c.fields(enumTag, c.Resolve(ref))
+}
+
+func (c *Registry) fields(t tag, ref TypeRef) []Field {
+	tag, index := ref.extract()
+	if tag != t {
+		return nil
+	}
+	var m MapRef
+	if tag == recordTag {
+		m = c.records[index]
+	} else {
+		m = c.enums[index]
+	}
+	keys := c.keys(tag, index)
+	fields := make([]Field, len(keys))
+	for i, key := range keys {
+		fields[i] = Field{key, m[key]}
+	}
+	return fields
+}
+
 // Unbound returns a new unbound TypeRef.
 func (c *Registry) Unbound() (ref TypeRef) {
 	ref = makeTypeRef(unboundTag, c.unbound)
@@ -214,7 +524,7 @@ func (c *Registry) Unbound() (ref TypeRef) {
 // Var returns a new variable TypeRef.
 func (c *Registry) Var() (ref TypeRef) {
 	i := len(c.vars)
-	c.vars = append(c.vars, NeverRef)
+	c.vars = append(c.vars, unassigned)
 	return makeTypeRef(varTag, i)
 }
 
@@ -224,22 +534,24 @@ func (c *Registry) Resolve(ref TypeRef) TypeRef {
 	if !ref.IsVar() {
 		return ref
 	}
-	other := c.Resolve(c.vars[ref.index()])
-	if other == NeverRef {
+	bound := c.vars[ref.index()]
+	if bound == unassigned {
 		return ref
 	}
-	c.vars[ref.index()] = other
+	other := c.Resolve(bound)
+	// Variables stay bound to those of open types, to see what they gain.
+	if v := c.boundVar(bound); c.open[v] {
+		c.vars[ref.index()] = v
+	} else {
+		c.vars[ref.index()] = other
+	}
 	return other
 }
 
-// GetVar returns the TypeRef for an record type.
+// GetVar returns the type a variable is bound to,
+// or the variable itself if it's not yet bound.
 func (c *Registry) GetVar(ref TypeRef) TypeRef {
-	c.Resolve(ref)
-	tag, index := ref.extract()
-	if tag != varTag {
-		return ref
-	}
-	return c.vars[index]
+	return c.Resolve(ref)
 }
 
 func (c *Registry) IsFree(ref TypeRef) bool {
@@ -255,9 +567,9 @@ func VarString(ref TypeRef) string {
 	return "$" + strconv.FormatInt(int64(index), 10)
 }
 
-type MapTypeRef func(ref TypeRef)
+type visitor func(ref TypeRef)
 
-func (c *Registry) traverse(target TypeRef, mtr MapTypeRef) {
+func (c *Registry) traverse(target TypeRef, mtr visitor) {
 	tag, index := target.extract()
 	switch tag {
 	case listTag:
@@ -267,50 +579,129 @@ func (c *Registry) traverse(target TypeRef, mtr MapTypeRef) {
 		c.traverse(fn.Arg, mtr)
 		c.traverse(fn.Result, mtr)
 	case enumTag:
-		for _, v := range c.enums[index] {
-			c.traverse(v, mtr)
+		for _, k := range c.keys(enumTag, index) {
+			c.traverse(c.enums[index][k], mtr)
 		}
 	case recordTag:
-		for _, v := range c.records[index] {
-			c.traverse(v, mtr)
+		for _, k := range c.keys(recordTag, index) {
+			c.traverse(c.records[index][k], mtr)
 		}
+	case typeTag:
+		c.traverse(TypeRef(index), mtr)
 	}
 
 	mtr(target)
 }
 
-type Replacer func(ref TypeRef, isArg bool) TypeRef
+// Visit traverses a type in depth-first order, calling f for the type
+// and each type it's composed of, following bound variables. If f returns
+// false, the types within that type are skipped.
+func (c *Registry) Visit(ref TypeRef, f func(TypeRef) bool) {
+	ref = c.Resolve(ref)
+	if !f(ref) {
+		return
+	}
+
+	tag, index := ref.extract()
+	switch tag {
+	case listTag:
+		c.Visit(c.lists[index], f)
+	case funcTag:
+		fn := c.funcs[index]
+		c.Visit(fn.Arg, f)
+		c.Visit(fn.Result, f)
+	case enumTag, recordTag:
+		for _, field := range c.fields(tag, ref) {
+			c.Visit(field.Type, f)
+		}
+	case typeTag:
+		c.Visit(TypeRef(index), f)
+	}
+}
+
+type replacer func(ref TypeRef, isArg bool) TypeRef
 
-func (c *Registry) replace(target TypeRef, f Replacer, isArg bool) TypeRef {
+func (c *Registry) replace(target TypeRef, f replacer, isArg bool) TypeRef {
 	tag, index := target.extract()
 	switch tag {
 	case unboundTag:
 		return f(target, isArg)
 	case varTag:
-		return f(target, isArg)
+		// Replace what bound variables have been bound to; except for
+		// those of open enums and records, which f replaces to keep them
+		// open.
+		if v := c.boundVar(target); c.open[v] {
+			return f(v, isArg)
+		}
+		ref := c.Resolve(target)
+		if !ref.IsVar() {
+			return c.replace(ref, f, isArg)
+		}
+		return f(ref, isArg)
 	case listTag:
 		return c.List(c.replace(c.lists[index], f, isArg))
 	case funcTag:
 		fn := c.funcs[index]
 		return c.Func(c.replace(fn.Arg, f, true), c.replace(fn.Result, f, isArg))
 	case enumTag:
+		// In order, so that any variables f makes are numbered alike
+		// from run to run.
 		ref := make(MapRef, len(c.enums[index]))
-		for k, v := range c.enums[index] {
-			ref[k] = c.replace(v, f, isArg)
+		for _, k := range c.keys(enumTag, index) {
+			ref[k] = c.replace(c.enums[index][k], f, isArg)
 		}
-		return c.Enum(ref)
+		return c.EnumInOrder(ref, c.enumOrder[index])
 	case recordTag:
 		ref := make(MapRef, len(c.records[index]))
-		for k, v := range c.records[index] {
-			ref[k] = c.replace(v, f, isArg)
+		for _, k := range c.keys(recordTag, index) {
+			ref[k] = c.replace(c.records[index][k], f, isArg)
 		}
-		return c.Record(ref)
+		return c.RecordInOrder(ref, c.recordOrder[index])
+	case typeTag:
+		return TypeOf(c.replace(TypeRef(index), f, isArg))
 	}
 
 	// Else, the target remains unchanged.
 	return target
 }
 
+// boundVar returns the last variable of the chain ref starts, which is
+// bound to a type that isn't a variable, or unassigned if there's none.
+func (c *Registry) boundVar(ref TypeRef) TypeRef {
+	if !ref.IsVar() {
+		return unassigned
+	}
+	for {
+		next := c.vars[ref.index()]
+		if next == unassigned {
+			return unassigned
+		}
+		if !next.IsVar() {
+			return ref
+		}
+		ref = next
+	}
+}
+
+// openType returns a free variable bound to the enum or record, which
+// gains the tags or keys of the open enums or records it is unified with.
+// Enums remain open until closed; records until unified with a closed
+// record, whose keys are then all there are.
+func (c *Registry) openType(typ TypeRef) TypeRef {
+	v := c.Var()
+	c.vars[v.index()] = typ
+	if c.open == nil {
+		c.open = map[TypeRef]bool{}
+	}
+	c.open[v] = true
+	return v
+}
+
+// close stops the enum or record ref is bound to from gaining tags or keys.
+func (c *Registry) close(ref TypeRef) {
+	delete(c.open, c.boundVar(ref))
+}
+
 // bind binds a free variable to a type.
 func (reg *Registry) bind(a, b TypeRef) {
 	// Get to the bottom of `a`.
@@ -322,15 +713,37 @@ func (reg *Registry) bind(a, b TypeRef) {
 	reg.vars[a.index()] = b
 }
 
+// reopen replaces the open enum or record v with a new one, bound to a
+// replacement of its type by f; once per substitutions, so that all its
+// occurrences remain one type.
+func (c *Registry) reopen(subst *substitutions, v TypeRef, f replacer, isArg bool) TypeRef {
+	b := subst.bound(v)
+	if b == NeverRef {
+		b = c.openType(c.replace(c.Resolve(v), f, isArg))
+		subst.bind(v, b)
+	}
+	return b
+}
+
 // The opposite of instantiate.
 func (c *Registry) generalize(target TypeRef) TypeRef {
-	var subst Subst
-	return c.replace(target, func(other TypeRef, isArg bool) TypeRef {
+	var subst substitutions
+	var f replacer
+	f = func(other TypeRef, isArg bool) TypeRef {
+		if c.open[other] {
+			b := c.reopen(&subst, other, f, isArg)
+			if c.generic == nil {
+				c.generic = map[TypeRef]bool{}
+			}
+			c.generic[b] = true
+			return b
+		}
 		if other.IsVar() {
 			b := subst.bound(other)
 			if b == NeverRef {
 				if isArg {
 					b = c.Unbound()
+					c.setClass(b, c.classOf(other))
 					subst.bind(other, b)
 				} else {
 					return other
@@ -339,17 +752,23 @@ func (c *Registry) generalize(target TypeRef) TypeRef {
 			return b
 		}
 		return other
-	}, false)
+	}
+	return c.replace(target, f, false)
 }
 
 func (c *Registry) Instantiate(target TypeRef) TypeRef {
-	var subst Subst
-	return c.replace(target, func(other TypeRef, isArg bool) TypeRef {
+	var subst substitutions
+	var f replacer
+	f = func(other TypeRef, isArg bool) TypeRef {
+		if c.open[other] && c.generic[other] {
+			return c.reopen(&subst, other, f, isArg)
+		}
 		if other.IsUnbound() {
 			b := subst.bound(other)
 			if b == NeverRef {
 				if isArg {
 					b = c.Var()
+					c.setClass(b, c.classOf(other))
 					subst.bind(other, b)
 				} else {
 					return other
@@ -358,18 +777,35 @@ func (c *Registry) Instantiate(target TypeRef) TypeRef {
 			return b
 		}
 		return other
-	}, false)
+	}
+	return c.replace(target, f, false)
 }
 
 func (c *Registry) unify(a, b TypeRef) TypeRef {
+	// Open enums and records gain the tags and keys of those they are
+	// unified with. Variables are bound to the variables of open types
+	// rather than their types, so that all of them see what's gained later.
+	origA := a
+	varA, varB := c.boundVar(a), c.boundVar(b)
 	a = c.Resolve(a)
 	b = c.Resolve(b)
 
-	// Early out if they are already the same.
-	if a == b {
+	// Early out if they are already the same; unless open, and may close.
+	if a == b && a != UnknownRef && !c.open[varA] && !c.open[varB] {
 		return a
 	}
 
+	// Empty lists have elements of any type.
+	if a == EmptyRef {
+		return b
+	}
+	if b == EmptyRef {
+		return a
+	}
+	if a == UnknownRef || b == UnknownRef {
+		panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "': the type ? is not known")
+	}
+
 	tag, index := a.extract()
 	if tag == unboundTag {
 		panic("unexpected unbound var during unification")
@@ -381,13 +817,25 @@ func (c *Registry) unify(a, b TypeRef) TypeRef {
 				panic("occurs check failed")
 			}
 		})
-		c.vars[index] = b
+		if cl := c.classes[a]; cl != 0 && !c.constrain(b, cl) {
+			panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "': " + c.ErrorString(b) + " isn't " + cl.Members())
+		}
+		if c.open[varB] {
+			c.vars[index] = varB
+		} else {
+			c.vars[index] = b
+		}
 		return a
 	}
 
 	if b.IsVar() {
-		c.unify(b, a)
-		return a
+		c.unify(b, origA)
+		return origA
+	}
+
+	// Type values of any type are of the kind type.
+	if a == KindRef && b.IsType() || b == KindRef && a.IsType() {
+		return KindRef
 	}
 
 	bTag, bIndex := b.extract()
@@ -400,21 +848,52 @@ func (c *Registry) unify(a, b TypeRef) TypeRef {
 			c.unify(aFn.Arg, bFn.Arg)
 			c.unify(aFn.Result, bFn.Result)
 		case listTag:
-			c.unify(c.GetList(a), c.GetList(b))
+			return c.List(c.unify(c.GetList(a), c.GetList(b)))
 		case recordTag:
-			return c.unifyRecords(c.records[index], c.records[bIndex])
+			openA, openB := c.open[varA], c.open[varB]
+			merged := c.unifyRecords(index, bIndex, openA, openB)
+			for _, v := range []TypeRef{varA, varB} {
+				if v != unassigned {
+					c.vars[v.index()] = merged
+				}
+			}
+			if openA && openB {
+				return varA
+			}
+			// Records unified with closed ones have their keys.
+			delete(c.open, varA)
+			delete(c.open, varB)
+			return merged
 		case primitiveTag:
+			if a == NeverRef || b == NeverRef {
+				panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "': never has no values")
+			}
 			if index != bIndex {
-				panic("cannot unify '" + c.String(a) + "' with '" + c.String(b) + "'")
+				panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "'")
 			}
 		case enumTag:
-			return c.unifyEnums(c.enums[index], c.enums[bIndex])
+			openA, openB := c.open[varA], c.open[varB]
+			merged := c.unifyEnums(index, bIndex, openA, openB)
+			for _, v := range []TypeRef{varA, varB} {
+				if v != unassigned {
+					c.vars[v.index()] = merged
+				}
+			}
+			switch {
+			case openA:
+				return varA
+			case openB:
+				return varB
+			}
+			return merged
+		case typeTag:
+			return TypeOf(c.unify(TypeRef(index), TypeRef(bIndex)))
 		default:
-			panic("cannot unify '" + c.String(a) + "' with '" + c.String(b) + "'")
+			panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "'")
 		}
 		return a
 	} else {
-		panic("cannot unify '" + c.String(a) + "' with '" + c.String(b) + "'")
+		panic("cannot unify '" + c.ErrorString(a) + "' with '" + c.ErrorString(b) + "'")
 	}
 }
 
@@ -422,29 +901,122 @@ func ignoreValues(_, _ TypeRef) bool {
 	return true
 }
 
-func (reg *Registry) unifyRecords(a, b MapRef) TypeRef {
-	// We can't unify records with different keys.
-	if !maps.EqualFunc(a, b, ignoreValues) {
-		panic("cannot unify '" + reg.String(reg.Record(a)) + "' with '" + reg.String(reg.Record(b)) + "'")
+// Unifies two records, by index, keeping the order of the first that's
+// closed. Closed records must have all the keys of the other; so two of
+// them can't have different keys, but open ones are merged.
+func (reg *Registry) unifyRecords(a, b int, openA, openB bool) TypeRef {
+	// Panics unless the record in has all the keys of from.
+	missing := func(from, in int) {
+		for _, k := range reg.keys(recordTag, from) {
+			if _, ok := reg.records[in][k]; !ok {
+				panic("cannot unify '" + reg.ErrorString(makeTypeRef(recordTag, a)) + "' with '" + reg.ErrorString(makeTypeRef(recordTag, b)) +
+					"': " + reg.ErrorString(makeTypeRef(recordTag, in)) + " has no key " + k)
+			}
+		}
 	}
-	c := maps.Clone(a)
-	for k, v := range b {
-		c[k] = reg.unify(c[k], v)
+	switch {
+	case openA && openB:
+		c := maps.Clone(reg.records[a])
+		order := reg.keys(recordTag, a)
+		for _, k := range reg.keys(recordTag, b) {
+			if ov, ok := c[k]; ok {
+				c[k] = reg.unify(ov, reg.records[b][k])
+			} else {
+				c[k] = reg.records[b][k]
+				order = append(order, k)
+			}
+		}
+		return reg.RecordInOrder(c, order)
+	case openA:
+		missing(a, b)
+		return reg.unifyFields(b, a)
+	case openB:
+		missing(b, a)
+		return reg.unifyFields(a, b)
 	}
-	return reg.Record(c)
+
+	// We can't unify closed records with different keys.
+	if !maps.EqualFunc(reg.records[a], reg.records[b], ignoreValues) {
+		// The keys only one of them has are what the error is about.
+		var focus []string
+		for _, k := range reg.keys(recordTag, a) {
+			if _, ok := reg.records[b][k]; !ok {
+				focus = append(focus, k)
+			}
+		}
+		for _, k := range reg.keys(recordTag, b) {
+			if _, ok := reg.records[a][k]; !ok {
+				focus = append(focus, k)
+			}
+		}
+		panic("cannot unify '" + reg.errorString(makeTypeRef(recordTag, a), focus) + "' with '" + reg.errorString(makeTypeRef(recordTag, b), focus) + "'")
+	}
+	return reg.unifyFields(a, b)
+}
+
+// unifyFields unifies the fields of the record b with those of a, which
+// has all its keys, by index; keeping the order of a.
+func (reg *Registry) unifyFields(a, b int) TypeRef {
+	c := maps.Clone(reg.records[a])
+	for _, k := range reg.keys(recordTag, b) {
+		c[k] = reg.unify(c[k], reg.records[b][k])
+	}
+	return reg.RecordInOrder(c, reg.recordOrder[a])
 }
 
-// Merges two known-distinct maps.
-func (reg *Registry) unifyEnums(a, b MapRef) TypeRef {
-	c := maps.Clone(a)
-	for k, v := range b {
+// Merges two known-distinct enums, by index. Tags of the first keep
+// their order, followed by those only in the second. Only an open enum
+// may gain tags; a closed one must have all those of the other.
+func (reg *Registry) unifyEnums(a, b int, openA, openB bool) TypeRef {
+	// Panics unless the enum in has all the tags of from.
+	missing := func(from, in int) {
+		for _, k := range reg.keys(enumTag, from) {
+			if _, ok := reg.enums[in][k]; !ok {
+				panic("cannot unify '" + reg.ErrorString(makeTypeRef(enumTag, a)) + "' with '" + reg.ErrorString(makeTypeRef(enumTag, b)) +
+					"': " + reg.ErrorString(makeTypeRef(enumTag, in)) + " has no tag #" + k)
+			}
+		}
+	}
+	if !openA {
+		missing(b, a)
+	}
+	if !openB {
+		missing(a, b)
+	}
+
+	c := maps.Clone(reg.enums[a])
+	for _, k := range reg.keys(enumTag, b) {
+		v := reg.enums[b][k]
 		if ov, ok := c[k]; ok {
 			c[k] = reg.unify(ov, v)
 		} else {
 			c[k] = v
 		}
 	}
-	return reg.Enum(c)
+
+	// A closed enum keeps its order.
+	if openA && !openB {
+		return reg.EnumInOrder(c, reg.keys(enumTag, b))
+	}
+	order := reg.keys(enumTag, a)
+	for _, k := range reg.keys(enumTag, b) {
+		if _, ok := reg.enums[a][k]; !ok {
+			order = append(order, k)
+		}
+	}
+	return reg.EnumInOrder(c, order)
+}
+
+// keys returns the keys of an enum or record, by index, in order.
+func (reg *Registry) keys(tag tag, index int) []string {
+	m, order := reg.enums, reg.enumOrder
+	if tag == recordTag {
+		m, order = reg.records, reg.recordOrder
+	}
+	if order[index] != nil {
+		return slices.Clone(order[index])
+	}
+	return slices.Sorted(maps.Keys(m[index]))
 }
 
 // DebugString returns a string representation for TypeRef.
@@ -480,28 +1052,35 @@ func (reg *Registry) DebugString() string {
 	return s.String()
 }
 
-func findOrAdd[T comparable](ls *[]T, tag tag, el T) TypeRef {
-	list := *ls
-	for i, typ := range list {
-		if el == typ {
-			return makeTypeRef(tag, i)
-		}
+func findOrAdd[T any, K comparable](c *Registry, ls *[]T, index *map[K]int, tag tag, key K, el T) TypeRef {
+	if *index == nil {
+		*index = make(map[K]int)
+	}
+	if i, ok := (*index)[key]; ok {
+		return makeTypeRef(tag, i)
 	}
-	i := len(list)
-	*ls = append(list, el)
+	c.grow()
+	i := len(*ls)
+	*ls = append(*ls, el)
+	(*index)[key] = i
 	return makeTypeRef(tag, i)
 }
 
-func findOrAddMap(ls *[]MapRef, tag tag, el MapRef) TypeRef {
-	list := *ls
-	for i, typ := range list {
-		if maps.Equal(el, typ) {
-			return makeTypeRef(tag, i)
-		}
+func findOrAddMap(c *Registry, ls *[]MapRef, index *map[string]int, tag tag, el MapRef) TypeRef {
+	return findOrAdd(c, ls, index, tag, mapKey(el), el)
+}
+
+// mapKey returns a canonical key for a MapRef; equal MapRefs have equal keys.
+func mapKey(m MapRef) string {
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(m)) {
+		// Keys are identifiers, so they never contain NUL.
+		b.WriteString(key)
+		b.WriteByte(0)
+		b.WriteString(strconv.Itoa(int(m[key])))
+		b.WriteByte(0)
 	}
-	i := len(list)
-	*ls = append(list, el)
-	return makeTypeRef(tag, i)
+	return b.String()
 }
 
 var unboundNames = "abcdefghijklmnopqrstuvwxyz"
@@ -509,8 +1088,34 @@ var unboundNames = "abcdefghijklmnopqrstuvwxyz"
 type stringer struct {
 	strings.Builder
 	reg *Registry
+	// Whether to sort the keys of enums and records.
+	canonical bool
+	// Whether to abbreviate records with many fields, and the fields to
+	// print of the outermost one; or the first few if none are.
+	abbreviate bool
+	focus      []string
 	// Mapping from unbound index to
 	unbounds []int
+	// The classes of the variables printed, like `num a`.
+	constraints []string
+}
+
+// result returns the string, prefixed by the classes of its variables,
+// like `num a => a -> a`.
+func (b *stringer) result() string {
+	if len(b.constraints) == 0 {
+		return b.String()
+	}
+	return strings.Join(b.constraints, ", ") + " => " + b.String()
+}
+
+// constrain notes the class of a variable printed as name, if it has one.
+func (b *stringer) constrain(ref TypeRef, name string) {
+	if cl := b.reg.classes[ref]; cl != 0 {
+		if c := cl.String() + " " + name; !slices.Contains(b.constraints, c) {
+			b.constraints = append(b.constraints, c)
+		}
+	}
 }
 
 func (b *stringer) unbound(index int) {
@@ -518,6 +1123,12 @@ func (b *stringer) unbound(index int) {
 	if i == -1 {
 		i = len(b.unbounds)
 		b.unbounds = append(b.unbounds, index)
+		// Free variables are named like unbound types when canonical.
+		ref := makeTypeRef(unboundTag, index)
+		if index < 0 {
+			ref = makeTypeRef(varTag, -1-index)
+		}
+		b.constrain(ref, unboundNames[i:i+1])
 	}
 	b.WriteByte(unboundNames[i])
 	// b.WriteByte(unboundNames[index])
@@ -560,13 +1171,29 @@ func (b *stringer) string(ref TypeRef, nesting int) {
 		b.record(index)
 	case unboundTag:
 		b.unbound(index)
+	case typeTag:
+		if nesting > 1 {
+			b.WriteByte('(')
+		}
+		b.WriteString("type ")
+		b.string(TypeRef(index), 2)
+		if nesting > 1 {
+			b.WriteByte(')')
+		}
+	case opaqueTag:
+		b.WriteString(b.reg.opaques[index])
 	case varTag:
-		ref := b.reg.GetVar(ref)
-		if ref == NeverRef {
-			b.WriteByte('$')
-			b.WriteString(strconv.Itoa(index))
+		bound := b.reg.GetVar(ref)
+		if bound == ref && b.canonical {
+			// Name variables by their first appearance, like unbound types,
+			// rather than by their index in the Registry.
+			b.unbound(-1 - index)
+		} else if bound == ref {
+			name := "$" + strconv.Itoa(index)
+			b.constrain(ref, name)
+			b.WriteString(name)
 		} else {
-			b.string(ref, nesting)
+			b.string(bound, nesting)
 		}
 	default:
 		// The invalid type.
@@ -574,10 +1201,20 @@ func (b *stringer) string(ref TypeRef, nesting int) {
 	}
 }
 
+func (b *stringer) keys(tag tag, index int) []string {
+	if b.canonical {
+		if tag == recordTag {
+			return slices.Sorted(maps.Keys(b.reg.records[index]))
+		}
+		return slices.Sorted(maps.Keys(b.reg.enums[index]))
+	}
+	return b.reg.keys(tag, index)
+}
+
 func (b *stringer) enum(index int) {
 	e := b.reg.enums[index]
 	space := len(e) - 1
-	for _, key := range slices.Sorted(maps.Keys(e)) {
+	for _, key := range b.keys(enumTag, index) {
 		b.WriteByte('#')
 		b.WriteString(key)
 
@@ -596,9 +1233,28 @@ func (b *stringer) enum(index int) {
 
 func (b *stringer) record(index int) {
 	r := b.reg.records[index]
+	keys := b.keys(recordTag, index)
+	// Only the outermost record is focused.
+	focus := b.focus
+	b.focus = nil
+	hidden := 0
+	if b.abbreviate && len(keys) > maxErrorFields {
+		shown := keys[:maxErrorFields]
+		if focus != nil {
+			shown = slices.DeleteFunc(keys, func(key string) bool {
+				return !slices.Contains(focus, key)
+			})
+		}
+		hidden = len(r) - len(shown)
+		keys = shown
+	}
+
 	b.WriteString("{ ")
-	comma := len(r) - 1
-	for _, key := range slices.Sorted(maps.Keys(r)) {
+	comma := len(keys) - 1
+	if hidden > 0 {
+		comma++
+	}
+	for _, key := range keys {
 		b.WriteString(key)
 		b.WriteString(" : ")
 		b.string(r[key], 1)
@@ -608,5 +1264,11 @@ func (b *stringer) record(index int) {
 			b.WriteString(", ")
 		}
 	}
+	switch {
+	case hidden == 1:
+		b.WriteString("… 1 more field")
+	case hidden > 1:
+		b.WriteString("… " + strconv.Itoa(hidden) + " more fields")
+	}
 	b.WriteString(" }")
 }
@@ -1,6 +1,13 @@
 package types
 
-import "testing"
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Victorystick/scrapscript/parser"
+)
 
 func TestTypeRefDefaultsToNever(t *testing.T) {
 	reg := Registry{}
@@ -11,8 +18,8 @@ func TestTypeRefDefaultsToNever(t *testing.T) {
 func TestPrimitives(t *testing.T) {
 	reg := Registry{}
 
-	for i, ref := range primitives {
-		Eq(t, primitiveNames[i], reg.String(ref))
+	for _, ref := range primitives {
+		Eq(t, primitiveNames[ref.index()], reg.String(ref))
 	}
 }
 
@@ -52,6 +59,52 @@ func TestFunc(t *testing.T) {
 	Eq(t, reg.String(split), "text -> text -> list text")
 }
 
+func TestTypeOf(t *testing.T) {
+	reg := Registry{}
+
+	ints := reg.List(IntRef)
+	typ := TypeOf(ints)
+
+	Eq(t, typ.IsType(), true)
+	Eq(t, ints.IsType(), false)
+	Eq(t, typ.Denoted(), ints)
+	Eq(t, ints.Denoted(), UnknownRef)
+
+	Eq(t, reg.String(TypeOf(IntRef)), "type int")
+	Eq(t, reg.String(typ), "type (list int)")
+	Eq(t, reg.String(reg.Func(typ, TypeOf(typ))), "type (list int) -> type (type (list int))")
+
+	// Type values unify by the types they denote.
+	a := reg.Var()
+	Eq(t, reg.String(reg.unify(TypeOf(a), typ)), "type (list int)")
+	Eq(t, reg.Resolve(a), ints)
+}
+
+func TestOpaque(t *testing.T) {
+	reg := Registry{}
+
+	db := reg.Opaque("db")
+	Eq(t, db.IsOpaque(), true)
+	Eq(t, db, reg.Opaque("db"))
+	Neq(t, db, reg.Opaque("file"))
+
+	Eq(t, reg.String(db), "db")
+	Eq(t, reg.String(reg.Func(db, reg.List(db))), "db -> list db")
+	clone := reg.Clone()
+	Eq(t, clone.String(db), "db")
+
+	// Opaque types only unify with themselves, and variables.
+	a := reg.Var()
+	Eq(t, reg.unify(db, db), db)
+	reg.unify(a, db)
+	Eq(t, reg.Resolve(a), db)
+
+	defer func() {
+		Eq(t, recover(), any("cannot unify 'db' with 'file'"))
+	}()
+	reg.unify(db, reg.Opaque("file"))
+}
+
 func TestEnum(t *testing.T) {
 	reg := Registry{}
 
@@ -75,6 +128,21 @@ func TestEnum(t *testing.T) {
 	Eq(t, reg.String(reg.Enum(typ)), "#fun (int -> int)")
 }
 
+func TestEnumInOrder(t *testing.T) {
+	reg := Registry{}
+
+	zebra := reg.EnumInOrder(MapRef{"zebra": NeverRef, "horse": TextRef}, []string{"zebra", "horse"})
+	Eq(t, reg.String(zebra), "#zebra #horse text")
+
+	// The same tags are the same type, printed in the first order given.
+	Eq(t, reg.Enum(MapRef{"horse": TextRef, "zebra": NeverRef}), zebra)
+
+	// Merged enums keep the order of the first, then new tags of the second.
+	a := reg.openType(reg.EnumInOrder(MapRef{"c": NeverRef, "a": NeverRef}, []string{"c", "a"}))
+	b := reg.openType(reg.EnumInOrder(MapRef{"b": NeverRef, "a": NeverRef}, []string{"b", "a"}))
+	Eq(t, reg.String(reg.unify(a, b)), "#c #a #b")
+}
+
 func TestRecord(t *testing.T) {
 	reg := Registry{}
 
@@ -87,6 +155,45 @@ func TestRecord(t *testing.T) {
 	Eq(t, reg.String(reg.Record(typ)), "{ inc : (int -> int) }")
 }
 
+func TestRecordInOrder(t *testing.T) {
+	reg := Registry{}
+
+	ref := reg.RecordInOrder(MapRef{"y": IntRef, "x": TextRef}, []string{"y", "x"})
+	Eq(t, reg.String(ref), "{ y : int, x : text }")
+	Eq(t, reg.CanonicalString(ref), "{ x : text, y : int }")
+
+	zebra := reg.EnumInOrder(MapRef{"zebra": NeverRef, "horse": ref}, []string{"zebra", "horse"})
+	Eq(t, reg.String(zebra), "#zebra #horse { y : int, x : text }")
+	Eq(t, reg.CanonicalString(zebra), "#horse { x : text, y : int } #zebra")
+
+	// The canonical string doesn't depend on the order of declaration.
+	other := Registry{}
+	Eq(t, other.CanonicalString(other.Enum(MapRef{
+		"zebra": NeverRef,
+		"horse": other.Record(MapRef{"x": TextRef, "y": IntRef}),
+	})), reg.CanonicalString(zebra))
+}
+
+func TestManyRecords(t *testing.T) {
+	reg := Registry{}
+
+	refs := make([]TypeRef, 5000)
+	for i := range refs {
+		refs[i] = reg.Record(MapRef{"id": IntRef, strconv.Itoa(i): TextRef})
+	}
+	for i, ref := range refs {
+		// Constructing an equal map yields the same TypeRef.
+		Eq(t, reg.Record(MapRef{strconv.Itoa(i): TextRef, "id": IntRef}), ref)
+	}
+	Eq(t, reg.Size(), len(refs))
+
+	// A clone has its own indexes.
+	clone := reg.Clone()
+	Eq(t, clone.Record(MapRef{"new": IntRef}), reg.Record(MapRef{"new": IntRef}))
+	Eq(t, clone.Record(MapRef{"0": TextRef, "id": IntRef}), refs[0])
+	Eq(t, clone.Size(), reg.Size())
+}
+
 func TestGeneric(t *testing.T) {
 	reg := Registry{}
 
@@ -156,6 +263,103 @@ func TestGetVar(t *testing.T) {
 	Eq(t, reg.GetVar(a), IntRef)
 }
 
+func TestVarBoundToNever(t *testing.T) {
+	reg := Registry{}
+
+	a := reg.Var()
+	Eq(t, reg.GetVar(a), a)
+	reg.bind(a, NeverRef)
+
+	Eq(t, reg.IsFree(a), false)
+	Eq(t, reg.GetVar(a), NeverRef)
+	Eq(t, reg.String(reg.List(a)), "list never")
+}
+
+func TestEmpty(t *testing.T) {
+	reg := Registry{}
+
+	empty := reg.List(EmptyRef)
+	ints := reg.List(IntRef)
+	Eq(t, reg.String(empty), "list _")
+	Eq(t, reg.unify(empty, ints), ints)
+	Eq(t, reg.unify(ints, empty), ints)
+	Eq(t, reg.unify(empty, empty), empty)
+}
+
+func TestKind(t *testing.T) {
+	reg := Registry{}
+
+	ints := TypeOf(IntRef)
+	Eq(t, reg.String(KindRef), "type")
+	Eq(t, reg.unify(KindRef, ints), KindRef)
+	Eq(t, reg.unify(ints, KindRef), KindRef)
+	Eq(t, reg.unify(reg.List(ints), reg.List(KindRef)), reg.List(KindRef))
+
+	defer func() {
+		Eq(t, recover(), any("cannot unify 'type' with 'int'"))
+	}()
+	reg.unify(KindRef, IntRef)
+}
+
+func TestOpenEnums(t *testing.T) {
+	reg := Registry{}
+
+	a := reg.openType(reg.Enum(MapRef{"ok": IntRef}))
+	b := reg.Var()
+	reg.unify(b, a)
+	reg.unify(a, reg.openType(reg.Enum(MapRef{"err": TextRef})))
+	Eq(t, reg.String(a), "#ok int #err text")
+	// Variables bound to an open enum see the tags it gains.
+	Eq(t, reg.String(b), "#ok int #err text")
+
+	// An open enum must have only the tags of a closed one.
+	result := reg.Enum(MapRef{"ok": IntRef, "err": TextRef, "none": NeverRef})
+	Eq(t, reg.String(reg.unify(a, result)), "#err text #none #ok int")
+	Eq(t, reg.String(a), "#err text #none #ok int")
+}
+
+func TestCommon(t *testing.T) {
+	reg := Registry{}
+
+	ints := reg.List(IntRef)
+	empty := reg.List(EmptyRef)
+	common := func(a, b TypeRef) string {
+		typ, ok := reg.Common(a, b)
+		if !ok {
+			return "none"
+		}
+		return reg.String(typ)
+	}
+	Eq(t, common(IntRef, IntRef), "int")
+	Eq(t, common(IntRef, TextRef), "none")
+	Eq(t, common(empty, ints), "list int")
+	Eq(t, common(reg.List(ints), reg.List(empty)), "list (list int)")
+	Eq(t, common(reg.List(empty), ints), "none")
+	Eq(t, common(TypeOf(IntRef), KindRef), "none")
+	ok := reg.Enum(MapRef{"ok": IntRef})
+	Eq(t, common(ok, reg.Enum(MapRef{"err": TextRef})), "#ok int #err text")
+	Eq(t, common(ok, reg.Enum(MapRef{"ok": TextRef})), "none")
+}
+
+func TestUnifyErrors(t *testing.T) {
+	reg := Registry{}
+
+	unify := func(a, b TypeRef) (err any) {
+		defer func() { err = recover() }()
+		reg.unify(a, b)
+		return nil
+	}
+
+	Eq(t, unify(IntRef, NeverRef), any("cannot unify 'int' with 'never': never has no values"))
+	Eq(t, unify(UnknownRef, UnknownRef), any("cannot unify '?' with '?': the type ? is not known"))
+	Eq(t, unify(reg.List(TextRef), UnknownRef), any("cannot unify 'list text' with '?': the type ? is not known"))
+
+	// Only open enums gain tags.
+	result := reg.Enum(MapRef{"ok": IntRef, "err": TextRef})
+	Eq(t, unify(reg.openType(reg.Enum(MapRef{"none": NeverRef})), result), any("cannot unify '#none' with '#err text #ok int': #err text #ok int has no tag #none"))
+	Eq(t, unify(reg.Enum(MapRef{"ok": IntRef}), result), any("cannot unify '#ok int' with '#err text #ok int': #ok int has no tag #err"))
+}
+
 func TestResolve(t *testing.T) {
 	reg := Registry{}
 
@@ -204,3 +408,79 @@ func Eq[T comparable](t *testing.T, a, b T) {
 		t.Errorf("Expected %v to be %v", a, b)
 	}
 }
+
+func TestFieldsAndTags(t *testing.T) {
+	reg := Registry{}
+
+	rec := reg.RecordInOrder(MapRef{"y": IntRef, "x": TextRef}, []string{"y", "x"})
+	fields := reg.Fields(rec)
+	Eq(t, len(fields), 2)
+	Eq(t, fields[0], Field{"y", IntRef})
+	Eq(t, fields[1], Field{"x", TextRef})
+	Eq(t, len(reg.Tags(rec)), 0)
+
+	enum := reg.EnumInOrder(MapRef{"some": rec, "none": NeverRef}, []string{"some", "none"})
+	tags := reg.Tags(enum)
+	Eq(t, len(tags), 2)
+	Eq(t, tags[0], Field{"some", rec})
+	Eq(t, tags[1], Field{"none", NeverRef})
+
+	// Bound variables are followed.
+	v := reg.Var()
+	reg.bind(v, rec)
+	Eq(t, len(reg.Fields(v)), 2)
+}
+
+func TestVisit(t *testing.T) {
+	reg := Registry{}
+
+	rec := reg.RecordInOrder(MapRef{"y": IntRef, "x": TextRef}, []string{"y", "x"})
+	fn := reg.Func(reg.List(rec), ByteRef)
+
+	var visited []string
+	reg.Visit(fn, func(ref TypeRef) bool {
+		visited = append(visited, reg.String(ref))
+		return !ref.IsList()
+	})
+
+	Eq(t, strings.Join(visited, "; "), "list { y : int, x : text } -> byte; list { y : int, x : text }; byte")
+}
+
+func TestCanonicalVars(t *testing.T) {
+	reg := Registry{}
+	// Skip some variables, so that their indexes differ from their names.
+	reg.Var()
+	reg.Var()
+	a, b := reg.Var(), reg.Var()
+	ref := reg.Func(b, reg.Func(a, b))
+	Eq(t, reg.String(ref), "$3 -> $2 -> $3")
+	Eq(t, reg.CanonicalString(ref), "a -> b -> a")
+}
+
+func TestLimit(t *testing.T) {
+	reg := Registry{}
+	reg.Limit(2)
+	reg.List(IntRef)
+	reg.List(IntRef) // Existing types don't count again.
+	reg.Func(IntRef, IntRef)
+
+	var err error
+	func() {
+		defer RecoverLimit(&err)
+		reg.List(TextRef)
+	}()
+	if !errors.Is(err, ErrTooManyTypes) {
+		t.Errorf("expected ErrTooManyTypes, got %v", err)
+	}
+	Eq(t, reg.Size(), 2)
+
+	// Inference stops at the limit, rather than outgrowing it.
+	reg = Registry{}
+	reg.Limit(8)
+	se := must(parser.ParseExpr(`{ a = [ [ [ [ [ [ [ [ 1 ] ] ] ] ] ] ] ] }`))
+	_, err = Infer(&reg, DefaultScope(&reg), se, nil)
+	if !errors.Is(err, ErrTooManyTypes) {
+		t.Errorf("expected ErrTooManyTypes, got %v", err)
+	}
+	Eq(t, reg.Size(), 8)
+}
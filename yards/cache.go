@@ -1,31 +1,95 @@
+//go:build !scrap_tiny
+
 package yards
 
 import (
+	"io/fs"
 	"os"
 	"path/filepath"
 )
 
 type cachingFetcher struct {
 	path     string // The path to the cache directory.
-	main     Fetcher
+	nested   bool   // Whether sha256 scraps are in a subdirectory too.
 	fallback Fetcher
 }
 
+// dir returns the directory of the cached scraps of a hash algorithm.
+func (c *cachingFetcher) dir(algo string) string {
+	if algo == "sha256" && !c.nested {
+		return c.path
+	}
+	return filepath.Join(c.path, algo)
+}
+
 func (c *cachingFetcher) FetchSha256(key string) ([]byte, error) {
-	bs, err := c.main.FetchSha256(key)
-	if err == nil {
+	return c.FetchHash("sha256", key)
+}
+
+// FetchHash returns the cached scrap if it has the requested hash, or
+// fetches and caches it. Scraps of algorithms whose hashes can't be
+// checked aren't cached, since a corrupt copy would be trusted forever.
+func (c *cachingFetcher) FetchHash(algo, key string) ([]byte, error) {
+	bs, err := fs.ReadFile(os.DirFS(c.dir(algo)), key)
+	if err == nil && verify(algo, key, bs) == nil {
 		return bs, nil
 	}
 
-	bs, err = c.fallback.FetchSha256(key)
+	bs, err = FetchHash(c.fallback, algo, key)
 	if err != nil {
 		return nil, err
 	}
+	switch err := verify(algo, key, bs); err {
+	case ErrUnsupportedAlgo:
+		return bs, nil
+	case nil:
+		return bs, c.write(algo, key, bs)
+	default:
+		return nil, err
+	}
+}
+
+// StatSha256 stats the cached scrap, if any, without checking it.
+func (c *cachingFetcher) StatSha256(key string) (Info, error) {
+	if info, err := StatSha256(ByDirectory(os.DirFS(c.dir("sha256"))), key); err == nil {
+		return info, nil
+	}
+	return StatSha256(c.fallback, key)
+}
+
+// write caches a scrap atomically. Replacing a corrupt copy also repairs it.
+func (c *cachingFetcher) write(algo, key string, bs []byte) error {
+	dir := c.dir(algo)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return writeAtomic(dir, key, bs)
+}
 
+// writeAtomic writes a file by writing to a temporary file that is
+// renamed into place, so that a crash can't leave a partial scrap.
+func writeAtomic(dir, name string, bs []byte) error {
+	tmp, err := os.CreateTemp(dir, "."+name+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails once renamed.
+	if _, err := tmp.Write(bs); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
 	// TODO: Is this the correct mode perm?
-	return bs, os.WriteFile(filepath.Join(c.path, key), bs, 0644)
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
 }
 
+// NewCacheFetcher returns a Fetcher that caches the scraps of fetcher in a
+// directory, laid out like those read by ByDirectory.
 func NewCacheFetcher(pathname string, fetcher Fetcher) (Fetcher, error) {
 	// Create the cache directory if it doesn't exist.
 	if _, err := os.Stat(pathname); os.IsNotExist(err) {
@@ -36,16 +100,22 @@ func NewCacheFetcher(pathname string, fetcher Fetcher) (Fetcher, error) {
 	}
 	return &cachingFetcher{
 		path:     pathname,
-		main:     ByDirectory(os.DirFS(pathname)),
 		fallback: fetcher,
 	}, nil
 }
 
+// NewDefaultCacheFetcher returns a Fetcher that caches the scraps of
+// fetcher in the user's cache directory, in a directory per hash
+// algorithm, like scrapscript/sha256.
 func NewDefaultCacheFetcher(fetcher Fetcher) (Fetcher, error) {
 	dir, err := os.UserCacheDir()
 	if err != nil {
 		return nil, err
 	}
 
-	return NewCacheFetcher(filepath.Join(dir, "scrapscript/sha256"), fetcher)
+	return &cachingFetcher{
+		path:     filepath.Join(dir, "scrapscript"),
+		nested:   true,
+		fallback: fetcher,
+	}, nil
 }
@@ -1,39 +1,138 @@
+//go:build !scrap_tiny
+
 package yards
 
 import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"testing"
 	"testing/fstest"
 )
 
+func sha256Key(data string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data)))
+}
+
 func TestCache(t *testing.T) {
 	root := t.TempDir()
 	fsys := os.DirFS(root)
+	key := sha256Key("first")
 
 	// Cache directory should be empty.
-	_, err := fsys.Open("key1")
+	_, err := fsys.Open(key)
 	if err == nil {
-		t.Error("expected not to read key1")
+		t.Error("expected not to read key")
 	}
 
 	f, err := NewCacheFetcher(root, ByDirectory(fstest.MapFS{
-		"key1": {Data: []byte("first")},
+		key: {Data: []byte("first")},
 	}))
 	if err != nil {
 		t.Error("could not create cache directory")
 	}
 
-	bs, err := f.FetchSha256("key1")
+	bs, err := f.FetchSha256(key)
 	if err != nil {
 		t.Error("unexpected read failure")
 	}
 	equalBytes(t, bs, []byte("first"))
 
-	// Cache directory should contain fetched file.
-	bs, err = fs.ReadFile(fsys, "key1")
+	// Cache directory should contain only the fetched file.
+	bs, err = fs.ReadFile(fsys, key)
+	if err != nil {
+		t.Error("unexpected read failure")
+	}
+	equalBytes(t, bs, []byte("first"))
+
+	entries, _ := os.ReadDir(root)
+	if len(entries) != 1 {
+		t.Errorf("expected only the cached scrap, got %v", entries)
+	}
+}
+
+func TestCacheRepairsCorruptScraps(t *testing.T) {
+	root := t.TempDir()
+	key := sha256Key("first")
+
+	// As if a write was cut short.
+	err := os.WriteFile(filepath.Join(root, key), []byte("fir"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := NewCacheFetcher(root, ByDirectory(fstest.MapFS{
+		key: {Data: []byte("first")},
+	}))
+	bs, err := f.FetchSha256(key)
 	if err != nil {
 		t.Error("unexpected read failure")
 	}
 	equalBytes(t, bs, []byte("first"))
+
+	bs, _ = os.ReadFile(filepath.Join(root, key))
+	equalBytes(t, bs, []byte("first"))
+}
+
+func TestCacheRejectsWrongHash(t *testing.T) {
+	root := t.TempDir()
+	key := sha256Key("first")
+
+	f, _ := NewCacheFetcher(root, ByDirectory(fstest.MapFS{
+		key: {Data: []byte("forged")},
+	}))
+	if _, err := f.FetchSha256(key); err != ErrWrongHash {
+		t.Errorf("expected ErrWrongHash, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, key)); err == nil {
+		t.Error("expected the forged scrap not to be cached")
+	}
+}
+
+func TestCacheUncheckedAlgorithm(t *testing.T) {
+	root := t.TempDir()
+
+	f, _ := NewCacheFetcher(root, ByDirectory(fstest.MapFS{
+		"blake3/key": {Data: []byte("unchecked")},
+	}))
+	bs, err := FetchHash(f, "blake3", "key")
+	if err != nil {
+		t.Error("unexpected read failure")
+	}
+	equalBytes(t, bs, []byte("unchecked"))
+
+	// Scraps that can't be checked aren't cached.
+	if _, err := os.Stat(filepath.Join(root, "blake3", "key")); err == nil {
+		t.Error("expected the unchecked scrap not to be cached")
+	}
+}
+
+func TestCacheByAlgorithm(t *testing.T) {
+	root := t.TempDir()
+	data := "first"
+	key256 := sha256Key(data)
+	key512 := fmt.Sprintf("%x", sha512.Sum512([]byte(data)))
+
+	// Like NewDefaultCacheFetcher, in a directory per algorithm.
+	f := &cachingFetcher{path: root, nested: true, fallback: ByDirectory(fstest.MapFS{
+		key256:             {Data: []byte(data)},
+		"sha512/" + key512: {Data: []byte(data)},
+	})}
+	for algo, key := range map[string]string{"sha256": key256, "sha512": key512} {
+		bs, err := f.FetchHash(algo, key)
+		if err != nil {
+			t.Errorf("unexpected %s read failure %v", algo, err)
+		}
+		equalBytes(t, bs, []byte(data))
+
+		bs, err = os.ReadFile(filepath.Join(root, algo, key))
+		if err != nil {
+			t.Errorf("expected the %s scrap to be cached, got %v", algo, err)
+		}
+		equalBytes(t, bs, []byte(data))
+	}
 }
@@ -0,0 +1,170 @@
+//go:build !scrap_tiny
+
+package yards
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoPushYard is returned when pushing scraps to a FromConfig
+// FetchPusher that has no yard to push them to.
+var ErrNoPushYard = errors.New("no yard configured to push scraps to")
+
+// A Config declares the yards scraps are fetched from and pushed to,
+// as loaded by LoadConfig from a JSON file like:
+//
+//	{
+//	  "yards": [
+//	    {"kind": "directory", "path": "~/scraps", "push": true},
+//	    {"kind": "http", "url": "https://scraps.oseg.dev/", "timeout": "10s"}
+//	  ]
+//	}
+type Config struct {
+	// The yards to fetch scraps from, in order.
+	Yards []YardConfig `json:"yards"`
+}
+
+// A YardConfig declares a yard and its options.
+type YardConfig struct {
+	// The kind of yard: "directory" or "http".
+	Kind string `json:"kind"`
+	// The directory of a directory yard. A leading ~ is the home directory.
+	Path string `json:"path,omitempty"`
+	// The URL of an http yard, that the hashes of scraps are appended to.
+	URL string `json:"url,omitempty"`
+	// How long requests to an http yard may take, like "10s".
+	// By default there is no limit.
+	Timeout string `json:"timeout,omitempty"`
+	// Whether to push scraps to the yard.
+	// Only the first yard with Push set is pushed to.
+	Push bool `json:"push,omitempty"`
+}
+
+// DefaultConfigPath returns the path of the user's Config,
+// like ~/.config/scrapscript/config on Linux.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scrapscript", "config"), nil
+}
+
+// LoadConfig reads a Config from a JSON file.
+// Unknown fields are errors, to catch misspelled options.
+func LoadConfig(path string) (Config, error) {
+	var c Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// FromConfig returns a FetchPusher that fetches scraps from the yards
+// of a Config in order, and pushes them to the first yard with Push set.
+func FromConfig(c Config) (FetchPusher, error) {
+	if len(c.Yards) == 0 {
+		return nil, errors.New("no yards configured")
+	}
+	var yards configured
+	for i, yc := range c.Yards {
+		yard, err := yc.open()
+		if err != nil {
+			return nil, fmt.Errorf("yard %d: %w", i+1, err)
+		}
+		yards.sequenceFetcher = append(yards.sequenceFetcher, yard)
+		if yc.Push && yards.pusher == nil {
+			yards.pusher = yard
+		}
+	}
+	return yards, nil
+}
+
+func (yc YardConfig) open() (FetchPusher, error) {
+	switch yc.Kind {
+	case "directory":
+		if yc.Path == "" {
+			return nil, errors.New("directory yard without a path")
+		}
+		path := yc.Path
+		if rest, ok := strings.CutPrefix(path, "~"); ok {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(home, rest)
+		}
+		return directoryYard{&directoryFetcher{os.DirFS(path)}, path}, nil
+
+	case "http":
+		if yc.URL == "" {
+			return nil, errors.New("http yard without a url")
+		}
+		var timeout time.Duration
+		if yc.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(yc.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout: %w", err)
+			}
+		}
+		return byHttpWithTimeout(yc.URL, timeout), nil
+	}
+	return nil, fmt.Errorf("unknown kind of yard %q; must be directory or http", yc.Kind)
+}
+
+// configured is the FetchPusher of a Config.
+type configured struct {
+	sequenceFetcher
+	pusher Pusher // The first yard to push to, if any.
+}
+
+func (c configured) PushScrap(data []byte) (string, error) {
+	if c.pusher == nil {
+		return "", ErrNoPushYard
+	}
+	return c.pusher.PushScrap(data)
+}
+
+func (c configured) PushArtifact(kind, key string, data []byte) error {
+	if p, ok := c.pusher.(ArtifactPusher); ok {
+		return p.PushArtifact(kind, key, data)
+	}
+	return ErrNoPushYard
+}
+
+// A directoryYard is a directory that scraps can also be pushed to,
+// named by their sha256 hashes.
+type directoryYard struct {
+	*directoryFetcher
+	path string
+}
+
+func (d directoryYard) PushScrap(data []byte) (string, error) {
+	key := fmt.Sprintf("%x", sha256.Sum256(data))
+	if err := os.MkdirAll(d.path, 0700); err != nil {
+		return "", err
+	}
+	return key, writeAtomic(d.path, key, data)
+}
+
+func (d directoryYard) PushArtifact(kind, key string, data []byte) error {
+	dir := filepath.Join(d.path, kind)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return writeAtomic(dir, key, data)
+}
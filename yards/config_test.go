@@ -0,0 +1,90 @@
+//go:build !scrap_tiny
+
+package yards
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFromConfig(t *testing.T) {
+	root := t.TempDir()
+	local := filepath.Join(root, "local")
+	path := filepath.Join(root, "config")
+	err := os.WriteFile(path, []byte(`{
+		"yards": [
+			{"kind": "directory", "path": "`+local+`", "push": true},
+			{"kind": "http", "url": "http://localhost:0/", "timeout": "1s"}
+		]
+	}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Yards) != 2 || c.Yards[1].Timeout != "1s" {
+		t.Errorf("unexpected config %+v", c)
+	}
+	f, err := FromConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scraps are pushed to the directory, and found there first.
+	key, err := f.PushScrap([]byte("1 + 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, err := f.FetchSha256(key)
+	if err != nil {
+		t.Errorf("unexpected read failure %v", err)
+	}
+	equalBytes(t, bs, []byte("1 + 2"))
+	if info, err := StatSha256(f, key); err != nil || info.Size != 5 {
+		t.Errorf("unexpected info %v or error %v", info, err)
+	}
+
+	// As are artifacts.
+	if err := f.(ArtifactPusher).PushArtifact("type", key, []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	bs, err = f.(ArtifactFetcher).FetchArtifact("type", key)
+	if err != nil {
+		t.Errorf("unexpected read failure %v", err)
+	}
+	equalBytes(t, bs, []byte{1})
+}
+
+func TestFromConfigErrors(t *testing.T) {
+	f, _ := FromConfig(Config{Yards: []YardConfig{{Kind: "directory", Path: t.TempDir()}}})
+	if _, err := f.PushScrap([]byte("1")); err != ErrNoPushYard {
+		t.Errorf("expected ErrNoPushYard, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		config Config
+		err    string
+	}{
+		{Config{}, "no yards configured"},
+		{Config{Yards: []YardConfig{{Kind: "ftp"}}}, `yard 1: unknown kind of yard "ftp"`},
+		{Config{Yards: []YardConfig{{Kind: "http"}}}, "yard 1: http yard without a url"},
+		{Config{Yards: []YardConfig{{Kind: "http", URL: "x", Timeout: "soon"}}}, "yard 1: invalid timeout"},
+		{Config{Yards: []YardConfig{{Kind: "http", URL: "x"}, {Kind: "directory"}}}, "yard 2: directory yard without a path"},
+	} {
+		if _, err := FromConfig(tc.config); err == nil || !strings.HasPrefix(err.Error(), tc.err) {
+			t.Errorf("expected error %q, got %v", tc.err, err)
+		}
+	}
+
+	// Misspelled options are errors.
+	path := filepath.Join(t.TempDir(), "config")
+	os.WriteFile(path, []byte(`{"yards": [{"kind": "http", "uri": "x"}]}`), 0644)
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), `unknown field "uri"`) {
+		t.Errorf("expected an unknown field error, got %v", err)
+	}
+}
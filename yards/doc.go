@@ -0,0 +1,14 @@
+// Package yards implements storage for scraps, addressed by their hashes.
+//
+// All yards are implemented in pure Go without cgo, so programs using them
+// cross-compile with just GOOS and GOARCH. Embedders that don't need every
+// backend can exclude some with build tags:
+//
+//   - scrap_nohttp excludes net/http. ByHttp then returns a FetchPusher
+//     that fails with ErrNoHttp, and ByHttpWithClient is unavailable.
+//   - scrap_tiny selects the reduced-footprint profile for WASM and
+//     microcontroller-class targets. It implies scrap_nohttp, and also
+//     excludes the yards and stores backed by the os package, leaving only
+//     ByDirectory, ByMap and friends over caller-provided data. The
+//     evaluator then also requires fuel; see the eval package.
+package yards
@@ -1,10 +1,14 @@
+//go:build !scrap_nohttp && !scrap_tiny
+
 package yards
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
 type httpFetcher struct {
@@ -20,8 +24,31 @@ func ByHttpWithClient(hostname string, client *http.Client) FetchPusher {
 	return httpFetcher{client, hostname}
 }
 
+// byHttpWithTimeout returns an http yard whose requests may
+// take at most timeout, or any time if it's zero.
+func byHttpWithTimeout(hostname string, timeout time.Duration) FetchPusher {
+	if timeout == 0 {
+		return ByHttp(hostname)
+	}
+	return ByHttpWithClient(hostname, &http.Client{Timeout: timeout})
+}
+
 func (h httpFetcher) FetchSha256(key string) ([]byte, error) {
-	req, err := http.NewRequest("GET", string(h.hostname)+key, nil)
+	return h.get(key)
+}
+
+// FetchHash gets scraps by hashes of other algorithms than sha256
+// at the algorithm and key, like `sha512/<key>`.
+func (h httpFetcher) FetchHash(algo, key string) ([]byte, error) {
+	if algo == "sha256" {
+		return h.get(key)
+	}
+	return h.get(algo + "/" + key)
+}
+
+// get gets the scrap at path on the server.
+func (h httpFetcher) get(path string) ([]byte, error) {
+	req, err := http.NewRequest("GET", h.hostname+path, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +58,7 @@ func (h httpFetcher) FetchSha256(key string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		return nil, fmt.Errorf("http get failed with %s", resp.Status)
@@ -39,6 +67,68 @@ func (h httpFetcher) FetchSha256(key string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
+// StatSha256 sends a HEAD request, where the server may report the
+// type of the scrap in a Scrap-Type header. Servers that don't support
+// HEAD requests, or don't report the size, fail with errors.ErrUnsupported.
+func (h httpFetcher) StatSha256(key string) (Info, error) {
+	req, err := http.NewRequest("HEAD", string(h.hostname)+key, nil)
+	if err != nil {
+		return Info{}, err
+	}
+	req.Header.Add("Accept", "application/scrap")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return Info{}, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Info{}, ErrNotFound
+	case resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented:
+		return Info{}, errors.ErrUnsupported
+	case resp.StatusCode != 200:
+		return Info{}, fmt.Errorf("http head failed with %s", resp.Status)
+	case resp.ContentLength < 0:
+		return Info{}, errors.ErrUnsupported
+	}
+	return Info{Size: resp.ContentLength, Type: resp.Header.Get("Scrap-Type")}, nil
+}
+
+// FetchArtifact gets artifacts at their kind and key, like `type:<sha256>`.
+func (h httpFetcher) FetchArtifact(kind, key string) ([]byte, error) {
+	resp, err := h.client.Get(h.hostname + kind + ":" + key)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("http get failed with %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// PushArtifact puts artifacts at their kind and key, like `type:<sha256>`.
+func (h httpFetcher) PushArtifact(kind, key string, data []byte) error {
+	req, err := http.NewRequest("PUT", h.hostname+kind+":"+key, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("http put failed with %s", resp.Status)
+	}
+	return nil
+}
+
 func (h httpFetcher) PushScrap(data []byte) (key string, err error) {
 	req, err := http.NewRequest("POST", string(h.hostname), bytes.NewReader(data))
 	if err != nil {
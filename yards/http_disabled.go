@@ -0,0 +1,44 @@
+//go:build scrap_nohttp || scrap_tiny
+
+package yards
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrNoHttp is returned by all operations on HTTP yards in builds
+// with the scrap_nohttp or scrap_tiny tags.
+var ErrNoHttp = errors.New("http yards are excluded from this build")
+
+type httpDisabled struct{}
+
+// ByHttp returns a FetchPusher that always fails with ErrNoHttp,
+// since this build excludes net/http.
+func ByHttp(hostname string) FetchPusher {
+	return httpDisabled{}
+}
+
+func byHttpWithTimeout(hostname string, timeout time.Duration) FetchPusher {
+	return httpDisabled{}
+}
+
+func (httpDisabled) FetchSha256(key string) ([]byte, error) {
+	return nil, ErrNoHttp
+}
+
+func (httpDisabled) FetchHash(algo, key string) ([]byte, error) {
+	return nil, ErrNoHttp
+}
+
+func (httpDisabled) PushScrap(data []byte) (string, error) {
+	return "", ErrNoHttp
+}
+
+func (httpDisabled) FetchArtifact(kind, key string) ([]byte, error) {
+	return nil, ErrNoHttp
+}
+
+func (httpDisabled) PushArtifact(kind, key string, data []byte) error {
+	return ErrNoHttp
+}
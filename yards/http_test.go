@@ -1,3 +1,5 @@
+//go:build !scrap_nohttp && !scrap_tiny
+
 package yards
 
 import (
@@ -43,6 +45,20 @@ func TestByHttp(t *testing.T) {
 		t.Errorf("unexpectedly URL %s != %s", trans.req.URL, u)
 	}
 
+	// Other algorithms are fetched at the algorithm and key.
+	trans.resp = &http.Response{
+		StatusCode: 200,
+		Body:       io.NopCloser(bytes.NewReader([]byte{4, 5})),
+	}
+	bs, err = FetchHash(f, "sha512", "key")
+	if err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	equalBytes(t, bs, []byte{4, 5})
+	if got := trans.req.URL.String(); got != "https://scraps.oseg.dev/sha512/key" {
+		t.Errorf("unexpected URL %s", got)
+	}
+
 	// Error case.
 	trans.resp = &http.Response{
 		Status:     "Bad Req. 400",
@@ -57,3 +73,49 @@ func TestByHttp(t *testing.T) {
 		t.Error("unexpected read bytes")
 	}
 }
+
+func TestStatByHttp(t *testing.T) {
+	trans := transport{}
+	client := http.Client{Transport: &trans}
+	f := ByHttpWithClient("https://scraps.oseg.dev/", &client)
+
+	trans.resp = &http.Response{
+		StatusCode:    200,
+		ContentLength: 3,
+		Header:        http.Header{"Scrap-Type": {"int"}},
+		Body:          http.NoBody,
+	}
+	info, err := StatSha256(f, "key")
+	if err != nil || info != (Info{Size: 3, Type: "int"}) {
+		t.Errorf("unexpected info %v or error %v", info, err)
+	}
+	if trans.req.Method != "HEAD" {
+		t.Errorf("expected a HEAD request, got %s", trans.req.Method)
+	}
+
+	trans.resp = &http.Response{StatusCode: 404, Body: http.NoBody}
+	if _, err := StatSha256(f, "key"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Servers not supporting HEAD requests get a GET request instead.
+	client.Transport = roundTripper(func(req *http.Request) (*http.Response, error) {
+		if req.Method == "HEAD" {
+			return &http.Response{StatusCode: 405, Body: http.NoBody}, nil
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(bytes.NewReader([]byte{1, 2, 3, 4})),
+		}, nil
+	})
+	info, err = StatSha256(f, "key")
+	if err != nil || info.Size != 4 {
+		t.Errorf("expected to fall back to GET, got %v or error %v", info, err)
+	}
+}
+
+type roundTripper func(req *http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -0,0 +1,127 @@
+package yards
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRUStats are counters of an LRUFetcher, for monitoring.
+type LRUStats struct {
+	// The number of scraps cached, and the sum of their sizes.
+	Entries, Bytes int
+	// How many fetches were served from the cache, and how many weren't.
+	Hits, Misses uint64
+	// How many scraps were evicted to make room for others.
+	Evictions uint64
+}
+
+// An LRUFetcher caches the scraps fetched by another Fetcher in memory,
+// evicting the least recently used when the cache grows too large.
+// It may be used by multiple goroutines at once.
+type LRUFetcher struct {
+	fetcher    Fetcher
+	maxEntries int
+	maxBytes   int
+
+	mu      sync.Mutex
+	order   list.List // Of *lruEntry, most recently used first.
+	entries map[string]*list.Element
+	stats   LRUStats
+}
+
+type lruEntry struct {
+	key  string
+	data []byte
+}
+
+// WithLRU returns an LRUFetcher in front of fetcher, which keeps at most
+// maxEntries scraps of at most maxBytes in total. A limit of zero or less
+// means there is none. Scraps larger than maxBytes aren't cached at all.
+func WithLRU(fetcher Fetcher, maxEntries, maxBytes int) *LRUFetcher {
+	return &LRUFetcher{
+		fetcher:    fetcher,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (l *LRUFetcher) FetchSha256(key string) ([]byte, error) {
+	return l.fetch("sha256", key)
+}
+
+func (l *LRUFetcher) FetchHash(algo, key string) ([]byte, error) {
+	return l.fetch(algo, key)
+}
+
+// StatSha256 reports the size of a cached scrap,
+// or asks the underlying Fetcher.
+func (l *LRUFetcher) StatSha256(key string) (Info, error) {
+	l.mu.Lock()
+	el, ok := l.entries["sha256~~"+key]
+	l.mu.Unlock()
+	if ok {
+		return Info{Size: int64(len(el.Value.(*lruEntry).data))}, nil
+	}
+	return StatSha256(l.fetcher, key)
+}
+
+// Stats returns the current LRUStats.
+func (l *LRUFetcher) Stats() LRUStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
+
+func (l *LRUFetcher) fetch(algo, key string) ([]byte, error) {
+	id := algo + "~~" + key
+	if data, ok := l.get(id); ok {
+		return data, nil
+	}
+
+	// Fetch without holding the lock,
+	// so that slow fetches don't block others.
+	data, err := FetchHash(l.fetcher, algo, key)
+	if err != nil {
+		return nil, err
+	}
+	l.add(id, data)
+	return data, nil
+}
+
+func (l *LRUFetcher) get(id string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.entries[id]; ok {
+		l.stats.Hits++
+		l.order.MoveToFront(el)
+		return el.Value.(*lruEntry).data, true
+	}
+	l.stats.Misses++
+	return nil, false
+}
+
+func (l *LRUFetcher) add(id string, data []byte) {
+	if l.maxBytes > 0 && len(data) > l.maxBytes {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Another goroutine may have fetched it meanwhile.
+	if _, ok := l.entries[id]; ok {
+		return
+	}
+	l.entries[id] = l.order.PushFront(&lruEntry{id, data})
+	l.stats.Entries++
+	l.stats.Bytes += len(data)
+
+	for l.maxEntries > 0 && l.stats.Entries > l.maxEntries ||
+		l.maxBytes > 0 && l.stats.Bytes > l.maxBytes {
+		oldest := l.order.Remove(l.order.Back()).(*lruEntry)
+		delete(l.entries, oldest.key)
+		l.stats.Entries--
+		l.stats.Bytes -= len(oldest.data)
+		l.stats.Evictions++
+	}
+}
@@ -0,0 +1,90 @@
+package yards
+
+import (
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithLRU(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a":        {Data: []byte("aa")},
+		"b":        {Data: []byte("bb")},
+		"c":        {Data: []byte("cccc")},
+		"big":      {Data: []byte("0123456789")},
+		"sha512/a": {Data: []byte("AA")},
+	}
+	f := WithLRU(ByDirectory(fsys), 2, 6)
+
+	fetch := func(key string, want string) {
+		t.Helper()
+		bs, err := f.FetchSha256(key)
+		if err != nil {
+			t.Fatalf("unexpected read failure %v", err)
+		}
+		equalBytes(t, bs, []byte(want))
+	}
+	expect := func(want LRUStats) {
+		t.Helper()
+		if got := f.Stats(); got != want {
+			t.Errorf("expected %+v, got %+v", want, got)
+		}
+	}
+
+	fetch("a", "aa")
+	fetch("a", "aa")
+	fetch("b", "bb")
+	expect(LRUStats{Entries: 2, Bytes: 4, Hits: 1, Misses: 2})
+
+	// a was used more recently than b, so b is evicted to keep two entries.
+	fetch("a", "aa")
+	delete(fsys, "b")
+	fsys["b2"] = &fstest.MapFile{Data: []byte("b")}
+	fetch("b2", "b")
+	expect(LRUStats{Entries: 2, Bytes: 3, Hits: 2, Misses: 3, Evictions: 1})
+	if _, err := f.FetchSha256("b"); err == nil {
+		t.Error("expected b to be evicted")
+	}
+
+	// c needs the room of a to fit within 6 bytes.
+	fetch("c", "cccc")
+	expect(LRUStats{Entries: 2, Bytes: 5, Hits: 2, Misses: 5, Evictions: 2})
+
+	// Scraps larger than the limit aren't cached.
+	fetch("big", "0123456789")
+	expect(LRUStats{Entries: 2, Bytes: 5, Hits: 2, Misses: 6, Evictions: 2})
+
+	// Other algorithms are cached separately, here in the room of b2.
+	bs, err := FetchHash(f, "sha512", "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	equalBytes(t, bs, []byte("AA"))
+	expect(LRUStats{Entries: 2, Bytes: 6, Hits: 2, Misses: 7, Evictions: 3})
+}
+
+func TestWithLRUConcurrently(t *testing.T) {
+	f := WithLRU(ByDirectory(fstest.MapFS{
+		"a": {Data: []byte("a")},
+		"b": {Data: []byte("b")},
+	}), 1, 0)
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				key := string(rune('a' + i%2))
+				if bs, err := f.FetchSha256(key); err != nil || string(bs) != key {
+					t.Errorf("expected %s, got %s, %v", key, bs, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if stats := f.Stats(); stats.Hits+stats.Misses != 800 || stats.Entries != 1 {
+		t.Errorf("unexpected %+v", stats)
+	}
+}
@@ -0,0 +1,150 @@
+//go:build !scrap_tiny
+
+package yards
+
+import (
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A CacheEntry is a scrap, or value, in a cache.
+type CacheEntry struct {
+	// The key of the entry, like its sha256 hash. Entries of other hash
+	// algorithms are keyed by the algorithm, a slash and their hash.
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// A CacheManager lists and removes the entries of a cache,
+// for users to inspect it and keep it from growing forever.
+type CacheManager interface {
+	// List returns the entries of the cache, oldest first.
+	List() ([]CacheEntry, error)
+	Remove(key string) error
+}
+
+// A CacheDir manages the cache in a directory, like that of a
+// caching Fetcher or a DirectoryStore.
+type CacheDir string
+
+// DefaultCacheDir returns the HashCacheDir of NewDefaultCacheFetcher.
+func DefaultCacheDir() (HashCacheDir, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return HashCacheDir(filepath.Join(dir, "scrapscript")), nil
+}
+
+// A HashCacheDir manages a cache of scraps in a directory per hash
+// algorithm, like that of NewDefaultCacheFetcher. Other directories
+// beside them are left alone.
+type HashCacheDir string
+
+func (d HashCacheDir) List() ([]CacheEntry, error) {
+	var entries []CacheEntry
+	for _, algo := range slices.Sorted(maps.Keys(sums)) {
+		algoEntries, err := CacheDir(filepath.Join(string(d), algo)).List()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range algoEntries {
+			if algo != "sha256" {
+				e.Key = algo + "/" + e.Key
+			}
+			entries = append(entries, e)
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b CacheEntry) int {
+		return a.Modified.Compare(b.Modified)
+	})
+	return entries, nil
+}
+
+func (d HashCacheDir) Remove(key string) error {
+	algo, hash, ok := strings.Cut(key, "/")
+	if !ok {
+		algo, hash = "sha256", key
+	}
+	return os.Remove(filepath.Join(string(d), algo, hash))
+}
+
+func (d CacheDir) List() ([]CacheEntry, error) {
+	var entries []CacheEntry
+	err := filepath.WalkDir(string(d), func(path string, de fs.DirEntry, err error) error {
+		if os.IsNotExist(err) && path == string(d) {
+			// An empty cache needn't exist yet.
+			return fs.SkipAll
+		}
+		if err != nil || de.IsDir() {
+			return err
+		}
+		info, err := de.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(string(d), path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, CacheEntry{filepath.ToSlash(key), info.Size(), info.ModTime()})
+		return nil
+	})
+	slices.SortStableFunc(entries, func(a, b CacheEntry) int {
+		return a.Modified.Compare(b.Modified)
+	})
+	return entries, err
+}
+
+func (d CacheDir) Remove(key string) error {
+	return os.Remove(filepath.Join(string(d), filepath.FromSlash(key)))
+}
+
+// CollectGarbage removes the entries of a cache modified before
+// expiry, and then the oldest, until the rest fit within maxBytes.
+// A zero expiry or maxBytes isn't a limit. The removed entries are
+// returned, along with any error removing them.
+func CollectGarbage(m CacheManager, expiry time.Time, maxBytes int64) ([]CacheEntry, error) {
+	entries, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+
+	var removed []CacheEntry
+	for _, e := range entries {
+		expired := !expiry.IsZero() && e.Modified.Before(expiry)
+		if !expired && (maxBytes <= 0 || total <= maxBytes) {
+			break
+		}
+		if err := m.Remove(e.Key); err != nil {
+			return removed, err
+		}
+		total -= e.Size
+		removed = append(removed, e)
+	}
+	return removed, nil
+}
+
+// Clear removes all entries of a cache, returning those removed.
+func Clear(m CacheManager) ([]CacheEntry, error) {
+	entries, err := m.List()
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if err := m.Remove(e.Key); err != nil {
+			return entries[:i], err
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,114 @@
+//go:build !scrap_tiny
+
+package yards
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func keys(entries []CacheEntry) (keys []string) {
+	for _, e := range entries {
+		keys = append(keys, e.Key)
+	}
+	return
+}
+
+func TestCacheDir(t *testing.T) {
+	root := t.TempDir()
+	d := CacheDir(filepath.Join(root, "missing"))
+	if entries, err := d.List(); err != nil || len(entries) != 0 {
+		t.Errorf("expected a missing cache to be empty, got %v, %v", entries, err)
+	}
+
+	d = CacheDir(root)
+	now := time.Now()
+	for i, key := range []string{"old", "sha512/mid", "new"} {
+		path := filepath.Join(root, filepath.FromSlash(key))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, 10*(i+1)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := now.Add(time.Duration(i-3) * 24 * time.Hour)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := d.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := keys(entries); !slices.Equal(got, []string{"old", "sha512/mid", "new"}) {
+		t.Errorf("expected entries oldest first, got %q", got)
+	}
+	if entries[1].Size != 20 {
+		t.Errorf("expected sha512/mid to be 20 bytes, got %d", entries[1].Size)
+	}
+
+	// Nothing is old or large enough.
+	removed, err := CollectGarbage(d, now.Add(-4*24*time.Hour), 100)
+	if err != nil || len(removed) != 0 {
+		t.Errorf("expected nothing to be removed, got %q, %v", keys(removed), err)
+	}
+	// Entries older than 2.5 days.
+	removed, err = CollectGarbage(d, now.Add(-60*time.Hour), 0)
+	if got := keys(removed); err != nil || !slices.Equal(got, []string{"old"}) {
+		t.Errorf("expected old to be removed, got %q, %v", got, err)
+	}
+	// The oldest entries beyond 30 bytes.
+	removed, err = CollectGarbage(d, time.Time{}, 30)
+	if got := keys(removed); err != nil || !slices.Equal(got, []string{"sha512/mid"}) {
+		t.Errorf("expected sha512/mid to be removed, got %q, %v", got, err)
+	}
+
+	removed, err = Clear(d)
+	if got := keys(removed); err != nil || !slices.Equal(got, []string{"new"}) {
+		t.Errorf("expected new to be removed, got %q, %v", got, err)
+	}
+	if entries, err := d.List(); err != nil || len(entries) != 0 {
+		t.Errorf("expected a cleared cache to be empty, got %v, %v", entries, err)
+	}
+}
+
+func TestHashCacheDir(t *testing.T) {
+	root := t.TempDir()
+	d := HashCacheDir(root)
+	if entries, err := d.List(); err != nil || len(entries) != 0 {
+		t.Errorf("expected a missing cache to be empty, got %v, %v", entries, err)
+	}
+
+	now := time.Now()
+	for i, path := range []string{"sha256/a", "sha512/b", "values/c"} {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := now.Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Other directories, like those of values, aren't scraps.
+	entries, err := d.List()
+	if got := keys(entries); err != nil || !slices.Equal(got, []string{"a", "sha512/b"}) {
+		t.Errorf("expected the scraps by algorithm, got %q, %v", got, err)
+	}
+
+	removed, err := Clear(d)
+	if got := keys(removed); err != nil || !slices.Equal(got, []string{"a", "sha512/b"}) {
+		t.Errorf("expected the scraps to be removed, got %q, %v", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "values", "c")); err != nil {
+		t.Errorf("expected values to be kept, got %v", err)
+	}
+}
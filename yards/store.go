@@ -0,0 +1,32 @@
+//go:build !scrap_tiny
+
+package yards
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// A DirectoryStore saves and loads data as files in a directory.
+type DirectoryStore string
+
+// NewDefaultStore returns a DirectoryStore in the user's cache directory.
+func NewDefaultStore() (DirectoryStore, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return DirectoryStore(filepath.Join(dir, "scrapscript/values")), nil
+}
+
+func (d DirectoryStore) Load(key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), key))
+}
+
+func (d DirectoryStore) Save(key string, data []byte) error {
+	err := os.MkdirAll(string(d), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(string(d), key), data, 0644)
+}
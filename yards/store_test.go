@@ -0,0 +1,25 @@
+//go:build !scrap_tiny
+
+package yards
+
+import "testing"
+
+func TestDirectoryStore(t *testing.T) {
+	store := DirectoryStore(t.TempDir() + "/nested")
+
+	_, err := store.Load("key")
+	if err == nil {
+		t.Error("expected load failure")
+	}
+
+	err = store.Save("key", []byte("value"))
+	if err != nil {
+		t.Errorf("unexpected save failure %v", err)
+	}
+
+	bs, err := store.Load("key")
+	if err != nil {
+		t.Error("unexpected load failure")
+	}
+	equalBytes(t, bs, []byte("value"))
+}
@@ -2,30 +2,61 @@ package yards
 
 import (
 	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
 	"fmt"
 )
 
 var ErrWrongHash = errors.New("fetched bytes had wrong hash")
 
+// The hash algorithms whose hashes yards can check.
+var sums = map[string]func(data []byte) []byte{
+	"sha256": func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] },
+	"sha512": func(data []byte) []byte { sum := sha512.Sum512(data); return sum[:] },
+}
+
+// verify checks that data has the hex-encoded hash key of algorithm algo,
+// returning ErrWrongHash if it doesn't, or ErrUnsupportedAlgo if the
+// algorithm is unknown.
+func verify(algo, key string, data []byte) error {
+	sum, ok := sums[algo]
+	if !ok {
+		return ErrUnsupportedAlgo
+	}
+	if fmt.Sprintf("%x", sum(data)) != key {
+		return ErrWrongHash
+	}
+	return nil
+}
+
 type valid struct{ Fetcher }
 
 func (v valid) FetchSha256(key string) ([]byte, error) {
-	bytes, err := v.Fetcher.FetchSha256(key)
+	return v.FetchHash("sha256", key)
+}
+
+func (v valid) FetchHash(algo, key string) ([]byte, error) {
+	bytes, err := FetchHash(v.Fetcher, algo, key)
 	if err != nil {
 		return nil, err
 	}
 
-	hash := sha256.Sum256(bytes)
-	if fmt.Sprintf("%x", hash) != key {
-		return nil, ErrWrongHash
+	if err := verify(algo, key, bytes); err == ErrWrongHash {
+		return nil, err
 	}
 
 	return bytes, nil
 }
 
+// StatSha256 can't check hashes without fetching the scraps,
+// so Info is passed through unchecked.
+func (v valid) StatSha256(key string) (Info, error) {
+	return StatSha256(v.Fetcher, key)
+}
+
 // Validate wraps a Fetcher and checks that any returned bytes actually have
-// the sha256 hash that was requested.
+// the sha256, or sha512, hash that was requested. Scraps fetched by other
+// algorithms are passed through unchecked, for the caller to check.
 func Validate(fetcher Fetcher) Fetcher {
 	return valid{fetcher}
 }
@@ -3,15 +3,87 @@ package yards
 import (
 	"errors"
 	"io/fs"
+	"path"
 )
 
 var ErrNotFound = errors.New("no scrap found")
 
+// ErrUnsupportedAlgo is returned by FetchHash for fetchers
+// that can't fetch scraps by the requested hash algorithm.
+var ErrUnsupportedAlgo = errors.New("hash algorithm not supported by fetcher")
+
 // Fetcher is the interface for retrieving scraps by their SHA hashes.
 type Fetcher interface {
 	FetchSha256(key string) ([]byte, error)
 }
 
+// An AlgoFetcher can also retrieve scraps by hashes of other algorithms
+// than sha256, like sha512. Keys are hex-encoded, like those of FetchSha256.
+type AlgoFetcher interface {
+	Fetcher
+	FetchHash(algo, key string) ([]byte, error)
+}
+
+// FetchHash retrieves a scrap by its hash of the given algorithm, using
+// FetchSha256 for sha256, and otherwise FetchHash if fetcher is an
+// AlgoFetcher. Other fetchers fail with ErrUnsupportedAlgo.
+func FetchHash(fetcher Fetcher, algo, key string) ([]byte, error) {
+	if algo == "sha256" {
+		return fetcher.FetchSha256(key)
+	}
+	if f, ok := fetcher.(AlgoFetcher); ok {
+		return f.FetchHash(algo, key)
+	}
+	return nil, ErrUnsupportedAlgo
+}
+
+// Info is metadata about a scrap, known without fetching it.
+type Info struct {
+	// The size of the scrap in bytes.
+	Size int64
+	// The type of the scrap, if the yard reports it; otherwise empty.
+	Type string
+}
+
+// A StatFetcher can also report Info about scraps, and whether they
+// exist, without fetching them. StatSha256 fails with ErrNotFound for
+// scraps that don't exist, and with errors.ErrUnsupported if it can't
+// tell, like when a server doesn't support it.
+type StatFetcher interface {
+	Fetcher
+	StatSha256(key string) (Info, error)
+}
+
+// StatSha256 returns Info about the scrap with a sha256 hash, using
+// StatSha256 if fetcher is a StatFetcher that supports it, and
+// otherwise falling back to fetching the whole scrap.
+func StatSha256(fetcher Fetcher, key string) (Info, error) {
+	if f, ok := fetcher.(StatFetcher); ok {
+		info, err := f.StatSha256(key)
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return info, err
+		}
+	}
+	bs, err := fetcher.FetchSha256(key)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: int64(len(bs))}, nil
+}
+
+// An ArtifactFetcher can fetch artifacts derived from scraps, like their
+// inferred types, by their kind and the hex-encoded sha256 hash of the
+// scrap they're derived from; as `type:<sha256>`. Artifacts can't be
+// checked like scraps, so they must only be fetched from trusted yards.
+type ArtifactFetcher interface {
+	FetchArtifact(kind, key string) ([]byte, error)
+}
+
+// An ArtifactPusher can store artifacts derived from scraps.
+type ArtifactPusher interface {
+	PushArtifact(kind, key string, data []byte) error
+}
+
 // Pusher is the interface for storing scraps, returning their SHA hashes.
 type Pusher interface {
 	PushScrap(data []byte) (key string, err error)
@@ -24,6 +96,8 @@ type FetchPusher interface {
 }
 
 // ByDirectory returns a Fetcher that looks in the given directory.
+// Scraps are named by their sha256 hashes, or for other algorithms,
+// by their hashes in a subdirectory named after the algorithm.
 func ByDirectory(fs fs.FS) Fetcher {
 	return &directoryFetcher{fs}
 }
@@ -35,6 +109,26 @@ func (d *directoryFetcher) FetchSha256(key string) ([]byte, error) {
 	return fs.ReadFile(d, key)
 }
 
+func (d *directoryFetcher) FetchHash(algo, key string) ([]byte, error) {
+	return fs.ReadFile(d, path.Join(algo, key))
+}
+
+// FetchArtifact reads artifacts from a subdirectory named after their kind.
+func (d *directoryFetcher) FetchArtifact(kind, key string) ([]byte, error) {
+	return fs.ReadFile(d, path.Join(kind, key))
+}
+
+func (d *directoryFetcher) StatSha256(key string) (Info, error) {
+	fi, err := fs.Stat(d, key)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Info{}, ErrNotFound
+	}
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Size: fi.Size()}, nil
+}
+
 type sequenceFetcher []Fetcher
 
 // InOrder returns a Fetcher that looks for scraps using each fetcher in order.
@@ -50,3 +144,32 @@ func (s sequenceFetcher) FetchSha256(key string) ([]byte, error) {
 	}
 	return nil, ErrNotFound
 }
+
+func (s sequenceFetcher) FetchHash(algo, key string) ([]byte, error) {
+	for _, f := range s {
+		if bs, err := FetchHash(f, algo, key); err == nil {
+			return bs, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s sequenceFetcher) StatSha256(key string) (Info, error) {
+	for _, f := range s {
+		if info, err := StatSha256(f, key); err == nil {
+			return info, nil
+		}
+	}
+	return Info{}, ErrNotFound
+}
+
+func (s sequenceFetcher) FetchArtifact(kind, key string) ([]byte, error) {
+	for _, f := range s {
+		if f, ok := f.(ArtifactFetcher); ok {
+			if bs, err := f.FetchArtifact(kind, key); err == nil {
+				return bs, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
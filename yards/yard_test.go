@@ -57,3 +57,74 @@ func equalBytes(t *testing.T, actual, expected []byte) {
 		t.Errorf("read bytes were wrong %v != %v", actual, expected)
 	}
 }
+
+func TestFetchHash(t *testing.T) {
+	dir := ByDirectory(fstest.MapFS{
+		"key":        {Data: []byte("sha256")},
+		"sha512/key": {Data: []byte("sha512")},
+	})
+
+	bs, err := FetchHash(dir, "sha256", "key")
+	if err != nil {
+		t.Error("unexpected read failure")
+	}
+	equalBytes(t, bs, []byte("sha256"))
+
+	bs, err = FetchHash(InOrder(dir), "sha512", "key")
+	if err != nil {
+		t.Error("unexpected read failure")
+	}
+	equalBytes(t, bs, []byte("sha512"))
+
+	// Fetchers of only sha256 can't fetch other algorithms.
+	_, err = FetchHash(sha256Only{dir}, "sha512", "key")
+	if err != ErrUnsupportedAlgo {
+		t.Errorf("expected %s failure, got %v", ErrUnsupportedAlgo, err)
+	}
+}
+
+type sha256Only struct{ f Fetcher }
+
+func (s sha256Only) FetchSha256(key string) ([]byte, error) {
+	return s.f.FetchSha256(key)
+}
+
+// A fetcherFunc is a Fetcher that isn't a StatFetcher.
+type fetcherFunc func(key string) ([]byte, error)
+
+func (f fetcherFunc) FetchSha256(key string) ([]byte, error) {
+	return f(key)
+}
+
+func TestStatSha256(t *testing.T) {
+	dir := ByDirectory(fstest.MapFS{
+		"key": {Data: []byte("value")},
+	})
+	info, err := StatSha256(dir, "key")
+	if err != nil || info.Size != 5 {
+		t.Errorf("unexpected info %v or error %v", info, err)
+	}
+	if _, err := StatSha256(dir, "missing"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// Fetchers that can't stat scraps fetch them instead.
+	fetched := false
+	plain := fetcherFunc(func(key string) ([]byte, error) {
+		fetched = true
+		if key != "other" {
+			return nil, ErrNotFound
+		}
+		return []byte("another"), nil
+	})
+	info, err = StatSha256(InOrder(dir, plain), "other")
+	if err != nil || info.Size != 7 || !fetched {
+		t.Errorf("unexpected info %v or error %v", info, err)
+	}
+
+	fetched = false
+	info, err = StatSha256(InOrder(dir, plain), "key")
+	if err != nil || info.Size != 5 || fetched {
+		t.Errorf("expected to stat the first fetcher, got %v or error %v", info, err)
+	}
+}